@@ -0,0 +1,92 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"markdown-notes/internal/store"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// GetNoteAttachments returns the files attached to a note.
+func (c *Client) GetNoteAttachments(ctx context.Context, note_id int64) ([]store.Attachment, error) {
+	var res struct {
+		Attachments []store.Attachment `json:"attachments"`
+	}
+	err := c.do(ctx, http.MethodGet, "/notes/"+pathID(note_id)+"/attachments", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Attachments, nil
+}
+
+// UploadAttachment attaches the file read from content to a note.
+func (c *Client) UploadAttachment(ctx context.Context, note_id int64, filename string, content io.Reader) (*store.Attachment, error) {
+	body, err := multipartBody(nil, filename, content)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachment store.Attachment
+	err = c.do(ctx, http.MethodPost, "/notes/"+pathID(note_id)+"/attachments", nil, body, &attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// GetAttachment returns the content of an attachment, or of one of its
+// thumbnails unless size is empty, which the caller has to close.
+func (c *Client) GetAttachment(ctx context.Context, attachment_id int64, size string) (io.ReadCloser, error) {
+	var params url.Values
+	if size != "" {
+		params = url.Values{"size": {size}}
+	}
+
+	res, err := c.send(ctx, http.MethodGet, "/attachments/"+pathID(attachment_id), params, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// StripLocation removes the GPS position from an image attachment.
+func (c *Client) StripLocation(ctx context.Context, attachment_id int64) (*store.Attachment, error) {
+	var attachment store.Attachment
+	err := c.do(ctx, http.MethodPost, "/attachments/"+pathID(attachment_id)+"/strip-location", nil, nil, &attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// multipartBody makes a form with the fields and the content as its "file".
+func multipartBody(fields map[string]string, filename string, content io.Reader) (*rawBody, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	for name, value := range fields {
+		if err := w.WriteField(name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &rawBody{contentType: w.FormDataContentType(), content: &buf}, nil
+}
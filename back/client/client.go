@@ -0,0 +1,379 @@
+// Package client talks to the notes API over HTTP, with a typed method for
+// every endpoint. Requests take a context, failures come back as *Error with
+// what the API said, and idempotent requests are retried when the server or
+// the network is briefly unavailable.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRetries is how many times idempotent requests are retried.
+const DefaultRetries = 2
+
+// Error is an error response from the API. Message is the error the API
+// gave, Envelope the whole JSON body it came in, which for some errors
+// carries more, like the current note when a save was stale.
+type Error struct {
+	StatusCode int
+	Message    string
+	Envelope   utils.Envelope
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsStatus reports whether err is an API error with the status code.
+func IsStatus(err error, code int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// Auth is how the token is sent.
+type Auth int
+
+const (
+	// AuthCookie sends the token in the auth_token cookie, like the web app.
+	AuthCookie Auth = iota
+	// AuthBearer sends it in an Authorization: Bearer header.
+	AuthBearer
+)
+
+// Client makes requests as the user its token belongs to, in the personal
+// workspace unless another one is picked with SetWorkspace. It is safe to
+// use from several goroutines once set up.
+type Client struct {
+	baseURL     string
+	httpClient  *http.Client
+	token       string
+	auth        Auth
+	workspaceID int64
+	retries     int
+	retryWait   time.Duration
+
+	mu sync.Mutex
+	// shareCookies prove passwords entered for shares, by share token
+	shareCookies map[string]*http.Cookie
+}
+
+// New returns a client for the API at baseURL, like "http://localhost:8080".
+func New(baseURL string) *Client {
+	return &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		retries:      DefaultRetries,
+		retryWait:    200 * time.Millisecond,
+		shareCookies: map[string]*http.Cookie{},
+	}
+}
+
+// SetHTTPClient sets the client requests are made with.
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	c.httpClient = httpClient
+}
+
+// SetToken sets the auth token sent with every request.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// Token returns the auth token, which Login sets.
+func (c *Client) Token() string {
+	return c.token
+}
+
+// SetAuth sets how the token is sent, in a cookie by default.
+func (c *Client) SetAuth(auth Auth) {
+	c.auth = auth
+}
+
+// SetWorkspace makes requests work in the workspace, 0 goes back to the
+// personal one.
+func (c *Client) SetWorkspace(workspace_id int64) {
+	c.workspaceID = workspace_id
+}
+
+// SetRetries sets how many times idempotent requests are retried, and how
+// long to wait before the first retry. The wait doubles after that, unless
+// the server says how long to wait in a Retry-After header.
+func (c *Client) SetRetries(retries int, wait time.Duration) {
+	c.retries = retries
+	c.retryWait = wait
+}
+
+// Health checks that the API is up.
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/health", nil, nil, nil)
+}
+
+// Register creates a user and returns it with the id of the root folder of
+// their personal workspace.
+func (c *Client) Register(ctx context.Context, username string, email string, password string) (*store.User, int64, error) {
+	body := map[string]string{"username": username, "email": email, "password": password}
+
+	var res struct {
+		User store.User `json:"user"`
+		Root int64      `json:"root"`
+	}
+	err := c.do(ctx, http.MethodPost, "/user/register", nil, body, &res)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &res.User, res.Root, nil
+}
+
+// Login signs in and keeps the token the API hands out, which is valid for a
+// day.
+func (c *Client) Login(ctx context.Context, username string, password string) error {
+	body := map[string]string{"username": username, "password": password}
+
+	res, err := c.send(ctx, http.MethodPost, "/tokens/auth", nil, nil, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "auth_token" {
+			c.token = cookie.Value
+			return nil
+		}
+	}
+
+	return errors.New("login response has no auth token")
+}
+
+// Me returns the username of the user the token belongs to.
+func (c *Client) Me(ctx context.Context) (string, error) {
+	var res struct {
+		Username string `json:"username"`
+	}
+	err := c.do(ctx, http.MethodGet, "/me", nil, nil, &res)
+	if err != nil {
+		return "", err
+	}
+
+	return res.Username, nil
+}
+
+// rawBody is a request body that isn't JSON, like a file upload.
+type rawBody struct {
+	contentType string
+	content     io.Reader
+}
+
+// do sends a request with body encoded as JSON and decodes the response
+// into out, unless it is nil.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body any, out any) error {
+	return c.doWithHeader(ctx, method, path, query, nil, body, out)
+}
+
+// doWithHeader is do for requests that need extra headers.
+func (c *Client) doWithHeader(ctx context.Context, method string, path string, query url.Values, header http.Header, body any, out any) error {
+	res, err := c.send(ctx, method, path, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// getText returns the body of a response that isn't JSON, like a rendered
+// page.
+func (c *Client) getText(ctx context.Context, path string, query url.Values, header http.Header) (string, error) {
+	res, err := c.send(ctx, http.MethodGet, path, query, header, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// send sends a request and returns the response if it was successful, an
+// *Error otherwise. Requests without side effects, and ones that have the
+// same effect however often they are made, are retried on network errors
+// and when a gateway or the server is temporarily unavailable.
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, header http.Header, body any) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var (
+		data        []byte
+		raw         io.Reader
+		contentType string
+	)
+	switch body := body.(type) {
+	case nil:
+	case *rawBody:
+		raw, contentType = body.content, body.contentType
+	default:
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		contentType = "application/json"
+	}
+
+	attempts := 1
+	if raw == nil && idempotent(method) {
+		attempts += max(c.retries, 0)
+	}
+
+	for attempt := 1; ; attempt++ {
+		reader := raw
+		if data != nil {
+			reader = bytes.NewReader(data)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, u, reader)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		c.authorize(req.Header)
+
+		res, err := c.httpClient.Do(req)
+		if attempt >= attempts || ctx.Err() != nil || (err == nil && !retryable(res.StatusCode)) {
+			if err != nil {
+				return nil, err
+			}
+			if res.StatusCode >= 400 {
+				defer res.Body.Close()
+				return nil, decodeError(res)
+			}
+			return res, nil
+		}
+
+		wait := c.retryWait << (attempt - 1)
+		if res != nil {
+			if after := retryAfter(res); after > 0 {
+				wait = after
+			}
+			io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+			res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// authorize adds the token and the workspace to the headers of a request.
+func (c *Client) authorize(header http.Header) {
+	if c.token != "" {
+		if c.auth == AuthBearer {
+			header.Set("Authorization", "Bearer "+c.token)
+		} else {
+			cookie := (&http.Cookie{Name: "auth_token", Value: c.token}).String()
+			if existing := header.Get("Cookie"); existing != "" {
+				cookie = existing + "; " + cookie
+			}
+			header.Set("Cookie", cookie)
+		}
+	}
+	if c.workspaceID != 0 {
+		header.Set("X-Workspace-ID", strconv.FormatInt(c.workspaceID, 10))
+	}
+}
+
+// idempotent reports whether making a request twice does no more than
+// making it once.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryable reports whether a request that failed with the status may
+// succeed later.
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfter reads how many seconds a Retry-After header asks to wait, at
+// most a minute.
+func retryAfter(res *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+
+	return min(time.Duration(seconds)*time.Second, time.Minute)
+}
+
+// decodeError reads the error out of a response. Handlers answer with a
+// utils.Envelope like {"error": "..."}, echo itself with {"message": "..."}.
+func decodeError(res *http.Response) *Error {
+	apiErr := &Error{StatusCode: res.StatusCode, Message: http.StatusText(res.StatusCode)}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return apiErr
+	}
+
+	var envelope utils.Envelope
+	if json.Unmarshal(data, &envelope) != nil {
+		return apiErr
+	}
+	apiErr.Envelope = envelope
+
+	for _, key := range []string{"error", "message"} {
+		if message, ok := envelope[key].(string); ok && message != "" {
+			apiErr.Message = message
+			break
+		}
+	}
+
+	return apiErr
+}
+
+// pathID formats an id for a path.
+func pathID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
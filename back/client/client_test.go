@@ -0,0 +1,286 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"markdown-notes/internal/app"
+	"markdown-notes/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+
+	// flaky fails the first failures requests with status
+	flaky := func(status int, failures int32, header http.Header) (*httptest.Server, *atomic.Int32) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) <= failures {
+				for key, values := range header {
+					w.Header()[key] = values
+				}
+				w.WriteHeader(status)
+				return
+			}
+			w.Write([]byte(`{"username":"Theo"}`))
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &calls
+	}
+
+	t.Run("retries idempotent requests", func(t *testing.T) {
+		srv, calls := flaky(http.StatusServiceUnavailable, 2, nil)
+		c := New(srv.URL)
+		c.SetRetries(2, time.Millisecond)
+
+		username, err := c.Me(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "Theo", username)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("gives up after the retries", func(t *testing.T) {
+		srv, calls := flaky(http.StatusBadGateway, 5, nil)
+		c := New(srv.URL)
+		c.SetRetries(1, time.Millisecond)
+
+		_, err := c.Me(ctx)
+		assert.True(t, IsStatus(err, http.StatusBadGateway))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("doesn't retry other requests", func(t *testing.T) {
+		srv, calls := flaky(http.StatusServiceUnavailable, 1, nil)
+		c := New(srv.URL)
+		c.SetRetries(2, time.Millisecond)
+
+		_, err := c.CreateFolder(ctx, 0, "Projects")
+		assert.True(t, IsStatus(err, http.StatusServiceUnavailable))
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("doesn't retry client errors", func(t *testing.T) {
+		srv, calls := flaky(http.StatusNotFound, 1, nil)
+		c := New(srv.URL)
+		c.SetRetries(2, time.Millisecond)
+
+		_, err := c.Me(ctx)
+		assert.True(t, IsStatus(err, http.StatusNotFound))
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("waits as long as Retry-After asks", func(t *testing.T) {
+		srv, calls := flaky(http.StatusTooManyRequests, 1, http.Header{"Retry-After": {"1"}})
+		c := New(srv.URL)
+		c.SetRetries(1, time.Millisecond)
+
+		start := time.Now()
+		_, err := c.Me(ctx)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("stops waiting when the context is done", func(t *testing.T) {
+		srv, _ := flaky(http.StatusServiceUnavailable, 5, nil)
+		c := New(srv.URL)
+		c.SetRetries(2, time.Hour)
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		_, err := c.Me(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"handler error", http.StatusBadRequest, `{"error":"title is required"}`, "title is required"},
+		{"echo error", http.StatusUnauthorized, `{"message":"invalid or expired token"}`, "invalid or expired token"},
+		{"not json", http.StatusBadGateway, "<html>bad gateway</html>", "Bad Gateway"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body))}
+
+			err := decodeError(res)
+			assert.Equal(t, tt.status, err.StatusCode)
+			assert.Equal(t, tt.message, err.Message)
+		})
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	body := ": keep-alive\n\n" +
+		"id: 7\nevent: note.updated\ndata: {\"id\":7,\"type\":\"note.updated\",\"note_id\":3,\"folder_id\":1}\n\n" +
+		"id: 8\r\nevent: folder.created\r\ndata: {\"id\":8,\"type\":\"folder.created\",\"folder_id\":2}\r\n\r\n"
+	stream := &EventStream{body: io.NopCloser(nil), reader: bufio.NewReader(strings.NewReader(body))}
+
+	event, err := stream.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), event.ID)
+	assert.Equal(t, "note.updated", event.Type)
+	assert.Equal(t, int64(3), *event.NoteID)
+
+	event, err = stream.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "folder.created", event.Type)
+	assert.Equal(t, int64(8), stream.LastID)
+
+	_, err = stream.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// TestClient runs the client against the API.
+func TestClient(t *testing.T) {
+	db := store.SetupTestDB(t)
+	defer db.Close()
+	store.TruncateTables(t, db)
+
+	t.Setenv("ATTACHMENTS_DIR", t.TempDir())
+	t.Setenv("SITES_DIR", t.TempDir())
+	a, err := app.NewAppWithDB(db)
+	if err != nil {
+		t.Fatalf("creating app: %v", err)
+	}
+
+	e := echo.New()
+	a.RegisterRoutes(e)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := New(srv.URL)
+
+	assert.NoError(t, c.Health(ctx))
+
+	user, root, err := c.Register(ctx, "Theo", "drumandbassbob@gmail.com", "hunter2hunter2")
+	if err != nil {
+		t.Fatalf("registering: %v", err)
+	}
+	assert.Equal(t, "Theo", user.Username)
+
+	_, err = c.Me(ctx)
+	assert.True(t, IsStatus(err, http.StatusUnauthorized))
+
+	err = c.Login(ctx, "Theo", "wrong password")
+	assert.True(t, IsStatus(err, http.StatusUnauthorized))
+
+	err = c.Login(ctx, "Theo", "hunter2hunter2")
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+	assert.NotEmpty(t, c.Token())
+
+	t.Run("sends the token in a cookie or a bearer header", func(t *testing.T) {
+		username, err := c.Me(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "Theo", username)
+
+		bearer := New(srv.URL)
+		bearer.SetToken(c.Token())
+		bearer.SetAuth(AuthBearer)
+		username, err = bearer.Me(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "Theo", username)
+	})
+
+	t.Run("works with folders and notes", func(t *testing.T) {
+		folder, err := c.CreateFolder(ctx, 0, "Projects")
+		if err != nil {
+			t.Fatalf("creating folder: %v", err)
+		}
+		assert.Equal(t, root, *folder.ParentID)
+
+		note, err := c.CreateNote(ctx, folder.ID, "Plan", "# Plan\n\nship it #work")
+		if err != nil {
+			t.Fatalf("creating note: %v", err)
+		}
+
+		content, err := c.GetRootFolderContent(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, content.Folders, 1)
+
+		content, err = c.GetFolderContent(ctx, folder.ID)
+		assert.NoError(t, err)
+		assert.Len(t, content.Notes, 1)
+
+		text := "# Plan\n\nship it today #work"
+		saved, err := c.PatchNote(ctx, note.ID, store.NoteUpdate{Note: &text, IfVersion: &note.Version})
+		if assert.NoError(t, err) {
+			assert.Equal(t, text, saved.Note)
+		}
+
+		stale := "# Plan\n\nship it tomorrow"
+		_, err = c.PatchNote(ctx, note.ID, store.NoteUpdate{Note: &stale, IfVersion: &note.Version})
+		var staleErr *StaleNoteError
+		if assert.True(t, errors.As(err, &staleErr)) {
+			assert.Equal(t, text, staleErr.Note.Note)
+		}
+		assert.True(t, IsStatus(err, http.StatusPreconditionFailed))
+
+		tags, err := c.GetTags(ctx, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []store.TagCount{{Tag: "work", Count: 1}}, tags)
+
+		_, err = c.DeleteNote(ctx, note.ID)
+		assert.NoError(t, err)
+
+		trash, err := c.GetTrash(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, trash, 1)
+	})
+
+	t.Run("returns what the API said went wrong", func(t *testing.T) {
+		err := c.PurgeNote(ctx, 1<<40)
+		var apiErr *Error
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+			assert.NotEmpty(t, apiErr.Message)
+		}
+	})
+
+	t.Run("opens shares with a password", func(t *testing.T) {
+		note, err := c.CreateNote(ctx, 0, "Secret", "the password is swordfish")
+		if err != nil {
+			t.Fatalf("creating note: %v", err)
+		}
+
+		share, err := c.ShareNote(ctx, note.ID, ShareOptions{Password: "swordfish"})
+		if err != nil {
+			t.Fatalf("sharing note: %v", err)
+		}
+
+		visitor := New(srv.URL)
+		_, err = visitor.GetSharePage(ctx, share.Token, "")
+		assert.True(t, IsStatus(err, http.StatusUnauthorized))
+
+		_, err = visitor.GetSharePage(ctx, share.Token, "wrong")
+		assert.True(t, IsStatus(err, http.StatusUnauthorized))
+
+		page, err := visitor.GetSharePage(ctx, share.Token, "swordfish")
+		assert.NoError(t, err)
+		assert.Contains(t, page, "the password is swordfish")
+
+		page, err = visitor.GetSharePage(ctx, share.Token, "")
+		assert.NoError(t, err)
+		assert.Contains(t, page, "the password is swordfish")
+	})
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"io"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"net/http"
+)
+
+// GetRootFolderContent returns what is in the workspace's root folder.
+func (c *Client) GetRootFolderContent(ctx context.Context) (*service.FolderContent, error) {
+	var content service.FolderContent
+	err := c.do(ctx, http.MethodGet, "/folders", nil, nil, &content)
+	if err != nil {
+		return nil, err
+	}
+
+	return &content, nil
+}
+
+// GetFolderContent returns the notes and subfolders of a folder.
+func (c *Client) GetFolderContent(ctx context.Context, folder_id int64) (*service.FolderContent, error) {
+	var content service.FolderContent
+	err := c.do(ctx, http.MethodGet, "/folders/"+pathID(folder_id), nil, nil, &content)
+	if err != nil {
+		return nil, err
+	}
+
+	return &content, nil
+}
+
+// CreateFolder creates a folder in parent_id, the workspace's root folder
+// for 0.
+func (c *Client) CreateFolder(ctx context.Context, parent_id int64, name string) (*store.Folder, error) {
+	body := map[string]any{"parent_id": parent_id, "name": name}
+
+	var folder store.Folder
+	err := c.do(ctx, http.MethodPost, "/folders/new", nil, body, &folder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+// PatchFolder renames a folder or moves it to another parent, nil leaves
+// either as it is.
+func (c *Client) PatchFolder(ctx context.Context, folder_id int64, name *string, parent_id *int64) (*store.Folder, error) {
+	body := map[string]any{}
+	if name != nil {
+		body["name"] = *name
+	}
+	if parent_id != nil {
+		body["parent_id"] = *parent_id
+	}
+
+	var folder store.Folder
+	err := c.do(ctx, http.MethodPatch, "/folders/"+pathID(folder_id), nil, body, &folder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+// DeleteFolder deletes a folder with everything in it.
+func (c *Client) DeleteFolder(ctx context.Context, folder_id int64) error {
+	return c.do(ctx, http.MethodDelete, "/folders/"+pathID(folder_id), nil, nil, nil)
+}
+
+// ExportFolder returns a zip of the markdown files in a folder and below,
+// which the caller has to close.
+func (c *Client) ExportFolder(ctx context.Context, folder_id int64) (io.ReadCloser, error) {
+	res, err := c.send(ctx, http.MethodGet, "/folders/"+pathID(folder_id)+"/export.zip", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// PublishFolder publishes a folder as a static site, or builds the site of
+// a published folder again.
+func (c *Client) PublishFolder(ctx context.Context, folder_id int64) (*service.PublishedSite, error) {
+	var site service.PublishedSite
+	err := c.do(ctx, http.MethodPost, "/folders/"+pathID(folder_id)+"/publish", nil, nil, &site)
+	if err != nil {
+		return nil, err
+	}
+
+	return &site, nil
+}
+
+// UnpublishFolder takes a folder's site down.
+func (c *Client) UnpublishFolder(ctx context.Context, folder_id int64) error {
+	return c.do(ctx, http.MethodDelete, "/folders/"+pathID(folder_id)+"/publish", nil, nil, nil)
+}
+
+// DownloadSite returns a zip of the static site of a folder, which the
+// caller has to close.
+func (c *Client) DownloadSite(ctx context.Context, folder_id int64) (io.ReadCloser, error) {
+	res, err := c.send(ctx, http.MethodGet, "/folders/"+pathID(folder_id)+"/site.zip", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"io"
+	"markdown-notes/internal/service"
+	"net/http"
+	"strconv"
+)
+
+// StartImport uploads an archive of notes in format, like "markdown" or
+// "enex", to be imported into a folder, the workspace's root folder for 0.
+// Without a format the server guesses it from the filename. The import runs
+// in the background, GetImportJob tells how far it got.
+func (c *Client) StartImport(ctx context.Context, folder_id int64, format string, filename string, content io.Reader) (*service.ImportJob, error) {
+	fields := map[string]string{}
+	if folder_id != 0 {
+		fields["folder_id"] = strconv.FormatInt(folder_id, 10)
+	}
+	if format != "" {
+		fields["format"] = format
+	}
+
+	body, err := multipartBody(fields, filename, content)
+	if err != nil {
+		return nil, err
+	}
+
+	var job service.ImportJob
+	err = c.do(ctx, http.MethodPost, "/import", nil, body, &job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// GetImportJob returns an import with its progress, and its report once it
+// finished.
+func (c *Client) GetImportJob(ctx context.Context, job_id int64) (*service.ImportJob, error) {
+	var job service.ImportJob
+	err := c.do(ctx, http.MethodGet, "/import/"+pathID(job_id), nil, nil, &job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"markdown-notes/internal/graph"
+	"markdown-notes/internal/store"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// GetBacklinks returns the notes linking to a note.
+func (c *Client) GetBacklinks(ctx context.Context, note_id int64) ([]store.Backlink, error) {
+	var res struct {
+		Backlinks []store.Backlink `json:"backlinks"`
+	}
+	err := c.do(ctx, http.MethodGet, "/notes/"+pathID(note_id)+"/backlinks", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Backlinks, nil
+}
+
+// GetOutlinks returns the links written in a note, split into the ones
+// pointing to a note and the dangling ones.
+func (c *Client) GetOutlinks(ctx context.Context, note_id int64) ([]store.Outlink, []store.Outlink, error) {
+	var res struct {
+		Links      []store.Outlink `json:"links"`
+		Unresolved []store.Outlink `json:"unresolved"`
+	}
+	err := c.do(ctx, http.MethodGet, "/notes/"+pathID(note_id)+"/outlinks", nil, nil, &res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return res.Links, res.Unresolved, nil
+}
+
+// GraphOptions narrows down the link graph. FolderID limits it to a folder
+// and below, NoteID to the notes at most Depth links away from a note, 1 when
+// Depth is nil.
+type GraphOptions struct {
+	FolderID int64
+	NoteID   int64
+	Depth    *int
+}
+
+func (o GraphOptions) query(format string) url.Values {
+	params := url.Values{"format": {format}}
+	if o.FolderID != 0 {
+		params.Set("folder_id", strconv.FormatInt(o.FolderID, 10))
+	}
+	if o.NoteID != 0 {
+		params.Set("note_id", strconv.FormatInt(o.NoteID, 10))
+	}
+	if o.Depth != nil {
+		params.Set("depth", strconv.Itoa(*o.Depth))
+	}
+
+	return params
+}
+
+// GetGraph returns the graph of links between notes.
+func (c *Client) GetGraph(ctx context.Context, opts GraphOptions) (*graph.Graph, error) {
+	var g graph.Graph
+	err := c.do(ctx, http.MethodGet, "/graph", opts.query("json"), nil, &g)
+	if err != nil {
+		return nil, err
+	}
+
+	return &g, nil
+}
+
+// GetGraphDOT returns the graph of links between notes in Graphviz's DOT
+// language.
+func (c *Client) GetGraphDOT(ctx context.Context, opts GraphOptions) (string, error) {
+	return c.getText(ctx, "/graph", opts.query("dot"), nil)
+}
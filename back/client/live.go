@@ -0,0 +1,138 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"markdown-notes/internal/live"
+	"markdown-notes/internal/store"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// EventStream reads the changes to notes and folders the server sends as
+// they happen.
+type EventStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	// LastID is the id of the last event read, to resume from with Events
+	// after the stream broke off.
+	LastID int64
+}
+
+// Events opens the stream of changes made in the workspace after the event
+// with lastEventID, or from now on for 0. The caller has to close it.
+func (c *Client) Events(ctx context.Context, lastEventID int64) (*EventStream, error) {
+	var params url.Values
+	if lastEventID != 0 {
+		params = url.Values{"last_event_id": {strconv.FormatInt(lastEventID, 10)}}
+	}
+
+	res, err := c.send(ctx, http.MethodGet, "/events", params, http.Header{"Accept": {"text/event-stream"}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventStream{body: res.Body, reader: bufio.NewReader(res.Body), LastID: lastEventID}, nil
+}
+
+// Next waits for the next event. It returns io.EOF once the server ended the
+// stream.
+func (s *EventStream) Next() (*store.Event, error) {
+	var data strings.Builder
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" {
+				return nil, io.EOF
+			}
+			if err != io.EOF {
+				return nil, err
+			}
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if data.Len() == 0 {
+				continue
+			}
+
+			var event store.Event
+			err := json.Unmarshal([]byte(data.String()), &event)
+			if err != nil {
+				return nil, err
+			}
+			s.LastID = event.ID
+			return &event, nil
+		}
+
+		// lines starting with a colon are comments, which keep the
+		// connection alive, and only the data of an event is needed as it
+		// carries its id and type too
+		field, value, _ := strings.Cut(line, ":")
+		if field == "data" {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+	}
+}
+
+// Close closes the stream.
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
+
+// LiveConn is a connection for editing a note together with everyone else
+// editing it, see live.Message for what goes over it.
+type LiveConn struct {
+	conn *websocket.Conn
+}
+
+// DialLive connects to the live editing session of a note. The server first
+// sends an "init" message with the note's text and revision.
+func (c *Client) DialLive(ctx context.Context, note_id int64) (*LiveConn, error) {
+	header := http.Header{}
+	c.authorize(header)
+
+	conn, res, err := websocket.Dial(ctx, c.baseURL+"/notes/"+pathID(note_id)+"/live", &websocket.DialOptions{
+		HTTPClient: c.httpClient,
+		HTTPHeader: header,
+	})
+	if err != nil {
+		if res != nil && res.StatusCode >= 400 {
+			return nil, decodeError(res)
+		}
+		return nil, err
+	}
+
+	return &LiveConn{conn: conn}, nil
+}
+
+// Send sends a message, an "op" or a "cursor".
+func (l *LiveConn) Send(ctx context.Context, msg live.Message) error {
+	return wsjson.Write(ctx, l.conn, msg)
+}
+
+// Receive waits for the next message from the server.
+func (l *LiveConn) Receive(ctx context.Context) (*live.Message, error) {
+	var msg live.Message
+	err := wsjson.Read(ctx, l.conn, &msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// Close leaves the session.
+func (l *LiveConn) Close() error {
+	return l.conn.Close(websocket.StatusNormalClosure, "")
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"markdown-notes/internal/store"
+	"net/http"
+)
+
+// GetMembers returns the users given a role on a folder.
+func (c *Client) GetMembers(ctx context.Context, folder_id int64) ([]store.Member, error) {
+	var res struct {
+		Members []store.Member `json:"members"`
+	}
+	err := c.do(ctx, http.MethodGet, "/folders/"+pathID(folder_id)+"/members", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Members, nil
+}
+
+// AddMember gives a user a role on a folder and everything in it.
+func (c *Client) AddMember(ctx context.Context, folder_id int64, username string, role store.Role) (*store.Member, error) {
+	body := map[string]any{"username": username, "role": role}
+
+	var member store.Member
+	err := c.do(ctx, http.MethodPost, "/folders/"+pathID(folder_id)+"/members", nil, body, &member)
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// UpdateMember changes the role of a member of a folder.
+func (c *Client) UpdateMember(ctx context.Context, folder_id int64, user_id int64, role store.Role) (*store.Member, error) {
+	body := map[string]any{"role": role}
+
+	var member store.Member
+	err := c.do(ctx, http.MethodPatch, "/folders/"+pathID(folder_id)+"/members/"+pathID(user_id), nil, body, &member)
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// RemoveMember takes a user's role on a folder away.
+func (c *Client) RemoveMember(ctx context.Context, folder_id int64, user_id int64) error {
+	return c.do(ctx, http.MethodDelete, "/folders/"+pathID(folder_id)+"/members/"+pathID(user_id), nil, nil, nil)
+}
+
+// GetSharedFolders returns the folders of other workspaces the user was made
+// a member of.
+func (c *Client) GetSharedFolders(ctx context.Context) ([]store.SharedFolder, error) {
+	var res struct {
+		Folders []store.SharedFolder `json:"folders"`
+	}
+	err := c.do(ctx, http.MethodGet, "/folders/shared", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Folders, nil
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"markdown-notes/internal/store"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// StaleNoteError is what PatchNote returns when the note moved on from the
+// version the change was made against. Note is the note as it is now.
+type StaleNoteError struct {
+	Err  *Error
+	Note *store.Note
+}
+
+func (e *StaleNoteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StaleNoteError) Unwrap() error {
+	return e.Err
+}
+
+// GetNote returns a note, its Version is what PatchNote needs to not
+// overwrite someone else's edit.
+func (c *Client) GetNote(ctx context.Context, note_id int64) (*store.Note, error) {
+	var note store.Note
+	// the note is served rendered to browsers asking for HTML
+	err := c.doWithHeader(ctx, http.MethodGet, "/notes/"+pathID(note_id), nil, http.Header{"Accept": {"application/json"}}, nil, &note)
+	if err != nil {
+		return nil, err
+	}
+
+	return &note, nil
+}
+
+// GetNoteHTML returns a note rendered to HTML.
+func (c *Client) GetNoteHTML(ctx context.Context, note_id int64) (string, error) {
+	return c.getText(ctx, "/notes/"+pathID(note_id)+"/html", nil, nil)
+}
+
+// CreateNote creates a note in a folder, the workspace's root folder for 0.
+func (c *Client) CreateNote(ctx context.Context, folder_id int64, title string, note string) (*store.Note, error) {
+	body := map[string]any{"folder_id": folder_id, "title": title, "note": note}
+
+	var created store.Note
+	err := c.do(ctx, http.MethodPost, "/notes/new", nil, body, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// PatchNote changes the non-nil fields of update. With IfVersion set the
+// change is refused with a *StaleNoteError when the note moved on from that
+// version, without it the note is overwritten whatever its version.
+func (c *Client) PatchNote(ctx context.Context, note_id int64, update store.NoteUpdate) (*store.Note, error) {
+	body := map[string]any{}
+	if update.Title != nil {
+		body["title"] = *update.Title
+	}
+	if update.Note != nil {
+		body["note"] = *update.Note
+	}
+	if update.FolderID != nil {
+		body["folder_id"] = *update.FolderID
+	}
+
+	ifMatch := "*"
+	if update.IfVersion != nil {
+		ifMatch = strconv.Quote(strconv.FormatInt(*update.IfVersion, 10))
+	}
+
+	var res struct {
+		Note store.Note `json:"note"`
+	}
+	err := c.doWithHeader(ctx, http.MethodPatch, "/notes/"+pathID(note_id)+"/save", nil, http.Header{"If-Match": {ifMatch}}, body, &res)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusPreconditionFailed {
+		stale := &StaleNoteError{Err: apiErr}
+		if data, err := json.Marshal(apiErr.Envelope["note"]); err == nil {
+			json.Unmarshal(data, &stale.Note)
+		}
+		return nil, stale
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Note, nil
+}
+
+// DeleteNote moves a note to the trash and returns it.
+func (c *Client) DeleteNote(ctx context.Context, note_id int64) (*store.Note, error) {
+	var res struct {
+		Note store.Note `json:"note"`
+	}
+	err := c.do(ctx, http.MethodDelete, "/notes/"+pathID(note_id), nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Note, nil
+}
+
+// GetTrash returns the notes in the trash.
+func (c *Client) GetTrash(ctx context.Context) ([]store.Note, error) {
+	var res struct {
+		Notes []store.Note `json:"notes"`
+	}
+	err := c.do(ctx, http.MethodGet, "/trash", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Notes, nil
+}
+
+// RestoreNote takes a note out of the trash.
+func (c *Client) RestoreNote(ctx context.Context, note_id int64) (*store.Note, error) {
+	var res struct {
+		Note store.Note `json:"note"`
+	}
+	err := c.do(ctx, http.MethodPost, "/trash/"+pathID(note_id)+"/restore", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Note, nil
+}
+
+// PurgeNote deletes a note in the trash for good.
+func (c *Client) PurgeNote(ctx context.Context, note_id int64) error {
+	return c.do(ctx, http.MethodDelete, "/trash/"+pathID(note_id), nil, nil, nil)
+}
+
+// EmptyTrash deletes every note in the trash for good and returns how many
+// there were.
+func (c *Client) EmptyTrash(ctx context.Context) (int64, error) {
+	var res struct {
+		Purged int64 `json:"purged"`
+	}
+	err := c.do(ctx, http.MethodDelete, "/trash", nil, nil, &res)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.Purged, nil
+}
+
+// SearchNotes returns up to limit notes matching query, 20 for 0, starting
+// at cursor. The returned cursor is for the next page, 0 when there is none.
+func (c *Client) SearchNotes(ctx context.Context, query string, limit int, cursor int) ([]store.SearchHit, int, error) {
+	params := url.Values{"q": {query}}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	if cursor > 0 {
+		params.Set("cursor", strconv.Itoa(cursor))
+	}
+
+	var res struct {
+		Results    []store.SearchHit `json:"results"`
+		NextCursor int               `json:"next_cursor"`
+	}
+	err := c.do(ctx, http.MethodGet, "/search", params, nil, &res)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return res.Results, res.NextCursor, nil
+}
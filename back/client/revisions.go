@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"markdown-notes/internal/store"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// GetRevisions returns the revisions of a note, newest first and without
+// their content.
+func (c *Client) GetRevisions(ctx context.Context, note_id int64) ([]store.NoteRevision, error) {
+	var res struct {
+		Revisions []store.NoteRevision `json:"revisions"`
+	}
+	err := c.do(ctx, http.MethodGet, "/notes/"+pathID(note_id)+"/revisions", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Revisions, nil
+}
+
+// GetRevision returns a revision of a note with its content.
+func (c *Client) GetRevision(ctx context.Context, note_id int64, revision int64) (*store.NoteRevision, error) {
+	var rev store.NoteRevision
+	err := c.do(ctx, http.MethodGet, "/notes/"+pathID(note_id)+"/revisions/"+pathID(revision), nil, nil, &rev)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+// DiffRevisions returns a unified diff from one revision of a note to
+// another.
+func (c *Client) DiffRevisions(ctx context.Context, note_id int64, from int64, to int64) (string, error) {
+	params := url.Values{"from": {strconv.FormatInt(from, 10)}, "to": {strconv.FormatInt(to, 10)}}
+
+	var res struct {
+		Diff string `json:"diff"`
+	}
+	err := c.do(ctx, http.MethodGet, "/notes/"+pathID(note_id)+"/revisions/diff", params, nil, &res)
+	if err != nil {
+		return "", err
+	}
+
+	return res.Diff, nil
+}
+
+// RestoreRevision makes a revision the note's content again, which keeps the
+// content it replaces as a revision of its own.
+func (c *Client) RestoreRevision(ctx context.Context, note_id int64, revision int64) (*store.Note, error) {
+	var res struct {
+		Note store.Note `json:"note"`
+	}
+	err := c.do(ctx, http.MethodPost, "/notes/"+pathID(note_id)+"/revisions/"+pathID(revision)+"/restore", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Note, nil
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"io"
+	"markdown-notes/internal/store"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ShareOptions are the optional settings of a share link. A share without
+// ExpiresAt never expires, one without Password is open to anyone with the
+// link.
+type ShareOptions struct {
+	ExpiresAt *time.Time
+	Password  string
+}
+
+// ShareNote creates a share link for a note. The Token of the share is only
+// ever returned this once.
+func (c *Client) ShareNote(ctx context.Context, note_id int64, opts ShareOptions) (*store.Share, error) {
+	return c.createShare(ctx, "/notes/"+pathID(note_id)+"/shares", opts)
+}
+
+// ShareFolder creates a share link for a folder and everything below it. The
+// Token of the share is only ever returned this once.
+func (c *Client) ShareFolder(ctx context.Context, folder_id int64, opts ShareOptions) (*store.Share, error) {
+	return c.createShare(ctx, "/folders/"+pathID(folder_id)+"/shares", opts)
+}
+
+func (c *Client) createShare(ctx context.Context, path string, opts ShareOptions) (*store.Share, error) {
+	body := map[string]any{"expires_at": opts.ExpiresAt, "password": opts.Password}
+
+	var share store.Share
+	err := c.do(ctx, http.MethodPost, path, nil, body, &share)
+	if err != nil {
+		return nil, err
+	}
+
+	return &share, nil
+}
+
+// GetShares returns the share links the user created.
+func (c *Client) GetShares(ctx context.Context) ([]store.Share, error) {
+	var res struct {
+		Shares []store.Share `json:"shares"`
+	}
+	err := c.do(ctx, http.MethodGet, "/shares", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Shares, nil
+}
+
+// DeleteShare revokes a share link.
+func (c *Client) DeleteShare(ctx context.Context, share_id int64) error {
+	return c.do(ctx, http.MethodDelete, "/shares/"+pathID(share_id), nil, nil, nil)
+}
+
+// GetSharePage returns the page a share link opens on, the shared note or
+// the index of the shared folder. Pages of shares with a password need it
+// the first time, the client remembers it was entered after that.
+func (c *Client) GetSharePage(ctx context.Context, token string, password string) (string, error) {
+	return c.getSharePage(ctx, token, "", password)
+}
+
+// GetSharedNotePage returns the page of a note below a shared folder.
+func (c *Client) GetSharedNotePage(ctx context.Context, token string, note_id int64, password string) (string, error) {
+	return c.getSharePage(ctx, token, "/notes/"+pathID(note_id), password)
+}
+
+// GetSharedFolderPage returns the index of a folder below a shared folder.
+func (c *Client) GetSharedFolderPage(ctx context.Context, token string, folder_id int64, password string) (string, error) {
+	return c.getSharePage(ctx, token, "/folders/"+pathID(folder_id), password)
+}
+
+// GetSharedAttachment returns the content of an attachment of a shared note,
+// which the caller has to close. For a share with a password one of its pages
+// has to be opened with it first.
+func (c *Client) GetSharedAttachment(ctx context.Context, token string, attachment_id int64) (io.ReadCloser, error) {
+	res, err := c.send(ctx, http.MethodGet, sharePath(token)+"/attachments/"+pathID(attachment_id), nil, c.shareHeader(token), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// GetShareStylesheet returns the stylesheet of shared pages.
+func (c *Client) GetShareStylesheet(ctx context.Context) (string, error) {
+	return c.getText(ctx, "/s/style.css", nil, nil)
+}
+
+// getSharePage gets a shared page, posting the password when the share
+// wants one the client doesn't have proof of yet. The server proves the
+// password was entered with a Secure cookie, which an http.Client's jar
+// wouldn't send back over plain HTTP, so the client keeps it itself.
+func (c *Client) getSharePage(ctx context.Context, token string, page string, password string) (string, error) {
+	path := sharePath(token) + page
+
+	header := c.shareHeader(token)
+	if header != nil || password == "" {
+		text, err := c.getText(ctx, path, nil, header)
+		if password == "" || !IsStatus(err, http.StatusUnauthorized) {
+			return text, err
+		}
+	}
+
+	form := url.Values{"password": {password}}
+	body := &rawBody{contentType: "application/x-www-form-urlencoded", content: strings.NewReader(form.Encode())}
+	res, err := c.send(ctx, http.MethodPost, path, nil, nil, body)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	for _, cookie := range res.Cookies() {
+		if strings.HasPrefix(cookie.Name, "share_") {
+			c.mu.Lock()
+			c.shareCookies[token] = cookie
+			c.mu.Unlock()
+		}
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// shareHeader returns the header proving the password of a share was
+// entered, nil when it wasn't.
+func (c *Client) shareHeader(token string) http.Header {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cookie, ok := c.shareCookies[token]
+	if !ok {
+		return nil
+	}
+
+	return http.Header{"Cookie": {(&http.Cookie{Name: cookie.Name, Value: cookie.Value}).String()}}
+}
+
+func sharePath(token string) string {
+	return "/s/" + url.PathEscape(token)
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// GetSync returns the changes in the workspace after the change number
+// since, at most limit of them, or the server's default for 0.
+func (c *Client) GetSync(ctx context.Context, since int64, limit int) (*store.SyncChanges, error) {
+	query := url.Values{"since": {strconv.FormatInt(since, 10)}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var changes store.SyncChanges
+	err := c.do(ctx, http.MethodGet, "/sync", query, nil, &changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &changes, nil
+}
+
+// PostSync sends changes made offline and returns what became of each.
+func (c *Client) PostSync(ctx context.Context, changes []service.SyncChange) ([]service.SyncResult, error) {
+	var res struct {
+		Results []service.SyncResult `json:"results"`
+	}
+	err := c.do(ctx, http.MethodPost, "/sync", nil, map[string]any{"changes": changes}, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Results, nil
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"markdown-notes/internal/store"
+	"net/http"
+	"net/url"
+)
+
+// GetTags returns the tags used in the workspace with how many notes have
+// them, only the ones starting with prefix unless it is empty.
+func (c *Client) GetTags(ctx context.Context, prefix string) ([]store.TagCount, error) {
+	var params url.Values
+	if prefix != "" {
+		params = url.Values{"prefix": {prefix}}
+	}
+
+	var res struct {
+		Tags []store.TagCount `json:"tags"`
+	}
+	err := c.do(ctx, http.MethodGet, "/tags", params, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Tags, nil
+}
+
+// GetTagNotes returns the notes tagged with tag or a tag nested under it.
+func (c *Client) GetTagNotes(ctx context.Context, tag string) ([]store.Note, error) {
+	var res struct {
+		Notes []store.Note `json:"notes"`
+	}
+	err := c.do(ctx, http.MethodGet, "/tags/"+url.PathEscape(tag)+"/notes", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Notes, nil
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/tokens"
+	"net/http"
+	"net/url"
+)
+
+// GetWorkspaces returns the workspaces the user belongs to.
+func (c *Client) GetWorkspaces(ctx context.Context) ([]store.Workspace, error) {
+	var res struct {
+		Workspaces []store.Workspace `json:"workspaces"`
+	}
+	err := c.do(ctx, http.MethodGet, "/workspaces", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Workspaces, nil
+}
+
+// GetWorkspace returns a workspace the user belongs to.
+func (c *Client) GetWorkspace(ctx context.Context, workspace_id int64) (*store.Workspace, error) {
+	var workspace store.Workspace
+	err := c.do(ctx, http.MethodGet, "/workspaces/"+pathID(workspace_id), nil, nil, &workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// CreateWorkspace creates a workspace with the user as its admin.
+func (c *Client) CreateWorkspace(ctx context.Context, name string) (*store.Workspace, error) {
+	body := map[string]string{"name": name}
+
+	var workspace store.Workspace
+	err := c.do(ctx, http.MethodPost, "/workspaces", nil, body, &workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// GetWorkspaceMembers returns the users belonging to a workspace.
+func (c *Client) GetWorkspaceMembers(ctx context.Context, workspace_id int64) ([]store.WorkspaceMember, error) {
+	var res struct {
+		Members []store.WorkspaceMember `json:"members"`
+	}
+	err := c.do(ctx, http.MethodGet, "/workspaces/"+pathID(workspace_id)+"/members", nil, nil, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Members, nil
+}
+
+// UpdateWorkspaceMember changes the role of a member of a workspace.
+func (c *Client) UpdateWorkspaceMember(ctx context.Context, workspace_id int64, user_id int64, role store.WorkspaceRole) (*store.WorkspaceMember, error) {
+	body := map[string]any{"role": role}
+
+	var member store.WorkspaceMember
+	err := c.do(ctx, http.MethodPatch, "/workspaces/"+pathID(workspace_id)+"/members/"+pathID(user_id), nil, body, &member)
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// RemoveWorkspaceMember removes a user from a workspace.
+func (c *Client) RemoveWorkspaceMember(ctx context.Context, workspace_id int64, user_id int64) error {
+	return c.do(ctx, http.MethodDelete, "/workspaces/"+pathID(workspace_id)+"/members/"+pathID(user_id), nil, nil, nil)
+}
+
+// Invite creates an invitation to join a workspace with a role. Whoever the
+// token is given to can accept it with AcceptInvitation until it expires.
+func (c *Client) Invite(ctx context.Context, workspace_id int64, role store.WorkspaceRole) (*tokens.Token, error) {
+	body := map[string]any{"role": role}
+
+	var res struct {
+		Invitation tokens.Token `json:"invitation"`
+	}
+	err := c.do(ctx, http.MethodPost, "/workspaces/"+pathID(workspace_id)+"/invitations", nil, body, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Invitation, nil
+}
+
+// AcceptInvitation joins the workspace an invitation is for.
+func (c *Client) AcceptInvitation(ctx context.Context, token string) (*store.Workspace, error) {
+	var workspace store.Workspace
+	err := c.do(ctx, http.MethodPost, "/invitations/"+url.PathEscape(token)+"/accept", nil, nil, &workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
@@ -0,0 +1,108 @@
+// Command notes-sync keeps a local directory of markdown files in sync with
+// the folder tree of a workspace, so notes can be edited with any editor.
+//
+//	notes-sync [-server URL] [-workspace ID] [-interval 30s] DIR
+//
+// Every folder is a directory and every note a .md file named after its
+// title. Edits, renames, moves and deletes go both ways. When a note changed
+// on both sides neither version is lost: the server keeps one and the other
+// is saved next to it as a conflicted copy.
+//
+// The token comes from NOTES_TOKEN, or NOTES_USERNAME and NOTES_PASSWORD are
+// used to log in. What was synced is kept in DIR/.notes-sync.json.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"markdown-notes/client"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	server := flag.String("server", envOr("NOTES_SERVER", "http://localhost:8080"), "URL of the notes API")
+	workspace := flag.Int64("workspace", 0, "workspace to sync, the personal one by default")
+	interval := flag.Duration("interval", 0, "sync again after this long, once if 0")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: notes-sync [flags] DIR\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, *server, *workspace, *interval, flag.Arg(0))
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("notes-sync: %v", err)
+	}
+}
+
+func run(ctx context.Context, server string, workspace_id int64, interval time.Duration, dir string) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	m, err := loadManifest(dir)
+	if err != nil {
+		return err
+	}
+	if m.Seq != 0 && m.WorkspaceID != workspace_id {
+		return fmt.Errorf("%s is synced with workspace %d", dir, m.WorkspaceID)
+	}
+	m.WorkspaceID = workspace_id
+
+	c := client.New(server)
+	c.SetWorkspace(workspace_id)
+	if token := os.Getenv("NOTES_TOKEN"); token != "" {
+		c.SetToken(token)
+	} else {
+		username, password := os.Getenv("NOTES_USERNAME"), os.Getenv("NOTES_PASSWORD")
+		if username == "" || password == "" {
+			return errors.New("set NOTES_TOKEN, or NOTES_USERNAME and NOTES_PASSWORD")
+		}
+
+		err = c.Login(ctx, username, password)
+		if err != nil {
+			return err
+		}
+	}
+
+	s := newSyncer(c, dir, m, os.Stdout)
+	for {
+		err = s.run(ctx)
+		if interval <= 0 || ctx.Err() != nil {
+			return err
+		}
+		if err != nil {
+			// the server may be back by the next round
+			log.Printf("notes-sync: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
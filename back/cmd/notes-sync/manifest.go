@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"markdown-notes/internal/archive"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// manifestName is the file in the synced directory the manifest is kept in.
+const manifestName = ".notes-sync.json"
+
+// manifest is the state of the last sync: the folder tree on the server as
+// of change number Seq, and for every note where its file is and what was in
+// it. A file that no longer matches its note was edited, moved or deleted
+// locally, a note whose version moved on was edited remotely.
+type manifest struct {
+	WorkspaceID int64                  `json:"workspace_id"`
+	Seq         int64                  `json:"seq"`
+	Folders     map[int64]*folderState `json:"folders"`
+	Notes       map[int64]*noteState   `json:"notes"`
+}
+
+type folderState struct {
+	ParentID *int64 `json:"parent_id"`
+	Name     string `json:"name"`
+}
+
+// noteState is a note on the server and its file. Path is relative to the
+// synced directory and empty until the file is written, Hash is the hash of
+// the file's content as of the last sync.
+type noteState struct {
+	FolderID int64  `json:"folder_id"`
+	Title    string `json:"title"`
+	Version  int64  `json:"version"`
+	Path     string `json:"path"`
+	Hash     string `json:"hash"`
+}
+
+func newManifest() *manifest {
+	return &manifest{
+		Folders: map[int64]*folderState{},
+		Notes:   map[int64]*noteState{},
+	}
+}
+
+// loadManifest reads the manifest of dir, an empty one the first time.
+func loadManifest(dir string) (*manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return newManifest(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := newManifest()
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// save writes the manifest through a temporary file, so an interrupted sync
+// leaves the last one intact.
+func (m *manifest) save(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, manifestName+".tmp")
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(dir, manifestName))
+}
+
+// folderPath is where the folder's directory is, relative to the synced
+// directory. The root folder is the synced directory itself. Folders shared
+// from elsewhere, whose parent isn't synced, go right below it.
+func (m *manifest) folderPath(folder_id int64) string {
+	folder, ok := m.Folders[folder_id]
+	if !ok {
+		return ""
+	}
+
+	if folder.ParentID == nil {
+		return ""
+	}
+
+	if _, ok := m.Folders[*folder.ParentID]; !ok {
+		return archive.SanitizeName(folder.Name)
+	}
+
+	return path.Join(m.folderPath(*folder.ParentID), archive.SanitizeName(folder.Name))
+}
+
+// notePath is where the note's file belongs. Titles and folder names are
+// sanitized the way exports do, so they can't leave the directory and work as
+// file names on any system.
+func (m *manifest) notePath(note *noteState) string {
+	return path.Join(m.folderPath(note.FolderID), archive.SanitizeName(note.Title)+".md")
+}
+
+// folderIDs maps the directory of every folder to its id.
+func (m *manifest) folderIDs() map[string]int64 {
+	ids := map[string]int64{}
+	for id := range m.Folders {
+		dir := m.folderPath(id)
+		if existing, ok := ids[dir]; !ok || m.Folders[existing].ParentID != nil {
+			// the root folder wins the synced directory
+			ids[dir] = id
+		}
+	}
+
+	return ids
+}
+
+// inFolder reports whether folder_id is ancestor_id or below it.
+func (m *manifest) inFolder(folder_id int64, ancestor_id int64) bool {
+	for {
+		if folder_id == ancestor_id {
+			return true
+		}
+
+		folder, ok := m.Folders[folder_id]
+		if !ok || folder.ParentID == nil {
+			return false
+		}
+		folder_id = *folder.ParentID
+	}
+}
+
+func hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
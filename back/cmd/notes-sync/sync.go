@@ -0,0 +1,687 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stagingName is the directory files are moved through, so notes can swap
+// places.
+const stagingName = ".notes-sync-staging"
+
+// remote is the part of the API a sync needs, see client.Client.
+type remote interface {
+	GetSync(ctx context.Context, since int64, limit int) (*store.SyncChanges, error)
+	PostSync(ctx context.Context, changes []service.SyncChange) ([]service.SyncResult, error)
+}
+
+// localFile is a note's file as found in the synced directory.
+type localFile struct {
+	content []byte
+	hash    string
+}
+
+// pushOp is what a change sent to the server was about, to apply its result
+// to the manifest.
+type pushOp struct {
+	id   int64
+	path string
+	file *localFile
+}
+
+type syncer struct {
+	remote remote
+	dir    string
+	m      *manifest
+	out    io.Writer
+
+	// pending is the content of notes whose files have to be written
+	pending map[int64]string
+	// removed are the notes gone from the server, their files are deleted
+	// unless they were edited since the last sync
+	removed map[int64]*noteState
+	// removedDirs are the directories of folders gone from the server,
+	// deleted once empty
+	removedDirs []string
+}
+
+func newSyncer(remote remote, dir string, m *manifest, out io.Writer) *syncer {
+	return &syncer{
+		remote:  remote,
+		dir:     dir,
+		m:       m,
+		out:     out,
+		pending: map[int64]string{},
+		removed: map[int64]*noteState{},
+	}
+}
+
+// run syncs once: local changes are sent first, so the server resolves
+// conflicts with remote changes, then the remote changes are written out.
+// The first time the tree is pulled before anything is sent, and files that
+// are in the way of notes are kept. The manifest is saved after each step.
+func (s *syncer) run(ctx context.Context) error {
+	if s.m.Seq == 0 {
+		err := s.pullAndSettle(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	files, dirs, err := s.scan()
+	if err != nil {
+		return err
+	}
+
+	err = s.push(ctx, files, dirs)
+	if err != nil {
+		return err
+	}
+
+	err = s.m.save(s.dir)
+	if err != nil {
+		return err
+	}
+
+	return s.pullAndSettle(ctx)
+}
+
+func (s *syncer) pullAndSettle(ctx context.Context) error {
+	err := s.pull(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.settle()
+	if err != nil {
+		return err
+	}
+
+	return s.m.save(s.dir)
+}
+
+// scan reads the markdown files in the synced directory, keyed by their
+// path relative to it, and lists its directories. Hidden files and
+// directories are left out.
+func (s *syncer) scan() (map[string]*localFile, map[string]bool, error) {
+	files := map[string]*localFile{}
+	dirs := map[string]bool{"": true}
+
+	err := filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			dirs[rel] = true
+			return nil
+		}
+
+		if !d.Type().IsRegular() || !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[rel] = &localFile{content: content, hash: hash(content)}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return files, dirs, nil
+}
+
+// push sends what changed locally since the last sync. A note whose file was
+// edited is updated, one whose file is gone is renamed or moved when a new
+// file with the same content turned up, deleted otherwise. New files become
+// notes, in new folders for new directories, and folders whose directories
+// are gone are deleted.
+func (s *syncer) push(ctx context.Context, files map[string]*localFile, dirs map[string]bool) error {
+	changes := []service.SyncChange{}
+	ops := []pushOp{}
+
+	tracked := map[string]bool{}
+	for _, note := range s.m.Notes {
+		if note.Path != "" {
+			tracked[note.Path] = true
+		}
+	}
+
+	// folders whose directory is gone, but not ones below another of those
+	deletedFolders := []int64{}
+	for id, folder := range s.m.Folders {
+		dir := s.m.folderPath(id)
+		if folder.ParentID == nil || dirs[dir] || !dirs[dirOrRoot(path.Dir(dir))] {
+			continue
+		}
+		deletedFolders = append(deletedFolders, id)
+	}
+	sort.Slice(deletedFolders, func(i, j int) bool { return deletedFolders[i] < deletedFolders[j] })
+
+	folderIDs := s.m.folderIDs()
+	createdDirs := map[string]string{}
+	// folderFor returns the folder of dir, creating it and the ones above it
+	// as needed
+	var folderFor func(dir string) (*int64, string)
+	folderFor = func(dir string) (*int64, string) {
+		if id, ok := folderIDs[dir]; ok {
+			return &id, ""
+		}
+		if client_id, ok := createdDirs[dir]; ok {
+			return nil, client_id
+		}
+
+		parent_id, parent_client_id := folderFor(dirOrRoot(path.Dir(dir)))
+		client_id := "dir:" + dir
+		changes = append(changes, service.SyncChange{
+			Op:             "create",
+			Type:           "folder",
+			ClientID:       client_id,
+			Name:           ptr(path.Base(dir)),
+			ParentID:       parent_id,
+			ParentClientID: parent_client_id,
+		})
+		ops = append(ops, pushOp{path: dir})
+		createdDirs[dir] = client_id
+		return nil, client_id
+	}
+
+	ids := make([]int64, 0, len(s.m.Notes))
+	for id := range s.m.Notes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	untracked := []string{}
+	for p := range files {
+		if !tracked[p] {
+			untracked = append(untracked, p)
+		}
+	}
+	sort.Strings(untracked)
+
+	claimed := map[string]bool{}
+	for _, id := range ids {
+		note := s.m.Notes[id]
+		if note.Path == "" {
+			continue
+		}
+
+		if file, ok := files[note.Path]; ok {
+			if file.hash != note.Hash {
+				changes = append(changes, service.SyncChange{
+					Op:          "update",
+					Type:        "note",
+					ID:          id,
+					BaseVersion: note.Version,
+					Note:        ptr(string(file.content)),
+				})
+				ops = append(ops, pushOp{id: id, path: note.Path, file: file})
+			}
+			continue
+		}
+
+		moved := ""
+		for _, p := range untracked {
+			if !claimed[p] && files[p].hash == note.Hash {
+				moved = p
+				break
+			}
+		}
+
+		if moved != "" {
+			claimed[moved] = true
+			folder_id, folder_client_id := folderFor(dirOrRoot(path.Dir(moved)))
+			changes = append(changes, service.SyncChange{
+				Op:             "update",
+				Type:           "note",
+				ID:             id,
+				BaseVersion:    note.Version,
+				Title:          ptr(strings.TrimSuffix(path.Base(moved), ".md")),
+				FolderID:       folder_id,
+				FolderClientID: folder_client_id,
+			})
+			ops = append(ops, pushOp{id: id, path: moved, file: files[moved]})
+			continue
+		}
+
+		inDeleted := false
+		for _, folder_id := range deletedFolders {
+			inDeleted = inDeleted || s.m.inFolder(note.FolderID, folder_id)
+		}
+		if !inDeleted {
+			changes = append(changes, service.SyncChange{
+				Op:          "delete",
+				Type:        "note",
+				ID:          id,
+				BaseVersion: note.Version,
+			})
+			ops = append(ops, pushOp{id: id, path: note.Path})
+		}
+	}
+
+	for _, p := range untracked {
+		if claimed[p] {
+			continue
+		}
+
+		folder_id, folder_client_id := folderFor(dirOrRoot(path.Dir(p)))
+		changes = append(changes, service.SyncChange{
+			Op:             "create",
+			Type:           "note",
+			ClientID:       "file:" + p,
+			Title:          ptr(strings.TrimSuffix(path.Base(p), ".md")),
+			Note:           ptr(string(files[p].content)),
+			FolderID:       folder_id,
+			FolderClientID: folder_client_id,
+		})
+		ops = append(ops, pushOp{path: p, file: files[p]})
+	}
+
+	for _, folder_id := range deletedFolders {
+		changes = append(changes, service.SyncChange{
+			Op:          "delete",
+			Type:        "folder",
+			ID:          folder_id,
+			BaseVersion: s.m.Seq,
+		})
+		ops = append(ops, pushOp{id: folder_id, path: s.m.folderPath(folder_id)})
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	results, err := s.remote.PostSync(ctx, changes)
+	if err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		if i < len(ops) {
+			s.applyResult(changes[i], ops[i], result)
+		}
+	}
+
+	return nil
+}
+
+// applyResult records in the manifest what became of a change.
+func (s *syncer) applyResult(change service.SyncChange, op pushOp, result service.SyncResult) {
+	if result.Status == service.SyncError {
+		fmt.Fprintf(s.out, "error: %s %s %s: %s\n", change.Op, change.Type, op.path, result.Error)
+		return
+	}
+
+	switch change.Type + "." + change.Op {
+	case "folder.create":
+		if result.Folder != nil {
+			s.m.Folders[result.Folder.ID] = &folderState{ParentID: result.Folder.ParentID, Name: result.Folder.Name}
+		}
+		s.report("created folder", op.path, result)
+
+	case "folder.delete":
+		if result.Status == service.SyncConflict {
+			// the folder changed, get all of it again
+			s.m.Seq = 0
+		} else {
+			s.removeFolder(op.id)
+		}
+		s.report("deleted folder", op.path, result)
+
+	case "note.create", "note.update":
+		if result.Note == nil {
+			// the note was deleted on the server, and edits to it were saved
+			// as a copy that comes with the next pull
+			if note, ok := s.m.Notes[op.id]; ok {
+				s.removed[op.id] = note
+				delete(s.m.Notes, op.id)
+			}
+			s.report("updated", op.path, result)
+			return
+		}
+
+		s.m.Notes[result.Note.ID] = &noteState{
+			FolderID: result.Note.FolderID,
+			Title:    result.Note.Title,
+			Version:  result.Note.Version,
+			Path:     op.path,
+			Hash:     op.file.hash,
+		}
+		if result.Conflict == service.ConflictStale {
+			// the server kept its text, the file's was saved as the copy
+			s.pending[result.Note.ID] = result.Note.Note
+		}
+		if change.Op == "create" {
+			s.report("created", op.path, result)
+		} else {
+			s.report("updated", op.path, result)
+		}
+
+	case "note.delete":
+		if result.Status == service.SyncConflict && result.Note != nil {
+			note := s.m.Notes[op.id]
+			note.FolderID = result.Note.FolderID
+			note.Title = result.Note.Title
+			note.Version = result.Note.Version
+			s.pending[op.id] = result.Note.Note
+		} else {
+			delete(s.m.Notes, op.id)
+		}
+		s.report("deleted", op.path, result)
+	}
+}
+
+func (s *syncer) report(action string, p string, result service.SyncResult) {
+	if result.Status != service.SyncConflict {
+		fmt.Fprintf(s.out, "%s %s\n", action, p)
+		return
+	}
+
+	switch result.Conflict {
+	case service.ConflictStale:
+		if result.Copy != nil {
+			fmt.Fprintf(s.out, "conflict: %s changed on the server, your version is saved as %q\n", p, result.Copy.Title)
+		} else {
+			fmt.Fprintf(s.out, "conflict: %s changed on the server, not deleted\n", p)
+		}
+	case service.ConflictDeleted:
+		if result.Copy != nil {
+			fmt.Fprintf(s.out, "conflict: %s was deleted on the server, your version is saved as %q\n", p, result.Copy.Title)
+		} else {
+			fmt.Fprintf(s.out, "conflict: %s was deleted on the server\n", p)
+		}
+	case service.ConflictDuplicate:
+		fmt.Fprintf(s.out, "conflict: %s clashed with another name on the server and was renamed\n", p)
+	}
+}
+
+// pull fetches the changes since the last sync into the manifest. Starting
+// over from change 0, whatever the new tree leaves out was removed.
+func (s *syncer) pull(ctx context.Context) error {
+	old := s.m
+	if s.m.Seq == 0 {
+		s.m = newManifest()
+		s.m.WorkspaceID = old.WorkspaceID
+	}
+
+	since := s.m.Seq
+	for {
+		changes, err := s.remote.GetSync(ctx, since, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, folder := range changes.Folders {
+			s.m.Folders[folder.ID] = &folderState{ParentID: folder.ParentID, Name: folder.Name}
+		}
+
+		for _, note := range changes.Notes {
+			if note.DeletedAt != nil {
+				s.removeNote(note.ID)
+				continue
+			}
+
+			state := &noteState{FolderID: note.FolderID, Title: note.Title, Version: note.Version}
+			prev, ok := s.m.Notes[note.ID]
+			if !ok {
+				prev, ok = old.Notes[note.ID]
+			}
+			if ok {
+				state.Path, state.Hash = prev.Path, prev.Hash
+			}
+			if !ok || prev.Version != note.Version || prev.Path == "" {
+				s.pending[note.ID] = note.Note.Note
+			}
+			s.m.Notes[note.ID] = state
+		}
+
+		for _, tombstone := range changes.Tombstones {
+			if tombstone.Type == "folder" {
+				s.removeFolder(tombstone.ID)
+			} else {
+				s.removeNote(tombstone.ID)
+			}
+		}
+
+		since = changes.Seq
+		if !changes.More {
+			break
+		}
+	}
+	s.m.Seq = since
+
+	if old != s.m {
+		for id, note := range old.Notes {
+			if _, ok := s.m.Notes[id]; !ok {
+				s.removed[id] = note
+			}
+		}
+		for id := range old.Folders {
+			if _, ok := s.m.Folders[id]; !ok {
+				s.removedDirs = append(s.removedDirs, old.folderPath(id))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *syncer) removeNote(id int64) {
+	if note, ok := s.m.Notes[id]; ok {
+		s.removed[id] = note
+		delete(s.m.Notes, id)
+	}
+	delete(s.pending, id)
+}
+
+// removeFolder drops a folder and everything in it from the manifest.
+func (s *syncer) removeFolder(folder_id int64) {
+	if _, ok := s.m.Folders[folder_id]; !ok {
+		return
+	}
+
+	for id, note := range s.m.Notes {
+		if s.m.inFolder(note.FolderID, folder_id) {
+			s.removeNote(id)
+		}
+	}
+
+	gone := []int64{}
+	for id := range s.m.Folders {
+		if s.m.inFolder(id, folder_id) {
+			gone = append(gone, id)
+			s.removedDirs = append(s.removedDirs, s.m.folderPath(id))
+		}
+	}
+	for _, id := range gone {
+		delete(s.m.Folders, id)
+	}
+}
+
+// settle brings the files in line with the manifest: files of removed notes
+// are deleted, moved notes are moved and changed ones written. Files that
+// were edited in the meantime are never overwritten or deleted. A file in
+// the way of a note is kept too, and the note written next to it as a
+// conflicted copy.
+func (s *syncer) settle() error {
+	for _, note := range s.removed {
+		if note.Path != "" && s.fileHash(note.Path) == note.Hash {
+			err := os.Remove(s.localPath(note.Path))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	s.removed = map[int64]*noteState{}
+
+	for id := range s.m.Folders {
+		err := os.MkdirAll(s.localPath(s.m.folderPath(id)), 0o755)
+		if err != nil {
+			return err
+		}
+	}
+
+	staging := filepath.Join(s.dir, stagingName)
+	err := os.MkdirAll(staging, 0o755)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	staged := map[int64]string{}
+	for id, note := range s.m.Notes {
+		if note.Path == "" || note.Path == s.m.notePath(note) {
+			continue
+		}
+
+		if s.fileHash(note.Path) != note.Hash {
+			// edited or removed since, leave it be and write the note anew
+			if _, ok := s.pending[id]; !ok {
+				note.Version = 0
+			}
+			note.Path = ""
+			continue
+		}
+
+		staged[id] = filepath.Join(staging, strconv.FormatInt(id, 10)+".md")
+		err = os.Rename(s.localPath(note.Path), staged[id])
+		if err != nil {
+			return err
+		}
+	}
+
+	ids := make([]int64, 0, len(s.m.Notes))
+	for id := range s.m.Notes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		note := s.m.Notes[id]
+		content, write := s.pending[id]
+		stagedPath, move := staged[id]
+		if !write && !move {
+			continue
+		}
+
+		if !write {
+			data, err := os.ReadFile(stagedPath)
+			if err != nil {
+				return err
+			}
+			content = string(data)
+		}
+
+		target := s.freePath(note, content)
+		if move && !write {
+			err = os.Rename(stagedPath, s.localPath(target))
+		} else {
+			err = os.WriteFile(s.localPath(target), []byte(content), 0o644)
+		}
+		if err != nil {
+			return err
+		}
+
+		if target != note.Path {
+			fmt.Fprintf(s.out, "pulled %s\n", target)
+		}
+		note.Path = target
+		note.Hash = hash([]byte(content))
+		delete(s.pending, id)
+	}
+
+	// deepest first, so parents are empty by the time they are removed
+	sort.Slice(s.removedDirs, func(i, j int) bool { return len(s.removedDirs[i]) > len(s.removedDirs[j]) })
+	for _, dir := range s.removedDirs {
+		if dir != "" {
+			os.Remove(s.localPath(dir))
+		}
+	}
+	s.removedDirs = nil
+
+	return nil
+}
+
+// freePath picks where to write a note's content: where it belongs, unless
+// another file is there. The note's own unchanged file and a file with the
+// same content don't count.
+func (s *syncer) freePath(note *noteState, content string) string {
+	want := s.m.notePath(note)
+	contentHash := hash([]byte(content))
+
+	for n := 0; ; n++ {
+		p := want
+		if n > 0 {
+			suffix := " (conflicted copy)"
+			if n > 1 {
+				suffix = fmt.Sprintf(" (conflicted copy %d)", n)
+			}
+			p = strings.TrimSuffix(want, ".md") + suffix + ".md"
+		}
+
+		existing := s.fileHash(p)
+		if existing == "" || existing == contentHash || (p == note.Path && existing == note.Hash) {
+			return p
+		}
+	}
+}
+
+// fileHash is the hash of the file at p, empty when there is none.
+func (s *syncer) fileHash(p string) string {
+	content, err := os.ReadFile(s.localPath(p))
+	if err != nil {
+		return ""
+	}
+
+	return hash(content)
+}
+
+func (s *syncer) localPath(p string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(p))
+}
+
+// dirOrRoot turns the "." path.Dir returns for top level paths into the
+// root's "".
+func dirOrRoot(dir string) string {
+	if dir == "." {
+		return ""
+	}
+
+	return dir
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
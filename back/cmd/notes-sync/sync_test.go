@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"io"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRemote keeps a folder tree in memory the way the sync API would.
+type fakeRemote struct {
+	seq        int64
+	nextID     int64
+	folders    map[int64]*store.SyncFolder
+	notes      map[int64]*store.SyncNote
+	tombstones []store.Tombstone
+	posted     [][]service.SyncChange
+}
+
+func newFakeRemote() *fakeRemote {
+	r := &fakeRemote{nextID: 1, folders: map[int64]*store.SyncFolder{}, notes: map[int64]*store.SyncNote{}}
+	r.addFolder(nil, "")
+	return r
+}
+
+func (r *fakeRemote) bump() int64 {
+	r.seq++
+	return r.seq
+}
+
+func (r *fakeRemote) addFolder(parent_id *int64, name string) *store.SyncFolder {
+	folder := &store.SyncFolder{Folder: store.Folder{ID: r.nextID, ParentID: parent_id, Name: name}, ChangeSeq: r.bump()}
+	r.nextID++
+	r.folders[folder.ID] = folder
+	return folder
+}
+
+func (r *fakeRemote) addNote(folder_id int64, title string, content string) *store.SyncNote {
+	note := &store.SyncNote{Note: store.Note{ID: r.nextID, FolderID: folder_id, Title: title, Note: content, Version: 1}, ChangeSeq: r.bump()}
+	r.nextID++
+	r.notes[note.ID] = note
+	return note
+}
+
+func (r *fakeRemote) updateNote(id int64, title *string, folder_id *int64, content *string) *store.SyncNote {
+	note := r.notes[id]
+	if title != nil {
+		note.Title = *title
+	}
+	if folder_id != nil {
+		note.FolderID = *folder_id
+	}
+	if content != nil {
+		note.Note.Note = *content
+		note.Version++
+	}
+	note.ChangeSeq = r.bump()
+	return note
+}
+
+func (r *fakeRemote) GetSync(ctx context.Context, since int64, limit int) (*store.SyncChanges, error) {
+	changes := &store.SyncChanges{Seq: r.seq}
+	for _, folder := range r.folders {
+		if folder.ChangeSeq > since {
+			changes.Folders = append(changes.Folders, *folder)
+		}
+	}
+	for _, note := range r.notes {
+		if note.ChangeSeq > since {
+			changes.Notes = append(changes.Notes, *note)
+		}
+	}
+	for _, tombstone := range r.tombstones {
+		if tombstone.ChangeSeq > since {
+			changes.Tombstones = append(changes.Tombstones, tombstone)
+		}
+	}
+
+	return changes, nil
+}
+
+func (r *fakeRemote) PostSync(ctx context.Context, changes []service.SyncChange) ([]service.SyncResult, error) {
+	r.posted = append(r.posted, changes)
+	clientIDs := map[string]int64{}
+	results := []service.SyncResult{}
+
+	for _, change := range changes {
+		result := service.SyncResult{ClientID: change.ClientID, Status: service.SyncAccepted}
+
+		switch change.Type + "." + change.Op {
+		case "folder.create":
+			parent_id := change.ParentID
+			if change.ParentClientID != "" {
+				id := clientIDs[change.ParentClientID]
+				parent_id = &id
+			}
+			folder := r.addFolder(parent_id, *change.Name)
+			clientIDs[change.ClientID] = folder.ID
+			result.Folder = &folder.Folder
+
+		case "note.create":
+			folder_id := clientIDs[change.FolderClientID]
+			if change.FolderID != nil {
+				folder_id = *change.FolderID
+			}
+			result.Note = &r.addNote(folder_id, *change.Title, *change.Note).Note
+
+		case "note.update":
+			note := r.notes[change.ID]
+			content := change.Note
+			if note.Version != change.BaseVersion && content != nil {
+				result.Status, result.Conflict = service.SyncConflict, service.ConflictStale
+				result.Copy = &r.addNote(note.FolderID, note.Title+" (conflicted copy)", *content).Note
+				content = nil
+			}
+			folder_id := change.FolderID
+			if change.FolderClientID != "" {
+				id := clientIDs[change.FolderClientID]
+				folder_id = &id
+			}
+			result.Note = &r.updateNote(change.ID, change.Title, folder_id, content).Note
+
+		case "note.delete":
+			note := r.notes[change.ID]
+			if note.Version != change.BaseVersion {
+				result.Status, result.Conflict = service.SyncConflict, service.ConflictStale
+				result.Note = &note.Note
+				break
+			}
+			delete(r.notes, change.ID)
+			r.tombstones = append(r.tombstones, store.Tombstone{Type: "note", ID: change.ID, FolderID: note.FolderID, ChangeSeq: r.bump()})
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (r *fakeRemote) noteTitled(title string) *store.SyncNote {
+	for _, note := range r.notes {
+		if note.Title == title {
+			return note
+		}
+	}
+
+	return nil
+}
+
+func readFile(t *testing.T, dir string, name string) string {
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func writeFile(t *testing.T, dir string, name string, content string) {
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+	assert.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	remote := newFakeRemote()
+	projects := remote.addFolder(ptr(int64(1)), "Projects")
+	plan := remote.addNote(projects.ID, "Plan", "v1")
+	todo := remote.addNote(1, "Todo", "milk")
+
+	// every run starts from the saved manifest, like the command does
+	sync := func() {
+		m, err := loadManifest(dir)
+		assert.NoError(t, err)
+		err = newSyncer(remote, dir, m, io.Discard).run(ctx)
+		assert.NoError(t, err)
+	}
+
+	t.Run("writes out the tree", func(t *testing.T) {
+		sync()
+		assert.Equal(t, "v1", readFile(t, dir, "Projects/Plan.md"))
+		assert.Equal(t, "milk", readFile(t, dir, "Todo.md"))
+		assert.Empty(t, remote.posted)
+	})
+
+	t.Run("pushes local edits against the synced version", func(t *testing.T) {
+		writeFile(t, dir, "Projects/Plan.md", "v2 local")
+		sync()
+
+		assert.Len(t, remote.posted, 1)
+		assert.Equal(t, []service.SyncChange{{
+			Op:          "update",
+			Type:        "note",
+			ID:          plan.ID,
+			BaseVersion: 1,
+			Note:        ptr("v2 local"),
+		}}, remote.posted[0])
+		assert.Equal(t, "v2 local", remote.notes[plan.ID].Note.Note)
+	})
+
+	t.Run("pulls remote edits and renames", func(t *testing.T) {
+		remote.updateNote(todo.ID, ptr("Shopping"), &projects.ID, ptr("milk, eggs"))
+		sync()
+
+		assert.NoFileExists(t, filepath.Join(dir, "Todo.md"))
+		assert.Equal(t, "milk, eggs", readFile(t, dir, "Projects/Shopping.md"))
+	})
+
+	t.Run("keeps both sides of a conflict", func(t *testing.T) {
+		remote.updateNote(plan.ID, nil, nil, ptr("v3 remote"))
+		writeFile(t, dir, "Projects/Plan.md", "v3 local")
+		sync()
+
+		assert.Equal(t, "v3 remote", readFile(t, dir, "Projects/Plan.md"))
+		assert.Equal(t, "v3 local", readFile(t, dir, "Projects/Plan (conflicted copy).md"))
+	})
+
+	t.Run("creates notes and folders for new files", func(t *testing.T) {
+		writeFile(t, dir, "Ideas/Later/Someday.md", "maybe")
+		sync()
+
+		note := remote.noteTitled("Someday")
+		assert.NotNil(t, note)
+		later := remote.folders[note.FolderID]
+		assert.Equal(t, "Later", later.Name)
+		assert.Equal(t, "Ideas", remote.folders[*later.ParentID].Name)
+		assert.Equal(t, int64(1), *remote.folders[*later.ParentID].ParentID)
+	})
+
+	t.Run("pushes local moves as renames", func(t *testing.T) {
+		shopping := remote.noteTitled("Shopping")
+		assert.NoError(t, os.Rename(filepath.Join(dir, "Projects", "Shopping.md"), filepath.Join(dir, "Groceries.md")))
+		sync()
+
+		assert.Equal(t, "Groceries", remote.notes[shopping.ID].Title)
+		assert.Equal(t, int64(1), remote.notes[shopping.ID].FolderID)
+		assert.Equal(t, "milk, eggs", remote.notes[shopping.ID].Note.Note)
+	})
+
+	t.Run("pushes and pulls deletes", func(t *testing.T) {
+		groceries := remote.noteTitled("Groceries")
+		assert.NoError(t, os.Remove(filepath.Join(dir, "Groceries.md")))
+		sync()
+		assert.NotContains(t, remote.notes, groceries.ID)
+
+		delete(remote.notes, plan.ID)
+		remote.tombstones = append(remote.tombstones, store.Tombstone{Type: "note", ID: plan.ID, ChangeSeq: remote.bump()})
+		sync()
+		assert.NoFileExists(t, filepath.Join(dir, "Projects", "Plan.md"))
+	})
+}
+
+func TestNotePath(t *testing.T) {
+	root := int64(1)
+	m := newManifest()
+	m.Folders[root] = &folderState{}
+	m.Folders[2] = &folderState{ParentID: &root, Name: `..\..\evil`}
+	m.Folders[3] = &folderState{ParentID: &root, Name: ".hidden"}
+
+	tests := []struct {
+		note *noteState
+		want string
+	}{
+		{note: &noteState{FolderID: root, Title: "Plan"}, want: "Plan.md"},
+		{note: &noteState{FolderID: root, Title: "a/b: c?"}, want: "a-b- c-.md"},
+		{note: &noteState{FolderID: root, Title: "CON"}, want: "CON_.md"},
+		{note: &noteState{FolderID: root, Title: "bell\a"}, want: "bell.md"},
+		{note: &noteState{FolderID: 2, Title: "x"}, want: "-..-evil/x.md"},
+		{note: &noteState{FolderID: 3, Title: ".notes-sync"}, want: "hidden/notes-sync.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, m.notePath(tt.note))
+		})
+	}
+}
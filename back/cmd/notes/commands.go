@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"markdown-notes/client"
+	"markdown-notes/internal/store"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+// newFlags returns a flag set for a command that reports errors instead of
+// exiting.
+func newFlags(usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(usage, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: notes %s\n", usage)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// parseArgs parses a command's flags and checks it got between min and max
+// arguments.
+func parseArgs(flags *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags.NArg() < min || flags.NArg() > max {
+		flags.Usage()
+		return nil, flag.ErrHelp
+	}
+
+	return flags.Args(), nil
+}
+
+func login(ctx context.Context, cfg *config, p string, args []string) error {
+	flags := newFlags("login [-server URL] USERNAME")
+	server := flags.String("server", cfg.Server, "URL of the notes API")
+	args, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if *server == "" {
+		*server = defaultServer
+	}
+
+	password := os.Getenv("NOTES_PASSWORD")
+	if password == "" {
+		fmt.Fprint(os.Stderr, "password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	c := client.New(*server)
+	err = c.Login(ctx, args[0], password)
+	if err != nil {
+		return err
+	}
+
+	cfg.Server = *server
+	cfg.Token = c.Token()
+	return cfg.save(p)
+}
+
+func (c *cli) ls(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlags("ls [PATH]"), args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	p := ""
+	if len(args) == 1 {
+		p = args[0]
+	}
+
+	folder, note, parent, err := c.lookup(ctx, p)
+	if err != nil {
+		return err
+	}
+	if note != nil {
+		fmt.Fprintln(c.stdout, note.Title)
+		return nil
+	}
+
+	content := parent
+	if folder != nil {
+		content, err = c.api.GetFolderContent(ctx, folder.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	names := []string{}
+	for _, folder := range content.Folders {
+		names = append(names, folder.Name+"/")
+	}
+	sort.Strings(names)
+
+	titles := []string{}
+	for _, note := range content.Notes {
+		titles = append(titles, note.Title)
+	}
+	sort.Strings(titles)
+
+	for _, name := range append(names, titles...) {
+		fmt.Fprintln(c.stdout, name)
+	}
+
+	return nil
+}
+
+func (c *cli) cat(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlags("cat PATH"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	note, err := c.note(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(c.stdout, note.Note)
+	return err
+}
+
+// edit opens a note in $EDITOR and saves it if it changed. If someone else
+// saved the note while it was open nothing is overwritten, the edit is kept
+// in its temporary file to merge by hand.
+func (c *cli) edit(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlags("edit PATH"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	note, err := c.note(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	edited, tmp, err := c.editText(note.Note)
+	if err != nil {
+		return err
+	}
+
+	if edited == note.Note {
+		os.Remove(tmp)
+		fmt.Fprintln(c.stdout, "no changes")
+		return nil
+	}
+
+	_, err = c.api.PatchNote(ctx, note.ID, store.NoteUpdate{Note: &edited, IfVersion: &note.Version})
+	if client.IsStatus(err, http.StatusPreconditionFailed) {
+		return fmt.Errorf("%s was changed by someone else while you edited it, your version is in %s", args[0], tmp)
+	}
+	if err != nil {
+		return fmt.Errorf("%w, your version is in %s", err, tmp)
+	}
+
+	os.Remove(tmp)
+	return nil
+}
+
+// newNote creates a note, or a folder for a path ending in "/". The note's
+// text is read from stdin when it isn't a terminal, otherwise it is written
+// in $EDITOR.
+func (c *cli) newNote(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlags("new PATH"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	dir, name := splitPath(args[0])
+	if name == "" {
+		return errors.New("the root folder exists already")
+	}
+
+	parent, err := c.folder(ctx, path.Join(dir...))
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(args[0], "/") {
+		_, err = c.api.CreateFolder(ctx, parent.FolderID, name)
+		return err
+	}
+
+	if f, ok := c.stdin.(*os.File); !ok || !isTerminal(f) {
+		text, err := io.ReadAll(c.stdin)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.api.CreateNote(ctx, parent.FolderID, strings.TrimSuffix(name, ".md"), string(text))
+		return err
+	}
+
+	text, tmp, err := c.editText("")
+	if err != nil {
+		return err
+	}
+
+	_, err = c.api.CreateNote(ctx, parent.FolderID, strings.TrimSuffix(name, ".md"), text)
+	if err != nil {
+		return fmt.Errorf("%w, the text is in %s", err, tmp)
+	}
+
+	os.Remove(tmp)
+	return nil
+}
+
+// mv renames a note or a folder, and moves it when the new path is in
+// another folder. A new path naming a folder moves it into that folder.
+func (c *cli) mv(ctx context.Context, args []string) error {
+	args, err := parseArgs(newFlags("mv PATH NEWPATH"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	folder, note, parent, err := c.lookup(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if folder == nil && note == nil {
+		return errors.New("the root folder can't be moved")
+	}
+
+	dir, name := splitPath(args[1])
+	target, err := c.folder(ctx, path.Join(append(dir, name)...))
+	if err == nil {
+		// into an existing folder, keeping the name
+		name = ""
+	} else {
+		target, err = c.folder(ctx, path.Join(dir...))
+		if err != nil {
+			return err
+		}
+	}
+
+	var moveTo *int64
+	if target.FolderID != parent.FolderID {
+		moveTo = &target.FolderID
+	}
+
+	if folder != nil {
+		var rename *string
+		if name != "" && name != folder.Name {
+			rename = &name
+		}
+		if rename == nil && moveTo == nil {
+			return nil
+		}
+
+		_, err = c.api.PatchFolder(ctx, folder.ID, rename, moveTo)
+		return err
+	}
+
+	var rename *string
+	if title := strings.TrimSuffix(name, ".md"); title != "" && title != note.Title {
+		rename = &title
+	}
+	if rename == nil && moveTo == nil {
+		return nil
+	}
+
+	_, err = c.api.PatchNote(ctx, note.ID, store.NoteUpdate{Title: rename, FolderID: moveTo})
+	return err
+}
+
+// rm moves a note to the trash, or deletes a folder and everything in it
+// with -r.
+func (c *cli) rm(ctx context.Context, args []string) error {
+	flags := newFlags("rm [-r] PATH")
+	recursive := flags.Bool("r", false, "delete a folder with everything in it")
+	args, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	folder, note, _, err := c.lookup(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case note != nil:
+		_, err = c.api.DeleteNote(ctx, note.ID)
+		return err
+	case folder == nil:
+		return errors.New("the root folder can't be deleted")
+	case !*recursive:
+		return fmt.Errorf("%s is a folder, use -r to delete it with everything in it", args[0])
+	default:
+		return c.api.DeleteFolder(ctx, folder.ID)
+	}
+}
+
+func (c *cli) search(ctx context.Context, args []string) error {
+	flags := newFlags("search [-n LIMIT] QUERY")
+	limit := flags.Int("n", 20, "how many notes to show at most")
+	args, err := parseArgs(flags, args, 1, 1<<16)
+	if err != nil {
+		return err
+	}
+
+	query := strings.Join(args, " ")
+	shown := 0
+	cursor := 0
+	for shown < *limit {
+		hits, next, err := c.api.SearchNotes(ctx, query, min(*limit-shown, 100), cursor)
+		if err != nil {
+			return err
+		}
+
+		for _, hit := range hits {
+			fmt.Fprintf(c.stdout, "%s\n", path.Join(hit.FolderPath, unmark(hit.Title)))
+			if snippet := strings.Join(strings.Fields(unmark(hit.Snippet)), " "); snippet != "" {
+				fmt.Fprintf(c.stdout, "    %s\n", snippet)
+			}
+		}
+		shown += len(hits)
+
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	return nil
+}
+
+// unmark drops the <mark> tags search wraps matches in and unescapes the rest.
+func unmark(s string) string {
+	return html.UnescapeString(strings.NewReplacer("<mark>", "", "</mark>", "").Replace(s))
+}
+
+// export downloads a zip of the markdown files in a folder, the root folder
+// by default. The zip is named after the folder unless -o says otherwise,
+// "-" writes it to stdout.
+func (c *cli) export(ctx context.Context, args []string) error {
+	flags := newFlags("export [-o FILE] [PATH]")
+	out := flags.String("o", "", "file to write the zip to")
+	args, err := parseArgs(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	p := ""
+	if len(args) == 1 {
+		p = args[0]
+	}
+
+	_, name := splitPath(p)
+	content, err := c.folder(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		if name == "" {
+			name = "notes"
+		}
+		*out = name + ".zip"
+	}
+
+	zip, err := c.api.ExportFolder(ctx, content.FolderID)
+	if err != nil {
+		return err
+	}
+	defer zip.Close()
+
+	if *out == "-" {
+		_, err = io.Copy(c.stdout, zip)
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, zip)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "exported %s\n", *out)
+	return nil
+}
+
+// editText opens text in the editor and returns what it was changed to,
+// along with the temporary file it was edited in for the caller to remove.
+func (c *cli) editText(text string) (string, string, error) {
+	f, err := os.CreateTemp("", "notes-*.md")
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = f.WriteString(text)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+
+	err = c.editor(f.Name())
+	if err != nil {
+		return "", f.Name(), fmt.Errorf("editor: %w, the text is in %s", err, f.Name())
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", f.Name(), err
+	}
+
+	return string(data), f.Name(), nil
+}
+
+// runEditor runs $VISUAL or $EDITOR, vi if neither is set, through the
+// shell so they can have arguments like "code --wait".
+func runEditor(p string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", p)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
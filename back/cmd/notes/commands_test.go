@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"markdown-notes/client"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAPI serves a folder tree from memory. Methods the tests don't need
+// panic through the nil api it embeds.
+type fakeAPI struct {
+	api
+	folders map[int64]*store.Folder
+	notes   map[int64]*store.Note
+}
+
+func newFakeAPI() *fakeAPI {
+	f := &fakeAPI{folders: map[int64]*store.Folder{}, notes: map[int64]*store.Note{}}
+	root := int64(1)
+	projects := int64(2)
+	f.folders[1] = &store.Folder{ID: 1}
+	f.folders[2] = &store.Folder{ID: 2, ParentID: &root, Name: "Projects"}
+	f.folders[3] = &store.Folder{ID: 3, ParentID: &projects, Name: "Archive"}
+	f.notes[10] = &store.Note{ID: 10, FolderID: 2, Title: "Plan", Note: "v1", Version: 1}
+	f.notes[11] = &store.Note{ID: 11, FolderID: 1, Title: "Todo", Note: "milk", Version: 1}
+	return f
+}
+
+func (f *fakeAPI) GetRootFolderContent(ctx context.Context) (*service.FolderContent, error) {
+	return f.GetFolderContent(ctx, 1)
+}
+
+func (f *fakeAPI) GetFolderContent(ctx context.Context, folder_id int64) (*service.FolderContent, error) {
+	content := &service.FolderContent{FolderID: folder_id, Notes: []store.Note{}, Folders: []store.Folder{}}
+	for _, folder := range f.folders {
+		if folder.ParentID != nil && *folder.ParentID == folder_id {
+			content.Folders = append(content.Folders, *folder)
+		}
+	}
+	for _, note := range f.notes {
+		if note.FolderID == folder_id {
+			content.Notes = append(content.Notes, *note)
+		}
+	}
+
+	return content, nil
+}
+
+func (f *fakeAPI) GetNote(ctx context.Context, note_id int64) (*store.Note, error) {
+	note := *f.notes[note_id]
+	return &note, nil
+}
+
+func (f *fakeAPI) PatchNote(ctx context.Context, note_id int64, update store.NoteUpdate) (*store.Note, error) {
+	note := f.notes[note_id]
+	if update.IfVersion != nil && *update.IfVersion != note.Version {
+		return nil, &client.Error{StatusCode: http.StatusPreconditionFailed, Message: "note was changed"}
+	}
+
+	if update.Title != nil {
+		note.Title = *update.Title
+	}
+	if update.FolderID != nil {
+		note.FolderID = *update.FolderID
+	}
+	if update.Note != nil {
+		note.Note = *update.Note
+		note.Version++
+	}
+
+	return note, nil
+}
+
+func (f *fakeAPI) PatchFolder(ctx context.Context, folder_id int64, name *string, parent_id *int64) (*store.Folder, error) {
+	folder := f.folders[folder_id]
+	if name != nil {
+		folder.Name = *name
+	}
+	if parent_id != nil {
+		folder.ParentID = parent_id
+	}
+
+	return folder, nil
+}
+
+func newTestCLI(f *fakeAPI) (*cli, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &cli{api: f, stdin: strings.NewReader(""), stdout: out}, out
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"", nil},
+		{"/", nil},
+		{"Projects", []string{"Projects"}},
+		{"/Projects/Plan", []string{"Projects", "Plan"}},
+		{"Projects//Plan/", []string{"Projects", "Plan"}},
+		{"../Projects/./Plan", []string{"Projects", "Plan"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, cleanPath(tt.path))
+		})
+	}
+}
+
+func TestLs(t *testing.T) {
+	ctx := context.Background()
+	c, out := newTestCLI(newFakeAPI())
+
+	assert.NoError(t, c.ls(ctx, nil))
+	assert.Equal(t, "Projects/\nTodo\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, c.ls(ctx, []string{"/Projects/"}))
+	assert.Equal(t, "Archive/\nPlan\n", out.String())
+
+	assert.EqualError(t, c.ls(ctx, []string{"Nope/Plan"}), "Nope: no such folder")
+	assert.EqualError(t, c.ls(ctx, []string{"Projects/Nope"}), "Projects/Nope: no such note or folder")
+}
+
+func TestCat(t *testing.T) {
+	ctx := context.Background()
+	c, out := newTestCLI(newFakeAPI())
+
+	assert.NoError(t, c.cat(ctx, []string{"Projects/Plan.md"}))
+	assert.Equal(t, "v1", out.String())
+
+	assert.EqualError(t, c.cat(ctx, []string{"Projects/Archive"}), "Projects/Archive: no such note")
+}
+
+func TestEdit(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("saves against the version it opened", func(t *testing.T) {
+		f := newFakeAPI()
+		c, _ := newTestCLI(f)
+		c.editor = func(p string) error {
+			return os.WriteFile(p, []byte("v2"), 0o644)
+		}
+
+		assert.NoError(t, c.edit(ctx, []string{"Projects/Plan"}))
+		assert.Equal(t, "v2", f.notes[10].Note)
+		assert.Equal(t, int64(2), f.notes[10].Version)
+	})
+
+	t.Run("keeps the edit when the note changed meanwhile", func(t *testing.T) {
+		f := newFakeAPI()
+		c, _ := newTestCLI(f)
+		var tmp string
+		c.editor = func(p string) error {
+			tmp = p
+			f.notes[10].Note = "v2 from someone else"
+			f.notes[10].Version++
+			return os.WriteFile(p, []byte("v2 from me"), 0o644)
+		}
+
+		err := c.edit(ctx, []string{"Projects/Plan"})
+		assert.ErrorContains(t, err, "changed by someone else")
+		assert.ErrorContains(t, err, tmp)
+		assert.Equal(t, "v2 from someone else", f.notes[10].Note)
+
+		kept, err := os.ReadFile(tmp)
+		assert.NoError(t, err)
+		assert.Equal(t, "v2 from me", string(kept))
+		os.Remove(tmp)
+	})
+}
+
+func TestMv(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeAPI()
+	c, _ := newTestCLI(f)
+
+	assert.NoError(t, c.mv(ctx, []string{"Todo", "Projects/Archive"}))
+	assert.Equal(t, int64(3), f.notes[11].FolderID)
+	assert.Equal(t, "Todo", f.notes[11].Title)
+
+	assert.NoError(t, c.mv(ctx, []string{"Projects/Archive/Todo", "/Shopping.md"}))
+	assert.Equal(t, int64(1), f.notes[11].FolderID)
+	assert.Equal(t, "Shopping", f.notes[11].Title)
+
+	assert.NoError(t, c.mv(ctx, []string{"Projects/Archive", "Old"}))
+	assert.Equal(t, int64(1), *f.folders[3].ParentID)
+	assert.Equal(t, "Old", f.folders[3].Name)
+}
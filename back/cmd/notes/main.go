@@ -0,0 +1,155 @@
+// Command notes works with notes from the command line. Notes and folders
+// are named by their path from the workspace's root folder, like
+// "Projects/Plan".
+//
+//	notes login [-server URL] USERNAME
+//	notes ls [PATH]
+//	notes cat PATH
+//	notes edit PATH
+//	notes new PATH
+//	notes mv PATH NEWPATH
+//	notes rm [-r] PATH
+//	notes search [-n LIMIT] QUERY
+//	notes export [-o FILE] [PATH]
+//
+// login keeps the server and the token in notes/config.json in the user's
+// config directory, or in NOTES_CONFIG. NOTES_SERVER and NOTES_TOKEN take
+// precedence over it, -workspace picks a workspace other than the personal
+// one.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"markdown-notes/client"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"net/http"
+	"os"
+	"os/signal"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// api is the part of client.Client the commands use.
+type api interface {
+	GetRootFolderContent(ctx context.Context) (*service.FolderContent, error)
+	GetFolderContent(ctx context.Context, folder_id int64) (*service.FolderContent, error)
+	CreateFolder(ctx context.Context, parent_id int64, name string) (*store.Folder, error)
+	PatchFolder(ctx context.Context, folder_id int64, name *string, parent_id *int64) (*store.Folder, error)
+	DeleteFolder(ctx context.Context, folder_id int64) error
+	ExportFolder(ctx context.Context, folder_id int64) (io.ReadCloser, error)
+	GetNote(ctx context.Context, note_id int64) (*store.Note, error)
+	CreateNote(ctx context.Context, folder_id int64, title string, note string) (*store.Note, error)
+	PatchNote(ctx context.Context, note_id int64, update store.NoteUpdate) (*store.Note, error)
+	DeleteNote(ctx context.Context, note_id int64) (*store.Note, error)
+	SearchNotes(ctx context.Context, query string, limit int, cursor int) ([]store.SearchHit, int, error)
+}
+
+type cli struct {
+	api    api
+	stdin  io.Reader
+	stdout io.Writer
+	// editor opens a file in the user's editor and waits for it to close
+	editor func(path string) error
+}
+
+type command struct {
+	usage string
+	run   func(c *cli, ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"ls":     {"ls [PATH]", (*cli).ls},
+	"cat":    {"cat PATH", (*cli).cat},
+	"edit":   {"edit PATH", (*cli).edit},
+	"new":    {"new PATH", (*cli).newNote},
+	"mv":     {"mv PATH NEWPATH", (*cli).mv},
+	"rm":     {"rm [-r] PATH", (*cli).rm},
+	"search": {"search [-n LIMIT] QUERY", (*cli).search},
+	"export": {"export [-o FILE] [PATH]", (*cli).export},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: notes [-workspace ID] COMMAND [ARGS]\n\ncommands:\n")
+	fmt.Fprintf(os.Stderr, "  login [-server URL] USERNAME\n")
+	for _, name := range []string{"ls", "cat", "edit", "new", "mv", "rm", "search", "export"} {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
+
+func main() {
+	workspace := flag.Int64("workspace", 0, "workspace to work in, the personal one by default")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, *workspace, flag.Arg(0), flag.Args()[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "notes: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, workspace_id int64, name string, args []string) error {
+	p, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(p)
+	if err != nil {
+		return err
+	}
+
+	if name == "login" {
+		return login(ctx, cfg, p, args)
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		return flag.ErrHelp
+	}
+
+	server := cfg.Server
+	if env := os.Getenv("NOTES_SERVER"); env != "" {
+		server = env
+	}
+	if server == "" {
+		server = defaultServer
+	}
+
+	token := cfg.Token
+	if env := os.Getenv("NOTES_TOKEN"); env != "" {
+		token = env
+	}
+	if token == "" {
+		return errors.New("not logged in, run notes login first")
+	}
+
+	api := client.New(server)
+	api.SetToken(token)
+	api.SetWorkspace(workspace_id)
+
+	c := &cli{api: api, stdin: os.Stdin, stdout: os.Stdout, editor: runEditor}
+	err = cmd.run(c, ctx, args)
+	if client.IsStatus(err, http.StatusUnauthorized) {
+		return fmt.Errorf("%w, the token may have expired, run notes login again", err)
+	}
+
+	return err
+}
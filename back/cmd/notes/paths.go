@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"path"
+	"strings"
+)
+
+// cleanPath turns a path like "Projects/Plan", "/Projects/Plan.md" or
+// "Projects/" into its names below the root folder.
+func cleanPath(p string) []string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimPrefix(p, "/"), "/")
+}
+
+// splitPath splits a path into its folder's names and its last name, which
+// is empty for the root folder.
+func splitPath(p string) ([]string, string) {
+	names := cleanPath(p)
+	if len(names) == 0 {
+		return nil, ""
+	}
+
+	return names[:len(names)-1], names[len(names)-1]
+}
+
+// findFolder and findNote look up an entry of a folder by name. A note can
+// also be named with a .md suffix, like its file in an export.
+func findFolder(content *service.FolderContent, name string) *store.Folder {
+	for i := range content.Folders {
+		if content.Folders[i].Name == name {
+			return &content.Folders[i]
+		}
+	}
+
+	return nil
+}
+
+func findNote(content *service.FolderContent, name string) *store.Note {
+	for _, title := range []string{name, strings.TrimSuffix(name, ".md")} {
+		for i := range content.Notes {
+			if content.Notes[i].Title == title {
+				return &content.Notes[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// folder returns the content of the folder at p.
+func (c *cli) folder(ctx context.Context, p string) (*service.FolderContent, error) {
+	content, err := c.api.GetRootFolderContent(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, name := range cleanPath(p) {
+		folder := findFolder(content, name)
+		if folder == nil {
+			return nil, fmt.Errorf("%s: no such folder", path.Join(cleanPath(p)[:i+1]...))
+		}
+
+		content, err = c.api.GetFolderContent(ctx, folder.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return content, nil
+}
+
+// lookup finds what p names: a folder or a note, folders first when a
+// folder and a note have the same name. The content of the folder it is in
+// comes along, for the root folder that is the root folder itself.
+func (c *cli) lookup(ctx context.Context, p string) (*store.Folder, *store.Note, *service.FolderContent, error) {
+	dir, name := splitPath(p)
+	parent, err := c.folder(ctx, path.Join(dir...))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if name == "" {
+		return nil, nil, parent, nil
+	}
+
+	if folder := findFolder(parent, name); folder != nil {
+		return folder, nil, parent, nil
+	}
+	if note := findNote(parent, name); note != nil {
+		return nil, note, parent, nil
+	}
+
+	return nil, nil, nil, fmt.Errorf("%s: no such note or folder", path.Join(cleanPath(p)...))
+}
+
+// note returns the note at p as it is now.
+func (c *cli) note(ctx context.Context, p string) (*store.Note, error) {
+	dir, name := splitPath(p)
+	parent, err := c.folder(ctx, path.Join(dir...))
+	if err != nil {
+		return nil, err
+	}
+
+	note := findNote(parent, name)
+	if note == nil {
+		return nil, fmt.Errorf("%s: no such note", path.Join(cleanPath(p)...))
+	}
+
+	return c.api.GetNote(ctx, note.ID)
+}
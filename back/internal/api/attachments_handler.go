@@ -0,0 +1,252 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"markdown-notes/internal/exif"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/thumbnail"
+	"markdown-notes/internal/utils"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxAttachmentSize = 25 << 20
+
+func httpStatusFromAttachmentError(err error) int {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrForbidden):
+		return http.StatusForbidden
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrThumbnailSize),
+		errors.Is(err, thumbnail.ErrUnsupported),
+		errors.Is(err, exif.ErrUnsupported),
+		errors.Is(err, exif.ErrMalformed):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// attachmentDisposition serves types a browser can show safely inline and
+// makes everything else, HTML and SVG included, a download.
+func attachmentDisposition(attachment *store.Attachment) string {
+	mediaType, _, _ := mime.ParseMediaType(attachment.ContentType)
+
+	disposition := "attachment"
+	switch {
+	case mediaType == "image/png", mediaType == "image/jpeg", mediaType == "image/gif", mediaType == "image/webp":
+		disposition = "inline"
+	case mediaType == "application/pdf", mediaType == "text/plain":
+		disposition = "inline"
+	case strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		disposition = "inline"
+	}
+
+	return mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename})
+}
+
+type AttachmentsHandler struct {
+	attachmentsService service.AttachmentsServiceI
+	thumbnailService   service.ThumbnailServiceI
+	logger             *log.Logger
+}
+
+func NewAttachmentsHandler(
+	attachmentsService service.AttachmentsServiceI,
+	thumbnailService service.ThumbnailServiceI,
+	logger *log.Logger,
+) *AttachmentsHandler {
+	return &AttachmentsHandler{
+		attachmentsService: attachmentsService,
+		thumbnailService:   thumbnailService,
+		logger:             logger,
+	}
+}
+
+func (h *AttachmentsHandler) HandleUploadAttachment(c echo.Context) error {
+	var req getNoteRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxAttachmentSize)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		if status := httpStatusFromAttachmentError(err); status == http.StatusRequestEntityTooLarge {
+			return c.JSON(status, utils.Envelope{"error": fmt.Sprintf("attachments can be at most %d bytes", maxAttachmentSize)})
+		}
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": "file is required"})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		h.logger.Printf("ERROR: opening uploaded file %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+	defer file.Close()
+
+	user := c.Get("user").(*store.User)
+	attachment, err := h.attachmentsService.UploadAttachment(user, req.NoteID, fileHeader.Filename, file)
+	if err != nil {
+		status := httpStatusFromAttachmentError(err)
+		switch status {
+		case http.StatusNotFound:
+			return c.JSON(status, utils.Envelope{"error": "note doesn't exist or you don't have access to it"})
+		case http.StatusForbidden:
+			return c.JSON(status, utils.Envelope{"error": err.Error()})
+		case http.StatusRequestEntityTooLarge:
+			return c.JSON(status, utils.Envelope{"error": fmt.Sprintf("attachments can be at most %d bytes", maxAttachmentSize)})
+		}
+		h.logger.Printf("ERROR: uploading attachment %v", err)
+		return c.JSON(status, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusCreated, attachment)
+}
+
+func (h *AttachmentsHandler) HandleGetNoteAttachments(c echo.Context) error {
+	var req getNoteRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	attachments, err := h.attachmentsService.GetNoteAttachments(user, req.NoteID)
+	if err != nil {
+		status := httpStatusFromAttachmentError(err)
+		if status == http.StatusNotFound {
+			return c.JSON(status, utils.Envelope{"error": "note doesn't exist or you don't have access to it"})
+		}
+		h.logger.Printf("ERROR: getting note attachments %v", err)
+		return c.JSON(status, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"attachments": attachments})
+}
+
+type getAttachmentRequest struct {
+	AttachmentID int64  `param:"attachment_id"`
+	Size         string `query:"size"`
+}
+
+func (r *getAttachmentRequest) validate() error {
+	if r.AttachmentID <= 0 {
+		return errors.New("invalid attachment_id")
+	}
+
+	return nil
+}
+
+// attachmentError writes the response for an error from the attachment or
+// thumbnail services.
+func (h *AttachmentsHandler) attachmentError(c echo.Context, err error, action string) error {
+	status := httpStatusFromAttachmentError(err)
+	switch status {
+	case http.StatusNotFound:
+		return c.JSON(status, utils.Envelope{"error": "attachment doesn't exist or you don't have access to it"})
+	case http.StatusBadRequest, http.StatusForbidden:
+		return c.JSON(status, utils.Envelope{"error": err.Error()})
+	}
+
+	h.logger.Printf("ERROR: %s %v", action, err)
+	return c.JSON(status, utils.Envelope{"error": "internal server error"})
+}
+
+// HandleGetAttachment streams an attachment's content, or one of its
+// thumbnails when a size is given, honouring Range and conditional request
+// headers.
+func (h *AttachmentsHandler) HandleGetAttachment(c echo.Context) error {
+	var req getAttachmentRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+
+	if req.Size != "" {
+		thumb, content, err := h.thumbnailService.OpenThumbnail(user, req.AttachmentID, req.Size)
+		if err != nil {
+			return h.attachmentError(c, err, "opening thumbnail")
+		}
+		defer content.Close()
+
+		serveBlob(c, thumb.ContentType, "inline", thumb.SHA256, thumb.CreatedAt, content)
+		return nil
+	}
+
+	attachment, content, err := h.attachmentsService.OpenAttachment(user, req.AttachmentID)
+	if err != nil {
+		return h.attachmentError(c, err, "opening attachment")
+	}
+	defer content.Close()
+
+	serveBlob(c, attachment.ContentType, attachmentDisposition(attachment), attachment.SHA256, attachment.CreatedAt, content)
+	return nil
+}
+
+func serveBlob(c echo.Context, contentType string, disposition string, key string, modtime time.Time, content io.ReadSeeker) {
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, contentType)
+	header.Set(echo.HeaderContentDisposition, disposition)
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	header.Set("Content-Security-Policy", "sandbox")
+	header.Set("ETag", fmt.Sprintf(`"%s"`, key))
+	// stripping location changes what an attachment id serves, so clients
+	// revalidate against the ETag rather than caching blindly
+	header.Set("Cache-Control", "private, no-cache")
+
+	http.ServeContent(c.Response(), c.Request(), "", modtime, content)
+}
+
+func (h *AttachmentsHandler) HandleStripLocation(c echo.Context) error {
+	var req getAttachmentRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	attachment, err := h.attachmentsService.StripLocation(user, req.AttachmentID)
+	if err != nil {
+		return h.attachmentError(c, err, "stripping attachment location")
+	}
+
+	return c.JSON(http.StatusOK, attachment)
+}
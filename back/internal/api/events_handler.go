@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"markdown-notes/internal/events"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// eventsBatch is how many events are read from the log at a time.
+const eventsBatch = 100
+
+// keepAliveInterval is how often an idle stream sends a comment, so proxies
+// don't close it.
+const keepAliveInterval = 30 * time.Second
+
+type EventsHandler struct {
+	eventsStore store.EventsStore
+	broker      *events.Broker
+	logger      *log.Logger
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewEventsHandler(eventsStore store.EventsStore, broker *events.Broker, logger *log.Logger) *EventsHandler {
+	return &EventsHandler{
+		eventsStore: eventsStore,
+		broker:      broker,
+		logger:      logger,
+		done:        make(chan struct{}),
+	}
+}
+
+// Close ends every stream. Streams never finish on their own, so the server
+// calls this when it shuts down instead of waiting for them.
+func (h *EventsHandler) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// HandleEvents streams changes to notes and folders the user can see as
+// Server-Sent Events, each one with the store.Event as data and its type as
+// the event name. A reconnecting EventSource sends the Last-Event-ID header
+// and gets everything it missed, the last_event_id query parameter does the
+// same for the first connection. Without either only new changes are sent.
+// When the events it missed were pruned already, the stream starts with a
+// "reset" event instead, and the client has to load everything again before
+// applying the changes that follow.
+func (h *EventsHandler) HandleEvents(c echo.Context) error {
+	lastID := c.Request().Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.QueryParam("last_event_id")
+	}
+
+	var after_id int64
+	if lastID != "" {
+		var err error
+		after_id, err = strconv.ParseInt(lastID, 10, 64)
+		if err != nil || after_id < 0 {
+			return c.JSON(http.StatusBadRequest, utils.Envelope{"error": "invalid last event id"})
+		}
+	}
+
+	user := c.Get("user").(*store.User)
+	workspace_id := workspaceID(c)
+
+	// subscribed before reading the log, so nothing logged in between is missed
+	wake, unsubscribe := h.broker.Subscribe(workspace_id)
+	defer unsubscribe()
+
+	reset := false
+	if lastID != "" {
+		first, err := h.eventsStore.GetFirstEventID()
+		if err != nil {
+			h.logger.Printf("ERROR: getting first event id %v", err)
+			return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		}
+		reset = after_id < first-1
+	}
+
+	if lastID == "" || reset {
+		var err error
+		after_id, err = h.eventsStore.GetLastEventID()
+		if err != nil {
+			h.logger.Printf("ERROR: getting last event id %v", err)
+			return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	if reset {
+		data, err := json.Marshal(store.Event{ID: after_id, Type: store.EventReset, CreatedAt: time.Now()})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", after_id, store.EventReset, data)
+	}
+	res.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	ctx := c.Request().Context()
+	for {
+		for {
+			batch, err := h.eventsStore.GetEvents(user.ID, workspace_id, after_id, eventsBatch)
+			if err != nil {
+				if ctx.Err() == nil {
+					h.logger.Printf("ERROR: getting events %v", err)
+				}
+				return nil
+			}
+
+			for _, event := range batch {
+				data, err := json.Marshal(event)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+				if err != nil {
+					return nil
+				}
+				after_id = event.ID
+			}
+			res.Flush()
+
+			if len(batch) < eventsBatch {
+				break
+			}
+		}
+
+		select {
+		case <-wake:
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(res, ": keep-alive\n\n")
+			if err != nil {
+				return nil
+			}
+			res.Flush()
+		case <-ctx.Done():
+			return nil
+		case <-h.done:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"mime"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ExportHandler struct {
+	exportService service.ExportServiceI
+	logger        *log.Logger
+}
+
+func NewExportHandler(exportService service.ExportServiceI, logger *log.Logger) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+		logger:        logger,
+	}
+}
+
+// HandleExportFolder streams a folder subtree as a zip of markdown files.
+func (h *ExportHandler) HandleExportFolder(c echo.Context) error {
+	var req getFolderContentRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	export, err := h.exportService.ExportFolder(user, req.FolderID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "folder doesn't exist or you don't have access to it"})
+		}
+		h.logger.Printf("ERROR: preparing folder export %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "application/zip")
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": export.Name + ".zip"}))
+	c.Response().WriteHeader(http.StatusOK)
+
+	// The status is already sent, a failure now can only cut the archive
+	// short, which clients detect as a corrupt zip.
+	err = export.WriteZip(c.Response())
+	if err != nil {
+		h.logger.Printf("ERROR: writing folder export %v", err)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"database/sql"
 	"errors"
 	"log"
 	"markdown-notes/internal/service"
@@ -15,6 +16,12 @@ func httpStatusFromFolderError(err error) int {
 	switch {
 	case errors.Is(err, store.ErrDuplicateFolder):
 		return http.StatusConflict
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrRootFolder), errors.Is(err, store.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrFolderCycle), errors.Is(err, service.ErrOtherWorkspace):
+		return http.StatusBadRequest
 	default:
 		return http.StatusInternalServerError
 	}
@@ -64,6 +71,7 @@ func (h *FolderHandler) HandleCreateFolder(c echo.Context) error {
 	}
 
 	user := c.Get("user").(*store.User)
+	req.ParentID = workspaceFolder(c, req.ParentID)
 	if req.ParentID == 0 {
 		root_folder_id, err := h.folderStore.GetRootFolder(user.ID)
 		if err != nil {
@@ -83,10 +91,14 @@ func (h *FolderHandler) HandleCreateFolder(c echo.Context) error {
 
 func (h *FolderHandler) GetRootFolderContent(c echo.Context) error {
 	user := c.Get("user").(*store.User)
-	root_folder_id, err := h.folderStore.GetRootFolder(user.ID)
-	if err != nil {
-		h.logger.Printf("Error: getting root folder id %v", err)
-		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": err.Error()})
+	root_folder_id := workspaceFolder(c, 0)
+	if root_folder_id == 0 {
+		var err error
+		root_folder_id, err = h.folderStore.GetRootFolder(user.ID)
+		if err != nil {
+			h.logger.Printf("Error: getting root folder id %v", err)
+			return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": err.Error()})
+		}
 	}
 
 	folderContents, err := h.folderContentsService.GetFolderContent(user, root_folder_id)
@@ -126,8 +138,72 @@ func (h *FolderHandler) GetFolderContent(c echo.Context) error {
 	folderContents, err := h.folderContentsService.GetFolderContent(user, req.FolderID)
 	if err != nil {
 		h.logger.Printf("Error: getting folder content %v", err)
-		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": err.Error()})
+		return c.JSON(httpStatusFromFolderError(err), utils.Envelope{"error": err.Error()})
 	}
 
 	return c.JSON(http.StatusOK, folderContents)
 }
+
+type patchFolderRequest struct {
+	FolderID int64   `param:"folder_id"`
+	Name     *string `json:"name"`
+	ParentID *int64  `json:"parent_id"`
+}
+
+func (r *patchFolderRequest) validate() error {
+	if r.FolderID == 0 {
+		return errors.New("folder_id is required")
+	}
+
+	if r.Name == nil && r.ParentID == nil {
+		return errors.New("name or parent_id is required")
+	}
+
+	if r.Name != nil && *r.Name == "" {
+		return errors.New("name cannot be empty")
+	}
+
+	return nil
+}
+
+func (h *FolderHandler) HandlePatchFolder(c echo.Context) error {
+	var req patchFolderRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	folder, err := h.folderContentsService.UpdateFolder(user, req.FolderID, req.Name, req.ParentID)
+	if err != nil {
+		h.logger.Printf("Error: updating folder %v", err)
+		return c.JSON(httpStatusFromFolderError(err), utils.Envelope{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, folder)
+}
+
+func (h *FolderHandler) HandleDeleteFolder(c echo.Context) error {
+	var req getFolderContentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	err = h.folderContentsService.DeleteFolder(user, req.FolderID)
+	if err != nil {
+		h.logger.Printf("Error: deleting folder %v", err)
+		return c.JSON(httpStatusFromFolderError(err), utils.Envelope{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"markdown-notes/internal/importer"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxImportSize = 100 << 20
+
+type ImportHandler struct {
+	importJobsService service.ImportJobsServiceI
+	logger            *log.Logger
+}
+
+func NewImportHandler(importJobsService service.ImportJobsServiceI, logger *log.Logger) *ImportHandler {
+	return &ImportHandler{
+		importJobsService: importJobsService,
+		logger:            logger,
+	}
+}
+
+type getImportJobRequest struct {
+	JobID int64 `param:"job_id"`
+}
+
+func (r *getImportJobRequest) validate() error {
+	if r.JobID == 0 {
+		return errors.New("job_id is required")
+	}
+
+	return nil
+}
+
+// HandleImport queues an export from another app to be recreated under the
+// folder in the folder_id form field or the root folder. The format field
+// picks the importer, .enex uploads default to enex and others to markdown.
+func (h *ImportHandler) HandleImport(c echo.Context) error {
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxImportSize)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, utils.Envelope{"error": fmt.Sprintf("imports can be at most %d bytes", maxImportSize)})
+		}
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": "file is required"})
+	}
+
+	var folder_id int64
+	if value := c.FormValue("folder_id"); value != "" {
+		folder_id, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || folder_id <= 0 {
+			return c.JSON(http.StatusBadRequest, utils.Envelope{"error": "folder_id must be a positive integer"})
+		}
+	}
+
+	format := c.FormValue("format")
+	if format == "" {
+		format = "markdown"
+		if strings.EqualFold(path.Ext(fileHeader.Filename), ".enex") {
+			format = "enex"
+		}
+	}
+	if _, ok := importer.Lookup(format); !ok {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": "format must be one of " + strings.Join(importer.Formats(), ", ")})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		h.logger.Printf("ERROR: opening uploaded import %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+	defer file.Close()
+
+	user := c.Get("user").(*store.User)
+	job, err := h.importJobsService.StartImport(user, workspaceFolder(c, folder_id), format, file)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "folder doesn't exist or you don't have access to it"})
+		case errors.Is(err, store.ErrForbidden):
+			return c.JSON(http.StatusForbidden, utils.Envelope{"error": err.Error()})
+		case errors.Is(err, service.ErrImportQueueFull), errors.Is(err, service.ErrImportsClosed):
+			return c.JSON(http.StatusServiceUnavailable, utils.Envelope{"error": err.Error()})
+		}
+		h.logger.Printf("ERROR: starting import %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/import/%d", job.ID))
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// HandleGetImportJob reports the progress of an import, and once it's done
+// what was created and skipped.
+func (h *ImportHandler) HandleGetImportJob(c echo.Context) error {
+	var req getImportJobRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	job, err := h.importJobsService.GetImportJob(user, req.JobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "import job doesn't exist"})
+		}
+		h.logger.Printf("ERROR: getting import job %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
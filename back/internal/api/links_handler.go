@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"log"
+	"markdown-notes/internal/graph"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type LinksHandler struct {
+	linksStore store.NoteLinksStore
+	logger     *log.Logger
+}
+
+func NewLinksHandler(linksStore store.NoteLinksStore, logger *log.Logger) *LinksHandler {
+	return &LinksHandler{
+		linksStore: linksStore,
+		logger:     logger,
+	}
+}
+
+func (h *LinksHandler) HandleGetBacklinks(c echo.Context) error {
+	var req getNoteRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	backlinks, err := h.linksStore.GetBacklinks(user.ID, req.NoteID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting backlinks %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"backlinks": backlinks})
+}
+
+func (h *LinksHandler) HandleGetOutlinks(c echo.Context) error {
+	var req getNoteRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	outlinks, err := h.linksStore.GetOutlinks(user.ID, req.NoteID)
+	if err != nil {
+		h.logger.Printf("ERROR: getting outlinks %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	resolved := []store.Outlink{}
+	unresolved := []store.Outlink{}
+	for _, link := range outlinks {
+		if link.Note == nil {
+			unresolved = append(unresolved, link)
+		} else {
+			resolved = append(resolved, link)
+		}
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"links": resolved, "unresolved": unresolved})
+}
+
+type getGraphRequest struct {
+	FolderID int64  `query:"folder_id"`
+	NoteID   int64  `query:"note_id"`
+	Depth    *int   `query:"depth"`
+	Format   string `query:"format"`
+}
+
+func (r *getGraphRequest) validate() error {
+	if r.FolderID < 0 {
+		return errors.New("invalid folder_id")
+	}
+
+	if r.NoteID < 0 {
+		return errors.New("invalid note_id")
+	}
+
+	if r.Depth != nil && (*r.Depth < 0 || *r.Depth > 10) {
+		return errors.New("depth must be between 0 and 10")
+	}
+
+	if r.Depth != nil && r.NoteID == 0 {
+		return errors.New("depth requires note_id")
+	}
+
+	if r.Format != "" && r.Format != "json" && r.Format != "dot" {
+		return errors.New("format must be json or dot")
+	}
+
+	return nil
+}
+
+func (h *LinksHandler) HandleGetGraph(c echo.Context) error {
+	var req getGraphRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	nodes, edges, err := h.linksStore.GetGraph(user.ID, workspaceFolder(c, req.FolderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, utils.Envelope{"error": "folder doesn't exist or you don't have access to it"})
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: getting graph %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	g := &graph.Graph{Nodes: nodes, Edges: edges}
+
+	if req.NoteID != 0 {
+		depth := 1
+		if req.Depth != nil {
+			depth = *req.Depth
+		}
+
+		var ok bool
+		g, ok = g.Neighborhood(req.NoteID, depth)
+		if !ok {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "note doesn't exist or you don't have access to it"})
+		}
+	}
+
+	if req.Format == "dot" {
+		var buf bytes.Buffer
+		if err := g.WriteDOT(&buf); err != nil {
+			h.logger.Printf("ERROR: writing graph dot %v", err)
+			return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		}
+
+		return c.Blob(http.StatusOK, "text/vnd.graphviz; charset=utf-8", buf.Bytes())
+	}
+
+	return c.JSON(http.StatusOK, g)
+}
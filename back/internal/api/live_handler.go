@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"markdown-notes/internal/live"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/labstack/echo/v4"
+)
+
+type LiveHandler struct {
+	hub    *live.Hub
+	logger *log.Logger
+}
+
+func NewLiveHandler(hub *live.Hub, logger *log.Logger) *LiveHandler {
+	return &LiveHandler{
+		hub:    hub,
+		logger: logger,
+	}
+}
+
+// HandleLive upgrades to a WebSocket for editing a note together with
+// everyone else who has it open, see live.Message for what goes over it.
+// Viewers get everybody's changes but can't make any. Browsers only send
+// the auth_token cookie along from the same origin, and connections from
+// other origins are refused.
+func (h *LiveHandler) HandleLive(c echo.Context) error {
+	var req getNoteRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	client, err := h.hub.Join(user, req.NoteID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "note doesn't exist or you don't have access to it"})
+		}
+		h.logger.Printf("ERROR: opening live note %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+	defer h.hub.Leave(client)
+
+	conn, err := websocket.Accept(c.Response(), c.Request(), nil)
+	if err != nil {
+		// Accept has written the response already
+		return nil
+	}
+	defer conn.CloseNow()
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	go h.writeLoop(ctx, conn, client)
+
+	for {
+		var msg live.Message
+		err = wsjson.Read(ctx, conn, &msg)
+		if err != nil {
+			if websocket.CloseStatus(err) == -1 && ctx.Err() == nil {
+				h.logger.Printf("ERROR: reading live note message %v", err)
+			}
+			return nil
+		}
+
+		err = client.Receive(msg)
+		if errors.Is(err, live.ErrDropped) {
+			return nil
+		}
+		if err != nil {
+			// the client is out of step and has to reconnect to catch up
+			err = wsjson.Write(ctx, conn, live.Message{Type: "error", Error: err.Error()})
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// writeLoop passes the messages the hub queues for the client on, closing
+// the connection once the hub drops the client.
+func (h *LiveHandler) writeLoop(ctx context.Context, conn *websocket.Conn, client *live.Client) {
+	for msg := range client.Send {
+		err := wsjson.Write(ctx, conn, msg)
+		if err != nil {
+			conn.CloseNow()
+			return
+		}
+	}
+
+	if ctx.Err() == nil {
+		conn.Close(websocket.StatusTryAgainLater, "fell behind")
+	}
+}
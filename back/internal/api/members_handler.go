@@ -0,0 +1,193 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func httpStatusFromMemberError(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, store.ErrDuplicateMember):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrMemberRole),
+		errors.Is(err, service.ErrMemberUser),
+		errors.Is(err, service.ErrMemberOwner):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type MembersHandler struct {
+	membersService service.MembersServiceI
+	logger         *log.Logger
+}
+
+func NewMembersHandler(membersService service.MembersServiceI, logger *log.Logger) *MembersHandler {
+	return &MembersHandler{
+		membersService: membersService,
+		logger:         logger,
+	}
+}
+
+// memberError writes the response for an error from the members service.
+func (h *MembersHandler) memberError(c echo.Context, err error, action string) error {
+	status := httpStatusFromMemberError(err)
+	switch status {
+	case http.StatusNotFound:
+		return c.JSON(status, utils.Envelope{"error": "folder or member doesn't exist or you don't have access to it"})
+	case http.StatusInternalServerError:
+		h.logger.Printf("ERROR: %s %v", action, err)
+		return c.JSON(status, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(status, utils.Envelope{"error": err.Error()})
+}
+
+type addMemberRequest struct {
+	FolderID int64      `param:"folder_id"`
+	Username string     `json:"username"`
+	Role     store.Role `json:"role"`
+}
+
+func (r *addMemberRequest) validate() error {
+	if r.FolderID == 0 {
+		return errors.New("folder_id is required")
+	}
+
+	if r.Username == "" {
+		return errors.New("username is required")
+	}
+
+	return nil
+}
+
+type memberRequest struct {
+	FolderID int64      `param:"folder_id"`
+	UserID   int64      `param:"user_id"`
+	Role     store.Role `json:"role"`
+}
+
+func (r *memberRequest) validate() error {
+	if r.FolderID == 0 {
+		return errors.New("folder_id is required")
+	}
+
+	if r.UserID == 0 {
+		return errors.New("user_id is required")
+	}
+
+	return nil
+}
+
+func (h *MembersHandler) HandleGetMembers(c echo.Context) error {
+	var req getFolderContentRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	members, err := h.membersService.GetMembers(user, req.FolderID)
+	if err != nil {
+		return h.memberError(c, err, "getting folder members")
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"members": members})
+}
+
+// HandleAddMember invites a user by username to a folder and everything
+// below it.
+func (h *MembersHandler) HandleAddMember(c echo.Context) error {
+	var req addMemberRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	member, err := h.membersService.AddMember(user, req.FolderID, req.Username, req.Role)
+	if err != nil {
+		return h.memberError(c, err, "adding folder member")
+	}
+
+	return c.JSON(http.StatusCreated, member)
+}
+
+func (h *MembersHandler) HandleUpdateMember(c echo.Context) error {
+	var req memberRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	member, err := h.membersService.UpdateMember(user, req.FolderID, req.UserID, req.Role)
+	if err != nil {
+		return h.memberError(c, err, "updating folder member")
+	}
+
+	return c.JSON(http.StatusOK, member)
+}
+
+// HandleRemoveMember takes a member's access to a folder away, members can
+// also use it to leave a folder shared with them.
+func (h *MembersHandler) HandleRemoveMember(c echo.Context) error {
+	var req memberRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	err = h.membersService.RemoveMember(user, req.FolderID, req.UserID)
+	if err != nil {
+		return h.memberError(c, err, "removing folder member")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleGetSharedFolders lists the folders other users shared with the
+// current user.
+func (h *MembersHandler) HandleGetSharedFolders(c echo.Context) error {
+	user := c.Get("user").(*store.User)
+	folders, err := h.membersService.GetSharedFolders(user)
+	if err != nil {
+		h.logger.Printf("ERROR: getting shared folders %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"folders": folders})
+}
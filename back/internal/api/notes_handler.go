@@ -3,11 +3,15 @@ package api
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"markdown-notes/internal/render"
 	"markdown-notes/internal/service"
 	"markdown-notes/internal/store"
 	"markdown-notes/internal/utils"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 )
@@ -16,25 +20,91 @@ func httpStatusFromNoteError(err error) int {
 	switch {
 	case errors.Is(err, store.ErrDuplicateNote):
 		return http.StatusConflict
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrForbidden):
+		return http.StatusForbidden
 	default:
 		return http.StatusInternalServerError
 	}
 }
 
+// noteETag is the entity tag handed out for a note, it changes whenever the
+// note is saved.
+func noteETag(note *store.Note) string {
+	return fmt.Sprintf(`"%d"`, note.Version)
+}
+
+// noteHTMLETag is the entity tag of the rendered note, distinct from the JSON
+// one so caches never answer one representation with the other.
+func noteHTMLETag(note *store.Note) string {
+	return fmt.Sprintf(`"%d-html"`, note.Version)
+}
+
+// parseIfMatch reads the version a client expects to overwrite from an
+// If-Match header, either ETag of the note will do. "*" matches any version
+// and gives back nil.
+func parseIfMatch(header string) (*int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return nil, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(strings.TrimSuffix(tag, "-html"), 10, 64)
+	if err != nil {
+		return nil, errors.New("If-Match must be an ETag returned for the note")
+	}
+
+	return &version, nil
+}
+
+// prefersHTML reports whether an Accept header ranks text/html above
+// application/json. Wildcards are ignored so JSON stays the default.
+func prefersHTML(accept string) bool {
+	var htmlQ, jsonQ float64
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if name == "q" {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+
+	return htmlQ > 0 && htmlQ > jsonQ
+}
+
 type NotesHandler struct {
 	notesStore            store.NotesStore
 	folderContentsService service.FolderContentsServiceI
+	renderer              *render.Renderer
 	logger                *log.Logger
 }
 
 func NewNotesHandler(
 	notesStore store.NotesStore,
 	folderContentsService service.FolderContentsServiceI,
+	renderer *render.Renderer,
 	logger *log.Logger,
 ) *NotesHandler {
 	return &NotesHandler{
 		notesStore:            notesStore,
 		folderContentsService: folderContentsService,
+		renderer:              renderer,
 		logger:                logger,
 	}
 }
@@ -66,7 +136,7 @@ func (h *NotesHandler) HandleCreateNote(c echo.Context) error {
 	}
 
 	user := c.Get("user").(*store.User)
-	note, err := h.folderContentsService.CreateNote(user, req.FolderID, req.Title, req.Note)
+	note, err := h.folderContentsService.CreateNote(user, workspaceFolder(c, req.FolderID), req.Title, req.Note)
 	if err != nil {
 		h.logger.Printf("Error creating note: %v", err)
 		return c.JSON(httpStatusFromNoteError(err), utils.Envelope{"error": err.Error()})
@@ -109,12 +179,58 @@ func (h *NotesHandler) HandleGetNote(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 	}
 
+	c.Response().Header().Add("Vary", echo.HeaderAccept)
+
+	if prefersHTML(c.Request().Header.Get(echo.HeaderAccept)) {
+		return h.renderNote(c, note)
+	}
+
+	c.Response().Header().Set("ETag", noteETag(note))
 	return c.JSON(http.StatusOK, note)
 }
 
+func (h *NotesHandler) HandleGetNoteHTML(c echo.Context) error {
+	var req getNoteRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	note, err := h.notesStore.GetNote(user.ID, req.NoteID)
+	if err != nil {
+		// same answer as HandleGetNote, the HTML is just another view of it
+		if err == sql.ErrNoRows {
+			return c.JSON(http.StatusUnauthorized, utils.Envelope{"error": "note doesn't exist or you don't have access to it"})
+		}
+		h.logger.Printf("ERROR: getting note to render %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return h.renderNote(c, note)
+}
+
+func (h *NotesHandler) renderNote(c echo.Context, note *store.Note) error {
+	html, err := h.renderer.Render(note.Note)
+	if err != nil {
+		h.logger.Printf("ERROR: rendering note %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	c.Response().Header().Set("ETag", noteHTMLETag(note))
+	return c.HTML(http.StatusOK, html)
+}
+
 type patchNoteRequest struct {
-	NoteID int64  `param:"note_id"`
-	Note   string `json:"note"`
+	NoteID   int64   `param:"note_id"`
+	Note     *string `json:"note"`
+	Title    *string `json:"title"`
+	FolderID *int64  `json:"folder_id"`
 }
 
 func (r *patchNoteRequest) validate() error {
@@ -122,6 +238,14 @@ func (r *patchNoteRequest) validate() error {
 		return errors.New("note_id is required")
 	}
 
+	if r.Note == nil && r.Title == nil && r.FolderID == nil {
+		return errors.New("note, title or folder_id is required")
+	}
+
+	if r.Title != nil && *r.Title == "" {
+		return errors.New("title cannot be empty")
+	}
+
 	return nil
 }
 
@@ -137,12 +261,194 @@ func (h *NotesHandler) HandlePatchNote(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 	}
 
+	ifMatch := c.Request().Header.Get("If-Match")
+	if ifMatch == "" {
+		return c.JSON(http.StatusPreconditionRequired, utils.Envelope{"error": "If-Match header is required"})
+	}
+
+	version, err := parseIfMatch(ifMatch)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
 	user := c.Get("user").(*store.User)
-	note, err := h.notesStore.UpdateNote(user.ID, req.NoteID, req.Note)
+	note, err := h.folderContentsService.UpdateNote(user, req.NoteID, store.NoteUpdate{
+		Title:     req.Title,
+		Note:      req.Note,
+		FolderID:  req.FolderID,
+		IfVersion: version,
+	})
 	if err != nil {
 		h.logger.Printf("ERROR: couldn't update the note %v", err)
+		if errors.Is(err, store.ErrStaleNote) {
+			current, getErr := h.notesStore.GetNote(user.ID, req.NoteID)
+			if getErr != nil {
+				return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			}
+			c.Response().Header().Set("ETag", noteETag(current))
+			return c.JSON(http.StatusPreconditionFailed, utils.Envelope{"error": err.Error(), "note": current})
+		}
+		if errors.Is(err, store.ErrDuplicateNote) {
+			return c.JSON(http.StatusConflict, utils.Envelope{"error": err.Error()})
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "note doesn't exist or you don't have access to it"})
+		}
+		if errors.Is(err, store.ErrForbidden) {
+			return c.JSON(http.StatusForbidden, utils.Envelope{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrOtherWorkspace) {
+			return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
 	}
 
+	c.Response().Header().Set("ETag", noteETag(note))
 	return c.JSON(http.StatusOK, utils.Envelope{"note": note})
 }
+
+func (h *NotesHandler) HandleDeleteNote(c echo.Context) error {
+	var req getNoteRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	note, err := h.notesStore.TrashNote(user.ID, req.NoteID)
+	if err != nil {
+		h.logger.Printf("ERROR: couldn't move note to trash %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "note doesn't exist or you don't have access to it"})
+		}
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"note": note})
+}
+
+func (h *NotesHandler) HandleGetTrash(c echo.Context) error {
+	user := c.Get("user").(*store.User)
+	notes, err := h.notesStore.GetTrashedNotes(user.ID, workspaceID(c))
+	if err != nil {
+		h.logger.Printf("ERROR: getting trashed notes %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"notes": notes})
+}
+
+func (h *NotesHandler) HandleRestoreNote(c echo.Context) error {
+	var req getNoteRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	note, err := h.notesStore.RestoreNote(user.ID, req.NoteID)
+	if err != nil {
+		h.logger.Printf("ERROR: couldn't restore note %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "note isn't in the trash or you don't have access to it"})
+		}
+		return c.JSON(httpStatusFromNoteError(err), utils.Envelope{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"note": note})
+}
+
+func (h *NotesHandler) HandlePurgeNote(c echo.Context) error {
+	var req getNoteRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	err = h.notesStore.PurgeNote(user.ID, req.NoteID)
+	if err != nil {
+		h.logger.Printf("ERROR: couldn't purge note %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "note isn't in the trash or you don't have access to it"})
+		}
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *NotesHandler) HandleEmptyTrash(c echo.Context) error {
+	user := c.Get("user").(*store.User)
+	purged, err := h.notesStore.EmptyTrash(user.ID, workspaceID(c))
+	if err != nil {
+		h.logger.Printf("ERROR: couldn't empty trash %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"purged": purged})
+}
+
+type searchNotesRequest struct {
+	Query  string `query:"q"`
+	Limit  *int   `query:"limit"`
+	Cursor int    `query:"cursor"`
+}
+
+func (r *searchNotesRequest) validate() error {
+	if strings.TrimSpace(r.Query) == "" {
+		return errors.New("q is required")
+	}
+
+	if r.Limit != nil && (*r.Limit < 1 || *r.Limit > 100) {
+		return errors.New("limit must be between 1 and 100")
+	}
+
+	if r.Cursor < 0 {
+		return errors.New("cursor cannot be negative")
+	}
+
+	return nil
+}
+
+func (h *NotesHandler) HandleSearchNotes(c echo.Context) error {
+	var req searchNotesRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	limit := 20
+	if req.Limit != nil {
+		limit = *req.Limit
+	}
+
+	user := c.Get("user").(*store.User)
+	hits, nextCursor, err := h.notesStore.SearchNotes(user.ID, workspaceID(c), req.Query, limit, req.Cursor)
+	if err != nil {
+		h.logger.Printf("ERROR: searching notes %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"results": hits, "next_cursor": nextCursor})
+}
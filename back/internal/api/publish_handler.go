@@ -0,0 +1,121 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"mime"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type PublishHandler struct {
+	publishService service.PublishServiceI
+	logger         *log.Logger
+}
+
+func NewPublishHandler(publishService service.PublishServiceI, logger *log.Logger) *PublishHandler {
+	return &PublishHandler{
+		publishService: publishService,
+		logger:         logger,
+	}
+}
+
+// HandlePublishFolder marks a folder as published and builds its static site
+// into the sites directory, replacing the one built last time.
+func (h *PublishHandler) HandlePublishFolder(c echo.Context) error {
+	var req getFolderContentRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	published, err := h.publishService.PublishFolder(user, req.FolderID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "folder doesn't exist or you don't have access to it"})
+		case errors.Is(err, store.ErrForbidden):
+			return c.JSON(http.StatusForbidden, utils.Envelope{"error": err.Error()})
+		}
+		h.logger.Printf("ERROR: publishing folder %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, published)
+}
+
+// HandleUnpublishFolder removes a folder's published site.
+func (h *PublishHandler) HandleUnpublishFolder(c echo.Context) error {
+	var req getFolderContentRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	err = h.publishService.UnpublishFolder(user, req.FolderID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "folder isn't published or you don't have access to it"})
+		}
+		h.logger.Printf("ERROR: unpublishing folder %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleDownloadSite streams a folder's static site as a zip, built fresh
+// whether or not the folder is published.
+func (h *PublishHandler) HandleDownloadSite(c echo.Context) error {
+	var req getFolderContentRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	build, err := h.publishService.BuildSite(user, req.FolderID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "folder doesn't exist or you don't have access to it"})
+		}
+		h.logger.Printf("ERROR: preparing site %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "application/zip")
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": build.Name + "-site.zip"}))
+	c.Response().WriteHeader(http.StatusOK)
+
+	// As with exports, a failure after the status is sent can only cut the
+	// archive short.
+	err = build.WriteZip(c.Response())
+	if err != nil {
+		h.logger.Printf("ERROR: writing site %v", err)
+	}
+
+	return nil
+}
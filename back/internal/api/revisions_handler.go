@@ -0,0 +1,204 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+func httpStatusFromRevisionError(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrDuplicateNote):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func revisionErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "revision doesn't exist or you don't have access to it"
+	case errors.Is(err, store.ErrDuplicateNote):
+		return err.Error()
+	default:
+		return "internal server error"
+	}
+}
+
+type RevisionsHandler struct {
+	revisionsStore store.NoteRevisionsStore
+	logger         *log.Logger
+}
+
+func NewRevisionsHandler(revisionsStore store.NoteRevisionsStore, logger *log.Logger) *RevisionsHandler {
+	return &RevisionsHandler{
+		revisionsStore: revisionsStore,
+		logger:         logger,
+	}
+}
+
+type getRevisionsRequest struct {
+	NoteID int64 `param:"note_id"`
+}
+
+func (r *getRevisionsRequest) validate() error {
+	if r.NoteID == 0 {
+		return errors.New("note_id is required")
+	}
+
+	return nil
+}
+
+func (h *RevisionsHandler) HandleGetRevisions(c echo.Context) error {
+	var req getRevisionsRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	revisions, err := h.revisionsStore.GetRevisions(user.ID, req.NoteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, utils.Envelope{"error": "note doesn't exist or you don't have access to it"})
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: getting revisions %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"revisions": revisions})
+}
+
+type getRevisionRequest struct {
+	NoteID   int64 `param:"note_id"`
+	Revision int64 `param:"rev"`
+}
+
+func (r *getRevisionRequest) validate() error {
+	if r.NoteID == 0 {
+		return errors.New("note_id is required")
+	}
+
+	if r.Revision == 0 {
+		return errors.New("rev is required")
+	}
+
+	return nil
+}
+
+func (h *RevisionsHandler) HandleGetRevision(c echo.Context) error {
+	var req getRevisionRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	revision, err := h.revisionsStore.GetRevision(user.ID, req.NoteID, req.Revision)
+	if err != nil {
+		h.logger.Printf("ERROR: getting revision %v", err)
+		return c.JSON(httpStatusFromRevisionError(err), utils.Envelope{"error": revisionErrorMessage(err)})
+	}
+
+	return c.JSON(http.StatusOK, revision)
+}
+
+type diffRevisionsRequest struct {
+	NoteID int64 `param:"note_id"`
+	From   int64 `query:"from"`
+	To     int64 `query:"to"`
+}
+
+func (r *diffRevisionsRequest) validate() error {
+	if r.NoteID == 0 {
+		return errors.New("note_id is required")
+	}
+
+	if r.From == 0 || r.To == 0 {
+		return errors.New("from and to are required")
+	}
+
+	return nil
+}
+
+func (h *RevisionsHandler) HandleDiffRevisions(c echo.Context) error {
+	var req diffRevisionsRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	from, err := h.revisionsStore.GetRevision(user.ID, req.NoteID, req.From)
+	if err != nil {
+		h.logger.Printf("ERROR: getting revision %v", err)
+		return c.JSON(httpStatusFromRevisionError(err), utils.Envelope{"error": revisionErrorMessage(err)})
+	}
+
+	to, err := h.revisionsStore.GetRevision(user.ID, req.NoteID, req.To)
+	if err != nil {
+		h.logger.Printf("ERROR: getting revision %v", err)
+		return c.JSON(httpStatusFromRevisionError(err), utils.Envelope{"error": revisionErrorMessage(err)})
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from.Note),
+		B:        difflib.SplitLines(to.Note),
+		FromFile: fmt.Sprintf("%s (revision %d)", from.Title, from.Revision),
+		ToFile:   fmt.Sprintf("%s (revision %d)", to.Title, to.Revision),
+		Context:  3,
+	})
+	if err != nil {
+		h.logger.Printf("ERROR: diffing revisions %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"from": from.Revision, "to": to.Revision, "diff": diff})
+}
+
+func (h *RevisionsHandler) HandleRestoreRevision(c echo.Context) error {
+	var req getRevisionRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	note, err := h.revisionsStore.RestoreRevision(user.ID, req.NoteID, req.Revision)
+	if err != nil {
+		h.logger.Printf("ERROR: restoring revision %v", err)
+		return c.JSON(httpStatusFromRevisionError(err), utils.Envelope{"error": revisionErrorMessage(err)})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"note": note})
+}
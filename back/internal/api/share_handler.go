@@ -0,0 +1,333 @@
+package api
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/site"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ShareHandler struct {
+	shareService service.ShareServiceI
+	logger       *log.Logger
+}
+
+func NewShareHandler(shareService service.ShareServiceI, logger *log.Logger) *ShareHandler {
+	return &ShareHandler{
+		shareService: shareService,
+		logger:       logger,
+	}
+}
+
+type createShareRequest struct {
+	NoteID    int64      `param:"note_id"`
+	FolderID  int64      `param:"folder_id"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"password"`
+}
+
+func (r *createShareRequest) validate() error {
+	if r.NoteID == 0 && r.FolderID == 0 {
+		return errors.New("note_id or folder_id is required")
+	}
+
+	if len(r.Password) > 72 {
+		return errors.New("password can be at most 72 bytes")
+	}
+
+	return nil
+}
+
+type deleteShareRequest struct {
+	ShareID int64 `param:"share_id"`
+}
+
+func (r *deleteShareRequest) validate() error {
+	if r.ShareID == 0 {
+		return errors.New("share_id is required")
+	}
+
+	return nil
+}
+
+// HandleCreateShare creates a share link for the note or folder in the path.
+// The token in the response is only ever shown this once.
+func (h *ShareHandler) HandleCreateShare(c echo.Context) error {
+	var req createShareRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+
+	var share *store.Share
+	what := "note"
+	if req.NoteID != 0 {
+		share, err = h.shareService.ShareNote(user, req.NoteID, req.ExpiresAt, req.Password)
+	} else {
+		what = "folder"
+		share, err = h.shareService.ShareFolder(user, req.FolderID, req.ExpiresAt, req.Password)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": what + " doesn't exist or you don't have access to it"})
+		case errors.Is(err, store.ErrForbidden):
+			return c.JSON(http.StatusForbidden, utils.Envelope{"error": err.Error()})
+		case errors.Is(err, service.ErrShareExpiry):
+			return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		}
+		h.logger.Printf("ERROR: creating share %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/s/"+share.Token)
+	return c.JSON(http.StatusCreated, share)
+}
+
+func (h *ShareHandler) HandleGetShares(c echo.Context) error {
+	user := c.Get("user").(*store.User)
+	shares, err := h.shareService.GetShares(user)
+	if err != nil {
+		h.logger.Printf("ERROR: getting shares %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"shares": shares})
+}
+
+func (h *ShareHandler) HandleDeleteShare(c echo.Context) error {
+	var req deleteShareRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	err = h.shareService.RevokeShare(user, req.ShareID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "share doesn't exist or you don't have access to it"})
+		}
+		h.logger.Printf("ERROR: revoking share %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+type viewShareRequest struct {
+	Token        string `param:"token"`
+	NoteID       int64  `param:"note_id"`
+	FolderID     int64  `param:"folder_id"`
+	AttachmentID int64  `param:"attachment_id"`
+}
+
+func shareAccessCookie(share *store.Share) string {
+	return "share_" + strconv.FormatInt(share.ID, 10)
+}
+
+// openShare binds the request and loads the share it is for. When the share
+// has a password that the visitor hasn't entered yet it writes the response,
+// a password form, and returns a nil share.
+func (h *ShareHandler) openShare(c echo.Context) (*viewShareRequest, *store.Share, error) {
+	var req viewShareRequest
+
+	if err := c.Bind(&req); err != nil {
+		return nil, nil, c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	share, err := h.shareService.OpenShare(req.Token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, c.JSON(http.StatusNotFound, utils.Envelope{"error": "share doesn't exist or has expired"})
+		}
+		h.logger.Printf("ERROR: opening share %v", err)
+		return nil, nil, c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	header := c.Response().Header()
+	// Keep the token out of Referer headers and shared pages out of caches
+	// and search engines, so revoking a share takes effect everywhere.
+	header.Set("Referrer-Policy", "no-referrer")
+	header.Set("X-Robots-Tag", "noindex")
+	header.Set("Cache-Control", "no-store")
+
+	if !share.HasPassword {
+		return &req, share, nil
+	}
+
+	if cookie, err := c.Cookie(shareAccessCookie(share)); err == nil {
+		if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(share.AccessKey())) == 1 {
+			return &req, share, nil
+		}
+	}
+
+	page := &site.PasswordPage{Page: site.Page{SiteName: share.Name, Title: share.Name}}
+	if c.Request().Method == http.MethodPost {
+		matches, err := share.PasswordHash.Matches(c.FormValue("password"))
+		if err != nil {
+			h.logger.Printf("ERROR: checking share password %v", err)
+			return nil, nil, c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		}
+
+		if matches {
+			cookie := new(http.Cookie)
+			cookie.Name = shareAccessCookie(share)
+			cookie.Value = share.AccessKey()
+			cookie.Path = "/"
+			cookie.HttpOnly = true
+			cookie.Secure = true
+			cookie.SameSite = http.SameSiteLaxMode
+			if share.ExpiresAt != nil {
+				cookie.Expires = *share.ExpiresAt
+			}
+			c.SetCookie(cookie)
+			return &req, share, nil
+		}
+		page.Error = "wrong password"
+	}
+
+	var buf bytes.Buffer
+	err = site.WritePassword(&buf, page)
+	if err != nil {
+		h.logger.Printf("ERROR: rendering share password page %v", err)
+		return nil, nil, c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return nil, nil, c.HTMLBlob(http.StatusUnauthorized, buf.Bytes())
+}
+
+// sharedPageError writes the response for an error rendering a shared page.
+func (h *ShareHandler) sharedPageError(c echo.Context, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, utils.Envelope{"error": "page isn't part of this share"})
+	}
+	h.logger.Printf("ERROR: rendering shared page %v", err)
+	return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+}
+
+func (h *ShareHandler) writePage(c echo.Context, write func(buf *bytes.Buffer) error) error {
+	var buf bytes.Buffer
+	err := write(&buf)
+	if err != nil {
+		return h.sharedPageError(c, err)
+	}
+
+	return c.HTMLBlob(http.StatusOK, buf.Bytes())
+}
+
+// HandleViewShare renders the shared note or the index of the shared folder.
+// A POST carries the password of a protected share.
+func (h *ShareHandler) HandleViewShare(c echo.Context) error {
+	req, share, err := h.openShare(c)
+	if share == nil {
+		return err
+	}
+
+	if share.NoteID != nil {
+		page, err := h.shareService.SharedNotePage(share, req.Token, 0)
+		if err != nil {
+			return h.sharedPageError(c, err)
+		}
+		return h.writePage(c, func(buf *bytes.Buffer) error {
+			return site.WriteNote(buf, page)
+		})
+	}
+
+	page, err := h.shareService.SharedFolderPage(share, req.Token, 0)
+	if err != nil {
+		return h.sharedPageError(c, err)
+	}
+	return h.writePage(c, func(buf *bytes.Buffer) error {
+		return site.WriteIndex(buf, page)
+	})
+}
+
+// HandleViewSharedNote renders a note below a shared folder.
+func (h *ShareHandler) HandleViewSharedNote(c echo.Context) error {
+	req, share, err := h.openShare(c)
+	if share == nil {
+		return err
+	}
+
+	if share.FolderID == nil || req.NoteID <= 0 {
+		return h.sharedPageError(c, sql.ErrNoRows)
+	}
+
+	page, err := h.shareService.SharedNotePage(share, req.Token, req.NoteID)
+	if err != nil {
+		return h.sharedPageError(c, err)
+	}
+	return h.writePage(c, func(buf *bytes.Buffer) error {
+		return site.WriteNote(buf, page)
+	})
+}
+
+// HandleViewSharedFolder renders the index of a folder below a shared folder.
+func (h *ShareHandler) HandleViewSharedFolder(c echo.Context) error {
+	req, share, err := h.openShare(c)
+	if share == nil {
+		return err
+	}
+
+	if req.FolderID <= 0 {
+		return h.sharedPageError(c, sql.ErrNoRows)
+	}
+
+	page, err := h.shareService.SharedFolderPage(share, req.Token, req.FolderID)
+	if err != nil {
+		return h.sharedPageError(c, err)
+	}
+	return h.writePage(c, func(buf *bytes.Buffer) error {
+		return site.WriteIndex(buf, page)
+	})
+}
+
+// HandleGetSharedAttachment streams an attachment of a shared note.
+func (h *ShareHandler) HandleGetSharedAttachment(c echo.Context) error {
+	req, share, err := h.openShare(c)
+	if share == nil {
+		return err
+	}
+
+	if req.AttachmentID <= 0 {
+		return h.sharedPageError(c, sql.ErrNoRows)
+	}
+
+	attachment, content, err := h.shareService.OpenSharedAttachment(share, req.AttachmentID)
+	if err != nil {
+		return h.sharedPageError(c, err)
+	}
+	defer content.Close()
+
+	serveBlob(c, attachment.ContentType, attachmentDisposition(attachment), attachment.SHA256, attachment.CreatedAt, content)
+	return nil
+}
+
+// HandleShareStylesheet serves the style sheet of shared pages.
+func (h *ShareHandler) HandleShareStylesheet(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=3600")
+	return c.Blob(http.StatusOK, "text/css; charset=utf-8", []byte(site.Stylesheet))
+}
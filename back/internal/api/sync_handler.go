@@ -0,0 +1,121 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxSyncChanges is how many changes a client can send in one batch.
+const maxSyncChanges = 500
+
+type SyncHandler struct {
+	syncService service.SyncServiceI
+	logger      *log.Logger
+}
+
+func NewSyncHandler(syncService service.SyncServiceI, logger *log.Logger) *SyncHandler {
+	return &SyncHandler{
+		syncService: syncService,
+		logger:      logger,
+	}
+}
+
+type getSyncRequest struct {
+	Since int64 `query:"since"`
+	Limit int   `query:"limit"`
+}
+
+func (r *getSyncRequest) validate() error {
+	if r.Since < 0 {
+		return errors.New("since cannot be negative")
+	}
+
+	if r.Limit < 0 || r.Limit > 1000 {
+		return errors.New("limit must be between 1 and 1000")
+	}
+
+	return nil
+}
+
+// HandleGetSync returns the changes to the workspace's notes and folders
+// after the change number since, with tombstones for the ones deleted. Sync
+// the personal workspace without X-Workspace-ID.
+func (h *SyncHandler) HandleGetSync(c echo.Context) error {
+	var req getSyncRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	if req.Limit == 0 {
+		req.Limit = 500
+	}
+
+	user := c.Get("user").(*store.User)
+	changes, err := h.syncService.GetChanges(user, workspaceID(c), req.Since, req.Limit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "workspace doesn't exist or you aren't a member of it"})
+		}
+		h.logger.Printf("ERROR: getting sync changes %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, changes)
+}
+
+type postSyncRequest struct {
+	Changes []service.SyncChange `json:"changes"`
+}
+
+func (r *postSyncRequest) validate() error {
+	if len(r.Changes) == 0 {
+		return errors.New("changes are required")
+	}
+
+	if len(r.Changes) > maxSyncChanges {
+		return errors.New("at most 500 changes can be sent at once")
+	}
+
+	return nil
+}
+
+// HandlePostSync applies a batch of changes made offline and returns what
+// became of each, in the same order. See service.SyncService.ApplyChanges
+// for how conflicts are resolved.
+func (h *SyncHandler) HandlePostSync(c echo.Context) error {
+	var req postSyncRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	results, err := h.syncService.ApplyChanges(user, workspaceID(c), req.Changes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "workspace doesn't exist or you aren't a member of it"})
+		}
+		h.logger.Printf("ERROR: applying sync changes %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"results": results})
+}
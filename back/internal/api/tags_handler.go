@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"markdown-notes/internal/markdown"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+)
+
+type TagsHandler struct {
+	tagsStore store.TagsStore
+	logger    *log.Logger
+}
+
+func NewTagsHandler(tagsStore store.TagsStore, logger *log.Logger) *TagsHandler {
+	return &TagsHandler{
+		tagsStore: tagsStore,
+		logger:    logger,
+	}
+}
+
+type getTagsRequest struct {
+	Prefix string `query:"prefix"`
+}
+
+func (h *TagsHandler) HandleGetTags(c echo.Context) error {
+	var req getTagsRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	prefix := ""
+	if req.Prefix != "" {
+		prefix = markdown.NormalizeTag(req.Prefix)
+		if prefix == "" {
+			return c.JSON(http.StatusBadRequest, utils.Envelope{"error": "invalid tag prefix"})
+		}
+	}
+
+	user := c.Get("user").(*store.User)
+	tags, err := h.tagsStore.GetTags(user.ID, workspaceID(c), prefix)
+	if err != nil {
+		h.logger.Printf("ERROR: getting tags %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"tags": tags})
+}
+
+type getTagNotesRequest struct {
+	Tag string `param:"tag"`
+}
+
+func (r *getTagNotesRequest) validate() error {
+	// nested tags arrive with their slashes escaped, e.g. project%2Falpha
+	tag, err := url.PathUnescape(r.Tag)
+	if err != nil {
+		return err
+	}
+
+	r.Tag = markdown.NormalizeTag(tag)
+	if r.Tag == "" {
+		return errors.New("a valid tag is required")
+	}
+
+	return nil
+}
+
+func (h *TagsHandler) HandleGetTagNotes(c echo.Context) error {
+	var req getTagNotesRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	notes, err := h.tagsStore.GetNotesWithTag(user.ID, workspaceID(c), req.Tag)
+	if err != nil {
+		h.logger.Printf("ERROR: getting notes with tag %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"tag": req.Tag, "notes": notes})
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"markdown-notes/internal/middleware"
+	"markdown-notes/internal/service"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/utils"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// workspaceID returns the workspace the request picked, 0 if it didn't.
+func workspaceID(c echo.Context) int64 {
+	if workspace, ok := middleware.CurrentWorkspace(c); ok {
+		return workspace.ID
+	}
+
+	return 0
+}
+
+// workspaceFolder swaps folder_id 0, the root folder, for the root of the
+// workspace the request picked. Without one it stays 0, which the stores and
+// services take to be the root of the user's personal workspace.
+func workspaceFolder(c echo.Context, folder_id int64) int64 {
+	if workspace, ok := middleware.CurrentWorkspace(c); ok && folder_id == 0 {
+		return workspace.RootFolderID
+	}
+
+	return folder_id
+}
+
+func httpStatusFromWorkspaceError(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, store.ErrLastAdmin):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrWorkspaceRole),
+		errors.Is(err, service.ErrPersonalWorkspace):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type WorkspacesHandler struct {
+	workspacesService service.WorkspacesServiceI
+	logger            *log.Logger
+}
+
+func NewWorkspacesHandler(workspacesService service.WorkspacesServiceI, logger *log.Logger) *WorkspacesHandler {
+	return &WorkspacesHandler{
+		workspacesService: workspacesService,
+		logger:            logger,
+	}
+}
+
+// workspaceError writes the response for an error from the workspaces
+// service.
+func (h *WorkspacesHandler) workspaceError(c echo.Context, err error, action string) error {
+	status := httpStatusFromWorkspaceError(err)
+	switch status {
+	case http.StatusNotFound:
+		return c.JSON(status, utils.Envelope{"error": "workspace or member doesn't exist or you aren't a member of it"})
+	case http.StatusInternalServerError:
+		h.logger.Printf("ERROR: %s %v", action, err)
+		return c.JSON(status, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(status, utils.Envelope{"error": err.Error()})
+}
+
+type createWorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+func (r *createWorkspaceRequest) validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(r.Name) > 255 {
+		return errors.New("name must be at most 255 characters")
+	}
+
+	return nil
+}
+
+type getWorkspaceRequest struct {
+	WorkspaceID int64 `param:"workspace_id"`
+}
+
+func (r *getWorkspaceRequest) validate() error {
+	if r.WorkspaceID == 0 {
+		return errors.New("workspace_id is required")
+	}
+
+	return nil
+}
+
+type workspaceMemberRequest struct {
+	WorkspaceID int64               `param:"workspace_id"`
+	UserID      int64               `param:"user_id"`
+	Role        store.WorkspaceRole `json:"role"`
+}
+
+func (r *workspaceMemberRequest) validate() error {
+	if r.WorkspaceID == 0 {
+		return errors.New("workspace_id is required")
+	}
+
+	if r.UserID == 0 {
+		return errors.New("user_id is required")
+	}
+
+	return nil
+}
+
+type inviteRequest struct {
+	WorkspaceID int64               `param:"workspace_id"`
+	Role        store.WorkspaceRole `json:"role"`
+}
+
+func (r *inviteRequest) validate() error {
+	if r.WorkspaceID == 0 {
+		return errors.New("workspace_id is required")
+	}
+
+	return nil
+}
+
+type acceptInvitationRequest struct {
+	Token string `param:"token"`
+}
+
+func (r *acceptInvitationRequest) validate() error {
+	if r.Token == "" {
+		return errors.New("token is required")
+	}
+
+	return nil
+}
+
+func (h *WorkspacesHandler) HandleGetWorkspaces(c echo.Context) error {
+	user := c.Get("user").(*store.User)
+	workspaces, err := h.workspacesService.GetWorkspaces(user)
+	if err != nil {
+		h.logger.Printf("ERROR: getting workspaces %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"workspaces": workspaces})
+}
+
+func (h *WorkspacesHandler) HandleCreateWorkspace(c echo.Context) error {
+	var req createWorkspaceRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	workspace, err := h.workspacesService.CreateWorkspace(user, req.Name)
+	if err != nil {
+		return h.workspaceError(c, err, "creating workspace")
+	}
+
+	return c.JSON(http.StatusCreated, workspace)
+}
+
+func (h *WorkspacesHandler) HandleGetWorkspace(c echo.Context) error {
+	var req getWorkspaceRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	workspace, err := h.workspacesService.GetWorkspace(user, req.WorkspaceID)
+	if err != nil {
+		return h.workspaceError(c, err, "getting workspace")
+	}
+
+	return c.JSON(http.StatusOK, workspace)
+}
+
+func (h *WorkspacesHandler) HandleGetMembers(c echo.Context) error {
+	var req getWorkspaceRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	members, err := h.workspacesService.GetMembers(user, req.WorkspaceID)
+	if err != nil {
+		return h.workspaceError(c, err, "getting workspace members")
+	}
+
+	return c.JSON(http.StatusOK, utils.Envelope{"members": members})
+}
+
+func (h *WorkspacesHandler) HandleUpdateMember(c echo.Context) error {
+	var req workspaceMemberRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	member, err := h.workspacesService.UpdateMember(user, req.WorkspaceID, req.UserID, req.Role)
+	if err != nil {
+		return h.workspaceError(c, err, "updating workspace member")
+	}
+
+	return c.JSON(http.StatusOK, member)
+}
+
+// HandleRemoveMember takes someone out of a workspace, members can also use
+// it to leave one.
+func (h *WorkspacesHandler) HandleRemoveMember(c echo.Context) error {
+	var req workspaceMemberRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	err = h.workspacesService.RemoveMember(user, req.WorkspaceID, req.UserID)
+	if err != nil {
+		return h.workspaceError(c, err, "removing workspace member")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleInvite creates an invitation token for the workspace. The token is
+// only returned here, whoever it is passed on to accepts it with
+// HandleAcceptInvitation.
+func (h *WorkspacesHandler) HandleInvite(c echo.Context) error {
+	var req inviteRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	token, err := h.workspacesService.Invite(user, req.WorkspaceID, req.Role)
+	if err != nil {
+		return h.workspaceError(c, err, "creating invitation")
+	}
+
+	return c.JSON(http.StatusCreated, utils.Envelope{"invitation": token})
+}
+
+func (h *WorkspacesHandler) HandleAcceptInvitation(c echo.Context) error {
+	var req acceptInvitationRequest
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	err := req.validate()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	}
+
+	user := c.Get("user").(*store.User)
+	workspace, err := h.workspacesService.AcceptInvitation(user, req.Token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, utils.Envelope{"error": "invitation doesn't exist or has expired"})
+		}
+		h.logger.Printf("ERROR: accepting invitation %v", err)
+		return c.JSON(http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, workspace)
+}
@@ -2,27 +2,55 @@ package app
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"markdown-notes/internal/api"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/events"
+	"markdown-notes/internal/live"
 	"markdown-notes/internal/middleware"
+	"markdown-notes/internal/render"
 	"markdown-notes/internal/service"
 	"markdown-notes/internal/store"
 	"markdown-notes/internal/utils"
 	"markdown-notes/migrations"
 	"net/http"
 	"os"
+	"runtime"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
 type App struct {
-	Logger         *log.Logger
-	DB             *sql.DB
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	NotesHandler   *api.NotesHandler
-	FolderHandler  *api.FolderHandler
-	UserMiddleware *middleware.UserMiddleware
+	Logger              *log.Logger
+	DB                  *sql.DB
+	UserHandler         *api.UserHandler
+	TokenHandler        *api.TokenHandler
+	NotesHandler        *api.NotesHandler
+	RevisionsHandler    *api.RevisionsHandler
+	TagsHandler         *api.TagsHandler
+	LinksHandler        *api.LinksHandler
+	AttachmentsHandler  *api.AttachmentsHandler
+	ExportHandler       *api.ExportHandler
+	ImportHandler       *api.ImportHandler
+	PublishHandler      *api.PublishHandler
+	ShareHandler        *api.ShareHandler
+	MembersHandler      *api.MembersHandler
+	LiveHandler         *api.LiveHandler
+	EventsHandler       *api.EventsHandler
+	SyncHandler         *api.SyncHandler
+	WorkspacesHandler   *api.WorkspacesHandler
+	FolderHandler       *api.FolderHandler
+	UserMiddleware      *middleware.UserMiddleware
+	WorkspaceMiddleware *middleware.WorkspaceMiddleware
+
+	importJobsService *service.ImportJobsService
+	thumbnailService  *service.ThumbnailService
+	blobCollector     *service.BlobCollector
+	eventsBroker      *events.Broker
+	liveHub           *live.Hub
 }
 
 func NewApp() (*App, error) {
@@ -36,6 +64,11 @@ func NewApp() (*App, error) {
 		panic(err)
 	}
 
+	return NewAppWithDB(pgDB)
+}
+
+// NewAppWithDB wires the app up on a database that is migrated already.
+func NewAppWithDB(pgDB *sql.DB) (*App, error) {
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 
 	// our stores will go hore
@@ -43,32 +76,155 @@ func NewApp() (*App, error) {
 	tokenStore := store.NewPostgresTokenStore(pgDB)
 	notesStore := store.NewPostgresNotesStore(pgDB)
 	folderStore := store.NewPostgresFoldersStore(pgDB)
+	revisionsStore := store.NewPostgresNoteRevisionsStore(pgDB)
+	tagsStore := store.NewPostgresTagsStore(pgDB)
+	linksStore := store.NewPostgresNoteLinksStore(pgDB)
+	attachmentsStore := store.NewPostgresAttachmentsStore(pgDB)
+	sharesStore := store.NewPostgresSharesStore(pgDB)
+	membersStore := store.NewPostgresMembersStore(pgDB)
+	workspacesStore := store.NewPostgresWorkspacesStore(pgDB)
+	eventsStore := store.NewPostgresEventsStore(pgDB)
+	syncStore := store.NewPostgresSyncStore(pgDB)
+
+	attachmentsDir := os.Getenv("ATTACHMENTS_DIR")
+	if attachmentsDir == "" {
+		attachmentsDir = "data/attachments"
+	}
+	blobs, err := blob.NewLocalBlobStore(attachmentsDir)
+	if err != nil {
+		return nil, fmt.Errorf("opening ATTACHMENTS_DIR: %w", err)
+	}
+
+	sitesDir := os.Getenv("SITES_DIR")
+	if sitesDir == "" {
+		sitesDir = "data/sites"
+	}
+
+	if window := os.Getenv("NOTE_REVISION_WINDOW"); window != "" {
+		revisionWindow, err := time.ParseDuration(window)
+		if err != nil {
+			return nil, fmt.Errorf("parsing NOTE_REVISION_WINDOW: %w", err)
+		}
+		notesStore.SetRevisionWindow(revisionWindow)
+	}
+
+	thumbnailWorkers := runtime.NumCPU()
+	if workers := os.Getenv("THUMBNAIL_WORKERS"); workers != "" {
+		thumbnailWorkers, err = strconv.Atoi(workers)
+		if err != nil {
+			return nil, fmt.Errorf("parsing THUMBNAIL_WORKERS: %w", err)
+		}
+	}
+
+	liveSaveInterval := live.DefaultSaveInterval
+	if interval := os.Getenv("LIVE_SAVE_INTERVAL"); interval != "" {
+		liveSaveInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("parsing LIVE_SAVE_INTERVAL: %w", err)
+		}
+	}
+
+	eventsRetention := events.DefaultRetention
+	if retention := os.Getenv("EVENTS_RETENTION"); retention != "" {
+		eventsRetention, err = time.ParseDuration(retention)
+		if err != nil {
+			return nil, fmt.Errorf("parsing EVENTS_RETENTION: %w", err)
+		}
+	}
+
+	importWorkers := 2
+	if workers := os.Getenv("IMPORT_WORKERS"); workers != "" {
+		importWorkers, err = strconv.Atoi(workers)
+		if err != nil {
+			return nil, fmt.Errorf("parsing IMPORT_WORKERS: %w", err)
+		}
+	}
+
+	renderer := render.NewRenderer(render.DefaultCacheSize)
+	liveHub := live.NewHub(notesStore, liveSaveInterval, logger)
+	eventsBroker := events.NewBroker(pgDB, eventsStore, eventsRetention, logger)
 
 	// our services will go here
-	registerUserSercvice := service.NewRegisterUserService(pgDB, userStore, folderStore)
-	folderContentsService := service.NewFolderContentsService(pgDB, userStore, folderStore, notesStore)
+	registerUserSercvice := service.NewRegisterUserService(pgDB, userStore, workspacesStore)
+	publishService := service.NewPublishService(folderStore, notesStore, tagsStore, linksStore, attachmentsStore, blobs, renderer, sitesDir)
+	folderContentsService := service.NewFolderContentsService(pgDB, userStore, folderStore, notesStore, publishService)
+	blobCollector := service.NewBlobCollector(attachmentsStore, blobs, service.DefaultBlobCollectInterval, logger)
+	thumbnailService := service.NewThumbnailService(attachmentsStore, blobs, blobCollector, thumbnailWorkers, logger)
+	attachmentsService := service.NewAttachmentsService(notesStore, attachmentsStore, blobs, blobCollector, thumbnailService)
+	exportService := service.NewExportService(folderStore, notesStore, tagsStore)
+	importService := service.NewImportService(pgDB, folderStore, notesStore, attachmentsStore, blobs, blobCollector, thumbnailService)
+	importJobsService := service.NewImportJobsService(importService, folderStore, importWorkers, logger)
+	shareService := service.NewShareService(sharesStore, folderStore, notesStore, tagsStore, linksStore, attachmentsStore, blobs, renderer)
+	membersService := service.NewMembersService(userStore, folderStore, membersStore)
+	workspacesService := service.NewWorkspacesService(workspacesStore)
+	syncService := service.NewSyncService(syncStore, notesStore, folderStore, workspacesStore, folderContentsService, logger)
 
 	// our handlers will go here
 	userHandler := api.NewUserHandler(userStore, folderStore, registerUserSercvice, logger)
 	tokenHandler := api.NewTokenhandler(tokenStore, userStore, logger)
-	notesHandler := api.NewNotesHandler(notesStore, folderContentsService, logger)
+	notesHandler := api.NewNotesHandler(notesStore, folderContentsService, renderer, logger)
 	folderHandler := api.NewFolderHandler(folderContentsService, folderStore, logger)
+	revisionsHandler := api.NewRevisionsHandler(revisionsStore, logger)
+	tagsHandler := api.NewTagsHandler(tagsStore, logger)
+	linksHandler := api.NewLinksHandler(linksStore, logger)
+	attachmentsHandler := api.NewAttachmentsHandler(attachmentsService, thumbnailService, logger)
+	exportHandler := api.NewExportHandler(exportService, logger)
+	importHandler := api.NewImportHandler(importJobsService, logger)
+	publishHandler := api.NewPublishHandler(publishService, logger)
+	shareHandler := api.NewShareHandler(shareService, logger)
+	membersHandler := api.NewMembersHandler(membersService, logger)
+	workspacesHandler := api.NewWorkspacesHandler(workspacesService, logger)
+	liveHandler := api.NewLiveHandler(liveHub, logger)
+	eventsHandler := api.NewEventsHandler(eventsStore, eventsBroker, logger)
+	syncHandler := api.NewSyncHandler(syncService, logger)
 
 	app := &App{
-		Logger:        logger,
-		DB:            pgDB,
-		UserHandler:   userHandler,
-		TokenHandler:  tokenHandler,
-		NotesHandler:  notesHandler,
-		FolderHandler: folderHandler,
+		Logger:             logger,
+		DB:                 pgDB,
+		UserHandler:        userHandler,
+		TokenHandler:       tokenHandler,
+		NotesHandler:       notesHandler,
+		RevisionsHandler:   revisionsHandler,
+		TagsHandler:        tagsHandler,
+		LinksHandler:       linksHandler,
+		AttachmentsHandler: attachmentsHandler,
+		ExportHandler:      exportHandler,
+		ImportHandler:      importHandler,
+		PublishHandler:     publishHandler,
+		ShareHandler:       shareHandler,
+		MembersHandler:     membersHandler,
+		WorkspacesHandler:  workspacesHandler,
+		LiveHandler:        liveHandler,
+		EventsHandler:      eventsHandler,
+		SyncHandler:        syncHandler,
+		FolderHandler:      folderHandler,
 		UserMiddleware: &middleware.UserMiddleware{
 			UserStore: userStore,
 		},
+		WorkspaceMiddleware: &middleware.WorkspaceMiddleware{
+			WorkspacesStore: workspacesStore,
+		},
+		importJobsService: importJobsService,
+		thumbnailService:  thumbnailService,
+		blobCollector:     blobCollector,
+		eventsBroker:      eventsBroker,
+		liveHub:           liveHub,
 	}
 
 	return app, nil
 }
 
+// Close stops the background work of the app, once the server stopped
+// handling requests. Notes open for live editing are saved first, imports
+// queue thumbnails, so they finish before those.
+func (a *App) Close() {
+	a.liveHub.Close()
+	a.importJobsService.Close()
+	a.thumbnailService.Close()
+	a.blobCollector.Close()
+	a.eventsBroker.Close()
+}
+
 func (a *App) HealthCheck(e echo.Context) error {
 	return e.JSON(http.StatusOK, utils.Envelope{"status": "ok"})
 }
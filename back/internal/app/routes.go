@@ -0,0 +1,99 @@
+package app
+
+import (
+	"markdown-notes/internal/middleware"
+	"markdown-notes/internal/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterRoutes adds the API's routes to e.
+func (a *App) RegisterRoutes(e *echo.Echo) {
+	e.GET("/health", a.HealthCheck)
+	e.POST("/user/register", a.UserHandler.HandleRegisterUser)
+	e.POST("/tokens/auth", a.TokenHandler.HandleCreateToken)
+
+	// share links are for people without an account
+	e.GET("/s/style.css", a.ShareHandler.HandleShareStylesheet)
+	e.GET("/s/:token", a.ShareHandler.HandleViewShare)
+	e.POST("/s/:token", a.ShareHandler.HandleViewShare)
+	e.GET("/s/:token/notes/:note_id", a.ShareHandler.HandleViewSharedNote)
+	e.POST("/s/:token/notes/:note_id", a.ShareHandler.HandleViewSharedNote)
+	e.GET("/s/:token/folders/:folder_id", a.ShareHandler.HandleViewSharedFolder)
+	e.POST("/s/:token/folders/:folder_id", a.ShareHandler.HandleViewSharedFolder)
+	e.GET("/s/:token/attachments/:attachment_id", a.ShareHandler.HandleGetSharedAttachment)
+
+	r := e.Group("")
+	r.Use(a.UserMiddleware.AuthMiddleware, a.WorkspaceMiddleware.WorkspaceMiddleware)
+
+	restricted(r, a)
+}
+
+func restricted(g *echo.Group, app *App) {
+	g.GET("/me", func(c echo.Context) error {
+		u, ok := middleware.CurrentUser(c)
+		if !ok {
+			return echo.NewHTTPError(401, "not authenticated")
+		}
+		return c.JSON(200, utils.Envelope{"username": u.Username})
+	})
+	g.GET("/notes/:note_id", app.NotesHandler.HandleGetNote)
+	g.GET("/notes/:note_id/html", app.NotesHandler.HandleGetNoteHTML)
+	g.GET("/notes/:note_id/live", app.LiveHandler.HandleLive)
+	g.GET("/notes/:note_id/backlinks", app.LinksHandler.HandleGetBacklinks)
+	g.GET("/notes/:note_id/outlinks", app.LinksHandler.HandleGetOutlinks)
+	g.GET("/notes/:note_id/revisions", app.RevisionsHandler.HandleGetRevisions)
+	g.GET("/notes/:note_id/revisions/diff", app.RevisionsHandler.HandleDiffRevisions)
+	g.GET("/notes/:note_id/revisions/:rev", app.RevisionsHandler.HandleGetRevision)
+	g.GET("/notes/:note_id/attachments", app.AttachmentsHandler.HandleGetNoteAttachments)
+	g.GET("/attachments/:attachment_id", app.AttachmentsHandler.HandleGetAttachment)
+	g.GET("/folders", app.FolderHandler.GetRootFolderContent)
+	g.GET("/folders/shared", app.MembersHandler.HandleGetSharedFolders)
+	g.GET("/folders/:folder_id", app.FolderHandler.GetFolderContent)
+	g.GET("/folders/:folder_id/export.zip", app.ExportHandler.HandleExportFolder)
+	g.GET("/folders/:folder_id/site.zip", app.PublishHandler.HandleDownloadSite)
+	g.GET("/folders/:folder_id/members", app.MembersHandler.HandleGetMembers)
+	g.GET("/trash", app.NotesHandler.HandleGetTrash)
+	g.GET("/search", app.NotesHandler.HandleSearchNotes)
+	g.GET("/graph", app.LinksHandler.HandleGetGraph)
+	g.GET("/events", app.EventsHandler.HandleEvents)
+	g.GET("/sync", app.SyncHandler.HandleGetSync)
+	g.GET("/import/:job_id", app.ImportHandler.HandleGetImportJob)
+	g.GET("/shares", app.ShareHandler.HandleGetShares)
+	g.GET("/tags", app.TagsHandler.HandleGetTags)
+	g.GET("/tags/:tag/notes", app.TagsHandler.HandleGetTagNotes)
+	g.GET("/workspaces", app.WorkspacesHandler.HandleGetWorkspaces)
+	g.GET("/workspaces/:workspace_id", app.WorkspacesHandler.HandleGetWorkspace)
+	g.GET("/workspaces/:workspace_id/members", app.WorkspacesHandler.HandleGetMembers)
+
+	g.POST("/notes/new", app.NotesHandler.HandleCreateNote)
+	g.POST("/folders/new", app.FolderHandler.HandleCreateFolder)
+	g.POST("/import", app.ImportHandler.HandleImport)
+	g.POST("/sync", app.SyncHandler.HandlePostSync)
+	g.POST("/folders/:folder_id/publish", app.PublishHandler.HandlePublishFolder)
+	g.POST("/notes/:note_id/shares", app.ShareHandler.HandleCreateShare)
+	g.POST("/folders/:folder_id/shares", app.ShareHandler.HandleCreateShare)
+	g.POST("/folders/:folder_id/members", app.MembersHandler.HandleAddMember)
+	g.POST("/workspaces", app.WorkspacesHandler.HandleCreateWorkspace)
+	g.POST("/workspaces/:workspace_id/invitations", app.WorkspacesHandler.HandleInvite)
+	g.POST("/invitations/:token/accept", app.WorkspacesHandler.HandleAcceptInvitation)
+	g.POST("/notes/:note_id/attachments", app.AttachmentsHandler.HandleUploadAttachment)
+	g.POST("/attachments/:attachment_id/strip-location", app.AttachmentsHandler.HandleStripLocation)
+
+	g.POST("/notes/:note_id/revisions/:rev/restore", app.RevisionsHandler.HandleRestoreRevision)
+	g.POST("/trash/:note_id/restore", app.NotesHandler.HandleRestoreNote)
+
+	g.PATCH("/notes/:note_id/save", app.NotesHandler.HandlePatchNote)
+	g.PATCH("/folders/:folder_id", app.FolderHandler.HandlePatchFolder)
+	g.PATCH("/folders/:folder_id/members/:user_id", app.MembersHandler.HandleUpdateMember)
+	g.PATCH("/workspaces/:workspace_id/members/:user_id", app.WorkspacesHandler.HandleUpdateMember)
+
+	g.DELETE("/notes/:note_id", app.NotesHandler.HandleDeleteNote)
+	g.DELETE("/folders/:folder_id", app.FolderHandler.HandleDeleteFolder)
+	g.DELETE("/folders/:folder_id/publish", app.PublishHandler.HandleUnpublishFolder)
+	g.DELETE("/folders/:folder_id/members/:user_id", app.MembersHandler.HandleRemoveMember)
+	g.DELETE("/workspaces/:workspace_id/members/:user_id", app.WorkspacesHandler.HandleRemoveMember)
+	g.DELETE("/shares/:share_id", app.ShareHandler.HandleDeleteShare)
+	g.DELETE("/trash", app.NotesHandler.HandleEmptyTrash)
+	g.DELETE("/trash/:note_id", app.NotesHandler.HandlePurgeNote)
+}
@@ -0,0 +1,83 @@
+// Package archive maps folder and note names onto portable file names.
+package archive
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxNameBytes keeps names, with room for a collision suffix and extension,
+// under the 255 byte limit of common filesystems.
+const maxNameBytes = 200
+
+// reservedNames can't be used as file names on Windows, with or without an
+// extension.
+var reservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// SanitizeName turns a title into a name that is safe as a single path
+// element on Linux, macOS and Windows.
+func SanitizeName(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r):
+			continue
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			sb.WriteRune('-')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	clean := strings.Trim(sb.String(), " .")
+
+	if len(clean) > maxNameBytes {
+		cut := maxNameBytes
+		for !utf8.RuneStart(clean[cut]) {
+			cut--
+		}
+		clean = strings.TrimRight(clean[:cut], " .")
+	}
+
+	if clean == "" {
+		return "untitled"
+	}
+
+	if reservedNames[strings.ToLower(clean)] {
+		clean += "_"
+	}
+
+	return clean
+}
+
+// Namer hands out unique names within one directory. Names are compared
+// case insensitively so archives unpack the same on every filesystem.
+type Namer struct {
+	used map[string]bool
+}
+
+func NewNamer() *Namer {
+	return &Namer{used: map[string]bool{}}
+}
+
+// Name returns the sanitized name with ext appended, adding " (2)", " (3)"
+// and so on when it is already taken.
+func (n *Namer) Name(name string, ext string) string {
+	base := SanitizeName(name)
+
+	candidate := base + ext
+	for i := 2; n.used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+
+	n.used[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -0,0 +1,43 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeName(t *testing.T) {
+	cases := map[string]string{
+		"Meeting notes":     "Meeting notes",
+		"a/b\\c":            "a-b-c",
+		`what? "why" <how>`: "what- -why- -how-",
+		"tab\there\x00":     "tabhere",
+		"  .hidden. ":       "hidden",
+		"..":                "untitled",
+		"":                  "untitled",
+		"CON":               "CON_",
+		"lpt1":              "lpt1_",
+		"Cafés ☕":           "Cafés ☕",
+	}
+
+	for input, expected := range cases {
+		assert.Equal(t, expected, SanitizeName(input), "input %q", input)
+	}
+
+	long := SanitizeName(strings.Repeat("é", 150))
+	assert.LessOrEqual(t, len(long), maxNameBytes)
+	assert.True(t, utf8.ValidString(long))
+}
+
+func TestNamer(t *testing.T) {
+	namer := NewNamer()
+
+	assert.Equal(t, "Note.md", namer.Name("Note", ".md"))
+	assert.Equal(t, "note (2).md", namer.Name("note", ".md"))
+	assert.Equal(t, "Note (3).md", namer.Name("Note", ".md"))
+	assert.Equal(t, "a-b.md", namer.Name("a/b", ".md"))
+	assert.Equal(t, "a-b (2).md", namer.Name("a:b", ".md"))
+	assert.Equal(t, "Note", namer.Name("Note", ""))
+}
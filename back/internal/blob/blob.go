@@ -0,0 +1,127 @@
+// Package blob stores file contents addressed by their SHA-256 digest.
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var ErrInvalidKey = errors.New("blob key must be a hex encoded SHA-256 digest")
+
+// Blob is an open stored blob, seekable so it can serve range requests.
+type Blob interface {
+	io.ReadSeekCloser
+}
+
+// BlobStore keeps immutable blobs keyed by the SHA-256 of their content, so
+// storing the same bytes twice keeps a single copy.
+type BlobStore interface {
+	// Put stores everything read from r and returns its key and size.
+	Put(r io.Reader) (string, int64, error)
+	// Open returns the blob stored under key, or an error wrapping
+	// fs.ErrNotExist if there is none.
+	Open(key string) (Blob, error)
+	// Delete removes the blob stored under key, it is not an error if there
+	// is none.
+	Delete(key string) error
+}
+
+// LocalBlobStore keeps blobs as files below a directory, fanned out into
+// subdirectories by the first two characters of their key.
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+func validKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+func (s *LocalBlobStore) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+func (s *LocalBlobStore) Put(r io.Reader) (string, int64, error) {
+	// Write to a temporary file first, the key isn't known until the whole
+	// content has been hashed.
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(tmp, io.TeeReader(r, hash))
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return "", 0, err
+	}
+
+	key := hex.EncodeToString(hash.Sum(nil))
+	path := s.path(key)
+
+	_, err = os.Stat(path)
+	if err == nil {
+		// Already stored.
+		return key, size, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", 0, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return key, size, nil
+}
+
+func (s *LocalBlobStore) Open(key string) (Blob, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	return os.Open(s.path(key))
+}
+
+func (s *LocalBlobStore) Delete(key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
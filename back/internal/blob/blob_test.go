@@ -0,0 +1,66 @@
+package blob
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalBlobStore(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := NewLocalBlobStore(dir)
+	assert.NoError(t, err)
+
+	const helloKey = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+	t.Run("stores content under its sha256", func(t *testing.T) {
+		key, size, err := blobs.Put(strings.NewReader("hello world"))
+		assert.NoError(t, err)
+		assert.Equal(t, helloKey, key)
+		assert.Equal(t, int64(11), size)
+
+		b, err := blobs.Open(key)
+		assert.NoError(t, err)
+		defer b.Close()
+
+		content, err := io.ReadAll(b)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello world", string(content))
+	})
+
+	t.Run("deduplicates identical content", func(t *testing.T) {
+		key, _, err := blobs.Put(strings.NewReader("hello world"))
+		assert.NoError(t, err)
+		assert.Equal(t, helloKey, key)
+
+		entries, err := os.ReadDir(filepath.Join(dir, "b9"))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(entries))
+
+		// no temporary files are left behind
+		entries, err = os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(entries))
+	})
+
+	t.Run("rejects malformed keys", func(t *testing.T) {
+		_, err := blobs.Open("../../etc/passwd")
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	})
+
+	t.Run("deletes blobs", func(t *testing.T) {
+		err := blobs.Delete(helloKey)
+		assert.NoError(t, err)
+
+		_, err = blobs.Open(helloKey)
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+
+		err = blobs.Delete(helloKey)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,178 @@
+// Package events wakes up the streams of GET /events when notes or folders
+// change. The changes themselves are logged by triggers in the database,
+// which also NOTIFY the "events" channel with the workspace that changed, so
+// a change made through any replica reaches the streams of all of them. The
+// streams then read what they missed from the log.
+package events
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"markdown-notes/internal/store"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// DefaultRetention is how long events are kept for clients to resume from.
+const DefaultRetention = 7 * 24 * time.Hour
+
+const (
+	channel       = "events"
+	retryInterval = time.Second
+	pruneInterval = time.Hour
+)
+
+// Broker holds a connection listening for notifications and passes them on
+// to subscribers.
+type Broker struct {
+	db          *sql.DB
+	eventsStore store.EventsStore
+	retention   time.Duration
+	logger      *log.Logger
+
+	mu          sync.Mutex
+	subscribers map[chan struct{}]int64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewBroker starts listening right away and keeps reconnecting until Close.
+// Events older than retention are pruned every hour.
+func NewBroker(db *sql.DB, eventsStore store.EventsStore, retention time.Duration, logger *log.Logger) *Broker {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Broker{
+		db:          db,
+		eventsStore: eventsStore,
+		retention:   retention,
+		logger:      logger,
+		subscribers: map[chan struct{}]int64{},
+		cancel:      cancel,
+	}
+
+	b.wg.Add(2)
+	go b.listen(ctx)
+	go b.prune(ctx)
+
+	return b
+}
+
+// Subscribe returns a channel that receives a value whenever something
+// changed in the workspace, or in any of them for 0. Wake-ups that come in
+// while the last one hasn't been picked up yet are merged into it. The
+// returned func unsubscribes.
+func (b *Broker) Subscribe(workspace_id int64) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	b.subscribers[ch] = workspace_id
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+// Close stops listening.
+func (b *Broker) Close() {
+	b.cancel()
+	b.wg.Wait()
+}
+
+// wake notifies the subscribers of the workspace, or all of them for 0.
+func (b *Broker) wake(workspace_id int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch, subscribed := range b.subscribers {
+		if workspace_id != 0 && subscribed != 0 && subscribed != workspace_id {
+			continue
+		}
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *Broker) listen(ctx context.Context) {
+	defer b.wg.Done()
+
+	for {
+		err := b.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		b.logger.Printf("ERROR: listening for events %v", err)
+
+		select {
+		case <-time.After(retryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// listenOnce listens on a connection of its own until it fails. Whatever
+// was notified while not listening is still in the log, so everybody is
+// woken up once listening again to catch up.
+func (b *Broker) listenOnce(ctx context.Context) error {
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+
+		_, err := pgConn.Exec(ctx, "LISTEN "+channel)
+		if err != nil {
+			return err
+		}
+		b.wake(0)
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				// the connection is still listening, don't hand it back to the
+				// pool
+				return fmt.Errorf("%w: %w", driver.ErrBadConn, err)
+			}
+
+			workspace_id, err := strconv.ParseInt(notification.Payload, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: unexpected payload %q", driver.ErrBadConn, notification.Payload)
+			}
+			b.wake(workspace_id)
+		}
+	})
+}
+
+func (b *Broker) prune(ctx context.Context) {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := b.eventsStore.DeleteEventsBefore(time.Now().Add(-b.retention))
+		if err != nil && ctx.Err() == nil {
+			b.logger.Printf("ERROR: pruning events %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
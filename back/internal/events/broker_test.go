@@ -0,0 +1,42 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func woken(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestWake(t *testing.T) {
+	b := &Broker{subscribers: map[chan struct{}]int64{}}
+
+	all, _ := b.Subscribe(0)
+	one, _ := b.Subscribe(1)
+	two, unsubscribe := b.Subscribe(2)
+
+	b.wake(1)
+	b.wake(1)
+	assert.True(t, woken(all))
+	assert.False(t, woken(all), "wake-ups are merged")
+	assert.True(t, woken(one))
+	assert.False(t, woken(two))
+
+	b.wake(0)
+	assert.True(t, woken(all))
+	assert.True(t, woken(one))
+	assert.True(t, woken(two))
+
+	unsubscribe()
+	b.wake(2)
+	assert.True(t, woken(all))
+	assert.False(t, woken(one))
+	assert.False(t, woken(two))
+}
@@ -0,0 +1,265 @@
+// Package exif reads and scrubs the EXIF block embedded in JPEG and PNG
+// images, just enough to orient thumbnails and remove GPS location.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+const (
+	tagOrientation = 0x0112
+	tagGPSIFD      = 0x8825
+)
+
+var (
+	ErrUnsupported = errors.New("exif: only jpeg and png images are supported")
+	ErrMalformed   = errors.New("exif: malformed image")
+
+	jpegSOI       = []byte{0xff, 0xd8}
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	exifSignature = []byte("Exif\x00\x00")
+)
+
+// Orientation returns the EXIF orientation of an image, from 1 (upright) to
+// 8. Images without one, or that can't be parsed, are reported as 1.
+func Orientation(data []byte) int {
+	block, _, err := find(data)
+	if err != nil || block == nil {
+		return 1
+	}
+
+	t, err := parseTIFF(block)
+	if err != nil {
+		return 1
+	}
+
+	entry, ok := t.lookup(t.ifd0, tagOrientation)
+	if !ok || t.order.Uint16(entry[2:]) != 3 {
+		return 1
+	}
+
+	orientation := int(t.order.Uint16(entry[8:]))
+	if orientation < 1 || orientation > 8 {
+		return 1
+	}
+
+	return orientation
+}
+
+// StripLocation returns a copy of an image with every GPS tag in its EXIF
+// block blanked out, leaving the rest of the metadata and the pixels as they
+// were. changed is false if there was no location to remove.
+func StripLocation(data []byte) ([]byte, bool, error) {
+	out := bytes.Clone(data)
+
+	block, fixup, err := find(out)
+	if err != nil {
+		return nil, false, err
+	}
+	if block == nil {
+		return out, false, nil
+	}
+
+	t, err := parseTIFF(block)
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed, err := t.wipeGPS()
+	if err != nil || !changed {
+		return out, false, err
+	}
+
+	if fixup != nil {
+		fixup()
+	}
+
+	return out, true, nil
+}
+
+// find locates the TIFF structured EXIF block inside an image. The block is
+// a subslice of data so it can be edited in place, fixup (if not nil) must be
+// called afterwards to keep the container consistent.
+func find(data []byte) ([]byte, func(), error) {
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		return findJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return findPNG(data)
+	default:
+		return nil, nil, ErrUnsupported
+	}
+}
+
+func findJPEG(data []byte) ([]byte, func(), error) {
+	pos := len(jpegSOI)
+	for pos+4 <= len(data) {
+		if data[pos] != 0xff {
+			return nil, nil, ErrMalformed
+		}
+
+		marker := data[pos+1]
+		switch {
+		case marker == 0xff:
+			// fill byte
+			pos++
+			continue
+		case marker == 0xd8 || marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// markers without a length
+			pos += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			// start of scan or end of image, metadata comes before either
+			return nil, nil, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil, nil, ErrMalformed
+		}
+
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, exifSignature) {
+			return segment[len(exifSignature):], nil, nil
+		}
+
+		pos += 2 + length
+	}
+
+	return nil, nil, nil
+}
+
+func findPNG(data []byte) ([]byte, func(), error) {
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			return nil, nil, ErrMalformed
+		}
+
+		chunkType := string(data[pos+4 : pos+8])
+		chunk := data[pos+4 : pos+8+length]
+		crc := data[pos+8+length : pos+12+length]
+
+		switch chunkType {
+		case "eXIf":
+			return chunk[4:], func() {
+				binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk))
+			}, nil
+		case "IDAT", "IEND":
+			return nil, nil, nil
+		}
+
+		pos += 12 + length
+	}
+
+	return nil, nil, nil
+}
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+	ifd0  int
+}
+
+func parseTIFF(data []byte) (*tiff, error) {
+	if len(data) < 8 {
+		return nil, ErrMalformed
+	}
+
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, ErrMalformed
+	}
+
+	if t.order.Uint16(data[2:]) != 42 {
+		return nil, ErrMalformed
+	}
+
+	t.ifd0 = int(t.order.Uint32(data[4:]))
+	if _, err := t.entries(t.ifd0); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// entries returns the raw 12 byte entries of the IFD at offset.
+func (t *tiff) entries(offset int) ([]byte, error) {
+	if offset < 8 || offset+2 > len(t.data) {
+		return nil, ErrMalformed
+	}
+
+	count := int(t.order.Uint16(t.data[offset:]))
+	end := offset + 2 + count*12
+	if end > len(t.data) {
+		return nil, ErrMalformed
+	}
+
+	return t.data[offset+2 : end], nil
+}
+
+func (t *tiff) lookup(offset int, tag uint16) ([]byte, bool) {
+	entries, err := t.entries(offset)
+	if err != nil {
+		return nil, false
+	}
+
+	for i := 0; i+12 <= len(entries); i += 12 {
+		if t.order.Uint16(entries[i:]) == tag {
+			return entries[i : i+12], true
+		}
+	}
+
+	return nil, false
+}
+
+// typeSizes holds the size in bytes of one value of each TIFF field type.
+var typeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// wipeGPS zeroes the GPS IFD, including values stored out of line, and marks
+// it as empty. The pointer to it stays so no other offsets have to move.
+func (t *tiff) wipeGPS() (bool, error) {
+	pointer, ok := t.lookup(t.ifd0, tagGPSIFD)
+	if !ok {
+		return false, nil
+	}
+
+	offset := int(t.order.Uint32(pointer[8:]))
+	entries, err := t.entries(offset)
+	if err != nil {
+		return false, err
+	}
+	if len(entries) == 0 {
+		return false, nil
+	}
+
+	for i := 0; i+12 <= len(entries); i += 12 {
+		size := typeSizes[t.order.Uint16(entries[i+2:])] * int(t.order.Uint32(entries[i+4:]))
+		if size <= 4 {
+			continue
+		}
+
+		valueOffset := int(t.order.Uint32(entries[i+8:]))
+		if valueOffset < 8 || valueOffset+size > len(t.data) {
+			return false, ErrMalformed
+		}
+		clear(t.data[valueOffset : valueOffset+size])
+	}
+
+	// the entries and the next IFD offset after them
+	end := min(offset+2+len(entries)+4, len(t.data))
+	clear(t.data[offset:end])
+
+	return true, nil
+}
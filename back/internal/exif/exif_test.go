@@ -0,0 +1,153 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testTIFF builds a little endian EXIF block with an orientation and a GPS
+// IFD holding a latitude stored out of line.
+func testTIFF(orientation uint16) []byte {
+	le := binary.LittleEndian
+	b := make([]byte, 92)
+
+	copy(b, "II")
+	le.PutUint16(b[2:], 42)
+	le.PutUint32(b[4:], 8)
+
+	// IFD0 at 8
+	le.PutUint16(b[8:], 2)
+	le.PutUint16(b[10:], tagOrientation)
+	le.PutUint16(b[12:], 3)
+	le.PutUint32(b[14:], 1)
+	le.PutUint16(b[18:], orientation)
+	le.PutUint16(b[22:], tagGPSIFD)
+	le.PutUint16(b[24:], 4)
+	le.PutUint32(b[26:], 1)
+	le.PutUint32(b[30:], 38)
+
+	// GPS IFD at 38
+	le.PutUint16(b[38:], 2)
+	le.PutUint16(b[40:], 1) // GPSLatitudeRef
+	le.PutUint16(b[42:], 2)
+	le.PutUint32(b[44:], 2)
+	copy(b[48:], "N\x00")
+	le.PutUint16(b[52:], 2) // GPSLatitude
+	le.PutUint16(b[54:], 5)
+	le.PutUint32(b[56:], 3)
+	le.PutUint32(b[60:], 68)
+
+	// latitude at 68
+	for i, v := range []uint32{51, 1, 30, 1, 7, 1} {
+		le.PutUint32(b[68+i*4:], v)
+	}
+
+	return b
+}
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	return img
+}
+
+func testJPEG(t *testing.T, block []byte) []byte {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, testImage(), nil)
+	assert.NoError(t, err)
+
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(2+len(exifSignature)+len(block)))
+	segment = append(segment, exifSignature...)
+	segment = append(segment, block...)
+
+	encoded := buf.Bytes()
+	return append(append(bytes.Clone(encoded[:2]), segment...), encoded[2:]...)
+}
+
+func testPNG(t *testing.T, block []byte) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, testImage())
+	assert.NoError(t, err)
+
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(block)))
+	chunk = append(chunk, "eXIf"...)
+	chunk = append(chunk, block...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// after the signature and IHDR chunk
+	encoded := buf.Bytes()
+	return append(append(bytes.Clone(encoded[:33]), chunk...), encoded[33:]...)
+}
+
+func TestOrientation(t *testing.T) {
+	assert.Equal(t, 6, Orientation(testJPEG(t, testTIFF(6))))
+	assert.Equal(t, 3, Orientation(testPNG(t, testTIFF(3))))
+	assert.Equal(t, 1, Orientation(testJPEG(t, testTIFF(42))))
+	assert.Equal(t, 1, Orientation([]byte("GIF89a")))
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, testImage(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, Orientation(buf.Bytes()))
+}
+
+func TestStripLocation(t *testing.T) {
+	t.Run("jpeg", func(t *testing.T) {
+		original := testJPEG(t, testTIFF(6))
+
+		stripped, changed, err := StripLocation(original)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		assert.Equal(t, len(original), len(stripped))
+		assert.False(t, bytes.Contains(stripped, []byte("N\x00")))
+		assert.Equal(t, 6, Orientation(stripped))
+
+		_, err = jpeg.Decode(bytes.NewReader(stripped))
+		assert.NoError(t, err)
+
+		// nothing left to remove the second time
+		_, changed, err = StripLocation(stripped)
+		assert.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("png keeps a valid chunk checksum", func(t *testing.T) {
+		stripped, changed, err := StripLocation(testPNG(t, testTIFF(1)))
+		assert.NoError(t, err)
+		assert.True(t, changed)
+
+		_, err = png.Decode(bytes.NewReader(stripped))
+		assert.NoError(t, err)
+	})
+
+	t.Run("images without exif are left alone", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := png.Encode(&buf, testImage())
+		assert.NoError(t, err)
+
+		stripped, changed, err := StripLocation(buf.Bytes())
+		assert.NoError(t, err)
+		assert.False(t, changed)
+		assert.Equal(t, buf.Bytes(), stripped)
+	})
+
+	t.Run("unsupported and malformed images", func(t *testing.T) {
+		_, _, err := StripLocation([]byte("GIF89a"))
+		assert.ErrorIs(t, err, ErrUnsupported)
+
+		block := testTIFF(1)
+		binary.LittleEndian.PutUint32(block[60:], 1000)
+		_, _, err = StripLocation(testJPEG(t, block))
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+}
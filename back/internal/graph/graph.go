@@ -0,0 +1,111 @@
+// Package graph shapes the note link graph for export.
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"markdown-notes/internal/store"
+	"strings"
+)
+
+type Graph struct {
+	Nodes []store.GraphNode `json:"nodes"`
+	Edges []store.GraphEdge `json:"edges"`
+}
+
+// Neighborhood returns the subgraph of notes within depth links of focus,
+// following links in either direction. ok is false if focus isn't in g.
+func (g *Graph) Neighborhood(focus int64, depth int) (*Graph, bool) {
+	adjacent := map[int64][]int64{}
+	for _, edge := range g.Edges {
+		adjacent[edge.Source] = append(adjacent[edge.Source], edge.Target)
+		adjacent[edge.Target] = append(adjacent[edge.Target], edge.Source)
+	}
+
+	found := false
+	for _, node := range g.Nodes {
+		if node.ID == focus {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	seen := map[int64]bool{focus: true}
+	frontier := []int64{focus}
+	for i := 0; i < depth && len(frontier) > 0; i++ {
+		var next []int64
+		for _, id := range frontier {
+			for _, neighbor := range adjacent[id] {
+				if !seen[neighbor] {
+					seen[neighbor] = true
+					next = append(next, neighbor)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	sub := &Graph{Nodes: []store.GraphNode{}, Edges: []store.GraphEdge{}}
+	for _, node := range g.Nodes {
+		if seen[node.ID] {
+			sub.Nodes = append(sub.Nodes, node)
+		}
+	}
+	for _, edge := range g.Edges {
+		if seen[edge.Source] && seen[edge.Target] {
+			sub.Edges = append(sub.Edges, edge)
+		}
+	}
+
+	return sub, true
+}
+
+// WriteDOT writes g as a Graphviz digraph, clustering notes by folder.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph notes {")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+
+	var folders []string
+	byFolder := map[string][]store.GraphNode{}
+	for _, node := range g.Nodes {
+		if _, ok := byFolder[node.FolderPath]; !ok {
+			folders = append(folders, node.FolderPath)
+		}
+		byFolder[node.FolderPath] = append(byFolder[node.FolderPath], node)
+	}
+
+	for i, folder := range folders {
+		fmt.Fprintf(bw, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(bw, "\t\tlabel=%s;\n", quote(folder))
+		for _, node := range byFolder[folder] {
+			fmt.Fprintf(bw, "\t\tn%d [label=%s", node.ID, quote(node.Title))
+			if len(node.Tags) > 0 {
+				fmt.Fprintf(bw, ", tooltip=%s", quote("#"+strings.Join(node.Tags, " #")))
+			}
+			fmt.Fprintln(bw, "];")
+		}
+		fmt.Fprintln(bw, "\t}")
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(bw, "\tn%d -> n%d [class=%s];\n", edge.Source, edge.Target, quote(edge.Kind))
+	}
+
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+// quote returns s as a DOT double-quoted string.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,84 @@
+package graph
+
+import (
+	"markdown-notes/internal/store"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testGraph() *Graph {
+	return &Graph{
+		Nodes: []store.GraphNode{
+			{ID: 1, Title: "a", FolderID: 1, FolderPath: "/"},
+			{ID: 2, Title: "b", FolderID: 1, FolderPath: "/"},
+			{ID: 3, Title: `say "hi"`, FolderID: 2, FolderPath: "/sub", Tags: []string{"x", "y/z"}},
+			{ID: 4, Title: "d", FolderID: 2, FolderPath: "/sub"},
+			{ID: 5, Title: "lonely", FolderID: 1, FolderPath: "/"},
+		},
+		Edges: []store.GraphEdge{
+			{Source: 1, Target: 2, Kind: "wiki"},
+			{Source: 3, Target: 2, Kind: "markdown"},
+			{Source: 3, Target: 4, Kind: "wiki"},
+		},
+	}
+}
+
+func nodeIDs(g *Graph) []int64 {
+	ids := []int64{}
+	for _, node := range g.Nodes {
+		ids = append(ids, node.ID)
+	}
+	return ids
+}
+
+func TestNeighborhood(t *testing.T) {
+	g := testGraph()
+
+	t.Run("depth 0 is just the focal note", func(t *testing.T) {
+		sub, ok := g.Neighborhood(1, 0)
+		assert.True(t, ok)
+		assert.Equal(t, []int64{1}, nodeIDs(sub))
+		assert.Empty(t, sub.Edges)
+	})
+
+	t.Run("follows links in both directions", func(t *testing.T) {
+		sub, ok := g.Neighborhood(2, 1)
+		assert.True(t, ok)
+		assert.Equal(t, []int64{1, 2, 3}, nodeIDs(sub))
+		assert.Len(t, sub.Edges, 2)
+	})
+
+	t.Run("expands by depth", func(t *testing.T) {
+		sub, ok := g.Neighborhood(1, 2)
+		assert.True(t, ok)
+		assert.Equal(t, []int64{1, 2, 3}, nodeIDs(sub))
+
+		sub, ok = g.Neighborhood(1, 3)
+		assert.True(t, ok)
+		assert.Equal(t, []int64{1, 2, 3, 4}, nodeIDs(sub))
+		assert.Len(t, sub.Edges, 3)
+	})
+
+	t.Run("missing focal note", func(t *testing.T) {
+		_, ok := g.Neighborhood(99, 1)
+		assert.False(t, ok)
+	})
+}
+
+func TestWriteDOT(t *testing.T) {
+	var sb strings.Builder
+	err := testGraph().WriteDOT(&sb)
+	assert.NoError(t, err)
+
+	dot := sb.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph notes {\n"))
+	assert.True(t, strings.HasSuffix(dot, "}\n"))
+	assert.Contains(t, dot, "subgraph cluster_0 {\n\t\tlabel=\"/\";")
+	assert.Contains(t, dot, "subgraph cluster_1 {\n\t\tlabel=\"/sub\";")
+	assert.Contains(t, dot, `n3 [label="say \"hi\"", tooltip="#x #y/z"];`)
+	assert.Contains(t, dot, `n5 [label="lonely"];`)
+	assert.Contains(t, dot, `n3 -> n2 [class="markdown"];`)
+	assert.Equal(t, 3, strings.Count(dot, " -> "))
+}
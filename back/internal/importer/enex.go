@@ -0,0 +1,331 @@
+package importer
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"markdown-notes/internal/archive"
+	"markdown-notes/internal/markdown"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// enexTimeLayout is how Evernote writes created and updated times.
+const enexTimeLayout = "20060102T150405Z"
+
+// extensionRegex matches file extensions that are safe to use in the paths
+// resources are linked by.
+var extensionRegex = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// ENEX imports an Evernote .enex export. Every note lands in the folder being
+// imported into, with its tags, times and source URL kept as frontmatter and
+// its embedded resources as attachments.
+type ENEX struct{}
+
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Updated   string         `xml:"updated"`
+	Tags      []string       `xml:"tag"`
+	SourceURL string         `xml:"note-attributes>source-url"`
+	Resources []enexResource `xml:"resource"`
+}
+
+type enexResource struct {
+	Data     enexData `xml:"data"`
+	Mime     string   `xml:"mime"`
+	FileName string   `xml:"resource-attributes>file-name"`
+}
+
+// enexData is where the base64 content of a resource is in the export. It is
+// hashed and measured while decoding but not kept, the file is read from the
+// export again when it is imported.
+type enexData struct {
+	start int64
+	end   int64
+	size  int64
+	hash  string
+	valid bool
+}
+
+// UnmarshalXML streams the content through the hash. Offsets only cover
+// the content when it is plain text, without entities or CDATA sections,
+// which base64 never needs.
+func (d *enexData) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	d.start = decoder.InputOffset()
+	d.end = d.start
+	d.valid = true
+
+	hash := md5.New()
+	var (
+		pending []byte
+		decoded []byte
+		text    int64
+	)
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			text += int64(len(t))
+			d.end = decoder.InputOffset()
+			if !d.valid {
+				continue
+			}
+
+			for _, b := range t {
+				if !isSpace(b) {
+					pending = append(pending, b)
+				}
+			}
+			n := len(pending) / 4 * 4
+			if need := base64.StdEncoding.DecodedLen(n); cap(decoded) < need {
+				decoded = make([]byte, need)
+			}
+			written, err := base64.StdEncoding.Decode(decoded[:cap(decoded)], pending[:n])
+			if err != nil {
+				d.valid = false
+				continue
+			}
+			hash.Write(decoded[:written])
+			d.size += int64(written)
+			pending = append(pending[:0], pending[n:]...)
+		case xml.EndElement:
+			if len(pending) > 0 || text != d.end-d.start {
+				d.valid = false
+			}
+			d.hash = hex.EncodeToString(hash.Sum(nil))
+			return nil
+		default:
+			d.valid = false
+		}
+	}
+}
+
+// open reads the content back from the export.
+func (d *enexData) open(r io.ReaderAt) io.ReadCloser {
+	section := io.NewSectionReader(r, d.start, d.end-d.start)
+	return io.NopCloser(base64.NewDecoder(base64.StdEncoding, &spaceDropper{r: section}))
+}
+
+// spaceDropper leaves out the whitespace base64 in an export is wrapped with.
+type spaceDropper struct {
+	r io.Reader
+}
+
+func (s *spaceDropper) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		kept := 0
+		for _, b := range p[:n] {
+			if !isSpace(b) {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// enexMedia is a resource as written into the markdown.
+type enexMedia struct {
+	name  string
+	path  string
+	image bool
+}
+
+// enexReader collects the notes of an export as they are decoded.
+type enexReader struct {
+	r     io.ReaderAt
+	vault *Vault
+	namer *archive.Namer
+	files map[string]bool
+	total int64
+}
+
+func (ENEX) Read(r io.ReaderAt, size int64) (*Vault, error) {
+	if size > MaxTotalSize {
+		return nil, ErrTooLarge
+	}
+
+	decoder := xml.NewDecoder(io.NewSectionReader(r, 0, size))
+	reader := &enexReader{
+		r:     r,
+		vault: &Vault{},
+		namer: archive.NewNamer(),
+		files: map[string]bool{},
+	}
+	export := false
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, ErrMalformed
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "en-export":
+			export = true
+		case "note":
+			var note enexNote
+			if err = decoder.DecodeElement(&note, &start); err != nil {
+				return nil, ErrMalformed
+			}
+			if err = reader.add(&note); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !export {
+		return nil, ErrMalformed
+	}
+
+	return reader.vault, nil
+}
+
+func (e *enexReader) add(note *enexNote) error {
+	title := strings.TrimSpace(note.Title)
+	if title == "" {
+		title = "Untitled"
+	}
+	notePath := e.namer.Name(title, ".md")
+
+	media := map[string]enexMedia{}
+	for _, resource := range note.Resources {
+		name := strings.TrimSpace(path.Base(strings.ReplaceAll(resource.FileName, `\`, "/")))
+		if name == "" || name == "." || name == "/" {
+			name = "attachment" + mimeExtension(resource.Mime)
+		}
+
+		data := resource.Data
+		if !data.valid {
+			e.vault.skip(notePath, fmt.Sprintf("attachment %s is not valid base64", name))
+			continue
+		}
+
+		if data.size > MaxFileSize {
+			e.vault.skip(notePath, fmt.Sprintf("attachment %s is larger than 25MB", name))
+			continue
+		}
+
+		e.total += data.size
+		if e.total > MaxTotalSize {
+			return ErrTooLarge
+		}
+
+		hash := data.hash
+
+		ext := strings.ToLower(path.Ext(name))
+		if !extensionRegex.MatchString(ext) {
+			ext = mimeExtension(resource.Mime)
+		}
+		filePath := "_resources/" + hash + ext
+
+		if !e.files[filePath] {
+			e.files[filePath] = true
+			e.vault.Files = append(e.vault.Files, File{
+				Path: filePath,
+				Name: name,
+				Open: func() (io.ReadCloser, error) {
+					return data.open(e.r), nil
+				},
+			})
+		}
+
+		media[hash] = enexMedia{
+			name:  name,
+			path:  filePath,
+			image: strings.HasPrefix(resource.Mime, "image/"),
+		}
+	}
+
+	body, err := enmlToMarkdown(note.Content, func(hash string) (string, string, bool, bool) {
+		m, ok := media[hash]
+		return m.name, m.path, m.image, ok
+	})
+	if err != nil {
+		e.vault.skip(notePath, "note content is malformed")
+		return nil
+	}
+
+	meta := map[string]any{}
+	if len(note.Tags) > 0 {
+		meta["tags"] = note.Tags
+	}
+	if created, err := time.Parse(enexTimeLayout, note.Created); err == nil {
+		meta["created"] = created.Format(time.RFC3339)
+	}
+	if updated, err := time.Parse(enexTimeLayout, note.Updated); err == nil {
+		meta["updated"] = updated.Format(time.RFC3339)
+	}
+	if source := strings.TrimSpace(note.SourceURL); source != "" {
+		meta["source"] = source
+	}
+
+	joined, err := markdown.JoinFrontmatter(meta, body)
+	if err != nil {
+		return err
+	}
+
+	if len(joined) > MaxNoteSize {
+		e.vault.skip(notePath, "note is larger than 5MB")
+		return nil
+	}
+
+	e.vault.Notes = append(e.vault.Notes, Note{
+		Path:  notePath,
+		Title: title,
+		Body:  joined,
+	})
+
+	return nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// commonExtensions picks the usual extension for types that have several.
+var commonExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+	"audio/mpeg":      ".mp3",
+	"text/plain":      ".txt",
+}
+
+func mimeExtension(contentType string) string {
+	if ext, ok := commonExtensions[contentType]; ok {
+		return ext
+	}
+
+	extensions, err := mime.ExtensionsByType(contentType)
+	if err != nil || len(extensions) == 0 {
+		return ""
+	}
+	return extensions[0]
+}
@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestENMLToMarkdown(t *testing.T) {
+	media := func(hash string) (string, string, bool, bool) {
+		if hash == "abc" {
+			return "cat photo.png", "_resources/abc.png", true, true
+		}
+		return "", "", false, false
+	}
+
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note>
+<h1>Trip&nbsp;plan</h1>
+<div>Pack <b>light </b>and use <i>snake_case</i>.<br/></div>
+<div><br/></div>
+<div><en-todo checked="true"/>Book hotel</div>
+<div><en-todo/>Buy <a href="https://example.com/a b">tickets</a></div>
+<ul><li>one</li><li><div>two</div><ul><li>nested</li></ul></li></ul>
+<ol><li>first</li><li>second</li></ol>
+<div><en-media hash="ABC" type="image/png"/></div>
+<div><en-media hash="missing" type="image/png"/></div>
+<table><tr><th>a</th><th>b|c</th></tr><tr><td>1</td></tr></table>
+<div style="box-sizing: border-box; -en-codeblock:true;"><div>x := 1</div><div>y := 2</div></div>
+<blockquote><div>quoted</div><div>twice</div></blockquote>
+<div><a href="evernote:///view/1/2/3/">internal</a> and <code>a*b</code></div>
+<hr/>
+</en-note>`
+
+	out, err := enmlToMarkdown(content, media)
+	assert.NoError(t, err)
+	assert.Equal(t, "# Trip plan\n\n"+
+		"Pack **light** and use *snake\\_case*.\n\n"+
+		"- [x] Book hotel\n\n"+
+		"- [ ] Buy [tickets](<https://example.com/a b>)\n\n"+
+		"- one\n- two\n  - nested\n\n"+
+		"1. first\n2. second\n\n"+
+		"![cat photo.png](_resources/abc.png)\n\n"+
+		"| a | b\\|c |\n| --- | --- |\n| 1 |  |\n\n"+
+		"```\nx := 1\ny := 2\n```\n\n"+
+		"> quoted\n>\n> twice\n\n"+
+		"internal and `a*b`\n\n"+
+		"---\n", out)
+}
+
+func TestReadENEX(t *testing.T) {
+	image := []byte("\x89PNG\r\n\x1a\nimage")
+	sum := md5.Sum(image)
+	hash := hex.EncodeToString(sum[:])
+	encoded := base64.StdEncoding.EncodeToString(image)
+
+	enex := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export4.dtd">
+<en-export export-date="20240101T000000Z" application="Evernote">
+  <note>
+    <title>Trip</title>
+    <content><![CDATA[<?xml version="1.0" encoding="UTF-8"?><en-note><div>See <en-media hash="` + hash + `" type="image/png"/></div></en-note>]]></content>
+    <created>20230102T030405Z</created>
+    <tag>travel</tag>
+    <tag>2023</tag>
+    <note-attributes><source-url>https://example.com</source-url></note-attributes>
+    <resource>
+      <data encoding="base64">` + encoded[:8] + "\n  " + encoded[8:] + `</data>
+      <mime>image/png</mime>
+      <resource-attributes><file-name>beach.png</file-name></resource-attributes>
+    </resource>
+    <resource>
+      <data encoding="base64">!!!</data>
+      <mime>image/png</mime>
+    </resource>
+  </note>
+  <note>
+    <title>Trip</title>
+    <content><![CDATA[<en-note>second</en-note>]]></content>
+  </note>
+</en-export>`
+
+	vault, err := ENEX{}.Read(strings.NewReader(enex), int64(len(enex)))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Note{
+		{
+			Path:  "Trip.md",
+			Title: "Trip",
+			Body: "---\ncreated: \"2023-01-02T03:04:05Z\"\nsource: https://example.com\ntags:\n    - travel\n    - \"2023\"\n---\n" +
+				"See ![beach.png](_resources/" + hash + ".png)\n",
+		},
+		{Path: "Trip (2).md", Title: "Trip", Body: "second\n"},
+	}, vault.Notes)
+
+	assert.Equal(t, 1, len(vault.Files))
+	assert.Equal(t, "_resources/"+hash+".png", vault.Files[0].Path)
+	assert.Equal(t, "beach.png", vault.Files[0].Filename())
+	rc, err := vault.Files[0].Open()
+	assert.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, image, data)
+
+	assert.Equal(t, []Skipped{{Path: "Trip.md", Reason: "attachment attachment.png is not valid base64"}}, vault.Skipped)
+
+	_, err = ENEX{}.Read(strings.NewReader("<html></html>"), 13)
+	assert.ErrorIs(t, err, ErrMalformed)
+}
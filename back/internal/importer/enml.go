@@ -0,0 +1,461 @@
+package importer
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"markdown-notes/internal/markdown"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// enmlNode is an element or, when tag is empty, a run of text in an ENML
+// document.
+type enmlNode struct {
+	tag      string
+	attr     map[string]string
+	text     string
+	children []*enmlNode
+}
+
+// parseENML reads the XHTML dialect Evernote stores note content in. The
+// parser is lenient, as exports often carry HTML entities and unclosed tags.
+func parseENML(content string) (*enmlNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	root := &enmlNode{tag: "en-note"}
+	stack := []*enmlNode{root}
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, ErrMalformed
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			tag := strings.ToLower(t.Name.Local)
+			if tag == "en-note" && len(stack) == 1 {
+				continue
+			}
+
+			node := &enmlNode{tag: tag, attr: map[string]string{}}
+			for _, a := range t.Attr {
+				node.attr[strings.ToLower(a.Name.Local)] = a.Value
+			}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			tag := strings.ToLower(t.Name.Local)
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].tag == tag {
+					stack = stack[:i]
+					break
+				}
+			}
+		case xml.CharData:
+			parent.children = append(parent.children, &enmlNode{text: string(t)})
+		}
+	}
+
+	return root, nil
+}
+
+// enmlMedia is how an <en-media> element is written, by the hash of the
+// resource it shows.
+type enmlMedia func(hash string) (name string, path string, image bool, ok bool)
+
+// enmlConverter turns ENML into markdown.
+type enmlConverter struct {
+	media enmlMedia
+}
+
+// enmlToMarkdown converts the content of an Evernote note. Embedded
+// resources are written as links to the paths media gives for their hashes.
+func enmlToMarkdown(content string, media enmlMedia) (string, error) {
+	root, err := parseENML(content)
+	if err != nil {
+		return "", err
+	}
+
+	c := &enmlConverter{media: media}
+	return strings.Join(c.blocks(root.children), "\n\n") + "\n", nil
+}
+
+var enmlBlockTags = map[string]bool{
+	"div": true, "p": true, "section": true, "article": true, "center": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "table": true, "blockquote": true, "pre": true,
+	"hr": true, "en-note": true,
+}
+
+// blocks renders a run of sibling nodes as markdown blocks, grouping inline
+// content between block elements into paragraphs.
+func (c *enmlConverter) blocks(nodes []*enmlNode) []string {
+	var (
+		out    []string
+		inline strings.Builder
+	)
+
+	flush := func() {
+		if paragraph := paragraphText(inline.String()); paragraph != "" {
+			out = append(out, paragraph)
+		}
+		inline.Reset()
+	}
+
+	for _, node := range nodes {
+		if !enmlBlockTags[node.tag] {
+			inline.WriteString(c.inline(node))
+			continue
+		}
+
+		flush()
+		out = append(out, c.block(node)...)
+	}
+	flush()
+
+	return out
+}
+
+func (c *enmlConverter) block(node *enmlNode) []string {
+	switch node.tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(node.tag[1:])
+		text := strings.ReplaceAll(paragraphText(c.inlineChildren(node)), "\\\n", " ")
+		if text == "" {
+			return nil
+		}
+		return []string{strings.Repeat("#", level) + " " + text}
+	case "hr":
+		return []string{"---"}
+	case "pre":
+		return codeBlock(rawText(node))
+	case "blockquote":
+		inner := strings.Join(c.blocks(node.children), "\n\n")
+		if inner == "" {
+			return nil
+		}
+		return []string{prefixLines(inner, "> ", ">")}
+	case "ul", "ol":
+		if list := c.list(node); list != "" {
+			return []string{list}
+		}
+		return nil
+	case "table":
+		if table := c.table(node); table != "" {
+			return []string{table}
+		}
+		return nil
+	case "div":
+		if strings.Contains(strings.ReplaceAll(node.attr["style"], " ", ""), "-en-codeblock:true") {
+			return codeBlock(rawText(node))
+		}
+	}
+
+	return c.blocks(node.children)
+}
+
+func (c *enmlConverter) list(node *enmlNode) string {
+	style := strings.ReplaceAll(node.attr["style"], " ", "")
+	todo := strings.Contains(style, "--en-todo:true")
+
+	var items []string
+	n := 1
+	for _, child := range node.children {
+		if child.tag != "li" {
+			continue
+		}
+
+		marker := "- "
+		if node.tag == "ol" {
+			marker = strconv.Itoa(n) + ". "
+			n++
+		}
+		if todo {
+			if strings.Contains(strings.ReplaceAll(child.attr["style"], " ", ""), "--en-checked:true") {
+				marker += "[x] "
+			} else {
+				marker += "[ ] "
+			}
+		}
+
+		content := strings.Join(c.blocks(child.children), "\n")
+		items = append(items, marker+indentRest(content, len(marker)))
+	}
+
+	return strings.Join(items, "\n")
+}
+
+func (c *enmlConverter) table(node *enmlNode) string {
+	var rows [][]string
+	columns := 0
+
+	var walk func(n *enmlNode)
+	walk = func(n *enmlNode) {
+		for _, child := range n.children {
+			switch child.tag {
+			case "tr":
+				var row []string
+				for _, cell := range child.children {
+					if cell.tag != "td" && cell.tag != "th" {
+						continue
+					}
+					text := strings.Join(c.blocks(cell.children), "<br>")
+					text = strings.ReplaceAll(text, "\\\n", "<br>")
+					text = strings.ReplaceAll(text, "\n", " ")
+					row = append(row, strings.ReplaceAll(text, "|", `\|`))
+				}
+				columns = max(columns, len(row))
+				rows = append(rows, row)
+			case "thead", "tbody", "tfoot":
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+
+	if len(rows) == 0 || columns == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	writeRow := func(row []string) {
+		sb.WriteString("|")
+		for i := range columns {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			sb.WriteString(" " + cell + " |")
+		}
+	}
+
+	writeRow(rows[0])
+	sb.WriteString("\n|")
+	sb.WriteString(strings.Repeat(" --- |", columns))
+	for _, row := range rows[1:] {
+		sb.WriteString("\n")
+		writeRow(row)
+	}
+
+	return sb.String()
+}
+
+func (c *enmlConverter) inlineChildren(node *enmlNode) string {
+	var sb strings.Builder
+	for _, child := range node.children {
+		sb.WriteString(c.inline(child))
+	}
+	return sb.String()
+}
+
+func (c *enmlConverter) inline(node *enmlNode) string {
+	switch node.tag {
+	case "":
+		return escapeMarkdown(collapseSpace(node.text))
+	case "br":
+		return "\\\n"
+	case "b", "strong":
+		return wrapInline(c.inlineChildren(node), "**")
+	case "i", "em":
+		return wrapInline(c.inlineChildren(node), "*")
+	case "s", "strike", "del":
+		return wrapInline(c.inlineChildren(node), "~~")
+	case "code", "tt":
+		text := collapseSpace(rawText(node))
+		if strings.TrimSpace(text) == "" {
+			return text
+		}
+		if strings.Contains(text, "`") {
+			return "`` " + text + " ``"
+		}
+		return "`" + text + "`"
+	case "a":
+		text := strings.TrimSpace(c.inlineChildren(node))
+		href := strings.TrimSpace(node.attr["href"])
+		parsed, err := url.Parse(href)
+		if href == "" || err != nil || parsed.Scheme == "evernote" || parsed.Scheme == "javascript" {
+			return text
+		}
+		if text == "" {
+			text = escapeMarkdown(href)
+		}
+		return markdown.FormatLink(false, text, href)
+	case "img":
+		src := strings.TrimSpace(node.attr["src"])
+		if src == "" {
+			return ""
+		}
+		return markdown.FormatLink(true, escapeMarkdown(node.attr["alt"]), src)
+	case "en-todo":
+		if node.attr["checked"] == "true" {
+			return "[x] "
+		}
+		return "[ ] "
+	case "en-media":
+		name, path, image, ok := c.media(strings.ToLower(node.attr["hash"]))
+		if !ok {
+			return ""
+		}
+		return markdown.FormatLink(image, escapeMarkdown(name), path)
+	case "en-crypt", "script", "style", "title", "head":
+		return ""
+	}
+
+	return c.inlineChildren(node)
+}
+
+// paragraphText tidies up inline markdown into a paragraph, dropping
+// trailing line breaks and turning a leading checkbox into a task item.
+func paragraphText(text string) string {
+	for {
+		trimmed := strings.TrimSpace(text)
+		trimmed = strings.TrimPrefix(trimmed, "\\\n")
+		if strings.HasSuffix(trimmed, "\\") && !strings.HasSuffix(trimmed, "\\\\") {
+			trimmed = trimmed[:len(trimmed)-1]
+		}
+		if trimmed == text {
+			break
+		}
+		text = trimmed
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = strings.Join(lines, "\n")
+
+	if strings.HasPrefix(text, "[ ] ") || strings.HasPrefix(text, "[x] ") {
+		text = "- " + indentRest(text, 2)
+	}
+
+	return text
+}
+
+// wrapInline puts emphasis markers around text, keeping surrounding spaces
+// outside them so the markdown still parses.
+func wrapInline(text string, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+
+	start := text[:strings.Index(text, trimmed)]
+	end := text[len(start)+len(trimmed):]
+
+	return start + marker + trimmed + marker + end
+}
+
+// rawText is the text of a node without markdown escaping, with block
+// elements and line breaks kept as newlines.
+func rawText(node *enmlNode) string {
+	var sb strings.Builder
+
+	var walk func(n *enmlNode)
+	walk = func(n *enmlNode) {
+		switch {
+		case n.tag == "":
+			sb.WriteString(n.text)
+			return
+		case n.tag == "br":
+			sb.WriteString("\n")
+			return
+		}
+
+		block := enmlBlockTags[n.tag] || n.tag == "li"
+		if block && sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteString("\n")
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+		if block && !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteString("\n")
+		}
+	}
+
+	for _, child := range node.children {
+		walk(child)
+	}
+
+	return strings.ReplaceAll(sb.String(), "\u00a0", " ")
+}
+
+func codeBlock(text string) []string {
+	text = strings.Trim(text, "\n")
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+
+	return []string{fence + "\n" + text + "\n" + fence}
+}
+
+func collapseSpace(text string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range text {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\u00a0' {
+			if !space {
+				sb.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"_", `\_`,
+	"`", "\\`",
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+)
+
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// prefixLines starts every line of text with prefix, or with empty for
+// blank lines.
+func prefixLines(text string, prefix string, empty string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = empty
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indentRest indents every line but the first, so a multi line block lines
+// up under a list marker.
+func indentRest(text string, width int) string {
+	first, rest, found := strings.Cut(text, "\n")
+	if !found {
+		return text
+	}
+	return first + "\n" + prefixLines(rest, strings.Repeat(" ", width), "")
+}
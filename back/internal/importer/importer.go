@@ -0,0 +1,185 @@
+// Package importer reads notes exported from other apps into a Vault, a
+// format independent tree of notes and the files they embed.
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Limits on what an import may contain, checked while reading so a small
+// archive can't expand into something huge.
+const (
+	MaxNoteSize  = 5 << 20
+	MaxFileSize  = 25 << 20
+	MaxTotalSize = 512 << 20
+)
+
+var (
+	ErrTooLarge  = errors.New("import is too large")
+	ErrMalformed = errors.New("import file is malformed")
+)
+
+// Importer reads one kind of export into a Vault.
+type Importer interface {
+	Read(r io.ReaderAt, size int64) (*Vault, error)
+}
+
+var importers = map[string]Importer{
+	"markdown": MarkdownZip{},
+	"notion":   NotionZip{},
+	"enex":     ENEX{},
+}
+
+// Lookup finds the importer for a format name.
+func Lookup(format string) (Importer, bool) {
+	imp, ok := importers[format]
+	return imp, ok
+}
+
+// Formats lists the format names Lookup knows.
+func Formats() []string {
+	formats := make([]string, 0, len(importers))
+	for format := range importers {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	return formats
+}
+
+// Note is a note read from an import.
+type Note struct {
+	// Path locates the note in the import, it is what links and the
+	// report refer to it by.
+	Path string
+	// Dir is the slash separated directory the note is created in, ""
+	// for the folder being imported into.
+	Dir   string
+	Title string
+	Body  string
+	// ID is the id the note had when it was exported from here, links to
+	// it by that id are rewritten to the imported note. 0 for notes from
+	// elsewhere.
+	ID int64
+}
+
+// File is any other file in an import, notes can embed or link to it.
+type File struct {
+	Path string
+	// Name is the file name attachments made from the file get, the last
+	// element of Path when empty.
+	Name string
+	Open func() (io.ReadCloser, error)
+}
+
+// Filename is the name attachments made from the file get.
+func (f *File) Filename() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return path.Base(f.Path)
+}
+
+// Skipped records something in an import that was left out and why.
+type Skipped struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Vault is the content of an import, ready to be written.
+type Vault struct {
+	// Dirs lists every directory, including ones without notes.
+	Dirs    []string
+	Notes   []Note
+	Files   []File
+	Skipped []Skipped
+}
+
+func (v *Vault) skip(path string, reason string) {
+	v.Skipped = append(v.Skipped, Skipped{Path: path, Reason: reason})
+}
+
+// addDir records dir and all of its parents.
+func (v *Vault) addDir(dir string) {
+	for dir != "" && dir != "." {
+		for _, existing := range v.Dirs {
+			if existing == dir {
+				return
+			}
+		}
+		v.Dirs = append(v.Dirs, dir)
+		dir = path.Dir(dir)
+	}
+}
+
+// cleanPath normalises a path from an archive, reporting false for paths
+// that would escape it.
+func cleanPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") {
+		return "", false
+	}
+
+	clean := path.Clean(name)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+
+	return clean, true
+}
+
+// readLimited reads all of r, failing with ErrTooLarge past limit bytes.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, ErrTooLarge
+	}
+
+	return buf.Bytes(), nil
+}
+
+// LimitFile wraps a file opener so reading more than MaxFileSize fails with
+// ErrTooLarge instead of returning a truncated file.
+func LimitFile(open func() (io.ReadCloser, error)) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		rc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		return &limitedReadCloser{rc: rc, left: MaxFileSize}, nil
+	}
+}
+
+type limitedReadCloser struct {
+	rc   io.ReadCloser
+	left int64
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	if l.left < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
+	}
+
+	n, err := l.rc.Read(p)
+	l.left -= int64(n)
+	if l.left < 0 {
+		return n, ErrTooLarge
+	}
+
+	return n, err
+}
+
+func (l *limitedReadCloser) Close() error {
+	return l.rc.Close()
+}
@@ -0,0 +1,149 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"markdown-notes/internal/markdown"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildZip(t *testing.T, files map[string]string, order []string) *zip.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range order {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		_, err = io.WriteString(w, files[name])
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	return zr
+}
+
+func TestReadMarkdownZip(t *testing.T) {
+	files := map[string]string{
+		".obsidian/app.json":       "{}",
+		"Home.md":                  "welcome [[Plan]]",
+		"Projects/":                "",
+		"Projects/Plan.md":         "---\nid: 12\ntitle: The Plan\ntags: [work]\n---\nbody",
+		"Projects/img/diagram.png": "\x89PNG",
+		"Empty/Nested/":            "",
+		"../evil.md":               "nope",
+		"bad.md":                   "\xff\xfe",
+	}
+	zr := buildZip(t, files, []string{
+		".obsidian/app.json",
+		"Home.md",
+		"Projects/",
+		"Projects/Plan.md",
+		"Projects/img/diagram.png",
+		"Empty/Nested/",
+		"../evil.md",
+		"bad.md",
+	})
+
+	vault, err := ReadMarkdownZip(zr)
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"Projects", "Empty/Nested", "Empty"}, vault.Dirs)
+	assert.Equal(t, 2, len(vault.Notes))
+	assert.Equal(t, Note{Path: "Home.md", Dir: "", Title: "Home", Body: "welcome [[Plan]]"}, vault.Notes[0])
+	assert.Equal(t, Note{Path: "Projects/Plan.md", Dir: "Projects", Title: "The Plan", Body: "---\ntags:\n    - work\n---\nbody", ID: 12}, vault.Notes[1])
+
+	assert.Equal(t, 1, len(vault.Files))
+	assert.Equal(t, "Projects/img/diagram.png", vault.Files[0].Path)
+	rc, err := vault.Files[0].Open()
+	assert.NoError(t, err)
+	content, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, "\x89PNG", string(content))
+
+	assert.Equal(t, []Skipped{
+		{Path: "../evil.md", Reason: "path leaves the archive"},
+		{Path: "bad.md", Reason: "note is not valid UTF-8"},
+	}, vault.Skipped)
+}
+
+func TestResolver(t *testing.T) {
+	vault := &Vault{
+		Notes: []Note{
+			{Path: "Home.md", Dir: "", Title: "Home"},
+			{Path: "Projects/Plan.md", Dir: "Projects", Title: "Plan", ID: 12},
+			{Path: "Archive/2020/Plan.md", Dir: "Archive/2020", Title: "Plan"},
+			{Path: "Projects/Sub/Task.md", Dir: "Projects/Sub", Title: "Task"},
+		},
+		Files: []File{
+			{Path: "assets/diagram.png"},
+			{Path: "Projects/photo one.jpg"},
+		},
+	}
+	resolver := NewResolver(vault)
+	home := &vault.Notes[0]
+	task := &vault.Notes[3]
+
+	resolve := func(ref markdown.Ref, from *Note) string {
+		target, ok := resolver.Resolve(ref, from)
+		switch {
+		case !ok:
+			return ""
+		case target.Note != nil:
+			return target.Note.Path + target.Fragment
+		default:
+			return target.File.Path + target.Fragment
+		}
+	}
+
+	// shortest path wins
+	assert.Equal(t, "Projects/Plan.md", resolve(markdown.Ref{Wiki: true, Target: "Plan"}, home))
+	// a path picks one
+	assert.Equal(t, "Archive/2020/Plan.md", resolve(markdown.Ref{Wiki: true, Target: "2020/Plan"}, home))
+	assert.Equal(t, "Projects/Plan.md#Goals", resolve(markdown.Ref{Wiki: true, Target: "Projects/Plan.md", Fragment: "#Goals"}, home))
+	assert.Equal(t, "assets/diagram.png", resolve(markdown.Ref{Wiki: true, Embed: true, Target: "diagram.png"}, task))
+	assert.Equal(t, "", resolve(markdown.Ref{Wiki: true, Target: "Nowhere"}, home))
+
+	// markdown links are relative first
+	assert.Equal(t, "Projects/Plan.md#x", resolve(markdown.Ref{Target: "../Plan.md#x"}, task))
+	assert.Equal(t, "Projects/photo one.jpg", resolve(markdown.Ref{Embed: true, Target: "../photo one.jpg"}, task))
+	assert.Equal(t, "Home.md", resolve(markdown.Ref{Target: "/Home.md"}, task))
+	assert.Equal(t, "", resolve(markdown.Ref{Target: "https://example.com/Plan.md"}, home))
+
+	// links by id to notes of our own export
+	assert.Equal(t, "Projects/Plan.md#x", resolve(markdown.Ref{Target: markdown.NoteURL(12) + "#x"}, task))
+	assert.Equal(t, "", resolve(markdown.Ref{Target: markdown.NoteURL(13)}, task))
+}
+
+func TestReadMarkdownZipTooLarge(t *testing.T) {
+	// files count towards the total too, however many are never read
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i <= MaxTotalSize/MaxFileSize; i++ {
+		_, err := zw.CreateRaw(&zip.FileHeader{Name: fmt.Sprintf("%d.png", i), UncompressedSize64: MaxFileSize})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+
+	_, err = ReadMarkdownZip(zr)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestParseNote(t *testing.T) {
+	title, id, body := ParseNote("file", "no frontmatter")
+	assert.Equal(t, "file", title)
+	assert.Equal(t, int64(0), id)
+	assert.Equal(t, "no frontmatter", body)
+
+	title, id, body = ParseNote("file", "---\nid: 3\nupdated_at: x\n---\nbody")
+	assert.Equal(t, "file", title)
+	assert.Equal(t, int64(3), id)
+	assert.Equal(t, "body", body)
+}
@@ -0,0 +1,144 @@
+package importer
+
+import (
+	"archive/zip"
+	"io"
+	"markdown-notes/internal/markdown"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// exportKeys are frontmatter keys written by our own export. They describe
+// the note that was exported, not the one being created, so they're dropped.
+var exportKeys = []string{"id", "title", "created_at", "updated_at"}
+
+// MarkdownZip imports a zip of markdown files, see ReadMarkdownZip.
+type MarkdownZip struct{}
+
+func (MarkdownZip) Read(r io.ReaderAt, size int64) (*Vault, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return ReadMarkdownZip(zr)
+}
+
+// ReadMarkdownZip reads a zip of markdown files and directories, such as an
+// Obsidian vault or one of our own exports. Hidden files and directories,
+// .obsidian settings included, are skipped.
+func ReadMarkdownZip(zr *zip.Reader) (*Vault, error) {
+	vault := &Vault{}
+	var total int64
+
+	for _, f := range zr.File {
+		name, ok := cleanPath(f.Name)
+		if !ok {
+			vault.skip(f.Name, "path leaves the archive")
+			continue
+		}
+
+		if hidden(name) {
+			continue
+		}
+
+		if f.FileInfo().IsDir() {
+			vault.addDir(name)
+			continue
+		}
+
+		// Files are only read once a note links to them, but they count
+		// towards the total all the same. archive/zip fails reading past
+		// the size an entry claims, so it can't claim to be smaller.
+		total += int64(f.UncompressedSize64)
+		if total > MaxTotalSize {
+			return nil, ErrTooLarge
+		}
+
+		ext := strings.ToLower(path.Ext(name))
+		if ext != ".md" && ext != ".markdown" {
+			vault.Files = append(vault.Files, File{Path: name, Open: LimitFile(f.Open)})
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := readLimited(rc, MaxNoteSize)
+		rc.Close()
+		if err == ErrTooLarge {
+			vault.skip(name, "note is larger than 5MB")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !utf8.Valid(content) {
+			vault.skip(name, "note is not valid UTF-8")
+			continue
+		}
+
+		dir := path.Dir(name)
+		if dir == "." {
+			dir = ""
+		}
+		vault.addDir(dir)
+
+		title, id, body := ParseNote(strings.TrimSuffix(path.Base(name), path.Ext(name)), string(content))
+		vault.Notes = append(vault.Notes, Note{
+			Path:  name,
+			Dir:   dir,
+			Title: title,
+			Body:  body,
+			ID:    id,
+		})
+	}
+
+	return vault, nil
+}
+
+// ParseNote reads the metadata of an imported note from its frontmatter. A
+// title set there wins over the one from the file name, and the id is the one
+// our export wrote, 0 if there is none.
+func ParseNote(title string, content string) (string, int64, string) {
+	meta, body, err := markdown.SplitFrontmatter(content)
+	if err != nil || meta == nil {
+		return title, 0, content
+	}
+
+	if t, ok := meta["title"].(string); ok && strings.TrimSpace(t) != "" {
+		title = strings.TrimSpace(t)
+	}
+
+	var id int64
+	switch v := meta["id"].(type) {
+	case int:
+		id = int64(v)
+	case int64:
+		id = v
+	case uint64:
+		id = int64(v)
+	}
+
+	for _, key := range exportKeys {
+		delete(meta, key)
+	}
+
+	joined, err := markdown.JoinFrontmatter(meta, body)
+	if err != nil {
+		return title, id, content
+	}
+
+	return title, id, joined
+}
+
+func hidden(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") || segment == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
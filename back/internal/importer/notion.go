@@ -0,0 +1,315 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"io"
+	"markdown-notes/internal/markdown"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NotionZip imports Notion's "Markdown & CSV" export. Notion names every
+// page, subpage directory and database after its title followed by the page
+// ID, those IDs are stripped, and links between pages, including notion.so
+// URLs to pages in the export, are pointed at the imported notes. Databases
+// become notes holding a table that links to their rows.
+type NotionZip struct{}
+
+// notionIDRegex matches the page ID Notion appends to file and directory
+// names.
+var notionIDRegex = regexp.MustCompile(`^(.*?) ?([0-9a-f]{32})$`)
+
+// notionURLIDRegex finds the page ID at the end of a notion.so URL path.
+var notionURLIDRegex = regexp.MustCompile(`([0-9a-f]{32})$`)
+
+// stripNotionID splits a name without extension into the title and the
+// page ID, which is empty for names without one.
+func stripNotionID(name string) (string, string) {
+	m := notionIDRegex.FindStringSubmatch(name)
+	if m == nil || strings.TrimSpace(m[1]) == "" {
+		return name, ""
+	}
+	return strings.TrimSpace(m[1]), m[2]
+}
+
+func (NotionZip) Read(r io.ReaderAt, size int64) (*Vault, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	vault, err := ReadMarkdownZip(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	return readNotion(vault), nil
+}
+
+// readNotion turns a vault read from a Notion export into one without the
+// page IDs. Note paths stay as they were in the export, as that is what the
+// links between pages use.
+func readNotion(vault *Vault) *Vault {
+	dirs := renameNotionDirs(vault.Dirs)
+
+	out := &Vault{Skipped: vault.Skipped}
+	for _, dir := range vault.Dirs {
+		out.Dirs = append(out.Dirs, dirs[dir])
+	}
+
+	// pages finds notes by the page ID in their file name, rows finds them
+	// by directory and title, which is how database CSVs refer to them.
+	pages := map[string]string{}
+	rows := map[string]string{}
+	for _, note := range vault.Notes {
+		title, id := stripNotionID(strings.TrimSuffix(path.Base(note.Path), path.Ext(note.Path)))
+		if id != "" {
+			pages[id] = note.Path
+		}
+		rows[note.Dir+"\x00"+strings.ToLower(title)] = note.Path
+	}
+
+	// databases maps each CSV to the path of the note made from it.
+	databases := map[string]string{}
+	for _, file := range vault.Files {
+		if strings.EqualFold(path.Ext(file.Path), ".csv") {
+			base := strings.TrimSuffix(file.Path, path.Ext(file.Path))
+			databases[file.Path] = strings.TrimSuffix(base, "_all") + ".md"
+		}
+	}
+
+	for _, note := range vault.Notes {
+		title, _ := stripNotionID(strings.TrimSuffix(path.Base(note.Path), path.Ext(note.Path)))
+		body := note.Body
+
+		// Pages start with their title as a heading, it's more accurate
+		// than the file name, which Notion truncates.
+		if rest, ok := strings.CutPrefix(body, "# "); ok {
+			heading, after, _ := strings.Cut(rest, "\n")
+			if heading = strings.TrimSpace(heading); heading != "" {
+				title = heading
+				body = strings.TrimLeft(after, "\r\n")
+			}
+		}
+
+		out.Notes = append(out.Notes, Note{
+			Path:  note.Path,
+			Dir:   dirs[note.Dir],
+			Title: title,
+			Body:  relinkNotion(body, note.Dir, pages, databases),
+		})
+	}
+
+	for _, file := range vault.Files {
+		notePath, ok := databases[file.Path]
+		if !ok {
+			out.Files = append(out.Files, file)
+			continue
+		}
+
+		// Newer exports carry both the current view of a database and
+		// every row in an _all.csv, the latter wins.
+		base := strings.TrimSuffix(notePath, ".md")
+		if file.Path != base+"_all.csv" && databases[base+"_all.csv"] != "" {
+			out.skip(file.Path, "database is imported from its _all.csv")
+			continue
+		}
+
+		dir := path.Dir(file.Path)
+		if dir == "." {
+			dir = ""
+		}
+		title, _ := stripNotionID(path.Base(base))
+
+		body, err := notionTable(file, func(value string) (string, bool) {
+			rowPath, ok := rows[base+"\x00"+strings.ToLower(value)]
+			if !ok {
+				return "", false
+			}
+			return relativeLink(dir, rowPath), true
+		})
+		if errors.Is(err, ErrTooLarge) {
+			out.skip(file.Path, "database is larger than 5MB")
+			continue
+		}
+		if err != nil {
+			out.skip(file.Path, "database is not a valid CSV file")
+			continue
+		}
+
+		out.Notes = append(out.Notes, Note{
+			Path:  notePath,
+			Dir:   dirs[dir],
+			Title: title,
+			Body:  body,
+		})
+	}
+
+	return out
+}
+
+// renameNotionDirs maps every directory of an export to its name without
+// page IDs. Pages that only differ by ID get " (2)" style suffixes.
+func renameNotionDirs(dirs []string) map[string]string {
+	sorted := append([]string{}, dirs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		di, dj := strings.Count(sorted[i], "/"), strings.Count(sorted[j], "/")
+		if di != dj {
+			return di < dj
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	renamed := map[string]string{"": ""}
+	used := map[string]bool{}
+	for _, dir := range sorted {
+		parent := path.Dir(dir)
+		if parent == "." {
+			parent = ""
+		}
+
+		name, _ := stripNotionID(path.Base(dir))
+		unique := path.Join(renamed[parent], name)
+		for n := 2; used[strings.ToLower(unique)]; n++ {
+			unique = path.Join(renamed[parent], name+" ("+strconv.Itoa(n)+")")
+		}
+		used[strings.ToLower(unique)] = true
+		renamed[dir] = unique
+	}
+
+	return renamed
+}
+
+// relinkNotion points links to databases at the notes made from their CSV
+// files, and links to notion.so pages that are part of the export at the
+// exported page.
+func relinkNotion(body string, dir string, pages map[string]string, databases map[string]string) string {
+	return markdown.RewriteRefs(body, func(ref markdown.Ref) (string, bool) {
+		if ref.Wiki {
+			return "", false
+		}
+
+		u, err := url.Parse(ref.Target)
+		if err != nil {
+			return "", false
+		}
+
+		if u.Scheme == "" && u.Host == "" {
+			notePath, ok := databases[path.Join(dir, u.Path)]
+			if !ok {
+				return "", false
+			}
+			return markdown.FormatLink(ref.Embed, ref.Text, relativeLink(dir, notePath)), true
+		}
+
+		if !(u.Host == "notion.so" || strings.HasSuffix(u.Host, ".notion.so") || strings.HasSuffix(u.Host, ".notion.site")) {
+			return "", false
+		}
+
+		m := notionURLIDRegex.FindStringSubmatch(strings.ReplaceAll(path.Base(u.Path), "-", ""))
+		if m == nil {
+			return "", false
+		}
+
+		pagePath, ok := pages[m[1]]
+		if !ok {
+			return "", false
+		}
+
+		destination := "/" + escapePath(pagePath)
+		if u.Fragment != "" {
+			destination += "#" + u.Fragment
+		}
+		return markdown.FormatLink(ref.Embed, ref.Text, destination), true
+	})
+}
+
+// notionTable converts a database CSV into a markdown table, linking the
+// first column to the row's page when link finds one.
+func notionTable(file File, link func(value string) (string, bool)) (string, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	content, err := readLimited(rc, MaxNoteSize)
+	if err != nil {
+		return "", err
+	}
+
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(content), "\ufeff")))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 {
+		return "", nil
+	}
+
+	columns := 0
+	for _, record := range records {
+		columns = max(columns, len(record))
+	}
+
+	var sb strings.Builder
+	for i, record := range records {
+		sb.WriteString("|")
+		for j := range columns {
+			cell := ""
+			if j < len(record) {
+				cell = record[j]
+			}
+
+			text := tableCell(cell)
+			if i > 0 && j == 0 {
+				if destination, ok := link(strings.TrimSpace(cell)); ok {
+					text = markdown.FormatLink(false, text, destination)
+				}
+			}
+			sb.WriteString(" " + text + " |")
+		}
+		sb.WriteString("\n")
+
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func tableCell(value string) string {
+	value = strings.ReplaceAll(strings.TrimSpace(value), "\r\n", "\n")
+	value = strings.ReplaceAll(escapeMarkdown(value), "\n", "<br>")
+	return strings.ReplaceAll(value, "|", `\|`)
+}
+
+// relativeLink is the escaped path of target as linked from a note in dir.
+func relativeLink(dir string, target string) string {
+	if dir != "" {
+		rel, ok := strings.CutPrefix(target, dir+"/")
+		if !ok {
+			return "/" + escapePath(target)
+		}
+		target = rel
+	}
+	return escapePath(target)
+}
+
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripNotionID(t *testing.T) {
+	title, id := stripNotionID("Road map 0123456789abcdef0123456789abcdef")
+	assert.Equal(t, "Road map", title)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", id)
+
+	title, id = stripNotionID("0123456789abcdef0123456789abcdef")
+	assert.Equal(t, "0123456789abcdef0123456789abcdef", title)
+	assert.Equal(t, "", id)
+
+	title, id = stripNotionID("Plain")
+	assert.Equal(t, "Plain", title)
+	assert.Equal(t, "", id)
+}
+
+func TestReadNotion(t *testing.T) {
+	const (
+		homeID  = "11111111111111111111111111111111"
+		taskID  = "22222222222222222222222222222222"
+		dbID    = "33333333333333333333333333333333"
+		otherID = "44444444444444444444444444444444"
+	)
+
+	files := map[string]string{
+		"Home " + homeID + ".md": "# Home: the start\n\nSee [Tasks](Home%20" + homeID + "/Tasks%20" + dbID + ".csv) and [Write docs](https://www.notion.so/acme/Write-docs-" + taskID + "#abc).\n" +
+			"![pic](Home%20" + homeID + "/pic.png) [elsewhere](https://www.notion.so/" + otherID + ")",
+		"Home " + homeID + "/Tasks " + dbID + ".csv":                          "\ufeffName,Status\nWrite docs,Done\nShip | it,\"To do\"\n",
+		"Home " + homeID + "/Tasks " + dbID + "_all.csv":                      "\ufeffName,Status,Owner\nWrite docs,Done,Ann\nShip | it,To do,\n",
+		"Home " + homeID + "/Tasks " + dbID + "/Write docs " + taskID + ".md": "# Write docs\n\nStatus: Done",
+		"Home " + homeID + "/pic.png":                                         "\x89PNG",
+	}
+	order := []string{
+		"Home " + homeID + ".md",
+		"Home " + homeID + "/Tasks " + dbID + ".csv",
+		"Home " + homeID + "/Tasks " + dbID + "_all.csv",
+		"Home " + homeID + "/Tasks " + dbID + "/Write docs " + taskID + ".md",
+		"Home " + homeID + "/pic.png",
+	}
+
+	vault, err := ReadMarkdownZip(buildZip(t, files, order))
+	assert.NoError(t, err)
+	vault = readNotion(vault)
+
+	assert.ElementsMatch(t, []string{"Home", "Home/Tasks"}, vault.Dirs)
+	assert.Equal(t, 3, len(vault.Notes))
+
+	assert.Equal(t, Note{
+		Path:  "Home " + homeID + ".md",
+		Dir:   "",
+		Title: "Home: the start",
+		Body: "See [Tasks](Home%20" + homeID + "/Tasks%20" + dbID + ".md) and [Write docs](/Home%20" + homeID + "/Tasks%20" + dbID + "/Write%20docs%20" + taskID + ".md#abc).\n" +
+			"![pic](Home%20" + homeID + "/pic.png) [elsewhere](https://www.notion.so/" + otherID + ")",
+	}, vault.Notes[0])
+
+	assert.Equal(t, Note{
+		Path:  "Home " + homeID + "/Tasks " + dbID + "/Write docs " + taskID + ".md",
+		Dir:   "Home/Tasks",
+		Title: "Write docs",
+		Body:  "Status: Done",
+	}, vault.Notes[1])
+
+	assert.Equal(t, Note{
+		Path:  "Home " + homeID + "/Tasks " + dbID + ".md",
+		Dir:   "Home",
+		Title: "Tasks",
+		Body: "| Name | Status | Owner |\n| --- | --- | --- |\n" +
+			"| [Write docs](Tasks%20" + dbID + "/Write%20docs%20" + taskID + ".md) | Done | Ann |\n" +
+			"| Ship \\| it | To do |  |\n",
+	}, vault.Notes[2])
+
+	assert.Equal(t, 1, len(vault.Files))
+	assert.Equal(t, "Home "+homeID+"/pic.png", vault.Files[0].Path)
+	rc, err := vault.Files[0].Open()
+	assert.NoError(t, err)
+	content, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, "\x89PNG", string(content))
+
+	assert.Equal(t, []Skipped{{Path: "Home " + homeID + "/Tasks " + dbID + ".csv", Reason: "database is imported from its _all.csv"}}, vault.Skipped)
+}
@@ -0,0 +1,151 @@
+package importer
+
+import (
+	"markdown-notes/internal/markdown"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Target is what a reference in an imported note points at, exactly one of
+// Note and File is set.
+type Target struct {
+	Note *Note
+	File *File
+	// Fragment is the #heading or #anchor part of the reference.
+	Fragment string
+}
+
+// Resolver matches the links and embeds in a vault's notes to the notes and
+// files they point at.
+type Resolver struct {
+	notes map[string]*Note
+	ids   map[int64]*Note
+	files map[string]*File
+}
+
+func NewResolver(vault *Vault) *Resolver {
+	r := &Resolver{
+		notes: map[string]*Note{},
+		ids:   map[int64]*Note{},
+		files: map[string]*File{},
+	}
+
+	for i := range vault.Notes {
+		note := &vault.Notes[i]
+		r.notes[noteKey(note.Path)] = note
+		if note.ID != 0 {
+			r.ids[note.ID] = note
+		}
+	}
+	for i := range vault.Files {
+		file := &vault.Files[i]
+		r.files[strings.ToLower(file.Path)] = file
+	}
+
+	return r
+}
+
+func noteKey(p string) string {
+	ext := path.Ext(p)
+	if strings.EqualFold(ext, ".md") || strings.EqualFold(ext, ".markdown") {
+		p = strings.TrimSuffix(p, ext)
+	}
+	return strings.ToLower(p)
+}
+
+// Resolve finds the target of a reference written in from. Wiki links are
+// looked up the way Obsidian does it: by path from the top of the vault, then
+// relative to the note, then by the shortest path ending in the target.
+// Markdown links are relative to the note first, or name a note of our own
+// export by its id. Links to the web and references that match nothing report
+// false.
+func (r *Resolver) Resolve(ref markdown.Ref, from *Note) (Target, bool) {
+	target := ref.Target
+	fragment := ref.Fragment
+
+	if !ref.Wiki {
+		parsed, err := url.Parse(target)
+		if err == nil && (parsed.Scheme != "" || parsed.Host != "") {
+			return Target{}, false
+		}
+		target, fragment, _ = strings.Cut(target, "#")
+		if fragment != "" {
+			fragment = "#" + fragment
+		}
+		target, _, _ = strings.Cut(target, "?")
+
+		if id, ok := markdown.ParseNoteURL(target); ok {
+			note, ok := r.ids[id]
+			if !ok || ref.Embed {
+				return Target{}, false
+			}
+			return Target{Note: note, Fragment: fragment}, true
+		}
+	}
+
+	target = strings.TrimSpace(strings.ReplaceAll(target, `\`, "/"))
+	if target == "" {
+		return Target{}, false
+	}
+
+	candidates := []string{}
+	relative := path.Join(from.Dir, target)
+	absolute := path.Clean(strings.TrimPrefix(target, "/"))
+	if ref.Wiki && !strings.HasPrefix(target, ".") {
+		candidates = append(candidates, absolute, relative)
+	} else {
+		candidates = append(candidates, relative, absolute)
+	}
+
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, "../") {
+			continue
+		}
+		if t, ok := r.exact(candidate, fragment); ok {
+			return t, true
+		}
+	}
+
+	return r.bySuffix(path.Clean("/"+target), fragment)
+}
+
+func (r *Resolver) exact(p string, fragment string) (Target, bool) {
+	if file, ok := r.files[strings.ToLower(p)]; ok {
+		return Target{File: file, Fragment: fragment}, true
+	}
+	if note, ok := r.notes[noteKey(p)]; ok {
+		return Target{Note: note, Fragment: fragment}, true
+	}
+	return Target{}, false
+}
+
+// bySuffix finds the note or file with the shortest path ending in suffix,
+// which starts with a slash.
+func (r *Resolver) bySuffix(suffix string, fragment string) (Target, bool) {
+	var (
+		best    Target
+		bestKey string
+		found   bool
+	)
+
+	better := func(key string) bool {
+		return !found || len(key) < len(bestKey) || len(key) == len(bestKey) && key < bestKey
+	}
+
+	fileSuffix := strings.ToLower(suffix)
+	for key, file := range r.files {
+		if ("/"+key == fileSuffix || strings.HasSuffix(key, fileSuffix)) && better(key) {
+			best, bestKey, found = Target{File: file, Fragment: fragment}, key, true
+		}
+	}
+
+	noteSuffix := noteKey(suffix)
+	for key, note := range r.notes {
+		if ("/"+key == noteSuffix || strings.HasSuffix(key, noteSuffix)) && better(key) {
+			best, bestKey, found = Target{Note: note, Fragment: fragment}, key, true
+		}
+	}
+
+	return best, found
+}
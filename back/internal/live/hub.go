@@ -0,0 +1,449 @@
+package live
+
+import (
+	"errors"
+	"log"
+	"markdown-notes/internal/store"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrReadOnly = errors.New("you can only view this note")
+	ErrRevision = errors.New("revision is newer than the document")
+	ErrDropped  = errors.New("connection fell behind and was dropped")
+	ErrClosed   = errors.New("live editing is shutting down")
+)
+
+// DefaultSaveInterval is how often the merged text of a note being edited is
+// written back, when it changed.
+const DefaultSaveInterval = 5 * time.Second
+
+// sendBuffer is how many messages can wait for a slow client before it is
+// dropped.
+const sendBuffer = 64
+
+// maxSaveAttempts is how often a save rebases onto the note as it was saved
+// elsewhere and tries again, before leaving it to the next save.
+const maxSaveAttempts = 3
+
+// NotesStore is the part of store.NotesStore the hub needs.
+type NotesStore interface {
+	NoteRole(user_id int64, note_id int64) (store.Role, error)
+	GetNote(user_id int64, note_id int64) (*store.Note, error)
+	PatchNote(user_id int64, note_id int64, update store.NoteUpdate) (*store.Note, error)
+}
+
+// Cursor is where someone's caret is, with SelectionEnd different from
+// Position when they selected text.
+type Cursor struct {
+	Position     int `json:"position"`
+	SelectionEnd int `json:"selection_end"`
+}
+
+// Presence is someone editing a note.
+type Presence struct {
+	UserID   int64   `json:"user_id"`
+	Username string  `json:"username"`
+	Cursor   *Cursor `json:"cursor"`
+}
+
+// Message is what goes over the connection in either direction. Clients send
+// "op" messages with the revision the operation was made against and
+// "cursor" messages. The server answers with "init" once connected, "ack"
+// when the client's operation was applied, and passes on everybody else's
+// "op", "cursor", "join" and "leave".
+type Message struct {
+	Type     string     `json:"type"`
+	Revision int        `json:"revision"`
+	Op       Operation  `json:"op,omitempty"`
+	Text     string     `json:"text,omitempty"`
+	Cursor   *Cursor    `json:"cursor,omitempty"`
+	Clients  []Presence `json:"clients,omitempty"`
+	UserID   int64      `json:"user_id,omitempty"`
+	Username string     `json:"username,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// Hub keeps the notes that are being edited in memory, one document per note
+// shared by everyone editing it.
+type Hub struct {
+	notesStore   NotesStore
+	saveInterval time.Duration
+	logger       *log.Logger
+
+	mu     sync.Mutex
+	docs   map[int64]*document
+	closed bool
+}
+
+func NewHub(notesStore NotesStore, saveInterval time.Duration, logger *log.Logger) *Hub {
+	return &Hub{
+		notesStore:   notesStore,
+		saveInterval: saveInterval,
+		logger:       logger,
+		docs:         map[int64]*document{},
+	}
+}
+
+type document struct {
+	hub    *Hub
+	noteID int64
+
+	saveMu sync.Mutex // held while writing the text back
+
+	mu       sync.Mutex
+	text     Text
+	base     Text        // the text of the note at version
+	version  int64       // the version of the note the text was loaded or last saved at
+	history  []Operation // operation i turned revision i into revision i+1
+	clients  map[*Client]bool
+	dirty    bool
+	editorID int64 // the last user who changed the text, it is saved as them
+	stop     chan struct{}
+}
+
+// Client is one connection to a document. Messages for it are queued on
+// Send, which is closed when the client is dropped.
+type Client struct {
+	Send chan Message
+
+	user   *store.User
+	role   store.Role
+	doc    *document
+	cursor *Cursor
+	left   bool
+}
+
+// Join connects the user to a note they have access to, loading it if nobody
+// is editing it yet. The client's first message is "init" with the current
+// text and who else is there.
+func (h *Hub) Join(user *store.User, note_id int64) (*Client, error) {
+	role, err := h.notesStore.NoteRole(user.ID, note_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = role.Check(store.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+
+	doc, ok := h.docs[note_id]
+	if !ok {
+		note, err := h.notesStore.GetNote(user.ID, note_id)
+		if err != nil {
+			return nil, err
+		}
+
+		doc = &document{
+			hub:     h,
+			noteID:  note_id,
+			text:    NewText(note.Note),
+			base:    NewText(note.Note),
+			version: note.Version,
+			clients: map[*Client]bool{},
+			stop:    make(chan struct{}),
+		}
+		h.docs[note_id] = doc
+		go doc.saveLoop(h.saveInterval)
+	}
+
+	client := &Client{
+		Send: make(chan Message, sendBuffer),
+		user: user,
+		role: role,
+		doc:  doc,
+	}
+
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+
+	clients := []Presence{}
+	for other := range doc.clients {
+		clients = append(clients, other.presence())
+	}
+
+	client.Send <- Message{Type: "init", Revision: len(doc.history), Text: doc.text.String(), Clients: clients}
+	doc.broadcast(client, Message{Type: "join", UserID: user.ID, Username: user.Username})
+	doc.clients[client] = true
+
+	return client, nil
+}
+
+// Leave disconnects the client, which may already have been dropped for
+// being too slow. The last one to leave a note saves it and closes the
+// document.
+func (h *Hub) Leave(client *Client) {
+	doc := client.doc
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	doc.mu.Lock()
+	if client.left {
+		doc.mu.Unlock()
+		return
+	}
+
+	client.left = true
+	doc.drop(client)
+	doc.broadcast(nil, Message{Type: "leave", UserID: client.user.ID, Username: client.user.Username})
+	last := len(doc.clients) == 0 && h.docs[doc.noteID] == doc
+	if last {
+		delete(h.docs, doc.noteID)
+		close(doc.stop)
+	}
+	doc.mu.Unlock()
+
+	// saved before anyone can join again, so they don't load the note from
+	// before the last changes
+	if last {
+		doc.save()
+	}
+}
+
+// Close drops every client and saves the notes they were editing. Connections
+// aren't drained by the HTTP server shutting down, so this is what keeps the
+// last edits from being lost. Nobody can join once the hub is closed.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	docs := make([]*document, 0, len(h.docs))
+	for note_id, doc := range h.docs {
+		doc.mu.Lock()
+		for client := range doc.clients {
+			doc.drop(client)
+		}
+		close(doc.stop)
+		doc.mu.Unlock()
+
+		delete(h.docs, note_id)
+		docs = append(docs, doc)
+	}
+	h.mu.Unlock()
+
+	for _, doc := range docs {
+		doc.save()
+	}
+}
+
+// Receive handles a message from the client. Operations are transformed
+// past the ones applied since the revision they were made against, applied,
+// acknowledged and passed on to everyone else.
+func (c *Client) Receive(msg Message) error {
+	doc := c.doc
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+
+	if !doc.clients[c] {
+		return ErrDropped
+	}
+
+	switch msg.Type {
+	case "op":
+		if !c.role.Can(store.RoleEditor) {
+			return ErrReadOnly
+		}
+
+		if msg.Revision < 0 || msg.Revision > len(doc.history) {
+			return ErrRevision
+		}
+
+		op := msg.Op
+		for _, concurrent := range doc.history[msg.Revision:] {
+			var err error
+			op, _, err = Transform(op, concurrent)
+			if err != nil {
+				return err
+			}
+		}
+
+		text, err := op.Apply(doc.text)
+		if err != nil {
+			return err
+		}
+
+		doc.apply(op, text)
+		doc.dirty = true
+		doc.editorID = c.user.ID
+
+		revision := len(doc.history)
+		doc.send(c, Message{Type: "ack", Revision: revision})
+		doc.broadcast(c, Message{Type: "op", Revision: revision, Op: op, UserID: c.user.ID, Username: c.user.Username})
+
+	case "cursor":
+		if msg.Cursor == nil {
+			c.cursor = nil
+		} else {
+			c.cursor = &Cursor{
+				Position:     clamp(msg.Cursor.Position, len(doc.text)),
+				SelectionEnd: clamp(msg.Cursor.SelectionEnd, len(doc.text)),
+			}
+		}
+
+		doc.broadcast(c, Message{Type: "cursor", Revision: len(doc.history), Cursor: c.cursor, UserID: c.user.ID, Username: c.user.Username})
+
+	default:
+		return errors.New("unknown message type " + msg.Type)
+	}
+
+	return nil
+}
+
+// apply makes text, which op turned the document's text into, the next
+// revision. The document's lock must be held.
+func (d *document) apply(op Operation, text Text) {
+	d.text = text
+	d.history = append(d.history, op)
+
+	for client := range d.clients {
+		if client.cursor != nil {
+			client.cursor = &Cursor{
+				Position:     op.TransformIndex(client.cursor.Position),
+				SelectionEnd: op.TransformIndex(client.cursor.SelectionEnd),
+			}
+		}
+	}
+}
+
+func (c *Client) presence() Presence {
+	return Presence{UserID: c.user.ID, Username: c.user.Username, Cursor: c.cursor}
+}
+
+// broadcast sends msg to every client except from. The document's lock must
+// be held.
+func (d *document) broadcast(from *Client, msg Message) {
+	for client := range d.clients {
+		if client != from {
+			d.send(client, msg)
+		}
+	}
+}
+
+// send queues msg for the client, dropping the client if it can't keep up.
+// The document's lock must be held.
+func (d *document) send(client *Client, msg Message) {
+	if !d.clients[client] {
+		return
+	}
+
+	select {
+	case client.Send <- msg:
+	default:
+		d.drop(client)
+	}
+}
+
+func (d *document) drop(client *Client) {
+	if d.clients[client] {
+		delete(d.clients, client)
+		close(client.Send)
+	}
+}
+
+func (d *document) saveLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.save()
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// save writes the text back to the note if it changed since the last save.
+// When the note was saved some other way in the meantime, the edits made
+// since the last save are rebased onto it and saved again. Whatever couldn't
+// be saved is left for the next save.
+func (d *document) save() {
+	d.saveMu.Lock()
+	defer d.saveMu.Unlock()
+
+	for range maxSaveAttempts {
+		d.mu.Lock()
+		if !d.dirty {
+			d.mu.Unlock()
+			return
+		}
+		text, version, editorID := d.text, d.version, d.editorID
+		d.dirty = false
+		d.mu.Unlock()
+
+		note := text.String()
+		saved, err := d.hub.notesStore.PatchNote(editorID, d.noteID, store.NoteUpdate{Note: &note, IfVersion: &version})
+		if err == nil {
+			d.mu.Lock()
+			d.base = text
+			d.version = saved.Version
+			d.mu.Unlock()
+			return
+		}
+
+		if errors.Is(err, store.ErrStaleNote) {
+			err = d.rebase(editorID)
+		}
+		if err != nil {
+			d.hub.logger.Printf("ERROR: saving live note %d %v", d.noteID, err)
+
+			d.mu.Lock()
+			d.dirty = true
+			d.mu.Unlock()
+			return
+		}
+	}
+}
+
+// rebase brings the document up to the note as someone else saved it, keeping
+// the changes made since the last save on top. Everyone is sent the operation
+// that turns their text into the merged one.
+func (d *document) rebase(user_id int64) error {
+	note, err := d.hub.notesStore.GetNote(user_id, d.noteID)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stored := NewText(note.Note)
+	op, _, err := Transform(replace(d.base, stored), replace(d.base, d.text))
+	if err != nil {
+		return err
+	}
+
+	text, err := op.Apply(d.text)
+	if err != nil {
+		return err
+	}
+
+	d.apply(op, text)
+	d.base = stored
+	d.version = note.Version
+	d.dirty = !slices.Equal(text, stored)
+
+	d.broadcast(nil, Message{Type: "op", Revision: len(d.history), Op: op})
+
+	return nil
+}
+
+func clamp(n int, max int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,270 @@
+package live
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"markdown-notes/internal/store"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNotesStore struct {
+	mu      sync.Mutex
+	roles   map[int64]store.Role
+	note    string
+	version int64
+	saves   int
+	err     error
+}
+
+func (s *fakeNotesStore) NoteRole(user_id int64, note_id int64) (store.Role, error) {
+	role, ok := s.roles[user_id]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return role, nil
+}
+
+func (s *fakeNotesStore) GetNote(user_id int64, note_id int64) (*store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &store.Note{ID: note_id, Note: s.note, Version: s.version}, nil
+}
+
+func (s *fakeNotesStore) PatchNote(user_id int64, note_id int64, update store.NoteUpdate) (*store.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	if update.IfVersion != nil && *update.IfVersion != s.version {
+		return nil, store.ErrStaleNote
+	}
+	s.note = *update.Note
+	s.version++
+	s.saves++
+	return &store.Note{ID: note_id, Note: s.note, Version: s.version}, nil
+}
+
+func receive(t *testing.T, client *Client) Message {
+	t.Helper()
+
+	select {
+	case msg := <-client.Send:
+		return msg
+	default:
+		t.Fatal("no message queued")
+		return Message{}
+	}
+}
+
+func TestHub(t *testing.T) {
+	editor := &store.User{ID: 1, Username: "Editor"}
+	viewer := &store.User{ID: 2, Username: "Viewer"}
+	stranger := &store.User{ID: 3, Username: "Stranger"}
+	notesStore := &fakeNotesStore{
+		roles: map[int64]store.Role{editor.ID: store.RoleEditor, viewer.ID: store.RoleViewer},
+		note:  "hello",
+	}
+	hub := NewHub(notesStore, time.Hour, log.New(io.Discard, "", 0))
+
+	_, err := hub.Join(stranger, 1)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	a, err := hub.Join(editor, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, Message{Type: "init", Revision: 0, Text: "hello", Clients: []Presence{}}, receive(t, a))
+
+	b, err := hub.Join(viewer, 1)
+	assert.NoError(t, err)
+	init := receive(t, b)
+	assert.Equal(t, "hello", init.Text)
+	assert.Equal(t, []Presence{{UserID: editor.ID, Username: editor.Username}}, init.Clients)
+	assert.Equal(t, "join", receive(t, a).Type)
+
+	t.Run("viewers can't edit", func(t *testing.T) {
+		err := b.Receive(Message{Type: "op", Revision: 0, Op: Operation{{Insert: "!"}, {Retain: 5}}})
+		assert.ErrorIs(t, err, ErrReadOnly)
+	})
+
+	t.Run("cursors follow edits", func(t *testing.T) {
+		err := b.Receive(Message{Type: "cursor", Cursor: &Cursor{Position: 5, SelectionEnd: 99}})
+		assert.NoError(t, err)
+		msg := receive(t, a)
+		assert.Equal(t, "cursor", msg.Type)
+		assert.Equal(t, &Cursor{Position: 5, SelectionEnd: 5}, msg.Cursor)
+	})
+
+	t.Run("edits are applied and passed on", func(t *testing.T) {
+		err := a.Receive(Message{Type: "op", Revision: 0, Op: Operation{{Insert: "oh "}, {Retain: 5}}})
+		assert.NoError(t, err)
+		assert.Equal(t, Message{Type: "ack", Revision: 1}, receive(t, a))
+
+		msg := receive(t, b)
+		assert.Equal(t, "op", msg.Type)
+		assert.Equal(t, 1, msg.Revision)
+		assert.Equal(t, Operation{{Insert: "oh "}, {Retain: 5}}, msg.Op)
+		assert.Equal(t, &Cursor{Position: 8, SelectionEnd: 8}, b.cursor)
+	})
+
+	t.Run("edits against an old revision are transformed", func(t *testing.T) {
+		err := a.Receive(Message{Type: "op", Revision: 0, Op: Operation{{Retain: 5}, {Insert: "!"}}})
+		assert.NoError(t, err)
+		assert.Equal(t, Message{Type: "ack", Revision: 2}, receive(t, a))
+		assert.Equal(t, Operation{{Retain: 8}, {Insert: "!"}}, receive(t, b).Op)
+
+		err = a.Receive(Message{Type: "op", Revision: 5, Op: Operation{{Retain: 9}}})
+		assert.ErrorIs(t, err, ErrRevision)
+	})
+
+	t.Run("the last one to leave saves", func(t *testing.T) {
+		hub.Leave(b)
+		assert.Equal(t, "leave", receive(t, a).Type)
+		assert.Equal(t, 0, notesStore.saves)
+
+		hub.Leave(a)
+		assert.Equal(t, 1, notesStore.saves)
+		assert.Equal(t, "oh hello!", notesStore.note)
+
+		c, err := hub.Join(editor, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "oh hello!", receive(t, c).Text)
+		hub.Leave(c)
+		assert.Equal(t, 1, notesStore.saves)
+	})
+}
+
+func TestHubRebasesOntoNotesSavedElsewhere(t *testing.T) {
+	editor := &store.User{ID: 1, Username: "Editor"}
+	viewer := &store.User{ID: 2, Username: "Viewer"}
+	notesStore := &fakeNotesStore{
+		roles:   map[int64]store.Role{editor.ID: store.RoleEditor, viewer.ID: store.RoleViewer},
+		note:    "hello",
+		version: 1,
+	}
+	hub := NewHub(notesStore, time.Hour, log.New(io.Discard, "", 0))
+
+	a, err := hub.Join(editor, 1)
+	assert.NoError(t, err)
+	receive(t, a)
+	b, err := hub.Join(viewer, 1)
+	assert.NoError(t, err)
+	receive(t, b)
+	receive(t, a)
+
+	err = a.Receive(Message{Type: "op", Revision: 0, Op: Operation{{Retain: 5}, {Insert: "!"}}})
+	assert.NoError(t, err)
+	receive(t, a)
+	receive(t, b)
+
+	// saved over the REST API while the note is open
+	saved := "hello world"
+	_, err = notesStore.PatchNote(editor.ID, 1, store.NoteUpdate{Note: &saved})
+	assert.NoError(t, err)
+
+	// the live edit is kept on top of the saved text
+	a.doc.save()
+	assert.Equal(t, "hello world!", notesStore.note)
+	assert.Equal(t, int64(3), notesStore.version)
+
+	msg := receive(t, b)
+	assert.Equal(t, Message{Type: "op", Revision: 2, Op: Operation{{Retain: 5}, {Insert: " world"}, {Retain: 1}}}, msg)
+	assert.Equal(t, msg, receive(t, a))
+
+	// saved at the version it was rebased onto
+	err = a.Receive(Message{Type: "op", Revision: 2, Op: Operation{{Retain: 12}, {Insert: "?"}}})
+	assert.NoError(t, err)
+	a.doc.save()
+	assert.Equal(t, "hello world!?", notesStore.note)
+
+	hub.Leave(b)
+	hub.Leave(a)
+}
+
+func TestHubRetriesFailedSaves(t *testing.T) {
+	editor := &store.User{ID: 1, Username: "Editor"}
+	notesStore := &fakeNotesStore{
+		roles:   map[int64]store.Role{editor.ID: store.RoleEditor},
+		note:    "hello",
+		version: 1,
+		err:     errors.New("database is down"),
+	}
+	hub := NewHub(notesStore, time.Hour, log.New(io.Discard, "", 0))
+
+	a, err := hub.Join(editor, 1)
+	assert.NoError(t, err)
+	receive(t, a)
+
+	err = a.Receive(Message{Type: "op", Revision: 0, Op: Operation{{Retain: 5}, {Insert: "!"}}})
+	assert.NoError(t, err)
+
+	a.doc.save()
+	assert.Equal(t, "hello", notesStore.note)
+
+	notesStore.err = nil
+	a.doc.save()
+	assert.Equal(t, "hello!", notesStore.note)
+
+	hub.Leave(a)
+}
+
+func TestHubCloseSavesOpenNotes(t *testing.T) {
+	editor := &store.User{ID: 1, Username: "Editor"}
+	notesStore := &fakeNotesStore{
+		roles:   map[int64]store.Role{editor.ID: store.RoleEditor},
+		note:    "hello",
+		version: 1,
+	}
+	hub := NewHub(notesStore, time.Hour, log.New(io.Discard, "", 0))
+
+	a, err := hub.Join(editor, 1)
+	assert.NoError(t, err)
+	receive(t, a)
+
+	err = a.Receive(Message{Type: "op", Revision: 0, Op: Operation{{Retain: 5}, {Insert: "!"}}})
+	assert.NoError(t, err)
+	receive(t, a)
+
+	hub.Close()
+	assert.Equal(t, "hello!", notesStore.note)
+
+	_, open := <-a.Send
+	assert.False(t, open)
+	assert.ErrorIs(t, a.Receive(Message{Type: "cursor"}), ErrDropped)
+
+	_, err = hub.Join(editor, 1)
+	assert.ErrorIs(t, err, ErrClosed)
+
+	hub.Leave(a)
+}
+
+func TestHubDropsSlowClients(t *testing.T) {
+	editor := &store.User{ID: 1, Username: "Editor"}
+	viewer := &store.User{ID: 2, Username: "Viewer"}
+	notesStore := &fakeNotesStore{
+		roles: map[int64]store.Role{editor.ID: store.RoleEditor, viewer.ID: store.RoleViewer},
+	}
+	hub := NewHub(notesStore, time.Hour, log.New(io.Discard, "", 0))
+
+	a, err := hub.Join(editor, 1)
+	assert.NoError(t, err)
+	b, err := hub.Join(viewer, 1)
+	assert.NoError(t, err)
+
+	for i := 0; i < sendBuffer; i++ {
+		err = a.Receive(Message{Type: "cursor", Cursor: &Cursor{}})
+		assert.NoError(t, err)
+	}
+
+	assert.ErrorIs(t, b.Receive(Message{Type: "cursor"}), ErrDropped)
+	for range b.Send {
+	}
+
+	hub.Leave(b)
+	hub.Leave(a)
+}
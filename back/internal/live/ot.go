@@ -0,0 +1,322 @@
+// Package live lets several people edit a note at the same time. Edits are
+// merged with operational transformation: every change is an Operation
+// against a numbered revision of the note, and the server transforms changes
+// made against an older revision past the ones applied since, so everybody
+// ends up with the same text.
+package live
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+var (
+	ErrBaseLength = errors.New("operation doesn't cover the whole document")
+	ErrOperation  = errors.New("invalid operation")
+)
+
+// Component is one step of an Operation. Exactly one of its fields is set:
+// Retain skips over characters, Insert adds text and Delete removes
+// characters.
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// Operation is a change to a text, in the JSON format ot.js uses: a list of
+// components that are a positive number to retain that many characters, a
+// string to insert or a negative number to delete characters. The components
+// walk over the whole text, so an operation can only be applied to a text of
+// its BaseLength. Characters are counted the way JavaScript strings count
+// them, in UTF-16 code units, so a character outside the Basic Multilingual
+// Plane such as an emoji is two of them.
+type Operation []Component
+
+// Text is a document as operations see it, in UTF-16 code units.
+type Text []uint16
+
+func NewText(s string) Text {
+	return utf16.Encode([]rune(s))
+}
+
+// String decodes the text, a surrogate pair an operation split in half
+// becomes U+FFFD.
+func (t Text) String() string {
+	return string(utf16.Decode(t))
+}
+
+// textLength is the length of s in UTF-16 code units.
+func textLength(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+func (o Operation) MarshalJSON() ([]byte, error) {
+	values := make([]any, 0, len(o))
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			values = append(values, c.Retain)
+		case c.Insert != "":
+			values = append(values, c.Insert)
+		default:
+			values = append(values, -c.Delete)
+		}
+	}
+
+	return json.Marshal(values)
+}
+
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var values []any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	op := Operation{}
+	for _, value := range values {
+		switch v := value.(type) {
+		case float64:
+			n := int(v)
+			if float64(n) != v || n == 0 {
+				return fmt.Errorf("%w: %v is not a character count", ErrOperation, v)
+			}
+			if n > 0 {
+				op = op.retain(n)
+			} else {
+				op = op.delete(-n)
+			}
+		case string:
+			op = op.insert(v)
+		default:
+			return fmt.Errorf("%w: unexpected %T", ErrOperation, value)
+		}
+	}
+
+	*o = op
+	return nil
+}
+
+// The builders below merge a component into the last one where they can,
+// keeping operations in the canonical form ot.js produces: inserts before
+// deletes and no two neighbouring components of the same kind.
+
+func (o Operation) retain(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Retain > 0 {
+		o[last].Retain += n
+		return o
+	}
+	return append(o, Component{Retain: n})
+}
+
+func (o Operation) insert(s string) Operation {
+	if s == "" {
+		return o
+	}
+	last := len(o) - 1
+	if last >= 0 && o[last].Insert != "" {
+		o[last].Insert += s
+		return o
+	}
+	if last >= 0 && o[last].Delete > 0 {
+		// keep inserts in front of deletes
+		if last > 0 && o[last-1].Insert != "" {
+			o[last-1].Insert += s
+			return o
+		}
+		o = append(o, o[last])
+		o[last] = Component{Insert: s}
+		return o
+	}
+	return append(o, Component{Insert: s})
+}
+
+func (o Operation) delete(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Delete > 0 {
+		o[last].Delete += n
+		return o
+	}
+	return append(o, Component{Delete: n})
+}
+
+// BaseLength is the length of the text the operation applies to.
+func (o Operation) BaseLength() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// TargetLength is the length of the text after the operation.
+func (o Operation) TargetLength() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + textLength(c.Insert)
+	}
+	return n
+}
+
+// Apply returns text with the operation applied.
+func (o Operation) Apply(text Text) (Text, error) {
+	if o.BaseLength() != len(text) {
+		return nil, ErrBaseLength
+	}
+
+	result := make(Text, 0, o.TargetLength())
+	i := 0
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			result = append(result, text[i:i+c.Retain]...)
+			i += c.Retain
+		case c.Insert != "":
+			result = append(result, NewText(c.Insert)...)
+		default:
+			i += c.Delete
+		}
+	}
+
+	return result, nil
+}
+
+// Transform takes two operations a and b made concurrently against the same
+// text and returns a' and b' such that applying a then b' gives the same text
+// as applying b then a'. When both insert at the same place, a's text goes
+// first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if a.BaseLength() != b.BaseLength() {
+		return nil, nil, ErrBaseLength
+	}
+
+	var aPrime, bPrime Operation
+	ai, bi := 0, 0
+	var ac, bc *Component
+	next := func(op Operation, i *int) *Component {
+		if *i >= len(op) {
+			return nil
+		}
+		c := op[*i]
+		*i++
+		return &c
+	}
+	ac, bc = next(a, &ai), next(b, &bi)
+
+	for ac != nil || bc != nil {
+		// inserts don't depend on the other side, the other side retains over
+		// them
+		if ac != nil && ac.Insert != "" {
+			aPrime = aPrime.insert(ac.Insert)
+			bPrime = bPrime.retain(textLength(ac.Insert))
+			ac = next(a, &ai)
+			continue
+		}
+		if bc != nil && bc.Insert != "" {
+			aPrime = aPrime.retain(textLength(bc.Insert))
+			bPrime = bPrime.insert(bc.Insert)
+			bc = next(b, &bi)
+			continue
+		}
+		if ac == nil || bc == nil {
+			return nil, nil, ErrBaseLength
+		}
+
+		aLen, bLen := ac.Retain+ac.Delete, bc.Retain+bc.Delete
+		n := min(aLen, bLen)
+
+		switch {
+		case ac.Retain > 0 && bc.Retain > 0:
+			aPrime = aPrime.retain(n)
+			bPrime = bPrime.retain(n)
+		case ac.Delete > 0 && bc.Retain > 0:
+			aPrime = aPrime.delete(n)
+		case ac.Retain > 0 && bc.Delete > 0:
+			bPrime = bPrime.delete(n)
+		}
+		// both deleting the same characters leaves nothing to do
+
+		ac = shorten(ac, n, next, a, &ai)
+		bc = shorten(bc, n, next, b, &bi)
+	}
+
+	return aPrime, bPrime, nil
+}
+
+// shorten consumes n characters of a retain or delete component, moving on
+// to the next component once it is used up.
+func shorten(c *Component, n int, next func(Operation, *int) *Component, op Operation, i *int) *Component {
+	if c.Retain > 0 {
+		c.Retain -= n
+		if c.Retain > 0 {
+			return c
+		}
+	} else {
+		c.Delete -= n
+		if c.Delete > 0 {
+			return c
+		}
+	}
+	return next(op, i)
+}
+
+// TransformIndex moves a position in the text before the operation to where
+// the same spot is after it. Text inserted right at the position ends up in
+// front of it.
+func (o Operation) TransformIndex(index int) int {
+	newIndex := index
+	i := 0
+	for _, c := range o {
+		if i > index {
+			break
+		}
+		switch {
+		case c.Retain > 0:
+			i += c.Retain
+		case c.Insert != "":
+			newIndex += textLength(c.Insert)
+		default:
+			newIndex -= min(c.Delete, index-i)
+			i += c.Delete
+		}
+	}
+
+	return newIndex
+}
+
+// replace returns an operation that turns a into b, keeping what they start
+// and end with.
+func replace(a, b Text) Operation {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	// don't split a surrogate pair
+	if prefix > 0 && utf16.IsSurrogate(rune(a[prefix-1])) && a[prefix-1] < 0xdc00 {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	if suffix > 0 && utf16.IsSurrogate(rune(a[len(a)-suffix])) && a[len(a)-suffix] >= 0xdc00 {
+		suffix--
+	}
+
+	return Operation{}.
+		retain(prefix).
+		insert(b[prefix : len(b)-suffix].String()).
+		delete(len(a) - prefix - suffix).
+		retain(suffix)
+}
@@ -0,0 +1,132 @@
+package live
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func op(t *testing.T, s string) Operation {
+	t.Helper()
+
+	var o Operation
+	if err := json.Unmarshal([]byte(s), &o); err != nil {
+		t.Fatalf("parsing operation %s: %v", s, err)
+	}
+	return o
+}
+
+func TestOperationJSON(t *testing.T) {
+	o := op(t, `[3, "ab", -2, 1]`)
+	assert.Equal(t, Operation{{Retain: 3}, {Insert: "ab"}, {Delete: 2}, {Retain: 1}}, o)
+	assert.Equal(t, 6, o.BaseLength())
+	assert.Equal(t, 6, o.TargetLength())
+
+	data, err := json.Marshal(o)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[3, "ab", -2, 1]`, string(data))
+
+	// neighbouring components are merged and inserts go before deletes
+	assert.Equal(t, Operation{{Retain: 3}, {Insert: "ab"}, {Delete: 2}}, op(t, `[1, 2, -2, "a", "b"]`))
+
+	var bad Operation
+	assert.ErrorIs(t, json.Unmarshal([]byte(`[0]`), &bad), ErrOperation)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`[1.5]`), &bad), ErrOperation)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`[true]`), &bad), ErrOperation)
+}
+
+func TestApply(t *testing.T) {
+	text, err := op(t, `[6, "big ", -5, "world"]`).Apply(NewText("hello small"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello big world", text.String())
+
+	text, err = op(t, `[1, "é", 1]`).Apply(NewText("ñü"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ñéü", text.String())
+
+	// emoji are two characters long, as in JavaScript
+	text, err = op(t, `[2, "!", -2]`).Apply(NewText("🙂🙃"))
+	assert.NoError(t, err)
+	assert.Equal(t, "🙂!", text.String())
+	assert.Equal(t, 3, op(t, `["🙂!"]`).TargetLength())
+
+	_, err = op(t, `[3]`).Apply(NewText("hello"))
+	assert.ErrorIs(t, err, ErrBaseLength)
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		a    string
+		b    string
+		want string
+	}{
+		{"inserts in different places", "hello world", `[5, ",", 6]`, `[11, "!"]`, "hello, world!"},
+		{"inserts in the same place put a first", "ac", `[1, "b", 1]`, `[1, "x", 1]`, "abxc"},
+		{"insert inside a deletion", "abcdef", `[1, -4, 1]`, `[3, "X", 3]`, "aXf"},
+		{"overlapping deletions", "abcdef", `[1, -3, 2]`, `[2, -3, 1]`, "af"},
+		{"same deletion", "abc", `[-3]`, `[-3]`, ""},
+		{"empty text", "", `["x"]`, `["y"]`, "xy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := op(t, tt.a), op(t, tt.b)
+			aPrime, bPrime, err := Transform(a, b)
+			assert.NoError(t, err)
+
+			ab, err := a.Apply(NewText(tt.text))
+			assert.NoError(t, err)
+			ab, err = bPrime.Apply(ab)
+			assert.NoError(t, err)
+
+			ba, err := b.Apply(NewText(tt.text))
+			assert.NoError(t, err)
+			ba, err = aPrime.Apply(ba)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.want, ab.String())
+			assert.Equal(t, tt.want, ba.String())
+		})
+	}
+
+	_, _, err := Transform(op(t, `[2]`), op(t, `[3]`))
+	assert.ErrorIs(t, err, ErrBaseLength)
+}
+
+func TestTransformIndex(t *testing.T) {
+	o := op(t, `[2, "xy", -3, 4]`)
+
+	assert.Equal(t, 1, o.TransformIndex(1))
+	assert.Equal(t, 4, o.TransformIndex(2))
+	assert.Equal(t, 4, o.TransformIndex(4))
+	assert.Equal(t, 5, o.TransformIndex(6))
+	assert.Equal(t, 8, o.TransformIndex(9))
+}
+
+func TestReplace(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want Operation
+	}{
+		{"same", "abc", "abc", Operation{{Retain: 3}}},
+		{"middle", "hello world", "hello big world", Operation{{Retain: 6}, {Insert: "big "}, {Retain: 5}}},
+		{"everything", "abc", "xyz", Operation{{Insert: "xyz"}, {Delete: 3}}},
+		{"surrogate pairs stay whole", "🙂", "🙃", Operation{{Insert: "🙃"}, {Delete: 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := replace(NewText(tt.a), NewText(tt.b))
+			assert.Equal(t, tt.want, op)
+
+			text, err := op.Apply(NewText(tt.a))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.b, text.String())
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package markdown
+
+import "strings"
+
+// stripCode blanks out fenced code blocks and inline code spans so that tags
+// and links written inside code aren't picked up. Everything else, including
+// line breaks, keeps its position.
+func stripCode(body string) string {
+	lines := strings.SplitAfter(body, "\n")
+
+	var (
+		out   strings.Builder
+		fence string
+	)
+
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			out.WriteString(blank(line))
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			out.WriteString(blank(line))
+			continue
+		}
+
+		out.WriteString(stripCodeSpans(line))
+	}
+
+	return out.String()
+}
+
+func stripCodeSpans(line string) string {
+	var out strings.Builder
+
+	for {
+		start := strings.IndexByte(line, '`')
+		if start == -1 {
+			out.WriteString(line)
+			return out.String()
+		}
+
+		ticks := 1
+		for start+ticks < len(line) && line[start+ticks] == '`' {
+			ticks++
+		}
+
+		end := strings.Index(line[start+ticks:], strings.Repeat("`", ticks))
+		if end == -1 {
+			out.WriteString(line)
+			return out.String()
+		}
+
+		stop := start + ticks + end + ticks
+		out.WriteString(line[:start])
+		out.WriteString(blank(line[start:stop]))
+		line = line[stop:]
+	}
+}
+
+// blank replaces every byte but line breaks with a space, so byte offsets
+// into the result match the original.
+func blank(s string) string {
+	out := []byte(s)
+	for i, b := range out {
+		if b != '\n' && b != '\r' {
+			out[i] = ' '
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,82 @@
+package markdown
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SplitFrontmatter separates a YAML frontmatter block delimited by --- lines
+// at the very top of a note from the markdown that follows it. Notes without
+// frontmatter come back with a nil map and the body untouched.
+func SplitFrontmatter(note string) (map[string]any, string, error) {
+	rest, ok := strings.CutPrefix(note, "---\n")
+	if !ok {
+		rest, ok = strings.CutPrefix(note, "---\r\n")
+	}
+	if !ok {
+		return nil, note, nil
+	}
+
+	offset := 0
+	for offset <= len(rest) {
+		line, after, found := strings.Cut(rest[offset:], "\n")
+		trimmed := strings.TrimRight(line, "\r")
+		if trimmed == "---" || trimmed == "..." {
+			meta := map[string]any{}
+			err := yaml.Unmarshal([]byte(rest[:offset]), &meta)
+			if err != nil {
+				return nil, note, err
+			}
+
+			if !found {
+				return meta, "", nil
+			}
+			return meta, after, nil
+		}
+
+		if !found {
+			break
+		}
+		offset += len(line) + 1
+	}
+
+	// an opening --- without a closing one is just a horizontal rule
+	return nil, note, nil
+}
+
+// JoinFrontmatter puts a YAML frontmatter block in front of a markdown body,
+// an empty meta map leaves the body as it is.
+func JoinFrontmatter(meta map[string]any, body string) (string, error) {
+	if len(meta) == 0 {
+		return body, nil
+	}
+
+	out, err := yaml.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+
+	return "---\n" + string(out) + "---\n" + body, nil
+}
+
+// stringList reads a frontmatter value that may be written either as a YAML
+// list or as a single comma or space separated string.
+func stringList(value any) []string {
+	var values []string
+
+	switch v := value.(type) {
+	case string:
+		values = strings.FieldsFunc(v, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,52 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitFrontmatter(t *testing.T) {
+	t.Run("note without frontmatter", func(t *testing.T) {
+		meta, body, err := SplitFrontmatter("# Title\ntext")
+		assert.NoError(t, err)
+		assert.Nil(t, meta)
+		assert.Equal(t, "# Title\ntext", body)
+	})
+
+	t.Run("splits frontmatter from body", func(t *testing.T) {
+		meta, body, err := SplitFrontmatter("---\nid: 4\ntitle: hello\n---\n# Title\n")
+		assert.NoError(t, err)
+		assert.Equal(t, 4, meta["id"])
+		assert.Equal(t, "hello", meta["title"])
+		assert.Equal(t, "# Title\n", body)
+	})
+
+	t.Run("unclosed block is a horizontal rule", func(t *testing.T) {
+		meta, body, err := SplitFrontmatter("---\nnot frontmatter")
+		assert.NoError(t, err)
+		assert.Nil(t, meta)
+		assert.Equal(t, "---\nnot frontmatter", body)
+	})
+
+	t.Run("invalid yaml is an error", func(t *testing.T) {
+		_, body, err := SplitFrontmatter("---\nkey: [\n---\nbody")
+		assert.Error(t, err)
+		assert.Equal(t, "---\nkey: [\n---\nbody", body)
+	})
+}
+
+func TestJoinFrontmatter(t *testing.T) {
+	note, err := JoinFrontmatter(map[string]any{"id": 1}, "body")
+	assert.NoError(t, err)
+	assert.Equal(t, "---\nid: 1\n---\nbody", note)
+
+	meta, body, err := SplitFrontmatter(note)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, meta["id"])
+	assert.Equal(t, "body", body)
+
+	note, err = JoinFrontmatter(nil, "body")
+	assert.NoError(t, err)
+	assert.Equal(t, "body", note)
+}
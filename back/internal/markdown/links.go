@@ -0,0 +1,113 @@
+package markdown
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	LinkKindWiki     = "wiki"
+	LinkKindMarkdown = "markdown"
+	LinkKindID       = "id"
+)
+
+// Link is a reference from one note to another as written in its markdown.
+// Target is the note being pointed at, a title or folder/title for wiki links,
+// a relative or absolute path without the .md extension for markdown links
+// and the note's id for markdown links made by NoteURL.
+type Link struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Text   string `json:"text"`
+}
+
+var (
+	wikiLinkRegex     = regexp.MustCompile(`\[\[([^\[\]|#]+)(#[^\[\]|]*)?(?:\|([^\[\]]*))?\]\]`)
+	markdownLinkRegex = regexp.MustCompile(`(!?)\[([^\]]*)\]\((<[^>]*>|[^)\s]+)(?:\s+"[^"]*")?\)`)
+)
+
+// ExtractLinks finds the links to other notes in a note: [[Title]] style wiki
+// links, with optional #heading and |alias parts, markdown links to relative
+// .md files and markdown links to notes by id. Links to the web, to headings in the same note and to
+// non-note files are skipped, as is anything written inside code.
+func ExtractLinks(note string) []Link {
+	_, body, err := SplitFrontmatter(note)
+	if err != nil {
+		body = note
+	}
+	body = stripCode(body)
+
+	var links []Link
+	seen := map[Link]bool{}
+	add := func(link Link) {
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	for _, match := range wikiLinkRegex.FindAllStringSubmatch(body, -1) {
+		target := strings.TrimSpace(match[1])
+		if target == "" || path.Ext(target) != "" && !strings.EqualFold(path.Ext(target), ".md") {
+			// embeds like [[diagram.png]] point at attachments, not notes
+			continue
+		}
+		target = strings.TrimSuffix(target, path.Ext(target))
+
+		text := strings.TrimSpace(match[3])
+		if text == "" {
+			text = target
+		}
+		add(Link{Kind: LinkKindWiki, Target: target, Text: text})
+	}
+
+	for _, match := range markdownLinkRegex.FindAllStringSubmatch(body, -1) {
+		if match[1] == "!" {
+			continue
+		}
+
+		destination := strings.TrimSuffix(strings.TrimPrefix(match[3], "<"), ">")
+		if id, ok := ParseNoteURL(destination); ok {
+			add(Link{Kind: LinkKindID, Target: strconv.FormatInt(id, 10), Text: match[2]})
+			continue
+		}
+
+		target, ok := markdownLinkTarget(match[3])
+		if !ok {
+			continue
+		}
+		add(Link{Kind: LinkKindMarkdown, Target: target, Text: match[2]})
+	}
+
+	return links
+}
+
+// markdownLinkTarget turns the destination of a markdown link into a note path,
+// reporting false for destinations that don't point at a markdown file.
+func markdownLinkTarget(destination string) (string, bool) {
+	destination = strings.TrimSuffix(strings.TrimPrefix(destination, "<"), ">")
+	destination, _, _ = strings.Cut(destination, "#")
+	destination, _, _ = strings.Cut(destination, "?")
+	if destination == "" {
+		return "", false
+	}
+
+	parsed, err := url.Parse(destination)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return "", false
+	}
+
+	target, err := url.PathUnescape(destination)
+	if err != nil {
+		return "", false
+	}
+
+	if !strings.EqualFold(path.Ext(target), ".md") {
+		return "", false
+	}
+
+	return strings.TrimSuffix(target, path.Ext(target)), true
+}
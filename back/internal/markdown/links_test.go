@@ -0,0 +1,73 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractLinks(t *testing.T) {
+	tests := []struct {
+		name  string
+		note  string
+		links []Link
+	}{
+		{
+			name:  "no links",
+			note:  "plain text",
+			links: nil,
+		},
+		{
+			name: "wiki links with headings and aliases",
+			note: "see [[Meeting Notes]], [[projects/Alpha#Goals|the goals]] and [[Meeting Notes]] again",
+			links: []Link{
+				{Kind: LinkKindWiki, Target: "Meeting Notes", Text: "Meeting Notes"},
+				{Kind: LinkKindWiki, Target: "projects/Alpha", Text: "the goals"},
+			},
+		},
+		{
+			name: "wiki embeds of attachments are skipped",
+			note: "![[diagram.png]] but ![[Other Note]] and [[Daily.md]]",
+			links: []Link{
+				{Kind: LinkKindWiki, Target: "Other Note", Text: "Other Note"},
+				{Kind: LinkKindWiki, Target: "Daily", Text: "Daily"},
+			},
+		},
+		{
+			name: "relative markdown links",
+			note: "[up](../Index.md) [spaced](My%20Note.md#part) [angled](<dir/Other Note.md>) [abs](/top/Root.md \"title\")",
+			links: []Link{
+				{Kind: LinkKindMarkdown, Target: "../Index", Text: "up"},
+				{Kind: LinkKindMarkdown, Target: "My Note", Text: "spaced"},
+				{Kind: LinkKindMarkdown, Target: "dir/Other Note", Text: "angled"},
+				{Kind: LinkKindMarkdown, Target: "/top/Root", Text: "abs"},
+			},
+		},
+		{
+			name: "links to notes by id",
+			note: "[plan](/api/notes/12#Goals) [same](/api/notes/12) ![img](/api/notes/13) [file](/api/attachments/14)",
+			links: []Link{
+				{Kind: LinkKindID, Target: "12", Text: "plan"},
+				{Kind: LinkKindID, Target: "12", Text: "same"},
+			},
+		},
+		{
+			name:  "web links, anchors, images and other files are skipped",
+			note:  "[web](https://example.com/a.md) [mail](mailto:a@b.c) [anchor](#top) ![img](pic.png) [pdf](doc.pdf)",
+			links: nil,
+		},
+		{
+			name: "links in code are skipped",
+			note: "`[[Not A Link]]`\n```\n[x](y.md)\n```\n[[Real]]",
+			links: []Link{
+				{Kind: LinkKindWiki, Target: "Real", Text: "Real"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.links, ExtractLinks(tt.note))
+		})
+	}
+}
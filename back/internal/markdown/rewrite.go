@@ -0,0 +1,220 @@
+package markdown
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// attachmentURLPrefix and noteURLPrefix are where the frontend serves the API
+// from, so links to attachments and notes written into notes work when the
+// note is rendered in a browser.
+const (
+	attachmentURLPrefix = "/api/attachments/"
+	noteURLPrefix       = "/api/notes/"
+)
+
+// AttachmentURL is the link to an attachment as written into notes.
+func AttachmentURL(attachment_id int64) string {
+	return attachmentURLPrefix + strconv.FormatInt(attachment_id, 10)
+}
+
+// ParseAttachmentURL reads the attachment id back out of a link made by
+// AttachmentURL, ignoring any query string.
+func ParseAttachmentURL(destination string) (int64, bool) {
+	rest, ok := strings.CutPrefix(destination, attachmentURLPrefix)
+	if !ok {
+		return 0, false
+	}
+	rest, _, _ = strings.Cut(rest, "?")
+
+	id, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// NoteURL is the link to a note by id as written into notes, it keeps
+// pointing at the note whatever it is renamed to or moved.
+func NoteURL(note_id int64) string {
+	return noteURLPrefix + strconv.FormatInt(note_id, 10)
+}
+
+// ParseNoteURL reads the note id back out of a link made by NoteURL,
+// ignoring any query string or fragment.
+func ParseNoteURL(destination string) (int64, bool) {
+	rest, ok := strings.CutPrefix(destination, noteURLPrefix)
+	if !ok {
+		return 0, false
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, _, _ = strings.Cut(rest, "?")
+
+	id, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// Ref is a wiki link, markdown link or embed found by RewriteRefs.
+type Ref struct {
+	// Wiki is set for [[...]] references and unset for [text](destination).
+	Wiki bool
+	// Embed is set for references written with a leading !.
+	Embed bool
+	// Target is the wiki link target or the markdown link destination with
+	// any <> brackets removed and percent escapes decoded.
+	Target string
+	// Fragment is the #heading part of a wiki link, including the #.
+	Fragment string
+	// Text is the wiki link alias or the markdown link text.
+	Text string
+}
+
+// Link is the note link ExtractLinks finds for the reference, reporting
+// false for references that don't point at a note.
+func (r Ref) Link() (Link, bool) {
+	if r.Wiki {
+		target := strings.TrimSpace(r.Target)
+		ext := path.Ext(target)
+		if target == "" || ext != "" && !strings.EqualFold(ext, ".md") {
+			return Link{}, false
+		}
+		target = strings.TrimSuffix(target, ext)
+
+		text := strings.TrimSpace(r.Text)
+		if text == "" {
+			text = target
+		}
+		return Link{Kind: LinkKindWiki, Target: target, Text: text}, true
+	}
+
+	if r.Embed {
+		return Link{}, false
+	}
+
+	if id, ok := ParseNoteURL(r.Target); ok {
+		return Link{Kind: LinkKindID, Target: strconv.FormatInt(id, 10), Text: r.Text}, true
+	}
+
+	// The target is already unescaped, unlike the destinations
+	// markdownLinkTarget reads.
+	target, _, _ := strings.Cut(r.Target, "#")
+	target, _, _ = strings.Cut(target, "?")
+	if target == "" || !strings.EqualFold(path.Ext(target), ".md") {
+		return Link{}, false
+	}
+
+	parsed, err := url.Parse(target)
+	if err == nil && (parsed.Scheme != "" || parsed.Host != "") {
+		return Link{}, false
+	}
+
+	return Link{Kind: LinkKindMarkdown, Target: strings.TrimSuffix(target, path.Ext(target)), Text: r.Text}, true
+}
+
+var wikiRefRegex = regexp.MustCompile(`(!?)\[\[([^\[\]|#]+)(#[^\[\]|]*)?(?:\|([^\[\]]*))?\]\]`)
+
+// RewriteRefs calls rewrite for every link and embed in a note body, outside
+// code, replacing the ones it returns true for. Frontmatter is left alone.
+func RewriteRefs(note string, rewrite func(ref Ref) (string, bool)) string {
+	_, body, err := SplitFrontmatter(note)
+	if err != nil {
+		body = note
+	}
+	prefix := note[:len(note)-len(body)]
+	stripped := stripCode(body)
+
+	type match struct {
+		start, end int
+		ref        Ref
+	}
+	var matches []match
+
+	for _, m := range wikiRefRegex.FindAllStringSubmatchIndex(stripped, -1) {
+		ref := Ref{
+			Wiki:   true,
+			Embed:  m[3] > m[2],
+			Target: strings.TrimSpace(body[m[4]:m[5]]),
+		}
+		if m[6] >= 0 {
+			ref.Fragment = body[m[6]:m[7]]
+		}
+		if m[8] >= 0 {
+			ref.Text = body[m[8]:m[9]]
+		}
+		matches = append(matches, match{m[0], m[1], ref})
+	}
+
+	for _, m := range markdownLinkRegex.FindAllStringSubmatchIndex(stripped, -1) {
+		destination := strings.TrimSuffix(strings.TrimPrefix(body[m[6]:m[7]], "<"), ">")
+		if unescaped, err := url.PathUnescape(destination); err == nil {
+			destination = unescaped
+		}
+
+		matches = append(matches, match{m[0], m[1], Ref{
+			Embed:  m[3] > m[2],
+			Target: destination,
+			Text:   body[m[4]:m[5]],
+		}})
+	}
+
+	slices.SortFunc(matches, func(a, b match) int {
+		return a.start - b.start
+	})
+
+	var out strings.Builder
+	out.WriteString(prefix)
+
+	last := 0
+	for _, m := range matches {
+		if m.start < last {
+			// overlaps a reference already handled
+			continue
+		}
+
+		replacement, ok := rewrite(m.ref)
+		if !ok {
+			continue
+		}
+
+		out.WriteString(body[last:m.start])
+		out.WriteString(replacement)
+		last = m.end
+	}
+	out.WriteString(body[last:])
+
+	return out.String()
+}
+
+// FormatWikiLink writes a [[target#fragment|text]] link, leaving out the
+// alias when it repeats the target.
+func FormatWikiLink(target string, fragment string, text string) string {
+	if text == "" || text == target {
+		return fmt.Sprintf("[[%s%s]]", target, fragment)
+	}
+	return fmt.Sprintf("[[%s%s|%s]]", target, fragment, text)
+}
+
+// FormatLink writes a [text](destination) link, or an image when embed is
+// set, bracketing destinations that contain spaces.
+func FormatLink(embed bool, text string, destination string) string {
+	bang := ""
+	if embed {
+		bang = "!"
+	}
+
+	if strings.ContainsAny(destination, " ()<>") {
+		destination = "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(destination) + ">"
+	}
+
+	return fmt.Sprintf("%s[%s](%s)", bang, text, destination)
+}
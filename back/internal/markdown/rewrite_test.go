@@ -0,0 +1,99 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteRefs(t *testing.T) {
+	note := "---\nlink: \"[[Keep]]\"\n---\n" +
+		"See [[Plan#Goals|the plan]], ![[diagram.png|300]] and [other](Other%20Note.md).\n" +
+		"![photo](<img/café photo.jpg> \"title\") `[[in code]]`\n" +
+		"```\n[[also code]] ünïcödé\n```\n" +
+		"[[Plan]] after ünïcödé"
+
+	var refs []Ref
+	out := RewriteRefs(note, func(ref Ref) (string, bool) {
+		refs = append(refs, ref)
+		if ref.Wiki && !ref.Embed {
+			return FormatWikiLink(strings.ToUpper(ref.Target), ref.Fragment, ref.Text), true
+		}
+		if ref.Embed {
+			return FormatLink(true, ref.Text, AttachmentURL(9)), true
+		}
+		return "", false
+	})
+
+	assert.Equal(t, []Ref{
+		{Wiki: true, Target: "Plan", Fragment: "#Goals", Text: "the plan"},
+		{Wiki: true, Embed: true, Target: "diagram.png", Text: "300"},
+		{Target: "Other Note.md", Text: "other"},
+		{Embed: true, Target: "img/café photo.jpg", Text: "photo"},
+		{Wiki: true, Target: "Plan"},
+	}, refs)
+
+	assert.Equal(t, "---\nlink: \"[[Keep]]\"\n---\n"+
+		"See [[PLAN#Goals|the plan]], ![300](/api/attachments/9) and [other](Other%20Note.md).\n"+
+		"![photo](/api/attachments/9) `[[in code]]`\n"+
+		"```\n[[also code]] ünïcödé\n```\n"+
+		"[[PLAN]] after ünïcödé", out)
+}
+
+func TestFormatLink(t *testing.T) {
+	assert.Equal(t, "[a](/b.md)", FormatLink(false, "a", "/b.md"))
+	assert.Equal(t, "![a](</my note.md>)", FormatLink(true, "a", "/my note.md"))
+	assert.Equal(t, "[[Plan]]", FormatWikiLink("Plan", "", "Plan"))
+	assert.Equal(t, "[[a/Plan#x|p]]", FormatWikiLink("a/Plan", "#x", "p"))
+}
+
+func TestAttachmentURL(t *testing.T) {
+	id, ok := ParseAttachmentURL(AttachmentURL(42))
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), id)
+
+	id, ok = ParseAttachmentURL("/api/attachments/42?size=small")
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), id)
+
+	_, ok = ParseAttachmentURL("/api/attachments/x")
+	assert.False(t, ok)
+	_, ok = ParseAttachmentURL("https://example.com/a.png")
+	assert.False(t, ok)
+}
+
+func TestNoteURL(t *testing.T) {
+	id, ok := ParseNoteURL(NoteURL(7))
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), id)
+
+	id, ok = ParseNoteURL("/api/notes/7#Goals")
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), id)
+
+	_, ok = ParseNoteURL("/api/notes/7/html")
+	assert.False(t, ok)
+	_, ok = ParseNoteURL("/api/attachments/7")
+	assert.False(t, ok)
+}
+
+func TestRefLink(t *testing.T) {
+	note := "[[Plan.md#Goals|the plan]] ![[diagram.png]] [[ Notes ]] [a](../Other%20Note.md#x) ![b](img.md) [c](https://example.com/c.md) [d](d.txt) [e](/api/notes/7#x)"
+
+	var links []Link
+	RewriteRefs(note, func(ref Ref) (string, bool) {
+		if link, ok := ref.Link(); ok {
+			links = append(links, link)
+		}
+		return "", false
+	})
+
+	assert.Equal(t, ExtractLinks(note), links)
+	assert.Equal(t, []Link{
+		{Kind: LinkKindWiki, Target: "Plan", Text: "the plan"},
+		{Kind: LinkKindWiki, Target: "Notes", Text: "Notes"},
+		{Kind: LinkKindMarkdown, Target: "../Other Note", Text: "a"},
+		{Kind: LinkKindID, Target: "7", Text: "e"},
+	}, links)
+}
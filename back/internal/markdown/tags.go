@@ -0,0 +1,82 @@
+package markdown
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const maxTagLength = 100
+
+// a tag starts with # at the start of a line or after a character that can't
+// be part of a word, a URL or an HTML entity, so "# Heading", "a#b",
+// "site.com/#anchor" and "&#39;" are all left alone
+var tagRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/#])#([\p{L}\p{N}_/-]+)`)
+
+// ExtractTags collects the tags of a note, both the #tags written in the
+// markdown and the ones listed under tags: in its frontmatter. Tags are
+// lower-cased, deduplicated and sorted, nested tags such as project/alpha are
+// kept whole.
+func ExtractTags(note string) []string {
+	meta, body, err := SplitFrontmatter(note)
+	if err != nil {
+		body = note
+	}
+
+	var tags []string
+
+	for _, key := range []string{"tags", "tag"} {
+		for _, tag := range stringList(meta[key]) {
+			if tag = NormalizeTag(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	for _, match := range tagRegex.FindAllStringSubmatch(stripCode(body), -1) {
+		if tag := NormalizeTag(match[1]); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
+// NormalizeTag turns user input such as "#Project/Alpha/" into the form tags
+// are stored in, giving back "" when nothing usable is left. Purely numeric
+// tags are rejected so issue references like #123 aren't treated as tags.
+func NormalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	tag = strings.TrimPrefix(tag, "#")
+
+	var parts []string
+	for _, part := range strings.Split(tag, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	tag = strings.Join(parts, "/")
+
+	if tag == "" || len(tag) > maxTagLength {
+		return ""
+	}
+
+	hasLetter := false
+	for _, r := range tag {
+		switch {
+		case unicode.IsLetter(r) || r == '_' || r == '-':
+			hasLetter = true
+		case unicode.IsDigit(r) || r == '/':
+		default:
+			return ""
+		}
+	}
+
+	if !hasLetter {
+		return ""
+	}
+
+	return tag
+}
@@ -0,0 +1,70 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractTags(t *testing.T) {
+	tests := []struct {
+		name string
+		note string
+		tags []string
+	}{
+		{
+			name: "no tags",
+			note: "just some text",
+			tags: nil,
+		},
+		{
+			name: "inline tags",
+			note: "#todo buy milk, see #Shopping and #todo again",
+			tags: []string{"shopping", "todo"},
+		},
+		{
+			name: "nested tags",
+			note: "working on #project/alpha/ and #project/beta",
+			tags: []string{"project/alpha", "project/beta"},
+		},
+		{
+			name: "headings, anchors, entities and numbers are not tags",
+			note: "# Heading\n## Sub\nsee site.com/#anchor, it&#39;s issue #123 or a#b",
+			tags: nil,
+		},
+		{
+			name: "tags inside code are ignored",
+			note: "real #tag\n```\n#notatag\n```\nand `#inline` code",
+			tags: []string{"tag"},
+		},
+		{
+			name: "frontmatter list",
+			note: "---\ntitle: hello\ntags: [Work, \"#meeting\"]\n---\nbody #inline",
+			tags: []string{"inline", "meeting", "work"},
+		},
+		{
+			name: "frontmatter string",
+			note: "---\ntags: work, project/alpha\n---\n",
+			tags: []string{"project/alpha", "work"},
+		},
+		{
+			name: "broken frontmatter still yields inline tags",
+			note: "---\ntags: [unclosed\n---\n#inline",
+			tags: []string{"inline"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.tags, ExtractTags(tt.note))
+		})
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	assert.Equal(t, "project/alpha", NormalizeTag("#Project//Alpha/"))
+	assert.Equal(t, "2024-review", NormalizeTag("2024-review"))
+	assert.Equal(t, "", NormalizeTag("#2024"))
+	assert.Equal(t, "", NormalizeTag("has space"))
+	assert.Equal(t, "", NormalizeTag("#"))
+}
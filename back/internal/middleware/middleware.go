@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"database/sql"
+	"errors"
 	"markdown-notes/internal/store"
 	"markdown-notes/internal/tokens"
 	"markdown-notes/internal/utils"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 )
@@ -13,17 +17,28 @@ type UserMiddleware struct {
 	UserStore store.UserStore
 }
 
+// AuthMiddleware looks the user up by the token in an Authorization: Bearer
+// header, for clients that aren't browsers, or in the auth_token cookie.
 func (um *UserMiddleware) AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		cookie, err := c.Cookie("auth_token")
-		if err != nil {
-			if err == http.ErrNoCookie {
-				return echo.NewHTTPError(http.StatusUnauthorized, utils.Envelope{"error": "missing auth token"})
+		var token string
+		if header := c.Request().Header.Get(echo.HeaderAuthorization); header != "" {
+			scheme, value, ok := strings.Cut(header, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(value) == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, utils.Envelope{"error": "invalid authorization header"})
+			}
+			token = strings.TrimSpace(value)
+		} else {
+			cookie, err := c.Cookie("auth_token")
+			if err != nil {
+				if err == http.ErrNoCookie {
+					return echo.NewHTTPError(http.StatusUnauthorized, utils.Envelope{"error": "missing auth token"})
+				}
+				return echo.NewHTTPError(http.StatusBadRequest, utils.Envelope{"error": "invalid cookie"})
 			}
-			return echo.NewHTTPError(http.StatusBadRequest, utils.Envelope{"error": "invalid cookie"})
+			token = cookie.Value
 		}
 
-		token := cookie.Value
 		user, err := um.UserStore.GetUserToken(tokens.ScopeAuth, token)
 		if err != nil || user == nil {
 			return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired token")
@@ -43,3 +58,56 @@ func CurrentUser(c echo.Context) (*store.User, bool) {
 	u, ok := v.(*store.User)
 	return u, ok
 }
+
+type WorkspaceMiddleware struct {
+	WorkspacesStore store.WorkspacesStore
+}
+
+// WorkspaceMiddleware picks the workspace a request works in from the
+// X-Workspace-ID header or the workspace_id query parameter. Requests without
+// either aren't tied to one: folder 0 stands for the root of the user's
+// personal workspace and listings cover every workspace. It has to run after
+// AuthMiddleware.
+func (wm *WorkspaceMiddleware) WorkspaceMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		param := c.Request().Header.Get("X-Workspace-ID")
+		if param == "" {
+			param = c.QueryParam("workspace_id")
+		}
+		if param == "" {
+			return next(c)
+		}
+
+		workspace_id, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, utils.Envelope{"error": "invalid workspace id"})
+		}
+
+		user, ok := CurrentUser(c)
+		if !ok {
+			return echo.NewHTTPError(http.StatusUnauthorized, "not authenticated")
+		}
+
+		workspace, err := wm.WorkspacesStore.GetWorkspace(user.ID, workspace_id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return echo.NewHTTPError(http.StatusNotFound, utils.Envelope{"error": "workspace doesn't exist or you aren't a member of it"})
+		}
+		if err != nil {
+			return err
+		}
+
+		c.Set("workspace", workspace)
+
+		return next(c)
+	}
+}
+
+// CurrentWorkspace returns the workspace the request picked, if it did.
+func CurrentWorkspace(c echo.Context) (*store.Workspace, bool) {
+	v := c.Get("workspace")
+	if v == nil {
+		return nil, false
+	}
+	w, ok := v.(*store.Workspace)
+	return w, ok
+}
@@ -0,0 +1,121 @@
+// Package render turns note markdown into sanitized HTML.
+package render
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"markdown-notes/internal/markdown"
+	"regexp"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+const DefaultCacheSize = 512
+
+// Renderer renders markdown to HTML and keeps the most recently rendered
+// documents in an LRU cache keyed by the SHA-256 of their source.
+type Renderer struct {
+	md     goldmark.Markdown
+	policy *bluemonday.Policy
+
+	mu      sync.Mutex
+	size    int
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List
+}
+
+type cacheEntry struct {
+	key  [sha256.Size]byte
+	html string
+}
+
+func NewRenderer(cacheSize int) *Renderer {
+	policy := bluemonday.UGCPolicy()
+	// Links between notes stay followable, only links off the site get nofollow.
+	policy.RequireNoFollowOnLinks(false)
+	policy.RequireNoFollowOnFullyQualifiedLinks(true)
+	// Task list items render as disabled checkboxes.
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	// Fenced code blocks keep their language for client side highlighting.
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	// Footnote references and back links.
+	policy.AllowAttrs("id").Matching(regexp.MustCompile(`^fn(ref)?[\w:-]*$`)).OnElements("li", "sup")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^footnote(s|-ref|-backref)$`)).OnElements("a", "div")
+	policy.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-(noteref|backlink|endnotes)$`)).OnElements("a", "div")
+
+	return &Renderer{
+		md: goldmark.New(
+			goldmark.WithExtensions(extension.GFM, extension.Footnote),
+		),
+		policy:  policy,
+		size:    cacheSize,
+		entries: map[[sha256.Size]byte]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Render returns the sanitized HTML for a note, leaving out its frontmatter.
+func (r *Renderer) Render(note string) (string, error) {
+	key := sha256.Sum256([]byte(note))
+
+	if html, ok := r.cached(key); ok {
+		return html, nil
+	}
+
+	_, body, err := markdown.SplitFrontmatter(note)
+	if err != nil {
+		// Malformed frontmatter is shown as written rather than dropped.
+		body = note
+	}
+
+	var buf bytes.Buffer
+	err = r.md.Convert([]byte(body), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	html := r.policy.SanitizeReader(&buf).String()
+	r.store(key, html)
+
+	return html, nil
+}
+
+func (r *Renderer) cached(key [sha256.Size]byte) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elem, ok := r.entries[key]
+	if !ok {
+		return "", false
+	}
+
+	r.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).html, true
+}
+
+func (r *Renderer) store(key [sha256.Size]byte, html string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size <= 0 {
+		return
+	}
+
+	if elem, ok := r.entries[key]; ok {
+		r.lru.MoveToFront(elem)
+		return
+	}
+
+	r.entries[key] = r.lru.PushFront(&cacheEntry{key: key, html: html})
+
+	for r.lru.Len() > r.size {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
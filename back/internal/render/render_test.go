@@ -0,0 +1,77 @@
+package render
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	r := NewRenderer(DefaultCacheSize)
+
+	t.Run("renders gfm extensions", func(t *testing.T) {
+		html, err := r.Render("- [x] done\n- [ ] todo\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n~~gone~~ text[^1]\n\n[^1]: a footnote\n")
+		assert.NoError(t, err)
+		assert.Contains(t, html, `<input checked="" disabled="" type="checkbox"> done`)
+		assert.Contains(t, html, `<input disabled="" type="checkbox"> todo`)
+		assert.Contains(t, html, "<td>1</td>")
+		assert.Contains(t, html, "<del>gone</del>")
+		assert.Contains(t, html, `<sup id="fnref:1"><a href="#fn:1" class="footnote-ref"`)
+		assert.Contains(t, html, `<li id="fn:1">`)
+	})
+
+	t.Run("keeps code block languages", func(t *testing.T) {
+		html, err := r.Render("```go\nx := 1\n```\n")
+		assert.NoError(t, err)
+		assert.Contains(t, html, `<code class="language-go">x := 1`)
+	})
+
+	t.Run("leaves out frontmatter", func(t *testing.T) {
+		html, err := r.Render("---\ntags: [a]\n---\n# Title\n")
+		assert.NoError(t, err)
+		assert.Equal(t, "<h1>Title</h1>\n", html)
+	})
+
+	t.Run("adds nofollow to links off the site only", func(t *testing.T) {
+		html, err := r.Render("[plan](Plan.html) [docs](https://example.com/docs)\n")
+		assert.NoError(t, err)
+		assert.Contains(t, html, `<a href="Plan.html">plan</a>`)
+		assert.Contains(t, html, `<a href="https://example.com/docs" rel="nofollow">docs</a>`)
+	})
+
+	t.Run("strips scripts and unsafe urls", func(t *testing.T) {
+		html, err := r.Render("<script>alert(1)</script>\n\n[click](javascript:alert(1)) <img src=x onerror=alert(1)>\n\n<a href=\"#\" onclick=\"alert(1)\">a</a>\n")
+		assert.NoError(t, err)
+		assert.NotContains(t, html, "<script")
+		assert.NotContains(t, html, "javascript:")
+		assert.NotContains(t, html, "onerror")
+		assert.NotContains(t, html, "onclick")
+	})
+}
+
+func TestRenderCache(t *testing.T) {
+	r := NewRenderer(2)
+
+	_, err := r.Render("a")
+	assert.NoError(t, err)
+	_, err = r.Render("b")
+	assert.NoError(t, err)
+
+	t.Run("serves repeated content from the cache", func(t *testing.T) {
+		html, ok := r.cached(sha256.Sum256([]byte("a")))
+		assert.True(t, ok)
+		assert.Equal(t, "<p>a</p>\n", html)
+	})
+
+	t.Run("evicts the least recently used entry", func(t *testing.T) {
+		_, err := r.Render("c")
+		assert.NoError(t, err)
+
+		_, ok := r.cached(sha256.Sum256([]byte("b")))
+		assert.False(t, ok)
+		_, ok = r.cached(sha256.Sum256([]byte("a")))
+		assert.True(t, ok)
+		assert.Equal(t, 2, r.lru.Len())
+	})
+}
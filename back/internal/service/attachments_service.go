@@ -0,0 +1,217 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/exif"
+	"markdown-notes/internal/store"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+type AttachmentsService struct {
+	notesStore       store.NotesStore
+	attachmentsStore store.AttachmentsStore
+	blobs            blob.BlobStore
+	collector        *BlobCollector
+	thumbnails       ThumbnailServiceI
+}
+
+// NewAttachmentsService creates the service, thumbnails may be nil to skip
+// making thumbnails of uploaded images.
+func NewAttachmentsService(
+	notesStore store.NotesStore,
+	attachmentsStore store.AttachmentsStore,
+	blobs blob.BlobStore,
+	collector *BlobCollector,
+	thumbnails ThumbnailServiceI,
+) *AttachmentsService {
+	return &AttachmentsService{
+		notesStore,
+		attachmentsStore,
+		blobs,
+		collector,
+		thumbnails,
+	}
+}
+
+type AttachmentsServiceI interface {
+	UploadAttachment(user *store.User, note_id int64, filename string, content io.Reader) (*store.Attachment, error)
+	GetNoteAttachments(user *store.User, note_id int64) ([]store.Attachment, error)
+	OpenAttachment(user *store.User, attachment_id int64) (*store.Attachment, blob.Blob, error)
+	StripLocation(user *store.User, attachment_id int64) (*store.Attachment, error)
+}
+
+// UploadAttachment stores content as an attachment of a note the user can
+// edit. The content type is sniffed from the content itself rather than
+// trusted from the client.
+func (a *AttachmentsService) UploadAttachment(user *store.User, note_id int64, filename string, content io.Reader) (*store.Attachment, error) {
+	role, err := a.notesStore.NoteRole(user.ID, note_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = role.Check(store.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	release := a.collector.Hold()
+	stored, err := putAttachmentContent(a.blobs, content)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	stored.NoteID = note_id
+	stored.Filename = cleanFilename(filename)
+
+	attachment, err := a.attachmentsStore.CreateAttachment(user.ID, stored)
+	release()
+	if err != nil {
+		a.collector.Discard([]string{stored.SHA256})
+		return nil, err
+	}
+
+	if a.thumbnails != nil {
+		a.thumbnails.Enqueue(attachment)
+	}
+
+	return attachment, nil
+}
+
+func (a *AttachmentsService) GetNoteAttachments(user *store.User, note_id int64) ([]store.Attachment, error) {
+	role, err := a.notesStore.NoteRole(user.ID, note_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = role.Check(store.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	return a.attachmentsStore.GetNoteAttachments(user.ID, note_id)
+}
+
+// OpenAttachment returns an attachment along with its content, the caller
+// closes the blob.
+func (a *AttachmentsService) OpenAttachment(user *store.User, attachment_id int64) (*store.Attachment, blob.Blob, error) {
+	role, err := a.attachmentsStore.AttachmentRole(user.ID, attachment_id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = role.Check(store.RoleViewer); err != nil {
+		return nil, nil, err
+	}
+
+	attachment, err := a.attachmentsStore.GetAttachment(user.ID, attachment_id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := a.blobs.Open(attachment.SHA256)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return attachment, b, nil
+}
+
+// StripLocation removes GPS metadata from a JPEG or PNG attachment. The
+// cleaned image is stored as a new blob, the old one is left to the
+// collector, which deletes it unless another attachment shares it.
+func (a *AttachmentsService) StripLocation(user *store.User, attachment_id int64) (*store.Attachment, error) {
+	role, err := a.attachmentsStore.AttachmentRole(user.ID, attachment_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = role.Check(store.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	attachment, err := a.attachmentsStore.GetAttachment(user.ID, attachment_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if attachment.ContentType != "image/jpeg" && attachment.ContentType != "image/png" {
+		return nil, exif.ErrUnsupported
+	}
+
+	original, err := a.blobs.Open(attachment.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(original)
+	original.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	stripped, changed, err := exif.StripLocation(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed {
+		return attachment, nil
+	}
+
+	release := a.collector.Hold()
+	defer release()
+
+	key, size, err := a.blobs.Put(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := a.attachmentsStore.ReplaceAttachmentContent(user.ID, attachment_id, key, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// putAttachmentContent stores content as a blob and returns an attachment
+// with its size, hash and sniffed content type filled in.
+func putAttachmentContent(blobs blob.BlobStore, content io.Reader) (*store.Attachment, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	key, size, err := blobs.Put(io.MultiReader(bytes.NewReader(head), content))
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.Attachment{
+		ContentType: http.DetectContentType(head),
+		Size:        size,
+		SHA256:      key,
+	}, nil
+}
+
+// cleanFilename keeps only the base name of an uploaded file.
+func cleanFilename(filename string) string {
+	filename = filepath.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if filename == "." || filename == "/" {
+		return "attachment"
+	}
+
+	if runes := []rune(filename); len(runes) > 255 {
+		ext := []rune(filepath.Ext(filename))
+		if len(ext) > 16 {
+			ext = nil
+		}
+		filename = string(runes[:255-len(ext)]) + string(ext)
+	}
+
+	return filename
+}
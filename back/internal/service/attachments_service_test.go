@@ -0,0 +1,247 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"log"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/exif"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/thumbnail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestAttachments(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	attachmentsStore := store.NewPostgresAttachmentsStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+
+	blobs, err := blob.NewLocalBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	collector := NewBlobCollector(attachmentsStore, blobs, time.Hour, log.New(io.Discard, "", 0))
+	defer collector.Close()
+	attachmentsService := NewAttachmentsService(notesStore, attachmentsStore, blobs, collector, nil)
+
+	user := &store.User{
+		Username: "Theo",
+		Email:    "drumandbassbob@gmail.com",
+	}
+	user.PasswordHash.Set("Password")
+
+	user2 := &store.User{
+		Username: "Other",
+		Email:    "other@gmail.com",
+	}
+	user2.PasswordHash.Set("Password")
+
+	rootFolderId, err := registerUserService.RegisterUser(user)
+	assert.NoError(t, err)
+	_, err = registerUserService.RegisterUser(user2)
+	assert.NoError(t, err)
+
+	note, err := notesStore.CreateNote(user.ID, rootFolderId, "note", "")
+	assert.NoError(t, err)
+
+	var first *store.Attachment
+
+	t.Run("uploads an attachment", func(t *testing.T) {
+		first, err = attachmentsService.UploadAttachment(user, note.ID, "../photos/cat.png", bytes.NewReader(pngHeader))
+		assert.NoError(t, err)
+		assert.Equal(t, "cat.png", first.Filename)
+		assert.Equal(t, "image/png", first.ContentType)
+		assert.Equal(t, int64(len(pngHeader)), first.Size)
+		assert.Equal(t, 64, len(first.SHA256))
+	})
+
+	t.Run("deduplicates the blob but not the attachment", func(t *testing.T) {
+		second, err := attachmentsService.UploadAttachment(user, note.ID, "copy.png", bytes.NewReader(pngHeader))
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.ID, second.ID)
+		assert.Equal(t, first.SHA256, second.SHA256)
+
+		attachments, err := attachmentsService.GetNoteAttachments(user, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(attachments))
+	})
+
+	t.Run("opens the attachment content", func(t *testing.T) {
+		attachment, b, err := attachmentsService.OpenAttachment(user, first.ID)
+		assert.NoError(t, err)
+		defer b.Close()
+
+		content, err := io.ReadAll(b)
+		assert.NoError(t, err)
+		assert.Equal(t, first.ID, attachment.ID)
+		assert.Equal(t, pngHeader, content)
+	})
+
+	t.Run("sniffs text content", func(t *testing.T) {
+		attachment, err := attachmentsService.UploadAttachment(user, note.ID, "notes.txt", strings.NewReader("plain text"))
+		assert.NoError(t, err)
+		assert.Equal(t, "text/plain; charset=utf-8", attachment.ContentType)
+	})
+
+	t.Run("other users can't upload to or read the note's attachments", func(t *testing.T) {
+		_, err := attachmentsService.UploadAttachment(user2, note.ID, "x.png", bytes.NewReader(pngHeader))
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, _, err = attachmentsService.OpenAttachment(user2, first.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, err = attachmentsService.GetNoteAttachments(user2, note.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("collects blobs of attachments purged along with their note", func(t *testing.T) {
+		other, err := notesStore.CreateNote(user.ID, rootFolderId, "other", "")
+		assert.NoError(t, err)
+
+		shared, err := attachmentsService.UploadAttachment(user, other.ID, "shared.png", bytes.NewReader(pngHeader))
+		assert.NoError(t, err)
+		only, err := attachmentsService.UploadAttachment(user, other.ID, "only.txt", strings.NewReader("only here"))
+		assert.NoError(t, err)
+
+		_, err = notesStore.TrashNote(user.ID, other.ID)
+		assert.NoError(t, err)
+		err = notesStore.PurgeNote(user.ID, other.ID)
+		assert.NoError(t, err)
+
+		collected, err := collector.Collect()
+		assert.NoError(t, err)
+		assert.True(t, collected)
+
+		_, err = blobs.Open(only.SHA256)
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+
+		b, err := blobs.Open(shared.SHA256)
+		if assert.NoError(t, err) {
+			b.Close()
+		}
+	})
+
+	t.Run("doesn't collect while blobs are being stored", func(t *testing.T) {
+		release := collector.Hold()
+		collected, err := collector.Collect()
+		release()
+		assert.NoError(t, err)
+		assert.False(t, collected)
+	})
+}
+
+func TestCleanFilename(t *testing.T) {
+	assert.Equal(t, "cat.png", cleanFilename("cat.png"))
+	assert.Equal(t, "cat.png", cleanFilename("/tmp/../cat.png"))
+	assert.Equal(t, "cat.png", cleanFilename(`C:\Users\me\cat.png`))
+	assert.Equal(t, "attachment", cleanFilename(""))
+	assert.Equal(t, "attachment", cleanFilename("/"))
+
+	long := cleanFilename(strings.Repeat("é", 300) + ".png")
+	assert.Equal(t, 255, len([]rune(long)))
+	assert.True(t, strings.HasSuffix(long, "é.png"))
+}
+
+func encodePNG(t *testing.T, width int, height int) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)))
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestThumbnails(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	attachmentsStore := store.NewPostgresAttachmentsStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+
+	blobs, err := blob.NewLocalBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	collector := NewBlobCollector(attachmentsStore, blobs, time.Hour, log.New(io.Discard, "", 0))
+	defer collector.Close()
+	thumbnailService := NewThumbnailService(attachmentsStore, blobs, collector, 2, log.New(io.Discard, "", 0))
+	attachmentsService := NewAttachmentsService(notesStore, attachmentsStore, blobs, collector, thumbnailService)
+
+	user := &store.User{
+		Username: "Theo",
+		Email:    "drumandbassbob@gmail.com",
+	}
+	user.PasswordHash.Set("Password")
+
+	rootFolderId, err := registerUserService.RegisterUser(user)
+	assert.NoError(t, err)
+
+	note, err := notesStore.CreateNote(user.ID, rootFolderId, "note", "")
+	assert.NoError(t, err)
+
+	photo, err := attachmentsService.UploadAttachment(user, note.ID, "photo.png", bytes.NewReader(encodePNG(t, 2048, 1024)))
+	assert.NoError(t, err)
+	text, err := attachmentsService.UploadAttachment(user, note.ID, "notes.txt", strings.NewReader("plain text"))
+	assert.NoError(t, err)
+
+	// wait for the workers to finish
+	thumbnailService.Close()
+
+	t.Run("workers make every size for uploaded images", func(t *testing.T) {
+		small, err := attachmentsStore.GetThumbnail(user.ID, photo.ID, "small")
+		assert.NoError(t, err)
+		assert.Equal(t, 256, small.Width)
+		assert.Equal(t, 128, small.Height)
+
+		medium, err := attachmentsStore.GetThumbnail(user.ID, photo.ID, "medium")
+		assert.NoError(t, err)
+		assert.Equal(t, 1024, medium.Width)
+	})
+
+	t.Run("opens a thumbnail", func(t *testing.T) {
+		thumb, b, err := thumbnailService.OpenThumbnail(user, photo.ID, "small")
+		assert.NoError(t, err)
+		defer b.Close()
+
+		img, err := png.Decode(b)
+		assert.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, thumb.Width, thumb.Height), img.Bounds())
+	})
+
+	t.Run("makes missing thumbnails on request", func(t *testing.T) {
+		_, err := db.Exec("DELETE FROM attachment_thumbnails WHERE attachment_id = $1", photo.ID)
+		assert.NoError(t, err)
+
+		thumb, b, err := thumbnailService.OpenThumbnail(user, photo.ID, "medium")
+		assert.NoError(t, err)
+		b.Close()
+		assert.Equal(t, 1024, thumb.Width)
+	})
+
+	t.Run("rejects unknown sizes and non images", func(t *testing.T) {
+		_, _, err := thumbnailService.OpenThumbnail(user, photo.ID, "huge")
+		assert.ErrorIs(t, err, ErrThumbnailSize)
+
+		_, _, err = thumbnailService.OpenThumbnail(user, text.ID, "small")
+		assert.ErrorIs(t, err, thumbnail.ErrUnsupported)
+	})
+
+	t.Run("strip location leaves images without exif alone", func(t *testing.T) {
+		stripped, err := attachmentsService.StripLocation(user, photo.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, photo.SHA256, stripped.SHA256)
+
+		_, err = attachmentsService.StripLocation(user, text.ID)
+		assert.ErrorIs(t, err, exif.ErrUnsupported)
+	})
+}
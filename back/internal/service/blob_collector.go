@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"log"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/store"
+	"sync"
+	"time"
+)
+
+// DefaultBlobCollectInterval is how often unreferenced blobs are deleted.
+const DefaultBlobCollectInterval = 10 * time.Minute
+
+const blobCollectBatch = 500
+
+// BlobCollector deletes blobs nothing refers to anymore. Blobs are shared
+// between identical uploads and the rows referring to them go away in many
+// ways, purging a note or deleting a folder among them, so the database marks
+// the blobs they referred to and the collector checks them every so often.
+//
+// A blob is stored before the row referring to it is committed, so whatever
+// stores one holds the collector with Hold until that row is committed.
+// Collecting doesn't run while any are held, otherwise a blob could be
+// deleted right after an upload found it was stored already.
+type BlobCollector struct {
+	attachmentsStore store.AttachmentsStore
+	blobs            blob.BlobStore
+	logger           *log.Logger
+
+	mu sync.RWMutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewBlobCollector starts collecting every interval until Close.
+func NewBlobCollector(attachmentsStore store.AttachmentsStore, blobs blob.BlobStore, interval time.Duration, logger *log.Logger) *BlobCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &BlobCollector{
+		attachmentsStore: attachmentsStore,
+		blobs:            blobs,
+		logger:           logger,
+		cancel:           cancel,
+	}
+
+	c.wg.Add(1)
+	go c.run(ctx, interval)
+
+	return c
+}
+
+// Hold keeps blobs from being collected until the returned func is called.
+func (c *BlobCollector) Hold() func() {
+	c.mu.RLock()
+	return c.mu.RUnlock
+}
+
+// Discard marks blobs stored for rows that were never committed, they are
+// deleted on the next collection unless something else refers to them.
+func (c *BlobCollector) Discard(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return c.attachmentsStore.AddOrphanedBlobs(keys)
+}
+
+// Collect deletes the marked blobs nothing refers to. It gives up and
+// returns false when blobs are being stored, rather than holding up uploads
+// behind a long import.
+func (c *BlobCollector) Collect() (bool, error) {
+	if !c.mu.TryLock() {
+		return false, nil
+	}
+	defer c.mu.Unlock()
+
+	for {
+		keys, err := c.attachmentsStore.GetOrphanedBlobs(blobCollectBatch)
+		if err != nil {
+			return true, err
+		}
+
+		for _, key := range keys {
+			inUse, err := c.attachmentsStore.BlobInUse(key)
+			if err != nil {
+				return true, err
+			}
+
+			if !inUse {
+				err = c.blobs.Delete(key)
+				if err != nil {
+					return true, err
+				}
+			}
+
+			err = c.attachmentsStore.ForgetOrphanedBlob(key)
+			if err != nil {
+				return true, err
+			}
+		}
+
+		if len(keys) < blobCollectBatch {
+			return true, nil
+		}
+	}
+}
+
+// Close stops collecting.
+func (c *BlobCollector) Close() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *BlobCollector) run(ctx context.Context, interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := c.Collect()
+			if err != nil {
+				c.logger.Printf("ERROR: collecting blobs %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"archive/zip"
+	"cmp"
+	"io"
+	"markdown-notes/internal/archive"
+	"markdown-notes/internal/markdown"
+	"markdown-notes/internal/store"
+	"slices"
+	"time"
+)
+
+type ExportService struct {
+	folderStore store.FoldersStore
+	notesStore  store.NotesStore
+	tagsStore   store.TagsStore
+}
+
+func NewExportService(
+	folderStore store.FoldersStore,
+	notesStore store.NotesStore,
+	tagsStore store.TagsStore,
+) *ExportService {
+	return &ExportService{
+		folderStore,
+		notesStore,
+		tagsStore,
+	}
+}
+
+type ExportServiceI interface {
+	ExportFolder(user *store.User, folder_id int64) (*FolderExport, error)
+}
+
+// FolderExport is a folder subtree ready to be written out as a zip. Folders
+// are loaded up front, notes are read one folder at a time while writing and
+// their tags all at once.
+type FolderExport struct {
+	Name string
+
+	user    *store.User
+	folders []store.Folder
+	service *ExportService
+}
+
+func (e *ExportService) ExportFolder(user *store.User, folder_id int64) (*FolderExport, error) {
+	folders, err := e.folderStore.GetFolderTree(user.ID, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	name := folders[0].Name
+	if folders[0].ParentID == nil {
+		name = "notes"
+	}
+
+	return &FolderExport{
+		Name:    archive.SanitizeName(name),
+		user:    user,
+		folders: folders,
+		service: e,
+	}, nil
+}
+
+// WriteZip streams the export to w. Folders become directories and notes
+// become markdown files with their metadata in YAML frontmatter.
+func (x *FolderExport) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	paths := map[int64]string{x.folders[0].ID: ""}
+	namers := map[int64]*archive.Namer{}
+	for _, folder := range x.folders {
+		namers[folder.ID] = archive.NewNamer()
+	}
+
+	// Subfolders claim their names before notes so a note can't push a
+	// folder to a suffixed name.
+	for _, folder := range x.folders[1:] {
+		parent := *folder.ParentID
+		paths[folder.ID] = paths[parent] + namers[parent].Name(folder.Name, "") + "/"
+	}
+
+	folderIDs := make([]int64, len(x.folders))
+	for i, folder := range x.folders {
+		folderIDs[i] = folder.ID
+	}
+	tags, err := x.service.tagsStore.GetFoldersNoteTags(x.user.ID, folderIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, folder := range x.folders {
+		if paths[folder.ID] != "" {
+			_, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     paths[folder.ID],
+				Modified: folder.UpdatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		notes, err := x.service.notesStore.GetNotesInFolder(x.user.ID, folder.ID)
+		if err != nil {
+			return err
+		}
+		slices.SortFunc(notes, func(a, b store.Note) int {
+			return cmp.Compare(a.ID, b.ID)
+		})
+
+		for _, note := range notes {
+			filename := namers[folder.ID].Name(note.Title, ".md")
+			content, err := exportNote(&note, tags[note.ID], filename)
+			if err != nil {
+				return err
+			}
+
+			fw, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     paths[folder.ID] + filename,
+				Method:   zip.Deflate,
+				Modified: note.UpdatedAt,
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = io.WriteString(fw, content)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return zw.Close()
+}
+
+// exportNote adds the note's metadata to any frontmatter it already has. The
+// title is only written out when the file name can't carry it unchanged.
+func exportNote(note *store.Note, tags []string, filename string) (string, error) {
+	meta, body, err := markdown.SplitFrontmatter(note.Note)
+	if err != nil {
+		// keep unparseable frontmatter as part of the body
+		meta, body = nil, note.Note
+	}
+	if meta == nil {
+		meta = map[string]any{}
+	}
+
+	meta["id"] = note.ID
+	meta["created_at"] = note.CreatedAt.UTC().Format(time.RFC3339)
+	meta["updated_at"] = note.UpdatedAt.UTC().Format(time.RFC3339)
+	if len(tags) > 0 {
+		meta["tags"] = tags
+	}
+	if filename != note.Title+".md" {
+		meta["title"] = note.Title
+	}
+
+	return markdown.JoinFrontmatter(meta, body)
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"io"
+	"markdown-notes/internal/markdown"
+	"markdown-notes/internal/store"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportNote(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	note := &store.Note{
+		ID:        7,
+		Title:     "a/b",
+		Note:      "---\nauthor: me\n---\nhello #x\n",
+		CreatedAt: created,
+		UpdatedAt: created.Add(time.Hour),
+	}
+
+	content, err := exportNote(note, []string{"x"}, "a-b.md")
+	assert.NoError(t, err)
+
+	meta, body, err := markdown.SplitFrontmatter(content)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello #x\n", body)
+	assert.Equal(t, map[string]any{
+		"author":     "me",
+		"id":         7,
+		"created_at": "2026-01-02T03:04:05Z",
+		"updated_at": "2026-01-02T04:04:05Z",
+		"tags":       []any{"x"},
+		"title":      "a/b",
+	}, meta)
+
+	note.Title = "plain"
+	note.Note = "no frontmatter"
+	content, err = exportNote(note, nil, "plain.md")
+	assert.NoError(t, err)
+
+	meta, body, err = markdown.SplitFrontmatter(content)
+	assert.NoError(t, err)
+	assert.Equal(t, "no frontmatter", body)
+	assert.NotContains(t, meta, "title")
+	assert.NotContains(t, meta, "tags")
+}
+
+func TestExportFolder(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	folderStore := store.NewPostgresFoldersStore(db)
+	tagsStore := store.NewPostgresTagsStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+	exportService := NewExportService(folderStore, notesStore, tagsStore)
+
+	user := &store.User{
+		Username: "Theo",
+		Email:    "drumandbassbob@gmail.com",
+	}
+	user.PasswordHash.Set("Password")
+
+	user2 := &store.User{
+		Username: "Other",
+		Email:    "other@gmail.com",
+	}
+	user2.PasswordHash.Set("Password")
+
+	rootFolderId, err := registerUserService.RegisterUser(user)
+	assert.NoError(t, err)
+	_, err = registerUserService.RegisterUser(user2)
+	assert.NoError(t, err)
+
+	projects, err := folderStore.CreateFolder(user.ID, rootFolderId, "Projects")
+	assert.NoError(t, err)
+	nested, err := folderStore.CreateFolder(user.ID, projects.ID, "a:b")
+	assert.NoError(t, err)
+
+	_, err = notesStore.CreateNote(user.ID, projects.ID, "Plan", "#work the plan")
+	assert.NoError(t, err)
+	_, err = notesStore.CreateNote(user.ID, nested.ID, "x/y", "first")
+	assert.NoError(t, err)
+	_, err = notesStore.CreateNote(user.ID, nested.ID, "x:y", "second")
+	assert.NoError(t, err)
+	trashed, err := notesStore.CreateNote(user.ID, projects.ID, "Old", "")
+	assert.NoError(t, err)
+	_, err = notesStore.TrashNote(user.ID, trashed.ID)
+	assert.NoError(t, err)
+
+	t.Run("zips the subtree", func(t *testing.T) {
+		export, err := exportService.ExportFolder(user, projects.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Projects", export.Name)
+
+		var buf bytes.Buffer
+		err = export.WriteZip(&buf)
+		assert.NoError(t, err)
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+
+		files := map[string]string{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			assert.NoError(t, err)
+			content, err := io.ReadAll(rc)
+			assert.NoError(t, err)
+			rc.Close()
+			files[f.Name] = string(content)
+		}
+
+		assert.Equal(t, []string{"Plan.md", "a-b/", "a-b/x-y (2).md", "a-b/x-y.md"}, sortedKeys(files))
+
+		meta, body, err := markdown.SplitFrontmatter(files["Plan.md"])
+		assert.NoError(t, err)
+		assert.Equal(t, "#work the plan", body)
+		assert.Equal(t, []any{"work"}, meta["tags"])
+
+		meta, body, err = markdown.SplitFrontmatter(files["a-b/x-y (2).md"])
+		assert.NoError(t, err)
+		assert.Equal(t, "second", body)
+		assert.Equal(t, "x:y", meta["title"])
+	})
+
+	t.Run("other users folder", func(t *testing.T) {
+		_, err := exportService.ExportFolder(user2, projects.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
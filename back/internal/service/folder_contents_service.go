@@ -6,24 +6,35 @@ import (
 	"markdown-notes/internal/store"
 )
 
+var (
+	ErrRootFolder     = errors.New("the root folder can't be renamed, moved or deleted")
+	ErrFolderCycle    = store.ErrFolderCycle
+	ErrOtherWorkspace = errors.New("notes and folders can't be moved into another workspace")
+)
+
 type FolderContentsService struct {
 	db          *sql.DB
 	userStore   store.UserStore
 	folderStore store.FoldersStore
 	noteStore   store.NotesStore
+	sites       *PublishService
 }
 
+// NewFolderContentsService creates the service, sites may be nil when
+// nothing is published.
 func NewFolderContentsService(
 	db *sql.DB,
 	userStore store.UserStore,
 	folderStore store.FoldersStore,
 	noteStore store.NotesStore,
+	sites *PublishService,
 ) *FolderContentsService {
 	return &FolderContentsService{
 		db,
 		userStore,
 		folderStore,
 		noteStore,
+		sites,
 	}
 }
 
@@ -37,16 +48,26 @@ type FolderContentsServiceI interface {
 	GetFolderContent(user *store.User, folder_id int64) (*FolderContent, error)
 	CreateSubFolder(user *store.User, parent_id int64, name string) (*store.Folder, error)
 	CreateNote(user *store.User, folder_id int64, title string, note string) (*store.Note, error)
+	UpdateNote(user *store.User, note_id int64, update store.NoteUpdate) (*store.Note, error)
+	UpdateFolder(user *store.User, folder_id int64, name *string, parent_id *int64) (*store.Folder, error)
+	DeleteFolder(user *store.User, folder_id int64) error
 }
 
-func (f *FolderContentsService) GetFolderContent(user *store.User, folder_id int64) (*FolderContent, error) {
-	owns, err := f.folderStore.UserOwnsFolder(user.ID, folder_id)
+// checkFolder returns an error unless the user has at least the required role
+// on the folder.
+func (f *FolderContentsService) checkFolder(user *store.User, folder_id int64, required store.Role) error {
+	role, err := f.folderStore.FolderRole(user.ID, folder_id)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if owns == false {
-		return nil, errors.New("unauthorized")
+	return role.Check(required)
+}
+
+func (f *FolderContentsService) GetFolderContent(user *store.User, folder_id int64) (*FolderContent, error) {
+	err := f.checkFolder(user, folder_id, store.RoleViewer)
+	if err != nil {
+		return nil, err
 	}
 
 	folders, err := f.folderStore.GetSubFolders(user.ID, folder_id)
@@ -67,15 +88,11 @@ func (f *FolderContentsService) GetFolderContent(user *store.User, folder_id int
 }
 
 func (f *FolderContentsService) CreateSubFolder(user *store.User, parent_id int64, name string) (*store.Folder, error) {
-	owns, err := f.folderStore.UserOwnsFolder(user.ID, parent_id)
+	err := f.checkFolder(user, parent_id, store.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
 
-	if owns == false {
-		return nil, errors.New("unauthorized")
-	}
-
 	folder, err := f.folderStore.CreateFolder(user.ID, parent_id, name)
 	if err != nil {
 		return nil, err
@@ -94,22 +111,140 @@ func (f *FolderContentsService) CreateNote(user *store.User, folder_id int64, ti
 		}
 		use_folder_id = root_folder_id
 	} else {
-		// otherwise check if folder belongs to the user
+		// otherwise check the user can add notes to the folder
 		use_folder_id = folder_id
-		owns, err := f.folderStore.UserOwnsFolder(user.ID, folder_id)
+		err := f.checkFolder(user, folder_id, store.RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dbNote, err := f.noteStore.CreateNote(user.ID, use_folder_id, title, note)
+	if err != nil {
+		return nil, err
+	}
+
+	return dbNote, nil
+}
+
+func (f *FolderContentsService) UpdateNote(user *store.User, note_id int64, update store.NoteUpdate) (*store.Note, error) {
+	role, err := f.noteStore.NoteRole(user.ID, note_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = role.Check(store.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	if update.FolderID != nil {
+		// moving the note, make sure the user can edit the destination and
+		// that it is in the same workspace
+		err = f.checkFolder(user, *update.FolderID, store.RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+
+		note, err := f.noteStore.GetNote(user.ID, note_id)
 		if err != nil {
 			return nil, err
 		}
 
-		if owns == false {
-			return nil, errors.New("unauthorized")
+		err = f.checkSameWorkspace(user, note.FolderID, *update.FolderID)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	dbNote, err := f.noteStore.CreateNote(user.ID, use_folder_id, title, note)
+	dbNote, err := f.noteStore.PatchNote(user.ID, note_id, update)
 	if err != nil {
 		return nil, err
 	}
 
 	return dbNote, nil
 }
+
+// checkSameWorkspace returns ErrOtherWorkspace unless both folders are in the
+// same workspace.
+func (f *FolderContentsService) checkSameWorkspace(user *store.User, folder_id int64, other_id int64) error {
+	folder, err := f.folderStore.GetFolder(user.ID, folder_id)
+	if err != nil {
+		return err
+	}
+
+	other, err := f.folderStore.GetFolder(user.ID, other_id)
+	if err != nil {
+		return err
+	}
+
+	if folder.WorkspaceID != other.WorkspaceID {
+		return ErrOtherWorkspace
+	}
+
+	return nil
+}
+
+func (f *FolderContentsService) UpdateFolder(user *store.User, folder_id int64, name *string, parent_id *int64) (*store.Folder, error) {
+	folder, err := f.folderStore.GetFolder(user.ID, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if folder.ParentID == nil {
+		return nil, ErrRootFolder
+	}
+
+	err = f.checkFolder(user, folder_id, store.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+
+	new_name := folder.Name
+	if name != nil {
+		new_name = *name
+	}
+
+	new_parent_id := *folder.ParentID
+	if parent_id != nil && *parent_id != new_parent_id {
+		err = f.checkFolder(user, *parent_id, store.RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+
+		err = f.checkSameWorkspace(user, folder_id, *parent_id)
+		if err != nil {
+			return nil, err
+		}
+
+		new_parent_id = *parent_id
+	}
+
+	return f.folderStore.UpdateFolder(user.ID, folder_id, new_parent_id, new_name)
+}
+
+func (f *FolderContentsService) DeleteFolder(user *store.User, folder_id int64) error {
+	folder, err := f.folderStore.GetFolder(user.ID, folder_id)
+	if err != nil {
+		return err
+	}
+
+	if folder.ParentID == nil {
+		return ErrRootFolder
+	}
+
+	err = f.checkFolder(user, folder_id, store.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	published, err := f.folderStore.DeleteFolder(user.ID, folder_id)
+	if err != nil {
+		return err
+	}
+
+	if f.sites != nil {
+		return f.sites.RemoveSites(published)
+	}
+
+	return nil
+}
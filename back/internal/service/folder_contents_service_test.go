@@ -13,8 +13,9 @@ func TestGetFolderContent(t *testing.T) {
 	userStore := store.NewPostgresUserStore(db)
 	notesStore := store.NewPostgresNotesStore(db)
 	folderStore := store.NewPostgresFoldersStore(db)
-	registerUserService := NewRegisterUserService(db, userStore, folderStore)
-	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore, nil)
 
 	user := &store.User{
 		Username: "Theo",
@@ -71,8 +72,9 @@ func TestCreateSubFolder(t *testing.T) {
 	userStore := store.NewPostgresUserStore(db)
 	notesStore := store.NewPostgresNotesStore(db)
 	folderStore := store.NewPostgresFoldersStore(db)
-	registerUserService := NewRegisterUserService(db, userStore, folderStore)
-	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore, nil)
 
 	user := &store.User{
 		Username: "Theo",
@@ -119,8 +121,9 @@ func TestCreateNote(t *testing.T) {
 	userStore := store.NewPostgresUserStore(db)
 	notesStore := store.NewPostgresNotesStore(db)
 	folderStore := store.NewPostgresFoldersStore(db)
-	registerUserService := NewRegisterUserService(db, userStore, folderStore)
-	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore, nil)
 
 	user := &store.User{
 		Username: "Theo",
@@ -167,3 +170,201 @@ func TestCreateNote(t *testing.T) {
 		assert.Nil(t, note)
 	})
 }
+
+func TestUpdateFolder(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	folderStore := store.NewPostgresFoldersStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore, nil)
+
+	user := &store.User{
+		Username: "Theo",
+		Email:    "drumandbassbob@gmail.com",
+	}
+	user.PasswordHash.Set("Password")
+
+	user2 := &store.User{
+		Username: "Other",
+		Email:    "other@gmail.com",
+	}
+	user2.PasswordHash.Set("Password")
+
+	rootFolderId, err := registerUserService.RegisterUser(user)
+	assert.NoError(t, err)
+	otherRootFolderId, err := registerUserService.RegisterUser(user2)
+	assert.NoError(t, err)
+
+	parent, err := folderContentsService.CreateSubFolder(user, rootFolderId, "parent")
+	assert.NoError(t, err)
+	child, err := folderContentsService.CreateSubFolder(user, parent.ID, "child")
+	assert.NoError(t, err)
+	sibling, err := folderContentsService.CreateSubFolder(user, rootFolderId, "sibling")
+	assert.NoError(t, err)
+
+	t.Run("renames folder in place", func(t *testing.T) {
+		name := "renamed"
+		folder, err := folderContentsService.UpdateFolder(user, parent.ID, &name, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "renamed", folder.Name)
+		assert.Equal(t, rootFolderId, *folder.ParentID)
+	})
+
+	t.Run("moves folder under a new parent", func(t *testing.T) {
+		folder, err := folderContentsService.UpdateFolder(user, sibling.ID, nil, &parent.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "sibling", folder.Name)
+		assert.Equal(t, parent.ID, *folder.ParentID)
+	})
+
+	t.Run("refuses to move folder into itself", func(t *testing.T) {
+		folder, err := folderContentsService.UpdateFolder(user, parent.ID, nil, &parent.ID)
+		assert.ErrorIs(t, err, ErrFolderCycle)
+		assert.Nil(t, folder)
+	})
+
+	t.Run("refuses to move folder into its descendant", func(t *testing.T) {
+		folder, err := folderContentsService.UpdateFolder(user, parent.ID, nil, &child.ID)
+		assert.ErrorIs(t, err, ErrFolderCycle)
+		assert.Nil(t, folder)
+	})
+
+	t.Run("refuses to touch root folder", func(t *testing.T) {
+		name := "not root"
+		folder, err := folderContentsService.UpdateFolder(user, rootFolderId, &name, nil)
+		assert.ErrorIs(t, err, ErrRootFolder)
+		assert.Nil(t, folder)
+	})
+
+	t.Run("surfaces duplicate sibling name", func(t *testing.T) {
+		name := "child"
+		folder, err := folderContentsService.UpdateFolder(user, sibling.ID, &name, nil)
+		assert.ErrorIs(t, err, store.ErrDuplicateFolder)
+		assert.Nil(t, folder)
+	})
+
+	t.Run("fails when moving into another user's folder", func(t *testing.T) {
+		folder, err := folderContentsService.UpdateFolder(user, child.ID, nil, &otherRootFolderId)
+		assert.Error(t, err)
+		assert.Nil(t, folder)
+	})
+
+	t.Run("fails when user doesn't own folder", func(t *testing.T) {
+		name := "hacked"
+		folder, err := folderContentsService.UpdateFolder(user2, child.ID, &name, nil)
+		assert.Error(t, err)
+		assert.Nil(t, folder)
+	})
+}
+
+func TestDeleteFolder(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	folderStore := store.NewPostgresFoldersStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore, nil)
+
+	user := &store.User{
+		Username: "Theo",
+		Email:    "drumandbassbob@gmail.com",
+	}
+	user.PasswordHash.Set("Password")
+
+	user2 := &store.User{
+		Username: "Other",
+		Email:    "other@gmail.com",
+	}
+	user2.PasswordHash.Set("Password")
+
+	rootFolderId, err := registerUserService.RegisterUser(user)
+	assert.NoError(t, err)
+	_, err = registerUserService.RegisterUser(user2)
+	assert.NoError(t, err)
+
+	parent, err := folderContentsService.CreateSubFolder(user, rootFolderId, "parent")
+	assert.NoError(t, err)
+	_, err = folderContentsService.CreateSubFolder(user, parent.ID, "child")
+	assert.NoError(t, err)
+
+	t.Run("refuses to delete root folder", func(t *testing.T) {
+		err := folderContentsService.DeleteFolder(user, rootFolderId)
+		assert.ErrorIs(t, err, ErrRootFolder)
+	})
+
+	t.Run("fails when user doesn't own folder", func(t *testing.T) {
+		err := folderContentsService.DeleteFolder(user2, parent.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("deletes folder recursively", func(t *testing.T) {
+		err := folderContentsService.DeleteFolder(user, parent.ID)
+		assert.NoError(t, err)
+
+		folderContent, err := folderContentsService.GetFolderContent(user, rootFolderId)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(folderContent.Folders))
+	})
+}
+
+func TestUpdateNote(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	folderStore := store.NewPostgresFoldersStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore, nil)
+
+	user := &store.User{
+		Username: "Theo",
+		Email:    "drumandbassbob@gmail.com",
+	}
+	user.PasswordHash.Set("Password")
+
+	user2 := &store.User{
+		Username: "Other",
+		Email:    "other@gmail.com",
+	}
+	user2.PasswordHash.Set("Password")
+
+	rootFolderId, err := registerUserService.RegisterUser(user)
+	assert.NoError(t, err)
+	otherRootFolderId, err := registerUserService.RegisterUser(user2)
+	assert.NoError(t, err)
+
+	subfolder, err := folderContentsService.CreateSubFolder(user, rootFolderId, "subfolder")
+	assert.NoError(t, err)
+	note, err := folderContentsService.CreateNote(user, rootFolderId, "note", "content")
+	assert.NoError(t, err)
+	_, err = folderContentsService.CreateNote(user, subfolder.ID, "clash", "content")
+	assert.NoError(t, err)
+
+	t.Run("renames and moves note", func(t *testing.T) {
+		title := "moved"
+		updated, err := folderContentsService.UpdateNote(user, note.ID, store.NoteUpdate{Title: &title, FolderID: &subfolder.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, "moved", updated.Title)
+		assert.Equal(t, subfolder.ID, updated.FolderID)
+		assert.Equal(t, "content", updated.Note)
+	})
+
+	t.Run("fails when title clashes in folder", func(t *testing.T) {
+		title := "clash"
+		updated, err := folderContentsService.UpdateNote(user, note.ID, store.NoteUpdate{Title: &title})
+		assert.ErrorIs(t, err, store.ErrDuplicateNote)
+		assert.Nil(t, updated)
+	})
+
+	t.Run("fails when moving into another user's folder", func(t *testing.T) {
+		updated, err := folderContentsService.UpdateNote(user, note.ID, store.NoteUpdate{FolderID: &otherRootFolderId})
+		assert.Error(t, err)
+		assert.Nil(t, updated)
+	})
+}
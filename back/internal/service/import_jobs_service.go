@@ -0,0 +1,282 @@
+package service
+
+import (
+	"archive/zip"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"markdown-notes/internal/importer"
+	"markdown-notes/internal/store"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrImportFormat    = errors.New("unknown import format")
+	ErrImportQueueFull = errors.New("too many imports are waiting, try again later")
+	ErrImportsClosed   = errors.New("the server is shutting down, try again later")
+)
+
+// Import job statuses.
+const (
+	ImportQueued  = "queued"
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// importQueueSize bounds how many uploaded imports can wait for a worker.
+const importQueueSize = 16
+
+// importJobTTL is how long a finished job can still be looked up.
+const importJobTTL = 24 * time.Hour
+
+// ImportJob is an import running in the background. Done and Total count
+// the notes written so far.
+type ImportJob struct {
+	ID         int64         `json:"id"`
+	Format     string        `json:"format"`
+	FolderID   int64         `json:"folder_id"`
+	Status     string        `json:"status"`
+	Done       int           `json:"done"`
+	Total      int           `json:"total"`
+	Report     *ImportReport `json:"report,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+
+	user *store.User
+	file string
+}
+
+// ImportJobsService runs imports on a pool of background workers. Jobs are
+// kept in memory, so they are only visible on the instance that took the
+// upload and are lost on restart.
+type ImportJobsService struct {
+	importService ImportServiceI
+	folderStore   store.FoldersStore
+	logger        *log.Logger
+	queue         chan *ImportJob
+	wg            sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[int64]*ImportJob
+	nextID int64
+	closed bool
+}
+
+func NewImportJobsService(
+	importService ImportServiceI,
+	folderStore store.FoldersStore,
+	workers int,
+	logger *log.Logger,
+) *ImportJobsService {
+	s := &ImportJobsService{
+		importService: importService,
+		folderStore:   folderStore,
+		logger:        logger,
+		queue:         make(chan *ImportJob, importQueueSize),
+		jobs:          map[int64]*ImportJob{},
+	}
+
+	for range max(workers, 1) {
+		s.wg.Add(1)
+		go s.work()
+	}
+
+	return s
+}
+
+type ImportJobsServiceI interface {
+	StartImport(user *store.User, folder_id int64, format string, upload io.Reader) (*ImportJob, error)
+	GetImportJob(user *store.User, job_id int64) (*ImportJob, error)
+}
+
+// StartImport saves an upload and queues it to be imported under one of the
+// user's folders, 0 meaning the root.
+func (s *ImportJobsService) StartImport(user *store.User, folder_id int64, format string, upload io.Reader) (*ImportJob, error) {
+	if _, ok := importer.Lookup(format); !ok {
+		return nil, ErrImportFormat
+	}
+
+	if folder_id != 0 {
+		role, err := s.folderStore.FolderRole(user.ID, folder_id)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = role.Check(store.RoleEditor); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.Copy(file, upload)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		os.Remove(file.Name())
+		return nil, ErrImportsClosed
+	}
+
+	s.prune()
+	s.nextID++
+	job := &ImportJob{
+		ID:        s.nextID,
+		Format:    format,
+		FolderID:  folder_id,
+		Status:    ImportQueued,
+		CreatedAt: time.Now(),
+		user:      user,
+		file:      file.Name(),
+	}
+
+	select {
+	case s.queue <- job:
+	default:
+		os.Remove(file.Name())
+		return nil, ErrImportQueueFull
+	}
+
+	s.jobs[job.ID] = job
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// GetImportJob returns the current state of one of the user's jobs.
+func (s *ImportJobsService) GetImportJob(user *store.User, job_id int64) (*ImportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[job_id]
+	if !ok || job.user.ID != user.ID {
+		return nil, sql.ErrNoRows
+	}
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// Close stops accepting jobs and waits for queued ones to finish. Uploads
+// still coming in fail with ErrImportsClosed.
+func (s *ImportJobsService) Close() {
+	s.mu.Lock()
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// prune forgets jobs that finished more than importJobTTL ago, the caller
+// holds the lock.
+func (s *ImportJobsService) prune() {
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > importJobTTL {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *ImportJobsService) update(job *ImportJob, change func(job *ImportJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change(job)
+}
+
+func (s *ImportJobsService) work() {
+	defer s.wg.Done()
+
+	for job := range s.queue {
+		s.update(job, func(job *ImportJob) {
+			job.Status = ImportRunning
+		})
+
+		report, err := s.run(job)
+		os.Remove(job.file)
+
+		message := ""
+		if err != nil {
+			var known bool
+			message, known = importErrorMessage(err)
+			if !known {
+				s.logger.Printf("ERROR: running import job %d %v", job.ID, err)
+			}
+		}
+
+		s.update(job, func(job *ImportJob) {
+			now := time.Now()
+			job.FinishedAt = &now
+			if err != nil {
+				job.Status = ImportFailed
+				job.Error = message
+				return
+			}
+			job.Status = ImportDone
+			job.Report = report
+		})
+	}
+}
+
+func (s *ImportJobsService) run(job *ImportJob) (*ImportReport, error) {
+	imp, ok := importer.Lookup(job.Format)
+	if !ok {
+		return nil, ErrImportFormat
+	}
+
+	file, err := os.Open(job.file)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	vault, err := imp.Read(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	return s.importService.Import(job.user, job.FolderID, vault, func(done int, total int) {
+		s.update(job, func(job *ImportJob) {
+			job.Done = done
+			job.Total = total
+		})
+	})
+}
+
+// importErrorMessage describes why an import failed in terms the user can
+// act on, reporting false for errors that aren't their doing.
+func importErrorMessage(err error) (string, bool) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "folder doesn't exist or you don't have access to it", true
+	case errors.Is(err, importer.ErrTooLarge):
+		return fmt.Sprintf("imports can expand to at most %d bytes and files to %d bytes", importer.MaxTotalSize, importer.MaxFileSize), true
+	case errors.Is(err, importer.ErrMalformed):
+		return "file is not a valid export", true
+	case errors.Is(err, zip.ErrFormat), errors.Is(err, zip.ErrAlgorithm), errors.Is(err, zip.ErrChecksum):
+		return "file is not a valid zip archive", true
+	}
+
+	return "internal server error", false
+}
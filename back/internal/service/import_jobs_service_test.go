@@ -0,0 +1,89 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"log"
+	"markdown-notes/internal/importer"
+	"markdown-notes/internal/store"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubImportService struct {
+	vaults chan *importer.Vault
+}
+
+func (s *stubImportService) Import(user *store.User, folder_id int64, vault *importer.Vault, progress ImportProgress) (*ImportReport, error) {
+	s.vaults <- vault
+	progress(len(vault.Notes), len(vault.Notes))
+	return &ImportReport{FolderID: 7, Notes: len(vault.Notes)}, nil
+}
+
+func waitForImportJob(t *testing.T, s *ImportJobsService, user *store.User, job_id int64) *ImportJob {
+	for range 100 {
+		job, err := s.GetImportJob(user, job_id)
+		assert.NoError(t, err)
+		if job.FinishedAt != nil {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("import job %d didn't finish", job_id)
+	return nil
+}
+
+func TestImportJobs(t *testing.T) {
+	imports := &stubImportService{vaults: make(chan *importer.Vault, 1)}
+	s := NewImportJobsService(imports, nil, 1, log.New(&bytes.Buffer{}, "", 0))
+	defer s.Close()
+
+	user := &store.User{ID: 1}
+	other := &store.User{ID: 2}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("Home.md")
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+
+	t.Run("imports in the background", func(t *testing.T) {
+		job, err := s.StartImport(user, 0, "markdown", bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, ImportQueued, job.Status)
+
+		vault := <-imports.vaults
+		assert.Equal(t, "Home", vault.Notes[0].Title)
+
+		finished := waitForImportJob(t, s, user, job.ID)
+		assert.Equal(t, ImportDone, finished.Status)
+		assert.Equal(t, 1, finished.Done)
+		assert.Equal(t, 1, finished.Total)
+		assert.Equal(t, &ImportReport{FolderID: 7, Notes: 1}, finished.Report)
+
+		_, err = s.GetImportJob(other, job.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("reports why an import failed", func(t *testing.T) {
+		job, err := s.StartImport(user, 0, "markdown", strings.NewReader("not a zip"))
+		assert.NoError(t, err)
+
+		finished := waitForImportJob(t, s, user, job.ID)
+		assert.Equal(t, ImportFailed, finished.Status)
+		assert.Equal(t, "file is not a valid zip archive", finished.Error)
+		assert.Nil(t, finished.Report)
+	})
+
+	t.Run("rejects unknown formats", func(t *testing.T) {
+		_, err := s.StartImport(user, 0, "word", strings.NewReader(""))
+		assert.ErrorIs(t, err, ErrImportFormat)
+	})
+}
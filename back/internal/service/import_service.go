@@ -0,0 +1,399 @@
+package service
+
+import (
+	"database/sql"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/importer"
+	"markdown-notes/internal/markdown"
+	"markdown-notes/internal/store"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ImportRenamed records a note whose title was taken in its folder.
+type ImportRenamed struct {
+	Path  string `json:"path"`
+	Title string `json:"title"`
+}
+
+// ImportReport describes what an import created and what it left out.
+type ImportReport struct {
+	FolderID    int64              `json:"folder_id"`
+	Folders     int                `json:"folders"`
+	Notes       int                `json:"notes"`
+	Attachments int                `json:"attachments"`
+	Renamed     []ImportRenamed    `json:"renamed"`
+	Skipped     []importer.Skipped `json:"skipped"`
+}
+
+type ImportService struct {
+	db               *sql.DB
+	folderStore      store.FoldersStore
+	notesStore       store.NotesStore
+	attachmentsStore store.AttachmentsStore
+	blobs            blob.BlobStore
+	collector        *BlobCollector
+	thumbnails       ThumbnailServiceI
+}
+
+// NewImportService creates the service, thumbnails may be nil to skip making
+// thumbnails of imported images.
+func NewImportService(
+	db *sql.DB,
+	folderStore store.FoldersStore,
+	notesStore store.NotesStore,
+	attachmentsStore store.AttachmentsStore,
+	blobs blob.BlobStore,
+	collector *BlobCollector,
+	thumbnails ThumbnailServiceI,
+) *ImportService {
+	return &ImportService{
+		db,
+		folderStore,
+		notesStore,
+		attachmentsStore,
+		blobs,
+		collector,
+		thumbnails,
+	}
+}
+
+type ImportServiceI interface {
+	Import(user *store.User, folder_id int64, vault *importer.Vault, progress ImportProgress) (*ImportReport, error)
+}
+
+// ImportProgress is told how many of an import's notes have been written,
+// it may be nil.
+type ImportProgress func(done int, total int)
+
+// imageSizeRegex matches the width or widthxheight alias Obsidian uses to size
+// embedded images.
+var imageSizeRegex = regexp.MustCompile(`^\d+(x\d+)?$`)
+
+// importedNote is a note from the vault along with where it ended up.
+type importedNote struct {
+	note     *importer.Note
+	id       int64
+	folderID int64
+	title    string
+}
+
+// Import recreates a vault under one of the user's folders, 0 meaning the
+// root. Everything is written in one transaction, so a failed import leaves
+// nothing behind. Links between notes are rewritten to the ids of the notes
+// they point at, and files the notes link to or embed become attachments.
+func (s *ImportService) Import(user *store.User, folder_id int64, vault *importer.Vault, progress ImportProgress) (*ImportReport, error) {
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+
+	if folder_id == 0 {
+		root, err := s.folderStore.GetRootFolder(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		folder_id = root
+	}
+
+	role, err := s.folderStore.FolderRole(user.ID, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = role.Check(store.RoleEditor); err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{
+		FolderID: folder_id,
+		Renamed:  []ImportRenamed{},
+		Skipped:  append([]importer.Skipped{}, vault.Skipped...),
+	}
+
+	// Blobs live outside the transaction, they are kept from being collected
+	// until it is committed and the ones this import stored are discarded if
+	// it fails.
+	var putKeys []string
+	committed := false
+	release := s.collector.Hold()
+	defer func() {
+		release()
+		if !committed {
+			s.collector.Discard(putKeys)
+		}
+	}()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	folderIDs := map[string]int64{"": folder_id}
+	// existing marks folders that were there before the import, their
+	// contents are checked for clashes.
+	existing := map[int64]bool{folder_id: true}
+
+	dirs := append([]string{}, vault.Dirs...)
+	sort.Slice(dirs, func(i, j int) bool {
+		di, dj := strings.Count(dirs[i], "/"), strings.Count(dirs[j], "/")
+		if di != dj {
+			return di < dj
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	for _, dir := range dirs {
+		parent := path.Dir(dir)
+		if parent == "." {
+			parent = ""
+		}
+		parent_id := folderIDs[parent]
+		name := path.Base(dir)
+
+		if existing[parent_id] {
+			subFolders, err := s.folderStore.GetSubFolders(user.ID, parent_id)
+			if err != nil {
+				return nil, err
+			}
+
+			found := false
+			for _, sub := range subFolders {
+				if strings.EqualFold(sub.Name, name) {
+					folderIDs[dir] = sub.ID
+					existing[sub.ID] = true
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+		}
+
+		id, err := s.folderStore.CreateFolderTx(tx, parent_id, name)
+		if err != nil {
+			return nil, err
+		}
+		folderIDs[dir] = id
+		report.Folders++
+	}
+
+	// Titles are compared the way links are resolved, ignoring case.
+	titles := map[int64]map[string]bool{}
+	takenTitles := func(folder_id int64) (map[string]bool, error) {
+		if taken, ok := titles[folder_id]; ok {
+			return taken, nil
+		}
+
+		taken := map[string]bool{}
+		if existing[folder_id] {
+			notes, err := s.notesStore.GetNotesInFolder(user.ID, folder_id)
+			if err != nil {
+				return nil, err
+			}
+			for _, note := range notes {
+				taken[strings.ToLower(note.Title)] = true
+			}
+		}
+		titles[folder_id] = taken
+
+		return taken, nil
+	}
+
+	// Notes are created with their bodies, which link to each other by id,
+	// so the ids are taken up front.
+	ids, err := s.notesStore.ReserveNoteIDsTx(tx, len(vault.Notes))
+	if err != nil {
+		return nil, err
+	}
+
+	created := make(map[*importer.Note]*importedNote, len(vault.Notes))
+	ordered := make([]*importedNote, 0, len(vault.Notes))
+	for i := range vault.Notes {
+		note := &vault.Notes[i]
+		folder_id := folderIDs[note.Dir]
+
+		taken, err := takenTitles(folder_id)
+		if err != nil {
+			return nil, err
+		}
+
+		title := importTitle(note.Title)
+		unique := title
+		for n := 2; taken[strings.ToLower(unique)]; n++ {
+			suffix := " (" + strconv.Itoa(n) + ")"
+			unique = truncateRunes(title, 255-utf8.RuneCountInString(suffix)) + suffix
+		}
+		taken[strings.ToLower(unique)] = true
+		if unique != note.Title {
+			report.Renamed = append(report.Renamed, ImportRenamed{Path: note.Path, Title: unique})
+		}
+
+		imported := &importedNote{note: note, id: ids[i], folderID: folder_id, title: unique}
+		created[note] = imported
+		ordered = append(ordered, imported)
+		report.Notes++
+	}
+
+	resolver := importer.NewResolver(vault)
+	referenced := map[*importer.File]bool{}
+	var attachments []*store.Attachment
+
+	progress(0, len(ordered))
+	for i, source := range ordered {
+		// A note linking to the same file twice gets one attachment. They
+		// are recorded once the note exists.
+		noteAttachments := map[*importer.File]*store.Attachment{}
+		var pending []*store.Attachment
+		var rewriteErr error
+
+		body := markdown.RewriteRefs(source.note.Body, func(ref markdown.Ref) (string, bool) {
+			if rewriteErr != nil {
+				return "", false
+			}
+
+			target, ok := resolver.Resolve(ref, source.note)
+			if !ok {
+				if ref.Embed && !isWebLink(ref.Target) {
+					report.Skipped = append(report.Skipped, importer.Skipped{
+						Path:   source.note.Path,
+						Reason: "embedded file " + ref.Target + " was not found",
+					})
+				}
+				return "", false
+			}
+
+			if target.File != nil {
+				referenced[target.File] = true
+
+				attachment, ok := noteAttachments[target.File]
+				if !ok {
+					stored, err := s.storeFile(tx, target.File, &putKeys)
+					if err != nil {
+						rewriteErr = err
+						return "", false
+					}
+					stored.NoteID = source.id
+					attachment = stored
+					noteAttachments[target.File] = attachment
+					pending = append(pending, attachment)
+				}
+
+				text := ref.Text
+				if ref.Wiki && (text == "" || imageSizeRegex.MatchString(text)) {
+					text = target.File.Filename()
+				}
+				return markdown.FormatLink(ref.Embed, text, markdown.AttachmentURL(attachment.ID)), true
+			}
+
+			return rewriteNoteLink(ref, target, created[target.Note]), true
+		})
+		if rewriteErr != nil {
+			return nil, rewriteErr
+		}
+
+		_, err = s.notesStore.CreateReservedNoteTx(tx, user.ID, source.id, source.folderID, source.title, body)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, attachment := range pending {
+			saved, err := s.attachmentsStore.CreateAttachmentTx(tx, user.ID, attachment)
+			if err != nil {
+				return nil, err
+			}
+			attachments = append(attachments, saved)
+		}
+
+		progress(i+1, len(ordered))
+	}
+
+	report.Attachments = len(attachments)
+
+	for i := range vault.Files {
+		file := &vault.Files[i]
+		if !referenced[file] {
+			report.Skipped = append(report.Skipped, importer.Skipped{Path: file.Path, Reason: "not referenced by any note"})
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	committed = true
+
+	if s.thumbnails != nil {
+		for _, attachment := range attachments {
+			s.thumbnails.Enqueue(attachment)
+		}
+	}
+
+	return report, nil
+}
+
+// storeFile stores a file from the vault for an attachment that is yet to be
+// created, with an id taken for it so notes can link to it. The blob it
+// stored is added to putKeys.
+func (s *ImportService) storeFile(tx *sql.Tx, file *importer.File, putKeys *[]string) (*store.Attachment, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	attachment, err := putAttachmentContent(s.blobs, rc)
+	if err != nil {
+		return nil, err
+	}
+	*putKeys = append(*putKeys, attachment.SHA256)
+	attachment.Filename = cleanFilename(file.Filename())
+
+	attachment.ID, err = s.attachmentsStore.ReserveAttachmentIDTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// rewriteNoteLink writes a link to an imported note by its id, which keeps
+// pointing at it whatever it is renamed to or moved. Wiki links keep their
+// alias, or else the target they named, as the text. Embedding a note isn't
+// something notes here can do, so embeds become plain links.
+func rewriteNoteLink(ref markdown.Ref, target importer.Target, dest *importedNote) string {
+	text := ref.Text
+	if ref.Wiki && text == "" {
+		text = ref.Target
+	}
+
+	return markdown.FormatLink(false, text, markdown.NoteURL(dest.id)+target.Fragment)
+}
+
+func isWebLink(target string) bool {
+	parsed, err := url.Parse(target)
+	return err == nil && (parsed.Scheme != "" || parsed.Host != "")
+}
+
+// importTitle makes a title from an imported file usable as a note title,
+// slashes would read as folders in links.
+func importTitle(title string) string {
+	title = strings.TrimSpace(strings.ReplaceAll(title, "/", "-"))
+	if title == "" {
+		return "Untitled"
+	}
+	return truncateRunes(title, 255)
+}
+
+func truncateRunes(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
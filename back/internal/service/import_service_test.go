@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"log"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/importer"
+	"markdown-notes/internal/markdown"
+	"markdown-notes/internal/store"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func vaultFile(path string, content []byte) importer.File {
+	return importer.File{
+		Path: path,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		},
+	}
+}
+
+func TestImport(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	folderStore := store.NewPostgresFoldersStore(db)
+	attachmentsStore := store.NewPostgresAttachmentsStore(db)
+	linksStore := store.NewPostgresNoteLinksStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+
+	blobs, err := blob.NewLocalBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	collector := NewBlobCollector(attachmentsStore, blobs, time.Hour, log.New(io.Discard, "", 0))
+	defer collector.Close()
+	importService := NewImportService(db, folderStore, notesStore, attachmentsStore, blobs, collector, nil)
+
+	user := &store.User{
+		Username: "Theo",
+		Email:    "drumandbassbob@gmail.com",
+	}
+	user.PasswordHash.Set("Password")
+
+	user2 := &store.User{
+		Username: "Other",
+		Email:    "other@gmail.com",
+	}
+	user2.PasswordHash.Set("Password")
+
+	rootFolderId, err := registerUserService.RegisterUser(user)
+	assert.NoError(t, err)
+	otherRootId, err := registerUserService.RegisterUser(user2)
+	assert.NoError(t, err)
+
+	existingNote, err := notesStore.CreateNote(user.ID, rootFolderId, "Home", "already here")
+	assert.NoError(t, err)
+	projects, err := folderStore.CreateFolder(user.ID, rootFolderId, "Projects")
+	assert.NoError(t, err)
+
+	newVault := func() *importer.Vault {
+		return &importer.Vault{
+			Dirs: []string{"Projects", "assets"},
+			Notes: []importer.Note{
+				{Path: "Home.md", Dir: "", Title: "Home", Body: "See [[Plan#Goals|the plan]] and ![[diagram.png|300]]\n![again](assets/diagram.png)"},
+				{Path: "Projects/Plan.md", Dir: "Projects", Title: "Plan", Body: "---\ntags:\n    - work\n---\nBack [[Home]], ![[missing.png]]"},
+			},
+			Files: []importer.File{
+				vaultFile("assets/diagram.png", pngHeader),
+				vaultFile("assets/unused.txt", []byte("unused")),
+			},
+			Skipped: []importer.Skipped{{Path: "bad.md", Reason: "note is not valid UTF-8"}},
+		}
+	}
+
+	t.Run("imports notes, folders and attachments", func(t *testing.T) {
+		var progress []int
+		report, err := importService.Import(user, 0, newVault(), func(done int, total int) {
+			progress = append(progress, done)
+			assert.Equal(t, 2, total)
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []int{0, 1, 2}, progress)
+		assert.Equal(t, rootFolderId, report.FolderID)
+		assert.Equal(t, 1, report.Folders)
+		assert.Equal(t, 2, report.Notes)
+		assert.Equal(t, 1, report.Attachments)
+		assert.Equal(t, []ImportRenamed{{Path: "Home.md", Title: "Home (2)"}}, report.Renamed)
+		assert.Equal(t, []importer.Skipped{
+			{Path: "bad.md", Reason: "note is not valid UTF-8"},
+			{Path: "Projects/Plan.md", Reason: "embedded file missing.png was not found"},
+			{Path: "assets/unused.txt", Reason: "not referenced by any note"},
+		}, report.Skipped)
+
+		rootNotes, err := notesStore.GetNotesInFolder(user.ID, rootFolderId)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(rootNotes))
+
+		projectNotes, err := notesStore.GetNotesInFolder(user.ID, projects.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(projectNotes))
+		plan := projectNotes[0]
+
+		var home store.Note
+		for _, note := range rootNotes {
+			if note.ID != existingNote.ID {
+				home = note
+			}
+		}
+		assert.Equal(t, "---\ntags:\n    - work\n---\nBack [Home]("+markdown.NoteURL(home.ID)+"), ![[missing.png]]", plan.Note)
+
+		// each note is written once, with its body
+		assert.Equal(t, int64(1), plan.Version)
+		assert.Equal(t, int64(1), home.Version)
+
+		attachments, err := attachmentsStore.GetNoteAttachments(user.ID, home.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(attachments))
+		assert.Equal(t, "diagram.png", attachments[0].Filename)
+		assert.Equal(t, "image/png", attachments[0].ContentType)
+
+		url := markdown.AttachmentURL(attachments[0].ID)
+		assert.Equal(t, "See [the plan]("+markdown.NoteURL(plan.ID)+"#Goals) and ![diagram.png]("+url+")\n![again]("+url+")", home.Note)
+
+		outlinks, err := linksStore.GetOutlinks(user.ID, home.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(outlinks))
+		assert.Equal(t, plan.ID, outlinks[0].Note.ID)
+
+		outlinks, err = linksStore.GetOutlinks(user.ID, plan.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(outlinks))
+		assert.Equal(t, home.ID, outlinks[0].Note.ID)
+	})
+
+	t.Run("doesn't import into another user's folder", func(t *testing.T) {
+		_, err := importService.Import(user, otherRootId, newVault(), nil)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("leaves nothing behind when it fails", func(t *testing.T) {
+		vault := newVault()
+		vault.Files[0] = importer.File{
+			Path: "assets/diagram.png",
+			Open: func() (io.ReadCloser, error) {
+				return nil, io.ErrUnexpectedEOF
+			},
+		}
+
+		_, err := importService.Import(user, projects.ID, vault, nil)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+		subFolders, err := folderStore.GetSubFolders(user.ID, projects.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(subFolders))
+
+		projectNotes, err := notesStore.GetNotesInFolder(user.ID, projects.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(projectNotes))
+	})
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"markdown-notes/internal/store"
+)
+
+var (
+	ErrMemberRole  = errors.New("role must be viewer, editor or owner")
+	ErrMemberUser  = errors.New("there is no user with that username")
+	ErrMemberOwner = errors.New("the folder's owner and you can't be invited to it")
+)
+
+type MembersService struct {
+	userStore    store.UserStore
+	folderStore  store.FoldersStore
+	membersStore store.MembersStore
+}
+
+func NewMembersService(userStore store.UserStore, folderStore store.FoldersStore, membersStore store.MembersStore) *MembersService {
+	return &MembersService{
+		userStore:    userStore,
+		folderStore:  folderStore,
+		membersStore: membersStore,
+	}
+}
+
+type MembersServiceI interface {
+	GetMembers(user *store.User, folder_id int64) ([]store.Member, error)
+	AddMember(user *store.User, folder_id int64, username string, role store.Role) (*store.Member, error)
+	UpdateMember(user *store.User, folder_id int64, member_id int64, role store.Role) (*store.Member, error)
+	RemoveMember(user *store.User, folder_id int64, member_id int64) error
+	GetSharedFolders(user *store.User) ([]store.SharedFolder, error)
+}
+
+func (s *MembersService) checkFolder(user *store.User, folder_id int64, required store.Role) error {
+	role, err := s.folderStore.FolderRole(user.ID, folder_id)
+	if err != nil {
+		return err
+	}
+
+	return role.Check(required)
+}
+
+// GetMembers lists the users given a role on the folder itself, anyone who
+// can see the folder can see who else has access.
+func (s *MembersService) GetMembers(user *store.User, folder_id int64) ([]store.Member, error) {
+	err := s.checkFolder(user, folder_id, store.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.membersStore.GetMembers(folder_id)
+}
+
+// AddMember gives the user called username a role on the folder and
+// everything below it. Only owners can invite.
+func (s *MembersService) AddMember(user *store.User, folder_id int64, username string, role store.Role) (*store.Member, error) {
+	if !role.Valid() {
+		return nil, ErrMemberRole
+	}
+
+	err := s.checkFolder(user, folder_id, store.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	invitee, err := s.userStore.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	if invitee == nil {
+		return nil, ErrMemberUser
+	}
+
+	if invitee.ID == user.ID {
+		return nil, ErrMemberOwner
+	}
+
+	// workspace admins own the folder already
+	inviteeRole, err := s.folderStore.FolderRole(invitee.ID, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if inviteeRole == store.RoleOwner {
+		return nil, ErrMemberOwner
+	}
+
+	return s.membersStore.AddMember(folder_id, invitee.ID, role)
+}
+
+// UpdateMember changes the role of one of the folder's members.
+func (s *MembersService) UpdateMember(user *store.User, folder_id int64, member_id int64, role store.Role) (*store.Member, error) {
+	if !role.Valid() {
+		return nil, ErrMemberRole
+	}
+
+	err := s.checkFolder(user, folder_id, store.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.membersStore.UpdateMember(folder_id, member_id, role)
+}
+
+// RemoveMember takes a member's role on the folder away. Owners can remove
+// anyone, other members only themselves.
+func (s *MembersService) RemoveMember(user *store.User, folder_id int64, member_id int64) error {
+	required := store.RoleOwner
+	if member_id == user.ID {
+		required = store.RoleViewer
+	}
+
+	err := s.checkFolder(user, folder_id, required)
+	if err != nil {
+		return err
+	}
+
+	return s.membersStore.DeleteMember(folder_id, member_id)
+}
+
+// GetSharedFolders lists the folders other users have shared with the user.
+func (s *MembersService) GetSharedFolders(user *store.User) ([]store.SharedFolder, error) {
+	return s.membersStore.GetSharedFolders(user.ID)
+}
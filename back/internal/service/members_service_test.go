@@ -0,0 +1,116 @@
+package service
+
+import (
+	"database/sql"
+	"markdown-notes/internal/store"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMembers(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	folderStore := store.NewPostgresFoldersStore(db)
+	membersStore := store.NewPostgresMembersStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore, nil)
+	membersService := NewMembersService(userStore, folderStore, membersStore)
+
+	users := map[string]*store.User{}
+	roots := map[string]int64{}
+	for _, name := range []string{"Theo", "Editor", "Viewer"} {
+		user := &store.User{Username: name, Email: name + "@gmail.com"}
+		user.PasswordHash.Set("Password")
+		root, err := registerUserService.RegisterUser(user)
+		assert.NoError(t, err)
+		users[name] = user
+		roots[name] = root
+	}
+	owner, editor, viewer := users["Theo"], users["Editor"], users["Viewer"]
+
+	projects, err := folderContentsService.CreateSubFolder(owner, roots["Theo"], "Projects")
+	assert.NoError(t, err)
+	plan, err := folderContentsService.CreateNote(owner, projects.ID, "Plan", "")
+	assert.NoError(t, err)
+
+	t.Run("owners invite by username", func(t *testing.T) {
+		member, err := membersService.AddMember(owner, projects.ID, "Editor", store.RoleEditor)
+		assert.NoError(t, err)
+		assert.Equal(t, editor.ID, member.UserID)
+
+		_, err = membersService.AddMember(owner, projects.ID, "Viewer", store.RoleViewer)
+		assert.NoError(t, err)
+
+		_, err = membersService.AddMember(owner, projects.ID, "Nobody", store.RoleViewer)
+		assert.ErrorIs(t, err, ErrMemberUser)
+
+		_, err = membersService.AddMember(owner, projects.ID, "Theo", store.RoleViewer)
+		assert.ErrorIs(t, err, ErrMemberOwner)
+
+		_, err = membersService.AddMember(owner, projects.ID, "Viewer", store.Role("admin"))
+		assert.ErrorIs(t, err, ErrMemberRole)
+
+		_, err = membersService.AddMember(editor, projects.ID, "Viewer", store.RoleOwner)
+		assert.ErrorIs(t, err, store.ErrForbidden)
+	})
+
+	t.Run("roles decide what members can do", func(t *testing.T) {
+		title := "Renamed"
+		_, err := folderContentsService.UpdateNote(editor, plan.ID, store.NoteUpdate{Title: &title})
+		assert.NoError(t, err)
+
+		_, err = folderContentsService.UpdateNote(viewer, plan.ID, store.NoteUpdate{Title: &title})
+		assert.ErrorIs(t, err, store.ErrForbidden)
+
+		content, err := folderContentsService.GetFolderContent(viewer, projects.ID)
+		assert.NoError(t, err)
+		assert.Len(t, content.Notes, 1)
+
+		// notes can't leave their workspace
+		_, err = folderContentsService.UpdateNote(editor, plan.ID, store.NoteUpdate{FolderID: &projects.ID})
+		assert.NoError(t, err)
+		editorRoot := roots["Editor"]
+		_, err = folderContentsService.UpdateNote(editor, plan.ID, store.NoteUpdate{FolderID: &editorRoot})
+		assert.ErrorIs(t, err, ErrOtherWorkspace)
+
+		err = folderContentsService.DeleteFolder(editor, projects.ID)
+		assert.ErrorIs(t, err, store.ErrForbidden)
+
+		_, err = folderContentsService.GetFolderContent(viewer, roots["Theo"])
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("shared with me", func(t *testing.T) {
+		shared, err := membersService.GetSharedFolders(viewer)
+		assert.NoError(t, err)
+		assert.Len(t, shared, 1)
+		assert.Equal(t, "Projects", shared[0].Name)
+		assert.Equal(t, "Theo", shared[0].Owner)
+	})
+
+	t.Run("changing roles and leaving", func(t *testing.T) {
+		_, err := membersService.UpdateMember(viewer, projects.ID, viewer.ID, store.RoleOwner)
+		assert.ErrorIs(t, err, store.ErrForbidden)
+
+		member, err := membersService.UpdateMember(owner, projects.ID, viewer.ID, store.RoleEditor)
+		assert.NoError(t, err)
+		assert.Equal(t, store.RoleEditor, member.Role)
+
+		err = membersService.RemoveMember(viewer, projects.ID, editor.ID)
+		assert.ErrorIs(t, err, store.ErrForbidden)
+
+		err = membersService.RemoveMember(viewer, projects.ID, viewer.ID)
+		assert.NoError(t, err)
+
+		err = membersService.RemoveMember(owner, projects.ID, editor.ID)
+		assert.NoError(t, err)
+
+		members, err := membersService.GetMembers(owner, projects.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, members)
+	})
+}
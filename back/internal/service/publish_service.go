@@ -0,0 +1,583 @@
+package service
+
+import (
+	"archive/zip"
+	"cmp"
+	"database/sql"
+	"errors"
+	"html/template"
+	"io"
+	"markdown-notes/internal/archive"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/markdown"
+	"markdown-notes/internal/render"
+	"markdown-notes/internal/site"
+	"markdown-notes/internal/store"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type PublishService struct {
+	folderStore      store.FoldersStore
+	notesStore       store.NotesStore
+	tagsStore        store.TagsStore
+	linksStore       store.NoteLinksStore
+	attachmentsStore store.AttachmentsStore
+	blobs            blob.BlobStore
+	renderer         *render.Renderer
+	sitesDir         string
+
+	// mu serializes publishing so two builds of a folder can't swap their
+	// output into place at once.
+	mu sync.Mutex
+}
+
+func NewPublishService(
+	folderStore store.FoldersStore,
+	notesStore store.NotesStore,
+	tagsStore store.TagsStore,
+	linksStore store.NoteLinksStore,
+	attachmentsStore store.AttachmentsStore,
+	blobs blob.BlobStore,
+	renderer *render.Renderer,
+	sitesDir string,
+) *PublishService {
+	return &PublishService{
+		folderStore:      folderStore,
+		notesStore:       notesStore,
+		tagsStore:        tagsStore,
+		linksStore:       linksStore,
+		attachmentsStore: attachmentsStore,
+		blobs:            blobs,
+		renderer:         renderer,
+		sitesDir:         sitesDir,
+	}
+}
+
+type PublishServiceI interface {
+	BuildSite(user *store.User, folder_id int64) (*SiteBuild, error)
+	PublishFolder(user *store.User, folder_id int64) (*PublishedSite, error)
+	UnpublishFolder(user *store.User, folder_id int64) error
+}
+
+// PublishedSite describes a site written to the sites directory.
+type PublishedSite struct {
+	FolderID    int64     `json:"folder_id"`
+	PublishedAt time.Time `json:"published_at"`
+	Pages       int       `json:"pages"`
+	Attachments int       `json:"attachments"`
+}
+
+// sitePage is where a note ends up in the site.
+type sitePage struct {
+	note store.Note
+	path string
+}
+
+// SiteBuild is a folder subtree laid out as a static site. Folders and notes,
+// with their links and tags, are loaded up front so every page knows where the
+// others are, notes are rendered while writing.
+type SiteBuild struct {
+	Name string
+
+	user     *store.User
+	folders  []store.Folder
+	dirs     map[int64]string
+	pages    map[int64][]sitePage
+	notePath map[int64]string
+	outlinks map[int64][]store.Outlink
+	tags     map[int64][]string
+	service  *PublishService
+}
+
+// BuildSite lays out the folder subtree as a site: an index.html per folder,
+// an HTML page per note, tags.html and style.css at the top and copied
+// attachments under attachments/.
+func (p *PublishService) BuildSite(user *store.User, folder_id int64) (*SiteBuild, error) {
+	folders, err := p.folderStore.GetFolderTree(user.ID, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	name := folders[0].Name
+	if folders[0].ParentID == nil {
+		name = "notes"
+	}
+
+	build := &SiteBuild{
+		Name:     archive.SanitizeName(name),
+		user:     user,
+		folders:  folders,
+		dirs:     map[int64]string{folders[0].ID: ""},
+		pages:    map[int64][]sitePage{},
+		notePath: map[int64]string{},
+		service:  p,
+	}
+
+	namers := map[int64]*archive.Namer{}
+	for _, folder := range folders {
+		namers[folder.ID] = archive.NewNamer()
+		namers[folder.ID].Name("index", ".html")
+	}
+	for _, reserved := range []string{"tags.html", "style.css", "attachments"} {
+		namers[folders[0].ID].Name(reserved, "")
+	}
+
+	for _, folder := range folders[1:] {
+		parent := *folder.ParentID
+		build.dirs[folder.ID] = build.dirs[parent] + namers[parent].Name(folder.Name, "") + "/"
+	}
+
+	for _, folder := range folders {
+		notes, err := p.notesStore.GetNotesInFolder(user.ID, folder.ID)
+		if err != nil {
+			return nil, err
+		}
+		slices.SortFunc(notes, func(a, b store.Note) int {
+			return cmp.Compare(a.ID, b.ID)
+		})
+
+		for _, note := range notes {
+			page := sitePage{
+				note: note,
+				path: build.dirs[folder.ID] + namers[folder.ID].Name(note.Title, ".html"),
+			}
+			build.pages[folder.ID] = append(build.pages[folder.ID], page)
+			build.notePath[note.ID] = page.path
+		}
+	}
+
+	folderIDs := make([]int64, len(folders))
+	for i, folder := range folders {
+		folderIDs[i] = folder.ID
+	}
+	build.outlinks, err = p.linksStore.GetFoldersOutlinks(user.ID, folderIDs)
+	if err != nil {
+		return nil, err
+	}
+	build.tags, err = p.tagsStore.GetFoldersNoteTags(user.ID, folderIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return build, nil
+}
+
+// WriteZip streams the site to w as a zip archive.
+func (b *SiteBuild) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	_, err := b.write(site.NewZipWriter(zw))
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// PublishFolder builds the folder's site into the sites directory, replacing
+// the last one published, and marks the folder as published. Only owners can
+// publish a folder.
+func (p *PublishService) PublishFolder(user *store.User, folder_id int64) (*PublishedSite, error) {
+	role, err := p.folderStore.FolderRole(user.ID, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = role.Check(store.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	build, err := p.BuildSite(user, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err = os.MkdirAll(p.sitesDir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build next to the live site so it can be swapped in with a rename.
+	tmp, err := os.MkdirTemp(p.sitesDir, ".build-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	published, err := build.write(site.NewDirWriter(tmp))
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.replaceSite(folder_id, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	published.PublishedAt, err = p.folderStore.PublishFolder(user.ID, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return published, nil
+}
+
+// UnpublishFolder removes the folder's published site.
+func (p *PublishService) UnpublishFolder(user *store.User, folder_id int64) error {
+	err := p.folderStore.UnpublishFolder(user.ID, folder_id)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return os.RemoveAll(p.siteDir(folder_id))
+}
+
+// RemoveSites removes the published sites of folders that were deleted.
+func (p *PublishService) RemoveSites(folder_ids []int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, folder_id := range folder_ids {
+		err := os.RemoveAll(p.siteDir(folder_id))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *PublishService) siteDir(folder_id int64) string {
+	return filepath.Join(p.sitesDir, strconv.FormatInt(folder_id, 10))
+}
+
+// replaceSite moves a finished build into the folder's site directory. The
+// old site is moved aside first so the directory is never half written.
+func (p *PublishService) replaceSite(folder_id int64, build string) error {
+	dir := p.siteDir(folder_id)
+
+	old, err := os.MkdirTemp(p.sitesDir, ".old-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(old)
+
+	err = os.Rename(dir, filepath.Join(old, "site"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Rename(build, dir)
+}
+
+// siteWriter tracks what has been written while a site is built.
+type siteWriter struct {
+	build       *SiteBuild
+	w           site.Writer
+	siteName    string
+	attachments map[int64]string
+	tags        map[string][]site.Link
+	pages       int
+}
+
+func (b *SiteBuild) write(w site.Writer) (*PublishedSite, error) {
+	sw := &siteWriter{
+		build:       b,
+		w:           w,
+		siteName:    b.folders[0].Name,
+		attachments: map[int64]string{},
+		tags:        map[string][]site.Link{},
+	}
+	if b.folders[0].ParentID == nil {
+		sw.siteName = "Notes"
+	}
+
+	err := sw.writeFile("style.css", time.Now(), func(w io.Writer) error {
+		_, err := io.WriteString(w, site.Stylesheet)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, folder := range b.folders {
+		err = sw.writeIndex(folder)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, page := range b.pages[folder.ID] {
+			err = sw.writeNote(folder, page)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = sw.writeTags()
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublishedSite{
+		FolderID:    b.folders[0].ID,
+		Pages:       sw.pages,
+		Attachments: len(sw.attachments),
+	}, nil
+}
+
+func (sw *siteWriter) writeFile(name string, modified time.Time, write func(w io.Writer) error) error {
+	f, err := sw.w.Create(name, modified)
+	if err != nil {
+		return err
+	}
+
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (sw *siteWriter) page(title string, pagePath string, folder store.Folder, inFolder bool) site.Page {
+	// Breadcrumbs lead from the top of the site down to the page's folder,
+	// or its parent for the folder's own index.
+	var chain []store.Folder
+	for id := folder.ID; id != sw.build.folders[0].ID; {
+		i := slices.IndexFunc(sw.build.folders, func(f store.Folder) bool { return f.ID == id })
+		chain = append(chain, sw.build.folders[i])
+		id = *sw.build.folders[i].ParentID
+	}
+	slices.Reverse(chain)
+	if !inFolder && len(chain) > 0 {
+		chain = chain[:len(chain)-1]
+	}
+
+	breadcrumbs := []site.Link{}
+	for _, f := range chain {
+		breadcrumbs = append(breadcrumbs, site.Link{
+			Name: f.Name,
+			URL:  site.Relative(pagePath, sw.build.dirs[f.ID]+"index.html"),
+		})
+	}
+
+	root := site.Root(pagePath)
+	return site.Page{
+		SiteName:   sw.siteName,
+		Title:      title,
+		Stylesheet: root + "style.css",
+		Nav: []site.Link{
+			{Name: sw.siteName, URL: root + "index.html"},
+			{Name: "Tags", URL: root + "tags.html"},
+		},
+		Breadcrumbs: breadcrumbs,
+	}
+}
+
+func (sw *siteWriter) writeIndex(folder store.Folder) error {
+	indexPath := sw.build.dirs[folder.ID] + "index.html"
+
+	title := folder.Name
+	if folder.ID == sw.build.folders[0].ID {
+		title = sw.siteName
+	}
+
+	page := &site.IndexPage{Page: sw.page(title, indexPath, folder, false)}
+	for _, child := range sw.build.folders {
+		if child.ParentID != nil && *child.ParentID == folder.ID {
+			page.Folders = append(page.Folders, site.Link{
+				Name: child.Name,
+				URL:  site.Relative(indexPath, sw.build.dirs[child.ID]+"index.html"),
+			})
+		}
+	}
+	for _, note := range sw.build.pages[folder.ID] {
+		page.Notes = append(page.Notes, site.Link{
+			Name: note.note.Title,
+			URL:  site.Relative(indexPath, note.path),
+		})
+	}
+	slices.SortFunc(page.Folders, compareLinks)
+	slices.SortFunc(page.Notes, compareLinks)
+
+	sw.pages++
+	return sw.writeFile(indexPath, folder.UpdatedAt, func(w io.Writer) error {
+		return site.WriteIndex(w, page)
+	})
+}
+
+func compareLinks(a, b site.Link) int {
+	return cmp.Compare(a.Name, b.Name)
+}
+
+func (sw *siteWriter) writeNote(folder store.Folder, note sitePage) error {
+	service := sw.build.service
+
+	resolved := map[markdown.Link]int64{}
+	for _, outlink := range sw.build.outlinks[note.note.ID] {
+		if outlink.Note != nil {
+			resolved[markdown.Link{Kind: outlink.Kind, Target: outlink.Target}] = outlink.Note.ID
+		}
+	}
+
+	var attachmentErr error
+	body := siteNote(note.note.Note, func(link markdown.Link) (string, bool) {
+		id, ok := resolved[markdown.Link{Kind: link.Kind, Target: link.Target}]
+		if !ok {
+			return "", false
+		}
+		target, ok := sw.build.notePath[id]
+		if !ok {
+			return "", false
+		}
+		return site.Relative(note.path, target), true
+	}, func(attachment_id int64) (string, bool) {
+		name, err := sw.copyAttachment(attachment_id)
+		if err != nil {
+			attachmentErr = err
+			return "", false
+		}
+		if name == "" {
+			return "", false
+		}
+		return site.Relative(note.path, name), true
+	})
+	if attachmentErr != nil {
+		return attachmentErr
+	}
+
+	html, err := service.renderer.Render(body)
+	if err != nil {
+		return err
+	}
+
+	page := &site.NotePage{
+		Page:      sw.page(note.note.Title, note.path, folder, true),
+		UpdatedAt: note.note.UpdatedAt,
+		// The renderer sanitizes its output.
+		Content: template.HTML(html),
+	}
+	for _, tag := range sw.build.tags[note.note.ID] {
+		page.Tags = append(page.Tags, site.Link{
+			Name: tag,
+			URL:  site.Relative(note.path, "tags.html") + "#" + url.PathEscape(tagAnchor(tag)),
+		})
+		sw.tags[tag] = append(sw.tags[tag], site.Link{Name: note.note.Title, URL: site.Relative("tags.html", note.path)})
+	}
+
+	sw.pages++
+	return sw.writeFile(note.path, note.note.UpdatedAt, func(w io.Writer) error {
+		return site.WriteNote(w, page)
+	})
+}
+
+// copyAttachment writes an attachment of one of the site's notes into the
+// site once, returning where it was written or "" if it isn't part of the
+// site.
+func (sw *siteWriter) copyAttachment(attachment_id int64) (string, error) {
+	if name, ok := sw.attachments[attachment_id]; ok {
+		return name, nil
+	}
+
+	service := sw.build.service
+	attachment, err := service.attachmentsStore.GetAttachment(sw.build.user.ID, attachment_id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	if _, ok := sw.build.notePath[attachment.NoteID]; !ok {
+		// Attachments of notes outside the folder stay private.
+		return "", nil
+	}
+
+	name := path.Join("attachments", strconv.FormatInt(attachment.ID, 10), archive.SanitizeName(attachment.Filename))
+
+	content, err := service.blobs.Open(attachment.SHA256)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	err = sw.writeFile(name, attachment.CreatedAt, func(w io.Writer) error {
+		_, err := io.Copy(w, content)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sw.attachments[attachment_id] = name
+	return name, nil
+}
+
+func (sw *siteWriter) writeTags() error {
+	page := &site.TagsPage{Page: sw.page("Tags", "tags.html", sw.build.folders[0], false)}
+
+	for tag, notes := range sw.tags {
+		slices.SortFunc(notes, compareLinks)
+		page.Tags = append(page.Tags, site.Tag{
+			Name:   tag,
+			Anchor: tagAnchor(tag),
+			Notes:  notes,
+		})
+	}
+	slices.SortFunc(page.Tags, func(a, b site.Tag) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return sw.writeFile("tags.html", time.Now(), func(w io.Writer) error {
+		return site.WriteTags(w, page)
+	})
+}
+
+func tagAnchor(tag string) string {
+	return "tag-" + tag
+}
+
+// siteNote rewrites a note's links for the site. Links to notes become links
+// to their pages and links to attachments to their copies, as given by
+// notePage and attachmentFile. Links to anything that isn't published are
+// replaced by their text.
+func siteNote(
+	note string,
+	notePage func(link markdown.Link) (string, bool),
+	attachmentFile func(attachment_id int64) (string, bool),
+) string {
+	return markdown.RewriteRefs(note, func(ref markdown.Ref) (string, bool) {
+		if !ref.Wiki {
+			if attachment_id, ok := markdown.ParseAttachmentURL(ref.Target); ok {
+				file, ok := attachmentFile(attachment_id)
+				if !ok {
+					return ref.Text, true
+				}
+				return markdown.FormatLink(ref.Embed, ref.Text, file), true
+			}
+		}
+
+		link, ok := ref.Link()
+		if !ok {
+			return "", false
+		}
+
+		page, ok := notePage(link)
+		if !ok {
+			return link.Text, true
+		}
+		return markdown.FormatLink(false, link.Text, page), true
+	})
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/markdown"
+	"markdown-notes/internal/render"
+	"markdown-notes/internal/store"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSiteNote(t *testing.T) {
+	pages := map[markdown.Link]string{
+		{Kind: markdown.LinkKindWiki, Target: "Plan"}:         "Projects/Plan.html",
+		{Kind: markdown.LinkKindMarkdown, Target: "../Ideas"}: "Ideas%202.html",
+	}
+	notePage := func(link markdown.Link) (string, bool) {
+		page, ok := pages[markdown.Link{Kind: link.Kind, Target: link.Target}]
+		return page, ok
+	}
+	attachmentFile := func(attachment_id int64) (string, bool) {
+		if attachment_id != 3 {
+			return "", false
+		}
+		return "attachments/3/cat.png", true
+	}
+
+	note := "---\ntags: [x]\n---\n" +
+		"See [[Plan#Goals|the plan]], [[Missing]] and [ideas](<../Ideas.md#top>).\n" +
+		"![cat](/api/attachments/3) ![private](/api/attachments/4) [web](https://example.com)\n" +
+		"`[[Plan]]`\n"
+
+	assert.Equal(t, "---\ntags: [x]\n---\n"+
+		"See [the plan](Projects/Plan.html), Missing and [ideas](Ideas%202.html).\n"+
+		"![cat](attachments/3/cat.png) private [web](https://example.com)\n"+
+		"`[[Plan]]`\n", siteNote(note, notePage, attachmentFile))
+}
+
+func TestPublishFolder(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	folderStore := store.NewPostgresFoldersStore(db)
+	tagsStore := store.NewPostgresTagsStore(db)
+	linksStore := store.NewPostgresNoteLinksStore(db)
+	attachmentsStore := store.NewPostgresAttachmentsStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+
+	blobs, err := blob.NewLocalBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	collector := NewBlobCollector(attachmentsStore, blobs, time.Hour, log.New(io.Discard, "", 0))
+	defer collector.Close()
+	attachmentsService := NewAttachmentsService(notesStore, attachmentsStore, blobs, collector, nil)
+	sitesDir := t.TempDir()
+	publishService := NewPublishService(folderStore, notesStore, tagsStore, linksStore, attachmentsStore, blobs, render.NewRenderer(render.DefaultCacheSize), sitesDir)
+
+	user := &store.User{
+		Username: "Theo",
+		Email:    "drumandbassbob@gmail.com",
+	}
+	user.PasswordHash.Set("Password")
+
+	user2 := &store.User{
+		Username: "Other",
+		Email:    "other@gmail.com",
+	}
+	user2.PasswordHash.Set("Password")
+
+	rootFolderId, err := registerUserService.RegisterUser(user)
+	assert.NoError(t, err)
+	_, err = registerUserService.RegisterUser(user2)
+	assert.NoError(t, err)
+
+	projects, err := folderStore.CreateFolder(user.ID, rootFolderId, "Projects")
+	assert.NoError(t, err)
+	nested, err := folderStore.CreateFolder(user.ID, projects.ID, "Old")
+	assert.NoError(t, err)
+
+	secret, err := notesStore.CreateNote(user.ID, rootFolderId, "Secret", "")
+	assert.NoError(t, err)
+	secretImage, err := attachmentsService.UploadAttachment(user, secret.ID, "secret.png", bytes.NewReader(pngHeader))
+	assert.NoError(t, err)
+
+	plan, err := notesStore.CreateNote(user.ID, projects.ID, "Plan", "")
+	assert.NoError(t, err)
+	image, err := attachmentsService.UploadAttachment(user, plan.ID, "cat.png", bytes.NewReader(pngHeader))
+	assert.NoError(t, err)
+	_, err = notesStore.UpdateNote(user.ID, plan.ID, fmt.Sprintf(
+		"#work See [[Archive]] and [[Secret]]\n\n![cat](%s) ![secret](%s)",
+		markdown.AttachmentURL(image.ID), markdown.AttachmentURL(secretImage.ID),
+	))
+	assert.NoError(t, err)
+	_, err = notesStore.CreateNote(user.ID, nested.ID, "Archive", "#work back to [the plan](/Projects/Plan.md)")
+	assert.NoError(t, err)
+
+	t.Run("zips the site", func(t *testing.T) {
+		build, err := publishService.BuildSite(user, projects.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Projects", build.Name)
+
+		var buf bytes.Buffer
+		err = build.WriteZip(&buf)
+		assert.NoError(t, err)
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+
+		files := map[string]string{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			assert.NoError(t, err)
+			content, err := io.ReadAll(rc)
+			assert.NoError(t, err)
+			rc.Close()
+			files[f.Name] = string(content)
+		}
+
+		attachment := "attachments/" + strconv.FormatInt(image.ID, 10) + "/cat.png"
+		assert.Equal(t, []string{"Old/Archive.html", "Old/index.html", "Plan.html", attachment, "index.html", "style.css", "tags.html"}, sortedKeys(files))
+		assert.Equal(t, string(pngHeader), files[attachment])
+
+		assert.Contains(t, files["Plan.html"], `<a href="Old/Archive.html">Archive</a>`)
+		assert.Contains(t, files["Plan.html"], `<img src="`+attachment+`" alt="cat">`)
+		assert.Contains(t, files["Plan.html"], "and Secret")
+		assert.NotContains(t, files["Plan.html"], "/api/attachments/")
+		assert.Contains(t, files["Plan.html"], `href="tags.html#tag-work"`)
+		assert.Contains(t, files["Old/Archive.html"], `<a href="../Plan.html">the plan</a>`)
+		assert.Contains(t, files["index.html"], `<a href="Old/index.html">Old</a>`)
+		assert.Contains(t, files["tags.html"], `<a href="Old/Archive.html">Archive</a>`)
+	})
+
+	t.Run("publishes into the sites directory", func(t *testing.T) {
+		published, err := publishService.PublishFolder(user, projects.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, projects.ID, published.FolderID)
+		assert.Equal(t, 5, published.Pages)
+		assert.Equal(t, 1, published.Attachments)
+		assert.False(t, published.PublishedAt.IsZero())
+
+		dir := filepath.Join(sitesDir, strconv.FormatInt(projects.ID, 10))
+		_, err = os.Stat(filepath.Join(dir, "Old", "Archive.html"))
+		assert.NoError(t, err)
+
+		// Republishing replaces the old site.
+		_, err = notesStore.CreateNote(user.ID, projects.ID, "Later", "")
+		assert.NoError(t, err)
+		_, err = publishService.PublishFolder(user, projects.ID)
+		assert.NoError(t, err)
+		_, err = os.Stat(filepath.Join(dir, "Later.html"))
+		assert.NoError(t, err)
+
+		entries, err := os.ReadDir(sitesDir)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		err = publishService.UnpublishFolder(user, projects.ID)
+		assert.NoError(t, err)
+		_, err = os.Stat(dir)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		err = publishService.UnpublishFolder(user, projects.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("other users folder", func(t *testing.T) {
+		_, err := publishService.PublishFolder(user2, projects.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("removes the sites of deleted folders", func(t *testing.T) {
+		_, err := publishService.PublishFolder(user, nested.ID)
+		assert.NoError(t, err)
+
+		folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore, publishService)
+		err = folderContentsService.DeleteFolder(user, projects.ID)
+		assert.NoError(t, err)
+
+		entries, err := os.ReadDir(sitesDir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
@@ -6,16 +6,16 @@ import (
 )
 
 type RegisterUserService struct {
-	db          *sql.DB
-	userStore   store.UserStore
-	folderStore store.FoldersStore
+	db              *sql.DB
+	userStore       store.UserStore
+	workspacesStore store.WorkspacesStore
 }
 
-func NewRegisterUserService(db *sql.DB, userStore store.UserStore, folderStore store.FoldersStore) *RegisterUserService {
+func NewRegisterUserService(db *sql.DB, userStore store.UserStore, workspacesStore store.WorkspacesStore) *RegisterUserService {
 	return &RegisterUserService{
-		db:          db,
-		userStore:   userStore,
-		folderStore: folderStore,
+		db:              db,
+		userStore:       userStore,
+		workspacesStore: workspacesStore,
 	}
 }
 
@@ -23,6 +23,8 @@ type RegisterUserServiceI interface {
 	RegisterUser(user *store.User) (int64, error)
 }
 
+// RegisterUser creates the user together with their personal workspace and
+// returns the workspace's root folder.
 func (s *RegisterUserService) RegisterUser(user *store.User) (int64, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -35,7 +37,7 @@ func (s *RegisterUserService) RegisterUser(user *store.User) (int64, error) {
 		return 0, err
 	}
 
-	folder_id, err := s.folderStore.CreateFolderTx(tx, user.ID, nil, "root")
+	workspace, err := s.workspacesStore.CreateWorkspaceTx(tx, user.ID, "Personal", true)
 	if err != nil {
 		return 0, err
 	}
@@ -45,5 +47,5 @@ func (s *RegisterUserService) RegisterUser(user *store.User) (int64, error) {
 		return 0, err
 	}
 
-	return folder_id, err
+	return workspace.RootFolderID, nil
 }
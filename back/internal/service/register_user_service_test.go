@@ -12,7 +12,8 @@ func TestRegisterUser(t *testing.T) {
 	store.TruncateTables(t, db)
 	userStore := store.NewPostgresUserStore(db)
 	folderStore := store.NewPostgresFoldersStore(db)
-	registerUserService := NewRegisterUserService(db, userStore, folderStore)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
 
 	user := &store.User{
 		Username: "Theo",
@@ -0,0 +1,419 @@
+package service
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"html/template"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/markdown"
+	"markdown-notes/internal/render"
+	"markdown-notes/internal/site"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/tokens"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var ErrShareExpiry = errors.New("expires_at must be in the future")
+
+// ShareStylesheet is where site.Stylesheet is served for shared pages. Shared
+// pages live below /s/ and link to each other relatively, so they work
+// wherever the API is mounted: the shared note or folder is at /s/<token>
+// and everything else below it.
+const ShareStylesheet = "style.css"
+
+type ShareService struct {
+	sharesStore      store.SharesStore
+	folderStore      store.FoldersStore
+	notesStore       store.NotesStore
+	tagsStore        store.TagsStore
+	linksStore       store.NoteLinksStore
+	attachmentsStore store.AttachmentsStore
+	blobs            blob.BlobStore
+	renderer         *render.Renderer
+}
+
+func NewShareService(
+	sharesStore store.SharesStore,
+	folderStore store.FoldersStore,
+	notesStore store.NotesStore,
+	tagsStore store.TagsStore,
+	linksStore store.NoteLinksStore,
+	attachmentsStore store.AttachmentsStore,
+	blobs blob.BlobStore,
+	renderer *render.Renderer,
+) *ShareService {
+	return &ShareService{
+		sharesStore:      sharesStore,
+		folderStore:      folderStore,
+		notesStore:       notesStore,
+		tagsStore:        tagsStore,
+		linksStore:       linksStore,
+		attachmentsStore: attachmentsStore,
+		blobs:            blobs,
+		renderer:         renderer,
+	}
+}
+
+type ShareServiceI interface {
+	ShareNote(user *store.User, note_id int64, expires_at *time.Time, password string) (*store.Share, error)
+	ShareFolder(user *store.User, folder_id int64, expires_at *time.Time, password string) (*store.Share, error)
+	GetShares(user *store.User) ([]store.Share, error)
+	RevokeShare(user *store.User, share_id int64) error
+	OpenShare(token string) (*store.Share, error)
+	SharedNotePage(share *store.Share, token string, note_id int64) (*site.NotePage, error)
+	SharedFolderPage(share *store.Share, token string, folder_id int64) (*site.IndexPage, error)
+	OpenSharedAttachment(share *store.Share, attachment_id int64) (*store.Attachment, blob.Blob, error)
+}
+
+// ShareNote creates a link to a note the user owns, expiring at expires_at
+// unless it's nil and protected by password unless it's empty.
+func (s *ShareService) ShareNote(user *store.User, note_id int64, expires_at *time.Time, password string) (*store.Share, error) {
+	role, err := s.notesStore.NoteRole(user.ID, note_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = role.Check(store.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	note, err := s.notesStore.GetNote(user.ID, note_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createShare(&store.Share{UserID: user.ID, NoteID: &note.ID, Name: note.Title}, expires_at, password)
+}
+
+// ShareFolder creates a link to a folder the user owns and everything below
+// it.
+func (s *ShareService) ShareFolder(user *store.User, folder_id int64, expires_at *time.Time, password string) (*store.Share, error) {
+	role, err := s.folderStore.FolderRole(user.ID, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = role.Check(store.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	folder, err := s.folderStore.GetFolder(user.ID, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createShare(&store.Share{UserID: user.ID, FolderID: &folder.ID, Name: folder.Name}, expires_at, password)
+}
+
+func (s *ShareService) createShare(share *store.Share, expires_at *time.Time, password string) (*store.Share, error) {
+	var ttl time.Duration
+	if expires_at != nil {
+		ttl = time.Until(*expires_at)
+		if ttl <= 0 {
+			return nil, ErrShareExpiry
+		}
+	}
+
+	token, err := tokens.GenerateToken(share.UserID, ttl, tokens.ScopeShare)
+	if err != nil {
+		return nil, err
+	}
+	if expires_at != nil {
+		share.ExpiresAt = &token.Expiry
+	}
+
+	if password != "" {
+		err = share.PasswordHash.Set(password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	share, err = s.sharesStore.CreateShare(share, token.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	share.Token = token.Plaintext
+	return share, nil
+}
+
+func (s *ShareService) GetShares(user *store.User) ([]store.Share, error) {
+	return s.sharesStore.GetUserShares(user.ID)
+}
+
+func (s *ShareService) RevokeShare(user *store.User, share_id int64) error {
+	return s.sharesStore.DeleteShare(user.ID, share_id)
+}
+
+// OpenShare returns the share a link points at, or sql.ErrNoRows if it was
+// revoked or has expired. Checking its password is up to the caller.
+func (s *ShareService) OpenShare(token string) (*store.Share, error) {
+	return s.sharesStore.GetShareByToken(token)
+}
+
+// shareScope is what a share lets visitors see.
+type shareScope struct {
+	share   *store.Share
+	token   string
+	folders []store.Folder
+}
+
+func (s *ShareService) scope(share *store.Share, token string) (*shareScope, error) {
+	scope := &shareScope{share: share, token: token}
+	if share.FolderID == nil {
+		return scope, nil
+	}
+
+	folders, err := s.folderStore.GetFolderTree(share.UserID, *share.FolderID)
+	if err != nil {
+		return nil, err
+	}
+	scope.folders = folders
+
+	return scope, nil
+}
+
+func (sc *shareScope) folder(folder_id int64) (store.Folder, bool) {
+	i := slices.IndexFunc(sc.folders, func(f store.Folder) bool { return f.ID == folder_id })
+	if i < 0 {
+		return store.Folder{}, false
+	}
+	return sc.folders[i], true
+}
+
+func (sc *shareScope) hasNote(note_id int64, folder_id int64) bool {
+	if sc.share.NoteID != nil {
+		return *sc.share.NoteID == note_id
+	}
+	_, ok := sc.folder(folder_id)
+	return ok
+}
+
+func (sc *shareScope) notePath(note_id int64) string {
+	if sc.share.NoteID != nil {
+		return sc.token
+	}
+	return sc.token + "/notes/" + strconv.FormatInt(note_id, 10)
+}
+
+func (sc *shareScope) folderPath(folder_id int64) string {
+	if folder_id == *sc.share.FolderID {
+		return sc.token
+	}
+	return sc.token + "/folders/" + strconv.FormatInt(folder_id, 10)
+}
+
+func (sc *shareScope) attachmentPath(attachment_id int64) string {
+	return sc.token + "/attachments/" + strconv.FormatInt(attachment_id, 10)
+}
+
+// page fills in what every shared page has. Breadcrumbs lead from the shared
+// folder down to folder_id.
+func (sc *shareScope) page(title string, pagePath string, folder_id int64) site.Page {
+	page := site.Page{
+		SiteName:   sc.share.Name,
+		Title:      title,
+		Stylesheet: site.Relative(pagePath, ShareStylesheet),
+	}
+	if sc.share.FolderID == nil {
+		return page
+	}
+
+	page.Nav = []site.Link{{Name: sc.share.Name, URL: site.Relative(pagePath, sc.token)}}
+
+	var chain []store.Folder
+	for id := folder_id; id != *sc.share.FolderID; {
+		folder, _ := sc.folder(id)
+		chain = append(chain, folder)
+		id = *folder.ParentID
+	}
+	slices.Reverse(chain)
+
+	page.Breadcrumbs = []site.Link{}
+	for _, folder := range chain {
+		page.Breadcrumbs = append(page.Breadcrumbs, site.Link{
+			Name: folder.Name,
+			URL:  site.Relative(pagePath, sc.folderPath(folder.ID)),
+		})
+	}
+
+	return page
+}
+
+// SharedNotePage renders a note of the share reached through token, note_id
+// 0 meaning the shared note itself.
+func (s *ShareService) SharedNotePage(share *store.Share, token string, note_id int64) (*site.NotePage, error) {
+	if note_id == 0 {
+		if share.NoteID == nil {
+			return nil, sql.ErrNoRows
+		}
+		note_id = *share.NoteID
+	}
+
+	scope, err := s.scope(share, token)
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := s.notesStore.GetNote(share.UserID, note_id)
+	if err != nil {
+		return nil, err
+	}
+	if !scope.hasNote(note.ID, note.FolderID) {
+		return nil, sql.ErrNoRows
+	}
+
+	outlinks, err := s.linksStore.GetOutlinks(share.UserID, note.ID)
+	if err != nil {
+		return nil, err
+	}
+	resolved := map[markdown.Link]*store.LinkedNote{}
+	for _, outlink := range outlinks {
+		if outlink.Note != nil {
+			resolved[markdown.Link{Kind: outlink.Kind, Target: outlink.Target}] = outlink.Note
+		}
+	}
+
+	pagePath := scope.notePath(note.ID)
+
+	var attachmentErr error
+	body := siteNote(note.Note, func(link markdown.Link) (string, bool) {
+		target, ok := resolved[markdown.Link{Kind: link.Kind, Target: link.Target}]
+		if !ok || !scope.hasNote(target.ID, target.FolderID) {
+			return "", false
+		}
+		return site.Relative(pagePath, scope.notePath(target.ID)), true
+	}, func(attachment_id int64) (string, bool) {
+		_, err := s.sharedAttachment(scope, attachment_id)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				attachmentErr = err
+			}
+			return "", false
+		}
+		return site.Relative(pagePath, scope.attachmentPath(attachment_id)), true
+	})
+	if attachmentErr != nil {
+		return nil, attachmentErr
+	}
+
+	html, err := s.renderer.Render(body)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := s.tagsStore.GetNoteTags(share.UserID, note.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &site.NotePage{
+		Page:      scope.page(note.Title, pagePath, note.FolderID),
+		UpdatedAt: note.UpdatedAt,
+		// The renderer sanitizes its output.
+		Content: template.HTML(html),
+	}
+	for _, tag := range tags {
+		page.Tags = append(page.Tags, site.Link{Name: tag})
+	}
+
+	return page, nil
+}
+
+// SharedFolderPage lists a folder of the share reached through token,
+// folder_id 0 meaning the shared folder itself.
+func (s *ShareService) SharedFolderPage(share *store.Share, token string, folder_id int64) (*site.IndexPage, error) {
+	if share.FolderID == nil {
+		return nil, sql.ErrNoRows
+	}
+	if folder_id == 0 {
+		folder_id = *share.FolderID
+	}
+
+	scope, err := s.scope(share, token)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, ok := scope.folder(folder_id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	pagePath := scope.folderPath(folder.ID)
+	// A folder's breadcrumbs end at its parent, the shared folder has none.
+	breadcrumbsTo := folder.ID
+	if folder.ID != *share.FolderID {
+		breadcrumbsTo = *folder.ParentID
+	}
+
+	page := &site.IndexPage{Page: scope.page(folder.Name, pagePath, breadcrumbsTo)}
+	for _, child := range scope.folders {
+		if child.ParentID != nil && *child.ParentID == folder.ID {
+			page.Folders = append(page.Folders, site.Link{
+				Name: child.Name,
+				URL:  site.Relative(pagePath, scope.folderPath(child.ID)),
+			})
+		}
+	}
+
+	notes, err := s.notesStore.GetNotesInFolder(share.UserID, folder.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		page.Notes = append(page.Notes, site.Link{
+			Name: note.Title,
+			URL:  site.Relative(pagePath, scope.notePath(note.ID)),
+		})
+	}
+
+	byName := func(a, b site.Link) int {
+		return cmp.Compare(a.Name, b.Name)
+	}
+	slices.SortFunc(page.Folders, byName)
+	slices.SortFunc(page.Notes, byName)
+
+	return page, nil
+}
+
+// OpenSharedAttachment opens an attachment of a note in the share.
+func (s *ShareService) OpenSharedAttachment(share *store.Share, attachment_id int64) (*store.Attachment, blob.Blob, error) {
+	scope, err := s.scope(share, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attachment, err := s.sharedAttachment(scope, attachment_id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := s.blobs.Open(attachment.SHA256)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return attachment, b, nil
+}
+
+func (s *ShareService) sharedAttachment(scope *shareScope, attachment_id int64) (*store.Attachment, error) {
+	attachment, err := s.attachmentsStore.GetAttachment(scope.share.UserID, attachment_id)
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := s.notesStore.GetNote(scope.share.UserID, attachment.NoteID)
+	if err != nil {
+		return nil, err
+	}
+	if !scope.hasNote(note.ID, note.FolderID) {
+		return nil, sql.ErrNoRows
+	}
+
+	return attachment, nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/markdown"
+	"markdown-notes/internal/render"
+	"markdown-notes/internal/store"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShares(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	folderStore := store.NewPostgresFoldersStore(db)
+	tagsStore := store.NewPostgresTagsStore(db)
+	linksStore := store.NewPostgresNoteLinksStore(db)
+	attachmentsStore := store.NewPostgresAttachmentsStore(db)
+	sharesStore := store.NewPostgresSharesStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+
+	blobs, err := blob.NewLocalBlobStore(t.TempDir())
+	assert.NoError(t, err)
+	collector := NewBlobCollector(attachmentsStore, blobs, time.Hour, log.New(io.Discard, "", 0))
+	defer collector.Close()
+	attachmentsService := NewAttachmentsService(notesStore, attachmentsStore, blobs, collector, nil)
+	shareService := NewShareService(sharesStore, folderStore, notesStore, tagsStore, linksStore, attachmentsStore, blobs, render.NewRenderer(render.DefaultCacheSize))
+
+	user := &store.User{
+		Username: "Theo",
+		Email:    "drumandbassbob@gmail.com",
+	}
+	user.PasswordHash.Set("Password")
+
+	user2 := &store.User{
+		Username: "Other",
+		Email:    "other@gmail.com",
+	}
+	user2.PasswordHash.Set("Password")
+
+	rootFolderId, err := registerUserService.RegisterUser(user)
+	assert.NoError(t, err)
+	_, err = registerUserService.RegisterUser(user2)
+	assert.NoError(t, err)
+
+	projects, err := folderStore.CreateFolder(user.ID, rootFolderId, "Projects")
+	assert.NoError(t, err)
+	nested, err := folderStore.CreateFolder(user.ID, projects.ID, "Old")
+	assert.NoError(t, err)
+
+	secret, err := notesStore.CreateNote(user.ID, rootFolderId, "Secret", "")
+	assert.NoError(t, err)
+	plan, err := notesStore.CreateNote(user.ID, projects.ID, "Plan", "")
+	assert.NoError(t, err)
+	image, err := attachmentsService.UploadAttachment(user, plan.ID, "cat.png", bytes.NewReader(pngHeader))
+	assert.NoError(t, err)
+	_, err = notesStore.UpdateNote(user.ID, plan.ID, fmt.Sprintf("#work See [[Archive]] and [[Secret]]\n\n![cat](%s)", markdown.AttachmentURL(image.ID)))
+	assert.NoError(t, err)
+	archive, err := notesStore.CreateNote(user.ID, nested.ID, "Archive", "back to [the plan](/Projects/Plan.md)")
+	assert.NoError(t, err)
+
+	t.Run("shares a folder", func(t *testing.T) {
+		share, err := shareService.ShareFolder(user, projects.ID, nil, "")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, share.Token)
+		assert.Equal(t, "Projects", share.Name)
+		assert.Nil(t, share.ExpiresAt)
+
+		opened, err := shareService.OpenShare(share.Token)
+		assert.NoError(t, err)
+		assert.False(t, opened.HasPassword)
+
+		index, err := shareService.SharedFolderPage(opened, share.Token, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "Projects", index.Title)
+		assert.Equal(t, "style.css", index.Stylesheet)
+		assert.Equal(t, "Old", index.Folders[0].Name)
+		assert.Equal(t, share.Token+"/folders/"+strconv.FormatInt(nested.ID, 10), index.Folders[0].URL)
+		assert.Equal(t, share.Token+"/notes/"+strconv.FormatInt(plan.ID, 10), index.Notes[0].URL)
+
+		page, err := shareService.SharedNotePage(opened, share.Token, plan.ID)
+		assert.NoError(t, err)
+		content := string(page.Content)
+		assert.Contains(t, content, `<a href="`+strconv.FormatInt(archive.ID, 10)+`">Archive</a>`)
+		assert.Contains(t, content, "and Secret")
+		assert.Contains(t, content, `<img src="../attachments/`+strconv.FormatInt(image.ID, 10)+`" alt="cat">`)
+		assert.Equal(t, "../../style.css", page.Stylesheet)
+		assert.Equal(t, "work", page.Tags[0].Name)
+
+		page, err = shareService.SharedNotePage(opened, share.Token, archive.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Old", page.Breadcrumbs[0].Name)
+		assert.Equal(t, "../folders/"+strconv.FormatInt(nested.ID, 10), page.Breadcrumbs[0].URL)
+
+		_, err = shareService.SharedNotePage(opened, share.Token, secret.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, err = shareService.SharedFolderPage(opened, share.Token, rootFolderId)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, content2, err := shareService.OpenSharedAttachment(opened, image.ID)
+		assert.NoError(t, err)
+		data, err := io.ReadAll(content2)
+		assert.NoError(t, err)
+		content2.Close()
+		assert.Equal(t, pngHeader, data)
+	})
+
+	t.Run("shares a note with a password and expiry", func(t *testing.T) {
+		expires := time.Now().Add(time.Hour)
+		share, err := shareService.ShareNote(user, plan.ID, &expires, "hunter2")
+		assert.NoError(t, err)
+		assert.True(t, share.HasPassword)
+		assert.NotNil(t, share.ExpiresAt)
+
+		opened, err := shareService.OpenShare(share.Token)
+		assert.NoError(t, err)
+		matches, err := opened.PasswordHash.Matches("hunter2")
+		assert.NoError(t, err)
+		assert.True(t, matches)
+
+		page, err := shareService.SharedNotePage(opened, share.Token, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "Plan", page.Title)
+		assert.Contains(t, string(page.Content), "See Archive and Secret")
+
+		_, err = shareService.SharedNotePage(opened, share.Token, archive.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = shareService.SharedFolderPage(opened, share.Token, 0)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("rejects past expiry", func(t *testing.T) {
+		expires := time.Now().Add(-time.Minute)
+		_, err := shareService.ShareNote(user, plan.ID, &expires, "")
+		assert.ErrorIs(t, err, ErrShareExpiry)
+	})
+
+	t.Run("other users note", func(t *testing.T) {
+		_, err := shareService.ShareNote(user2, plan.ID, nil, "")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = shareService.ShareFolder(user2, projects.ID, nil, "")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("lists and revokes shares", func(t *testing.T) {
+		shares, err := shareService.GetShares(user)
+		assert.NoError(t, err)
+		assert.Len(t, shares, 2)
+
+		err = shareService.RevokeShare(user2, shares[0].ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		for _, share := range shares {
+			err = shareService.RevokeShare(user, share.ID)
+			assert.NoError(t, err)
+		}
+
+		shares, err = shareService.GetShares(user)
+		assert.NoError(t, err)
+		assert.Empty(t, shares)
+	})
+}
@@ -0,0 +1,513 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"markdown-notes/internal/store"
+)
+
+var ErrSyncChange = errors.New("invalid change")
+
+// Statuses of a change sent to ApplyChanges.
+const (
+	SyncAccepted = "accepted"
+	SyncConflict = "conflict"
+	SyncError    = "error"
+)
+
+// Kinds of conflicts, see ApplyChanges.
+const (
+	ConflictStale     = "stale"
+	ConflictDeleted   = "deleted"
+	ConflictDuplicate = "duplicate"
+)
+
+// maxConflictedCopies is how many "(conflicted copy N)" names are tried
+// before giving up on finding a free one.
+const maxConflictedCopies = 10
+
+// SyncChange is a change a client made while offline. Op is "create",
+// "update" or "delete" and Type "note" or "folder". Nil fields are left as
+// they are.
+//
+// BaseVersion is what the client's change was made against: the note's
+// version for notes, and for folders the change number the client had
+// synced up to. Creates have no base and carry a ClientID instead, which the
+// result echoes back and which later changes in the same batch can put notes
+// and folders into with FolderClientID and ParentClientID.
+type SyncChange struct {
+	Op             string  `json:"op"`
+	Type           string  `json:"type"`
+	ClientID       string  `json:"client_id"`
+	ID             int64   `json:"id"`
+	BaseVersion    int64   `json:"base_version"`
+	Title          *string `json:"title"`
+	Note           *string `json:"note"`
+	FolderID       *int64  `json:"folder_id"`
+	FolderClientID string  `json:"folder_client_id"`
+	Name           *string `json:"name"`
+	ParentID       *int64  `json:"parent_id"`
+	ParentClientID string  `json:"parent_client_id"`
+}
+
+// SyncResult is what became of a change. Note and Folder are as they are on
+// the server afterwards, Copy is the note a conflicting edit was saved as.
+type SyncResult struct {
+	ClientID string        `json:"client_id,omitempty"`
+	Status   string        `json:"status"`
+	Conflict string        `json:"conflict,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Note     *store.Note   `json:"note,omitempty"`
+	Folder   *store.Folder `json:"folder,omitempty"`
+	Copy     *store.Note   `json:"copy,omitempty"`
+}
+
+type SyncService struct {
+	syncStore             store.SyncStore
+	notesStore            store.NotesStore
+	folderStore           store.FoldersStore
+	workspacesStore       store.WorkspacesStore
+	folderContentsService FolderContentsServiceI
+	logger                *log.Logger
+}
+
+func NewSyncService(
+	syncStore store.SyncStore,
+	notesStore store.NotesStore,
+	folderStore store.FoldersStore,
+	workspacesStore store.WorkspacesStore,
+	folderContentsService FolderContentsServiceI,
+	logger *log.Logger,
+) *SyncService {
+	return &SyncService{
+		syncStore:             syncStore,
+		notesStore:            notesStore,
+		folderStore:           folderStore,
+		workspacesStore:       workspacesStore,
+		folderContentsService: folderContentsService,
+		logger:                logger,
+	}
+}
+
+type SyncServiceI interface {
+	GetChanges(user *store.User, workspace_id int64, since int64, limit int) (*store.SyncChanges, error)
+	ApplyChanges(user *store.User, workspace_id int64, changes []SyncChange) ([]SyncResult, error)
+}
+
+// workspace returns the workspace to sync, the user's personal one for 0.
+func (s *SyncService) workspace(user *store.User, workspace_id int64) (*store.Workspace, error) {
+	if workspace_id == 0 {
+		return s.workspacesStore.GetPersonalWorkspace(user.ID)
+	}
+
+	return s.workspacesStore.GetWorkspace(user.ID, workspace_id)
+}
+
+// GetChanges returns the changes in the workspace after the change number
+// since, everything for 0. Clients apply them in order and ask again from
+// the returned Seq, right away while there are More.
+func (s *SyncService) GetChanges(user *store.User, workspace_id int64, since int64, limit int) (*store.SyncChanges, error) {
+	workspace, err := s.workspace(user, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.syncStore.GetChanges(user.ID, workspace.ID, since, limit)
+}
+
+// ApplyChanges applies a client's changes to the workspace in order and
+// returns what became of each. Conflicts are resolved without losing what
+// anyone wrote:
+//
+//   - A note edited on the server since its base version keeps the server's
+//     text, and the client's text is saved as a new note named
+//     "<title> (conflicted copy)" next to it. Renames and moves carry no text
+//     and are applied on top of the newer version instead.
+//   - A note deleted on the server, trashed included, keeps the client's
+//     text the same way, as a copy in the root folder of the workspace.
+//   - A note or folder is only deleted if it, or anything in a folder, wasn't
+//     changed on the server after the base version. Deleting something
+//     already gone is accepted.
+//   - A note or folder whose name clashes with another in the same folder
+//     gets "(conflicted copy)" added to it, except that creating a folder
+//     that already exists returns the existing one for the client to merge
+//     into.
+//
+// Changes resolved like this have the status "conflict" with the kind of
+// conflict, the others "accepted" or, when they can't be applied at all,
+// "error".
+func (s *SyncService) ApplyChanges(user *store.User, workspace_id int64, changes []SyncChange) ([]SyncResult, error) {
+	workspace, err := s.workspace(user, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+
+	created := map[string]int64{}
+	results := make([]SyncResult, 0, len(changes))
+	for _, change := range changes {
+		result, err := s.apply(user, workspace.RootFolderID, change, created)
+		if err != nil {
+			result = SyncResult{Status: SyncError, Error: syncErrorMessage(err)}
+			if result.Error == "" {
+				s.logger.Printf("ERROR: applying sync change %v", err)
+				result.Error = "internal server error"
+			}
+		}
+		result.ClientID = change.ClientID
+
+		if change.Op == "create" && change.Type == "folder" && result.Folder != nil && change.ClientID != "" {
+			created[change.ClientID] = result.Folder.ID
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// syncErrorMessage is the error to tell the client about, empty for errors
+// they can't do anything about.
+func syncErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "not found"
+	case errors.Is(err, store.ErrForbidden),
+		errors.Is(err, ErrSyncChange),
+		errors.Is(err, ErrRootFolder),
+		errors.Is(err, ErrFolderCycle),
+		errors.Is(err, ErrOtherWorkspace),
+		errors.Is(err, store.ErrDuplicateNote),
+		errors.Is(err, store.ErrDuplicateFolder):
+		return err.Error()
+	default:
+		return ""
+	}
+}
+
+func (s *SyncService) apply(user *store.User, root_id int64, change SyncChange, created map[string]int64) (SyncResult, error) {
+	if change.Op != "create" && change.ID == 0 {
+		return SyncResult{}, fmt.Errorf("%w: id is required", ErrSyncChange)
+	}
+
+	switch change.Type + "." + change.Op {
+	case "note.create":
+		folder_id, err := clientFolder(change.FolderID, change.FolderClientID, created)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		if folder_id == nil {
+			folder_id = &root_id
+		}
+		return s.createNote(user, *folder_id, change)
+	case "note.update":
+		folder_id, err := clientFolder(change.FolderID, change.FolderClientID, created)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		return s.updateNote(user, root_id, folder_id, change)
+	case "note.delete":
+		return s.deleteNote(user, change)
+	case "folder.create":
+		parent_id, err := clientFolder(change.ParentID, change.ParentClientID, created)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		if parent_id == nil {
+			parent_id = &root_id
+		}
+		return s.createFolder(user, *parent_id, change)
+	case "folder.update":
+		parent_id, err := clientFolder(change.ParentID, change.ParentClientID, created)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		return s.updateFolder(user, parent_id, change)
+	case "folder.delete":
+		return s.deleteFolder(user, change)
+	default:
+		return SyncResult{}, fmt.Errorf("%w: unknown %q %q", ErrSyncChange, change.Op, change.Type)
+	}
+}
+
+// clientFolder picks the folder a change refers to, by id or by the client id
+// of a folder created earlier in the batch. It is nil when there is neither.
+func clientFolder(folder_id *int64, client_id string, created map[string]int64) (*int64, error) {
+	if client_id != "" {
+		id, ok := created[client_id]
+		if !ok {
+			return nil, fmt.Errorf("%w: no folder was created as %q", ErrSyncChange, client_id)
+		}
+		return &id, nil
+	}
+
+	return folder_id, nil
+}
+
+func (s *SyncService) createNote(user *store.User, folder_id int64, change SyncChange) (SyncResult, error) {
+	if change.Title == nil || *change.Title == "" {
+		return SyncResult{}, fmt.Errorf("%w: title is required", ErrSyncChange)
+	}
+
+	var text string
+	if change.Note != nil {
+		text = *change.Note
+	}
+
+	note, renamed, err := withFreeName(*change.Title, false, func(title string) (*store.Note, error) {
+		return s.folderContentsService.CreateNote(user, folder_id, title, text)
+	})
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	if renamed {
+		return SyncResult{Status: SyncConflict, Conflict: ConflictDuplicate, Note: note}, nil
+	}
+	return SyncResult{Status: SyncAccepted, Note: note}, nil
+}
+
+func (s *SyncService) updateNote(user *store.User, root_id int64, folder_id *int64, change SyncChange) (SyncResult, error) {
+	if change.BaseVersion == 0 {
+		return SyncResult{}, fmt.Errorf("%w: base_version is required", ErrSyncChange)
+	}
+
+	update := store.NoteUpdate{
+		Title:     change.Title,
+		Note:      change.Note,
+		FolderID:  folder_id,
+		IfVersion: &change.BaseVersion,
+	}
+
+	note, err := s.folderContentsService.UpdateNote(user, change.ID, update)
+	if errors.Is(err, store.ErrStaleNote) && change.Note == nil {
+		update.IfVersion = nil
+		note, err = s.folderContentsService.UpdateNote(user, change.ID, update)
+	}
+
+	switch {
+	case err == nil:
+		return SyncResult{Status: SyncAccepted, Note: note}, nil
+
+	case errors.Is(err, store.ErrDuplicateNote):
+		current, err := s.notesStore.GetNote(user.ID, change.ID)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		title := current.Title
+		if change.Title != nil {
+			title = *change.Title
+		}
+
+		note, _, err = withFreeName(title, true, func(title string) (*store.Note, error) {
+			update.Title = &title
+			return s.folderContentsService.UpdateNote(user, change.ID, update)
+		})
+		if err != nil {
+			return SyncResult{}, err
+		}
+		return SyncResult{Status: SyncConflict, Conflict: ConflictDuplicate, Note: note}, nil
+
+	case errors.Is(err, store.ErrStaleNote):
+		current, err := s.notesStore.GetNote(user.ID, change.ID)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		title := current.Title
+		if change.Title != nil {
+			title = *change.Title
+		}
+
+		noteCopy, err := s.saveCopy(user, current.FolderID, title, *change.Note)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		return SyncResult{Status: SyncConflict, Conflict: ConflictStale, Note: current, Copy: noteCopy}, nil
+
+	case errors.Is(err, sql.ErrNoRows):
+		if change.Note == nil {
+			return SyncResult{Status: SyncConflict, Conflict: ConflictDeleted}, nil
+		}
+		title := "Untitled"
+		if change.Title != nil && *change.Title != "" {
+			title = *change.Title
+		}
+
+		noteCopy, err := s.saveCopy(user, root_id, title, *change.Note)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		return SyncResult{Status: SyncConflict, Conflict: ConflictDeleted, Copy: noteCopy}, nil
+
+	default:
+		return SyncResult{}, err
+	}
+}
+
+// saveCopy saves text that conflicted with the server as a new note.
+func (s *SyncService) saveCopy(user *store.User, folder_id int64, title string, text string) (*store.Note, error) {
+	note, _, err := withFreeName(title, true, func(title string) (*store.Note, error) {
+		return s.folderContentsService.CreateNote(user, folder_id, title, text)
+	})
+
+	return note, err
+}
+
+func (s *SyncService) deleteNote(user *store.User, change SyncChange) (SyncResult, error) {
+	if change.BaseVersion == 0 {
+		return SyncResult{}, fmt.Errorf("%w: base_version is required", ErrSyncChange)
+	}
+
+	role, err := s.notesStore.NoteRole(user.ID, change.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SyncResult{Status: SyncAccepted}, nil
+	}
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	if err = role.Check(store.RoleEditor); err != nil {
+		return SyncResult{}, err
+	}
+
+	// trashed only at the base version, so an edit made in the meantime
+	// isn't thrown away with it
+	note, err := s.notesStore.TrashNoteIfVersion(user.ID, change.ID, change.BaseVersion)
+	if errors.Is(err, store.ErrStaleNote) {
+		current, err := s.notesStore.GetNote(user.ID, change.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return SyncResult{Status: SyncAccepted}, nil
+		}
+		if err != nil {
+			return SyncResult{}, err
+		}
+		return SyncResult{Status: SyncConflict, Conflict: ConflictStale, Note: current}, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return SyncResult{Status: SyncAccepted}, nil
+	}
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	return SyncResult{Status: SyncAccepted, Note: note}, nil
+}
+
+func (s *SyncService) createFolder(user *store.User, parent_id int64, change SyncChange) (SyncResult, error) {
+	if change.Name == nil || *change.Name == "" {
+		return SyncResult{}, fmt.Errorf("%w: name is required", ErrSyncChange)
+	}
+
+	folder, err := s.folderContentsService.CreateSubFolder(user, parent_id, *change.Name)
+	if errors.Is(err, store.ErrDuplicateFolder) {
+		siblings, err := s.folderStore.GetSubFolders(user.ID, parent_id)
+		if err != nil {
+			return SyncResult{}, err
+		}
+
+		for _, sibling := range siblings {
+			if sibling.Name == *change.Name {
+				return SyncResult{Status: SyncConflict, Conflict: ConflictDuplicate, Folder: &sibling}, nil
+			}
+		}
+		return SyncResult{}, store.ErrDuplicateFolder
+	}
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	return SyncResult{Status: SyncAccepted, Folder: folder}, nil
+}
+
+// updateFolder renames and moves folders whatever changed since, the last
+// change wins.
+func (s *SyncService) updateFolder(user *store.User, parent_id *int64, change SyncChange) (SyncResult, error) {
+	folder, err := s.folderContentsService.UpdateFolder(user, change.ID, change.Name, parent_id)
+	if errors.Is(err, store.ErrDuplicateFolder) {
+		current, err := s.folderStore.GetFolder(user.ID, change.ID)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		name := current.Name
+		if change.Name != nil {
+			name = *change.Name
+		}
+
+		folder, _, err = withFreeName(name, true, func(name string) (*store.Folder, error) {
+			return s.folderContentsService.UpdateFolder(user, change.ID, &name, parent_id)
+		})
+		if err != nil {
+			return SyncResult{}, err
+		}
+		return SyncResult{Status: SyncConflict, Conflict: ConflictDuplicate, Folder: folder}, nil
+	}
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	return SyncResult{Status: SyncAccepted, Folder: folder}, nil
+}
+
+func (s *SyncService) deleteFolder(user *store.User, change SyncChange) (SyncResult, error) {
+	if change.BaseVersion == 0 {
+		return SyncResult{}, fmt.Errorf("%w: base_version is required", ErrSyncChange)
+	}
+
+	changed, err := s.syncStore.FolderChangedSince(user.ID, change.ID, change.BaseVersion)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SyncResult{Status: SyncAccepted}, nil
+	}
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	if changed {
+		folder, err := s.folderStore.GetFolder(user.ID, change.ID)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		return SyncResult{Status: SyncConflict, Conflict: ConflictStale, Folder: folder}, nil
+	}
+
+	err = s.folderContentsService.DeleteFolder(user, change.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return SyncResult{}, err
+	}
+
+	return SyncResult{Status: SyncAccepted}, nil
+}
+
+// withFreeName calls save with name and, for as long as that clashes with a
+// note or folder next to it, with "(conflicted copy N)" names. With asCopy set
+// it starts at the first conflicted copy name. It reports whether the name
+// had to change.
+func withFreeName[T any](name string, asCopy bool, save func(name string) (T, error)) (T, bool, error) {
+	start := 0
+	if asCopy {
+		start = 1
+	}
+
+	var (
+		saved T
+		err   error
+	)
+	for n := start; n <= maxConflictedCopies; n++ {
+		saved, err = save(conflictedName(name, n))
+		if !errors.Is(err, store.ErrDuplicateNote) && !errors.Is(err, store.ErrDuplicateFolder) {
+			return saved, n > 0, err
+		}
+	}
+
+	return saved, false, err
+}
+
+func conflictedName(name string, n int) string {
+	switch n {
+	case 0:
+		return name
+	case 1:
+		return name + " (conflicted copy)"
+	default:
+		return fmt.Sprintf("%s (conflicted copy %d)", name, n)
+	}
+}
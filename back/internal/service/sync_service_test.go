@@ -0,0 +1,164 @@
+package service
+
+import (
+	"io"
+	"log"
+	"markdown-notes/internal/store"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSync(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	folderStore := store.NewPostgresFoldersStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	syncStore := store.NewPostgresSyncStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore, nil)
+	syncService := NewSyncService(syncStore, notesStore, folderStore, workspacesStore, folderContentsService, log.New(io.Discard, "", 0))
+
+	user := &store.User{Username: "Theo", Email: "drumandbassbob@gmail.com"}
+	user.PasswordHash.Set("Password")
+	_, err := registerUserService.RegisterUser(user)
+	assert.NoError(t, err)
+
+	initial, err := syncService.GetChanges(user, 0, 0, 100)
+	assert.NoError(t, err)
+	root := initial.Folders[0].ID
+
+	t.Run("creates notes in folders created in the same batch", func(t *testing.T) {
+		results, err := syncService.ApplyChanges(user, 0, []SyncChange{
+			{Op: "create", Type: "folder", ClientID: "f1", Name: ptr("Offline")},
+			{Op: "create", Type: "note", ClientID: "n1", FolderClientID: "f1", Title: ptr("Draft"), Note: ptr("text")},
+			{Op: "create", Type: "note", ClientID: "n2", FolderClientID: "nope", Title: ptr("Lost")},
+			{Op: "delete", Type: "note"},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, results, 4)
+
+		assert.Equal(t, SyncAccepted, results[0].Status)
+		assert.Equal(t, "f1", results[0].ClientID)
+		assert.Equal(t, SyncAccepted, results[1].Status)
+		assert.Equal(t, results[0].Folder.ID, results[1].Note.FolderID)
+		assert.Equal(t, SyncError, results[2].Status)
+		assert.Equal(t, SyncError, results[3].Status)
+
+		changes, err := syncService.GetChanges(user, 0, initial.Seq, 100)
+		assert.NoError(t, err)
+		assert.Len(t, changes.Folders, 1)
+		assert.Len(t, changes.Notes, 1)
+	})
+
+	note, err := notesStore.CreateNote(user.ID, root, "Plan", "v1")
+	assert.NoError(t, err)
+	_, err = notesStore.UpdateNote(user.ID, note.ID, "v2 from the server")
+	assert.NoError(t, err)
+
+	t.Run("stale edits are saved as a conflicted copy", func(t *testing.T) {
+		results, err := syncService.ApplyChanges(user, 0, []SyncChange{
+			{Op: "update", Type: "note", ID: note.ID, BaseVersion: note.Version, Note: ptr("v2 from the client")},
+		})
+		assert.NoError(t, err)
+
+		result := results[0]
+		assert.Equal(t, SyncConflict, result.Status)
+		assert.Equal(t, ConflictStale, result.Conflict)
+		assert.Equal(t, "v2 from the server", result.Note.Note)
+		assert.Equal(t, "Plan (conflicted copy)", result.Copy.Title)
+		assert.Equal(t, "v2 from the client", result.Copy.Note)
+		assert.Equal(t, root, result.Copy.FolderID)
+	})
+
+	t.Run("stale renames are applied", func(t *testing.T) {
+		results, err := syncService.ApplyChanges(user, 0, []SyncChange{
+			{Op: "update", Type: "note", ID: note.ID, BaseVersion: note.Version, Title: ptr("Plan (conflicted copy)")},
+		})
+		assert.NoError(t, err)
+
+		result := results[0]
+		assert.Equal(t, SyncConflict, result.Status)
+		assert.Equal(t, ConflictDuplicate, result.Conflict)
+		assert.Equal(t, "Plan (conflicted copy) (conflicted copy)", result.Note.Title)
+		assert.Equal(t, "v2 from the server", result.Note.Note)
+	})
+
+	t.Run("edits win over deletes", func(t *testing.T) {
+		current, err := notesStore.GetNote(user.ID, note.ID)
+		assert.NoError(t, err)
+
+		results, err := syncService.ApplyChanges(user, 0, []SyncChange{
+			{Op: "delete", Type: "note", ID: note.ID, BaseVersion: note.Version},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, SyncConflict, results[0].Status)
+		assert.Equal(t, ConflictStale, results[0].Conflict)
+
+		results, err = syncService.ApplyChanges(user, 0, []SyncChange{
+			{Op: "delete", Type: "note", ID: note.ID, BaseVersion: current.Version},
+			{Op: "update", Type: "note", ID: note.ID, BaseVersion: current.Version, Title: ptr("Gone"), Note: ptr("late edit")},
+			{Op: "delete", Type: "note", ID: note.ID, BaseVersion: current.Version},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, SyncAccepted, results[0].Status)
+		assert.NotNil(t, results[0].Note.DeletedAt)
+
+		assert.Equal(t, SyncConflict, results[1].Status)
+		assert.Equal(t, ConflictDeleted, results[1].Conflict)
+		assert.Equal(t, "Gone (conflicted copy)", results[1].Copy.Title)
+		assert.Equal(t, root, results[1].Copy.FolderID)
+
+		assert.Equal(t, SyncAccepted, results[2].Status)
+	})
+
+	t.Run("creating a folder that exists merges into it", func(t *testing.T) {
+		results, err := syncService.ApplyChanges(user, 0, []SyncChange{
+			{Op: "create", Type: "folder", ClientID: "f2", Name: ptr("Offline")},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, SyncConflict, results[0].Status)
+		assert.Equal(t, ConflictDuplicate, results[0].Conflict)
+		assert.Equal(t, "Offline", results[0].Folder.Name)
+	})
+
+	t.Run("folders that changed since aren't deleted", func(t *testing.T) {
+		folder, err := folderStore.CreateFolder(user.ID, root, "Archive")
+		assert.NoError(t, err)
+		synced, err := syncService.GetChanges(user, 0, 0, 1000)
+		assert.NoError(t, err)
+		_, err = notesStore.CreateNote(user.ID, folder.ID, "New", "")
+		assert.NoError(t, err)
+
+		results, err := syncService.ApplyChanges(user, 0, []SyncChange{
+			{Op: "delete", Type: "folder", ID: folder.ID, BaseVersion: synced.Seq},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, SyncConflict, results[0].Status)
+		assert.Equal(t, ConflictStale, results[0].Conflict)
+
+		synced, err = syncService.GetChanges(user, 0, synced.Seq, 1000)
+		assert.NoError(t, err)
+		results, err = syncService.ApplyChanges(user, 0, []SyncChange{
+			{Op: "delete", Type: "folder", ID: folder.ID, BaseVersion: synced.Seq},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, SyncAccepted, results[0].Status)
+
+		changes, err := syncService.GetChanges(user, 0, synced.Seq, 1000)
+		assert.NoError(t, err)
+		assert.Equal(t, []store.Tombstone{{
+			Type:      "folder",
+			ID:        folder.ID,
+			FolderID:  root,
+			ChangeSeq: changes.Seq,
+			DeletedAt: changes.Tombstones[0].DeletedAt,
+		}}, changes.Tombstones)
+	})
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"markdown-notes/internal/blob"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/thumbnail"
+	"slices"
+	"sync"
+)
+
+var ErrThumbnailSize = errors.New("size must be small or medium")
+
+// thumbnailQueueSize bounds how many uploads can wait for thumbnails, past
+// that they are made the first time they are requested instead.
+const thumbnailQueueSize = 256
+
+// ThumbnailService makes thumbnails of image attachments on a pool of
+// background workers.
+type ThumbnailService struct {
+	attachmentsStore store.AttachmentsStore
+	blobs            blob.BlobStore
+	collector        *BlobCollector
+	logger           *log.Logger
+	jobs             chan store.Attachment
+	wg               sync.WaitGroup
+}
+
+func NewThumbnailService(
+	attachmentsStore store.AttachmentsStore,
+	blobs blob.BlobStore,
+	collector *BlobCollector,
+	workers int,
+	logger *log.Logger,
+) *ThumbnailService {
+	s := &ThumbnailService{
+		attachmentsStore: attachmentsStore,
+		blobs:            blobs,
+		collector:        collector,
+		logger:           logger,
+		jobs:             make(chan store.Attachment, thumbnailQueueSize),
+	}
+
+	for range max(workers, 1) {
+		s.wg.Add(1)
+		go s.work()
+	}
+
+	return s
+}
+
+type ThumbnailServiceI interface {
+	Enqueue(attachment *store.Attachment)
+	OpenThumbnail(user *store.User, attachment_id int64, size string) (*store.Thumbnail, blob.Blob, error)
+}
+
+func (s *ThumbnailService) work() {
+	defer s.wg.Done()
+
+	for attachment := range s.jobs {
+		sizes := make([]string, 0, len(thumbnail.Sizes))
+		for size := range thumbnail.Sizes {
+			sizes = append(sizes, size)
+		}
+		slices.Sort(sizes)
+
+		for _, size := range sizes {
+			_, err := s.generate(&attachment, size)
+			if err != nil {
+				s.logger.Printf("ERROR: making %s thumbnail of attachment %d %v", size, attachment.ID, err)
+				break
+			}
+		}
+	}
+}
+
+// Enqueue schedules thumbnails for an attachment if it is an image. It never
+// blocks, when the queue is full the thumbnails are made on first request.
+func (s *ThumbnailService) Enqueue(attachment *store.Attachment) {
+	if !thumbnail.Supported(attachment.ContentType) {
+		return
+	}
+
+	select {
+	case s.jobs <- *attachment:
+	default:
+		s.logger.Printf("WARNING: thumbnail queue full, skipping attachment %d", attachment.ID)
+	}
+}
+
+// Close stops accepting work and waits for queued thumbnails to be made.
+func (s *ThumbnailService) Close() {
+	close(s.jobs)
+	s.wg.Wait()
+}
+
+func (s *ThumbnailService) generate(attachment *store.Attachment, size string) (*store.Thumbnail, error) {
+	original, err := s.blobs.Open(attachment.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	defer original.Close()
+
+	data, err := io.ReadAll(original)
+	if err != nil {
+		return nil, err
+	}
+
+	thumb, err := thumbnail.Generate(data, thumbnail.Sizes[size])
+	if err != nil {
+		return nil, err
+	}
+
+	release := s.collector.Hold()
+	defer release()
+
+	key, byteSize, err := s.blobs.Put(bytes.NewReader(thumb.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	saved := &store.Thumbnail{
+		AttachmentID: attachment.ID,
+		Size:         size,
+		ContentType:  thumb.ContentType,
+		Width:        thumb.Width,
+		Height:       thumb.Height,
+		ByteSize:     byteSize,
+		SHA256:       key,
+	}
+
+	err = s.attachmentsStore.SaveThumbnail(saved)
+	if err != nil {
+		s.collector.Discard([]string{key})
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// OpenThumbnail returns a thumbnail of an image attachment the user can see,
+// making it first if the workers haven't got to it yet.
+func (s *ThumbnailService) OpenThumbnail(user *store.User, attachment_id int64, size string) (*store.Thumbnail, blob.Blob, error) {
+	if _, ok := thumbnail.Sizes[size]; !ok {
+		return nil, nil, ErrThumbnailSize
+	}
+
+	role, err := s.attachmentsStore.AttachmentRole(user.ID, attachment_id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = role.Check(store.RoleViewer); err != nil {
+		return nil, nil, err
+	}
+
+	thumb, err := s.attachmentsStore.GetThumbnail(user.ID, attachment_id, size)
+	if errors.Is(err, sql.ErrNoRows) {
+		attachment, err := s.attachmentsStore.GetAttachment(user.ID, attachment_id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !thumbnail.Supported(attachment.ContentType) {
+			return nil, nil, thumbnail.ErrUnsupported
+		}
+
+		thumb, err = s.generate(attachment, size)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := s.blobs.Open(thumb.SHA256)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return thumb, b, nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"markdown-notes/internal/store"
+	"markdown-notes/internal/tokens"
+	"time"
+)
+
+var (
+	ErrWorkspaceRole     = errors.New("role must be guest, member or admin")
+	ErrPersonalWorkspace = errors.New("nobody else can join a personal workspace")
+)
+
+// InvitationTTL is how long an invitation to a workspace can be accepted for.
+const InvitationTTL = 7 * 24 * time.Hour
+
+type WorkspacesService struct {
+	workspacesStore store.WorkspacesStore
+}
+
+func NewWorkspacesService(workspacesStore store.WorkspacesStore) *WorkspacesService {
+	return &WorkspacesService{
+		workspacesStore: workspacesStore,
+	}
+}
+
+type WorkspacesServiceI interface {
+	GetWorkspaces(user *store.User) ([]store.Workspace, error)
+	GetWorkspace(user *store.User, workspace_id int64) (*store.Workspace, error)
+	CreateWorkspace(user *store.User, name string) (*store.Workspace, error)
+	GetMembers(user *store.User, workspace_id int64) ([]store.WorkspaceMember, error)
+	UpdateMember(user *store.User, workspace_id int64, member_id int64, role store.WorkspaceRole) (*store.WorkspaceMember, error)
+	RemoveMember(user *store.User, workspace_id int64, member_id int64) error
+	Invite(user *store.User, workspace_id int64, role store.WorkspaceRole) (*tokens.Token, error)
+	AcceptInvitation(user *store.User, token string) (*store.Workspace, error)
+}
+
+// checkAdmin returns the workspace if the user is one of its admins,
+// sql.ErrNoRows if they don't belong to it and store.ErrForbidden otherwise.
+func (s *WorkspacesService) checkAdmin(user *store.User, workspace_id int64) (*store.Workspace, error) {
+	workspace, err := s.workspacesStore.GetWorkspace(user.ID, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if workspace.Role != store.WorkspaceRoleAdmin {
+		return nil, store.ErrForbidden
+	}
+
+	return workspace, nil
+}
+
+func (s *WorkspacesService) GetWorkspaces(user *store.User) ([]store.Workspace, error) {
+	return s.workspacesStore.GetUserWorkspaces(user.ID)
+}
+
+func (s *WorkspacesService) GetWorkspace(user *store.User, workspace_id int64) (*store.Workspace, error) {
+	return s.workspacesStore.GetWorkspace(user.ID, workspace_id)
+}
+
+// CreateWorkspace makes a new team workspace with the user as its admin.
+func (s *WorkspacesService) CreateWorkspace(user *store.User, name string) (*store.Workspace, error) {
+	return s.workspacesStore.CreateWorkspace(user.ID, name)
+}
+
+// GetMembers lists who belongs to a workspace, which anyone in it may see.
+func (s *WorkspacesService) GetMembers(user *store.User, workspace_id int64) ([]store.WorkspaceMember, error) {
+	_, err := s.workspacesStore.GetWorkspace(user.ID, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.workspacesStore.GetWorkspaceMembers(workspace_id)
+}
+
+// UpdateMember changes the role of someone in the workspace. Only admins can
+// do that, and the last admin can't step down.
+func (s *WorkspacesService) UpdateMember(user *store.User, workspace_id int64, member_id int64, role store.WorkspaceRole) (*store.WorkspaceMember, error) {
+	if !role.Valid() {
+		return nil, ErrWorkspaceRole
+	}
+
+	_, err := s.checkAdmin(user, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.workspacesStore.UpdateWorkspaceMember(workspace_id, member_id, role)
+}
+
+// RemoveMember takes someone out of the workspace. Admins can remove anyone,
+// everybody else only themselves.
+func (s *WorkspacesService) RemoveMember(user *store.User, workspace_id int64, member_id int64) error {
+	if member_id == user.ID {
+		_, err := s.workspacesStore.GetWorkspace(user.ID, workspace_id)
+		if err != nil {
+			return err
+		}
+	} else {
+		_, err := s.checkAdmin(user, workspace_id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.workspacesStore.DeleteWorkspaceMember(workspace_id, member_id)
+}
+
+// Invite creates an invitation to the workspace, whoever accepts it within
+// InvitationTTL joins with role. Only admins can invite.
+func (s *WorkspacesService) Invite(user *store.User, workspace_id int64, role store.WorkspaceRole) (*tokens.Token, error) {
+	if !role.Valid() {
+		return nil, ErrWorkspaceRole
+	}
+
+	workspace, err := s.checkAdmin(user, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if workspace.Personal {
+		return nil, ErrPersonalWorkspace
+	}
+
+	token, err := tokens.GenerateToken(user.ID, InvitationTTL, tokens.ScopeInvitation)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.workspacesStore.CreateInvitation(workspace_id, role, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// AcceptInvitation adds the user to the workspace they were invited to.
+func (s *WorkspacesService) AcceptInvitation(user *store.User, token string) (*store.Workspace, error) {
+	return s.workspacesStore.AcceptInvitation(user.ID, token)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"markdown-notes/internal/store"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkspaces(t *testing.T) {
+	db := store.SetupTestDB(t)
+	store.TruncateTables(t, db)
+	userStore := store.NewPostgresUserStore(db)
+	notesStore := store.NewPostgresNotesStore(db)
+	folderStore := store.NewPostgresFoldersStore(db)
+	workspacesStore := store.NewPostgresWorkspacesStore(db)
+	registerUserService := NewRegisterUserService(db, userStore, workspacesStore)
+	folderContentsService := NewFolderContentsService(db, userStore, folderStore, notesStore, nil)
+	workspacesService := NewWorkspacesService(workspacesStore)
+
+	users := map[string]*store.User{}
+	for _, name := range []string{"Theo", "Member"} {
+		user := &store.User{Username: name, Email: name + "@gmail.com"}
+		user.PasswordHash.Set("Password")
+		_, err := registerUserService.RegisterUser(user)
+		assert.NoError(t, err)
+		users[name] = user
+	}
+	admin, member := users["Theo"], users["Member"]
+
+	t.Run("registering makes a personal workspace", func(t *testing.T) {
+		workspaces, err := workspacesService.GetWorkspaces(admin)
+		assert.NoError(t, err)
+		assert.Len(t, workspaces, 1)
+		assert.True(t, workspaces[0].Personal)
+
+		_, err = workspacesService.Invite(admin, workspaces[0].ID, store.WorkspaceRoleMember)
+		assert.ErrorIs(t, err, ErrPersonalWorkspace)
+	})
+
+	team, err := workspacesService.CreateWorkspace(admin, "Team")
+	assert.NoError(t, err)
+
+	t.Run("admins invite", func(t *testing.T) {
+		_, err := workspacesService.Invite(admin, team.ID, "owner")
+		assert.ErrorIs(t, err, ErrWorkspaceRole)
+
+		token, err := workspacesService.Invite(admin, team.ID, store.WorkspaceRoleMember)
+		assert.NoError(t, err)
+
+		workspace, err := workspacesService.AcceptInvitation(member, token.Plaintext)
+		assert.NoError(t, err)
+		assert.Equal(t, team.RootFolderID, workspace.RootFolderID)
+
+		_, err = workspacesService.Invite(member, team.ID, store.WorkspaceRoleMember)
+		assert.ErrorIs(t, err, store.ErrForbidden)
+	})
+
+	t.Run("members work in the workspace root", func(t *testing.T) {
+		folder, err := folderContentsService.CreateSubFolder(member, team.RootFolderID, "Specs")
+		assert.NoError(t, err)
+		assert.Equal(t, team.ID, folder.WorkspaceID)
+
+		err = folderContentsService.DeleteFolder(member, folder.ID)
+		assert.ErrorIs(t, err, store.ErrForbidden)
+	})
+
+	t.Run("only admins change roles, anyone can leave", func(t *testing.T) {
+		_, err := workspacesService.UpdateMember(member, team.ID, admin.ID, store.WorkspaceRoleGuest)
+		assert.ErrorIs(t, err, store.ErrForbidden)
+
+		err = workspacesService.RemoveMember(member, team.ID, member.ID)
+		assert.NoError(t, err)
+
+		_, err = workspacesService.GetMembers(member, team.ID)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,166 @@
+package site
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+// Link is an entry in a page's navigation or listings.
+type Link struct {
+	Name string
+	URL  string
+}
+
+// Page is what every page has. Stylesheet is the URL the Stylesheet constant
+// is served at and Nav the links shown at the top of the page.
+type Page struct {
+	SiteName    string
+	Title       string
+	Stylesheet  string
+	Nav         []Link
+	Breadcrumbs []Link
+}
+
+// IndexPage lists what is in a folder.
+type IndexPage struct {
+	Page
+	Folders []Link
+	Notes   []Link
+}
+
+// NotePage shows a rendered note. Tags without a URL aren't linked.
+type NotePage struct {
+	Page
+	Tags      []Link
+	UpdatedAt time.Time
+	// Content is the note rendered to HTML, it must already be sanitized.
+	Content template.HTML
+}
+
+// TagsPage lists every tag used in the site with the notes that use it.
+type TagsPage struct {
+	Page
+	Tags []Tag
+}
+
+type Tag struct {
+	Name   string
+	Anchor string
+	Notes  []Link
+}
+
+// PasswordPage asks for the password protecting a page. Error explains why
+// the last attempt failed.
+type PasswordPage struct {
+	Page
+	Error string
+}
+
+const layout = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}{{if ne .Title .SiteName}} · {{.SiteName}}{{end}}</title>
+{{- if .Stylesheet}}
+<link rel="stylesheet" href="{{.Stylesheet}}">
+{{- end}}
+</head>
+<body>
+<header>
+{{- if .Nav}}
+<nav>{{range $i, $link := .Nav}}{{if $i}} {{end}}<a href="{{$link.URL}}">{{$link.Name}}</a>{{end}}</nav>
+{{- end}}
+{{- if .Breadcrumbs}}
+<ol class="breadcrumbs">{{range .Breadcrumbs}}<li><a href="{{.URL}}">{{.Name}}</a></li>{{end}}</ol>
+{{- end}}
+</header>
+<main>
+<h1>{{.Title}}</h1>
+{{template "content" .}}
+</main>
+</body>
+</html>
+`
+
+const indexContent = `{{define "content"}}
+{{- if .Folders}}
+<h2>Folders</h2>
+<ul class="folders">{{range .Folders}}<li><a href="{{.URL}}">{{.Name}}</a></li>{{end}}</ul>
+{{- end}}
+{{- if .Notes}}
+<h2>Notes</h2>
+<ul class="notes">{{range .Notes}}<li><a href="{{.URL}}">{{.Name}}</a></li>{{end}}</ul>
+{{- end}}
+{{- if not (or .Folders .Notes)}}
+<p>This folder is empty.</p>
+{{- end}}
+{{end}}`
+
+const noteContent = `{{define "content"}}
+<p class="meta">Updated <time datetime="{{.UpdatedAt.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{.UpdatedAt.UTC.Format "2 January 2006"}}</time>
+{{- range .Tags}} {{if .URL}}<a class="tag" href="{{.URL}}">#{{.Name}}</a>{{else}}<span class="tag">#{{.Name}}</span>{{end}}{{end}}</p>
+<article>
+{{.Content}}
+</article>
+{{end}}`
+
+const tagsContent = `{{define "content"}}
+{{- range .Tags}}
+<section id="{{.Anchor}}">
+<h2>#{{.Name}}</h2>
+<ul>{{range .Notes}}<li><a href="{{.URL}}">{{.Name}}</a></li>{{end}}</ul>
+</section>
+{{- else}}
+<p>No notes are tagged.</p>
+{{- end}}
+{{end}}`
+
+const passwordContent = `{{define "content"}}
+<form method="post">
+{{- if .Error}}
+<p class="error">{{.Error}}</p>
+{{- end}}
+<label>Password <input type="password" name="password" autofocus required></label>
+<button type="submit">View</button>
+</form>
+{{end}}`
+
+// Stylesheet styles every page, sites have it at style.css.
+const Stylesheet = `body { max-width: 48rem; margin: 0 auto; padding: 1rem; font-family: system-ui, sans-serif; line-height: 1.6; color: #222; }
+header nav a { margin-right: 1rem; font-weight: 600; }
+.breadcrumbs { list-style: none; padding: 0; color: #666; }
+.breadcrumbs li { display: inline; }
+.breadcrumbs li + li::before { content: " / "; }
+.meta { color: #666; }
+.tag { margin-left: 0.5rem; }
+.error { color: #b00020; }
+pre { overflow-x: auto; background: #f5f5f5; padding: 0.75rem; }
+img { max-width: 100%; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ddd; padding: 0.25rem 0.5rem; }
+`
+
+var (
+	indexTemplate    = template.Must(template.Must(template.New("page").Parse(layout)).Parse(indexContent))
+	noteTemplate     = template.Must(template.Must(template.New("page").Parse(layout)).Parse(noteContent))
+	tagsTemplate     = template.Must(template.Must(template.New("page").Parse(layout)).Parse(tagsContent))
+	passwordTemplate = template.Must(template.Must(template.New("page").Parse(layout)).Parse(passwordContent))
+)
+
+func WriteIndex(w io.Writer, page *IndexPage) error {
+	return indexTemplate.Execute(w, page)
+}
+
+func WriteNote(w io.Writer, page *NotePage) error {
+	return noteTemplate.Execute(w, page)
+}
+
+func WriteTags(w io.Writer, page *TagsPage) error {
+	return tagsTemplate.Execute(w, page)
+}
+
+func WritePassword(w io.Writer, page *PasswordPage) error {
+	return passwordTemplate.Execute(w, page)
+}
@@ -0,0 +1,126 @@
+// Package site renders notes and folders as standalone HTML pages and writes
+// them out as static sites.
+package site
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrInvalidName = errors.New("invalid file name in site")
+
+// Writer receives the files of a site, named by slash separated paths from
+// the top of the site.
+type Writer interface {
+	Create(name string, modified time.Time) (io.WriteCloser, error)
+}
+
+// ZipWriter writes a site into a zip archive. The caller closes the
+// zip.Writer once the site is written.
+type ZipWriter struct {
+	zw *zip.Writer
+}
+
+func NewZipWriter(zw *zip.Writer) *ZipWriter {
+	return &ZipWriter{zw: zw}
+}
+
+func (z *ZipWriter) Create(name string, modified time.Time) (io.WriteCloser, error) {
+	if !validName(name) {
+		return nil, ErrInvalidName
+	}
+
+	w, err := z.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nopCloser{w}, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// DirWriter writes a site into a directory on disk.
+type DirWriter struct {
+	dir string
+}
+
+func NewDirWriter(dir string) *DirWriter {
+	return &DirWriter{dir: dir}
+}
+
+func (d *DirWriter) Create(name string, modified time.Time) (io.WriteCloser, error) {
+	if !validName(name) {
+		return nil, ErrInvalidName
+	}
+
+	p := filepath.Join(d.dir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(p), 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Create(p)
+}
+
+// validName reports whether name stays inside the site.
+func validName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, `\`) {
+		return false
+	}
+
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Relative is the URL of the page at to as linked from the page at from,
+// both slash separated paths from the top of the site.
+func Relative(from string, to string) string {
+	var fromDirs []string
+	if dir := path.Dir(from); dir != "." {
+		fromDirs = strings.Split(dir, "/")
+	}
+	toParts := strings.Split(to, "/")
+
+	common := 0
+	for common < len(fromDirs) && common < len(toParts)-1 && fromDirs[common] == toParts[common] {
+		common++
+	}
+
+	segments := make([]string, 0, len(fromDirs)-common+len(toParts)-common)
+	for range len(fromDirs) - common {
+		segments = append(segments, "..")
+	}
+	for _, part := range toParts[common:] {
+		segments = append(segments, url.PathEscape(part))
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// Root is the relative URL of the top of the site from the page at p.
+func Root(p string) string {
+	return strings.Repeat("../", strings.Count(p, "/"))
+}
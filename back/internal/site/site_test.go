@@ -0,0 +1,133 @@
+package site
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelative(t *testing.T) {
+	tests := []struct {
+		from, to, want string
+	}{
+		{"index.html", "Home.html", "Home.html"},
+		{"index.html", "Projects/Plan.html", "Projects/Plan.html"},
+		{"Projects/Plan.html", "Home.html", "../Home.html"},
+		{"Projects/Plan.html", "Projects/Ideas.html", "Ideas.html"},
+		{"Projects/Plan.html", "Projects/Old/index.html", "Old/index.html"},
+		{"Projects/Old/a.html", "Archive/b.html", "../../Archive/b.html"},
+		{"a.html", "Q&A/what? 100%.html", "Q&A/what%3F%20100%25.html"},
+		{"Projects/index.html", "Projects/index.html", "index.html"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Relative(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+
+	assert.Equal(t, "", Root("index.html"))
+	assert.Equal(t, "../../", Root("a/b/c.html"))
+}
+
+func TestWriters(t *testing.T) {
+	modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	write := func(t *testing.T, w Writer, name string, content string) error {
+		f, err := w.Create(name, modified)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, content)
+		assert.NoError(t, err)
+		return f.Close()
+	}
+
+	t.Run("zip", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w := NewZipWriter(zw)
+
+		assert.NoError(t, write(t, w, "index.html", "home"))
+		assert.NoError(t, write(t, w, "a/b.html", "b"))
+		assert.NoError(t, zw.Close())
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		assert.Len(t, zr.File, 2)
+		assert.Equal(t, "a/b.html", zr.File[1].Name)
+		assert.True(t, zr.File[1].Modified.Equal(modified))
+	})
+
+	t.Run("dir", func(t *testing.T) {
+		dir := t.TempDir()
+		w := NewDirWriter(dir)
+
+		assert.NoError(t, write(t, w, "a/b/c.html", "c"))
+
+		content, err := os.ReadFile(filepath.Join(dir, "a", "b", "c.html"))
+		assert.NoError(t, err)
+		assert.Equal(t, "c", string(content))
+	})
+
+	t.Run("rejects names outside the site", func(t *testing.T) {
+		w := NewDirWriter(t.TempDir())
+		for _, name := range []string{"", "/etc/passwd", "../x.html", "a/../../x.html", "a//b", `a\b`} {
+			assert.ErrorIs(t, write(t, w, name, "x"), ErrInvalidName, name)
+		}
+	})
+}
+
+func TestPages(t *testing.T) {
+	page := Page{
+		SiteName:    "Notes",
+		Title:       "<Plan>",
+		Stylesheet:  "../style.css",
+		Nav:         []Link{{Name: "Notes", URL: "../index.html"}},
+		Breadcrumbs: []Link{{Name: "Projects", URL: "index.html"}},
+	}
+
+	var buf bytes.Buffer
+	err := WriteNote(&buf, &NotePage{
+		Page:      page,
+		Tags:      []Link{{Name: "work", URL: "../tags.html#tag-work"}, {Name: "draft"}},
+		UpdatedAt: time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC),
+		Content:   "<p>hello</p>",
+	})
+	assert.NoError(t, err)
+
+	html := buf.String()
+	assert.Contains(t, html, "<title>&lt;Plan&gt; · Notes</title>")
+	assert.Contains(t, html, `<link rel="stylesheet" href="../style.css">`)
+	assert.Contains(t, html, `<nav><a href="../index.html">Notes</a></nav>`)
+	assert.Contains(t, html, `<li><a href="index.html">Projects</a></li>`)
+	assert.Contains(t, html, `<a class="tag" href="../tags.html#tag-work">#work</a> <span class="tag">#draft</span>`)
+	assert.Contains(t, html, "4 March 2026")
+	assert.Contains(t, html, "<p>hello</p>")
+
+	buf.Reset()
+	err = WriteIndex(&buf, &IndexPage{Page: Page{SiteName: "Notes", Title: "Notes"}})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "<title>Notes</title>")
+	assert.Contains(t, buf.String(), "This folder is empty.")
+
+	buf.Reset()
+	err = WriteTags(&buf, &TagsPage{
+		Page: Page{SiteName: "Notes", Title: "Tags"},
+		Tags: []Tag{{Name: "work", Anchor: "tag-work", Notes: []Link{{Name: "Plan", URL: "Projects/Plan.html"}}}},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `<section id="tag-work">`)
+	assert.Contains(t, buf.String(), `<a href="Projects/Plan.html">Plan</a>`)
+
+	buf.Reset()
+	err = WritePassword(&buf, &PasswordPage{Page: Page{SiteName: "Notes", Title: "Plan"}, Error: "wrong password"})
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), "<nav>")
+	assert.NotContains(t, buf.String(), "stylesheet")
+	assert.Contains(t, buf.String(), `<p class="error">wrong password</p>`)
+}
@@ -0,0 +1,335 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Attachment struct {
+	ID          int64     `json:"id"`
+	NoteID      int64     `json:"note_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Thumbnail is a scaled down copy of an image attachment.
+type Thumbnail struct {
+	AttachmentID int64     `json:"attachment_id"`
+	Size         string    `json:"size"`
+	ContentType  string    `json:"content_type"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	ByteSize     int64     `json:"byte_size"`
+	SHA256       string    `json:"sha256"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type PostgresAttachmentsStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAttachmentsStore(db *sql.DB) *PostgresAttachmentsStore {
+	return &PostgresAttachmentsStore{db: db}
+}
+
+type AttachmentsStore interface {
+	CreateAttachment(user_id int64, attachment *Attachment) (*Attachment, error)
+	CreateAttachmentTx(tx *sql.Tx, user_id int64, attachment *Attachment) (*Attachment, error)
+	ReserveAttachmentIDTx(tx *sql.Tx) (int64, error)
+	GetAttachment(user_id int64, attachment_id int64) (*Attachment, error)
+	GetNoteAttachments(user_id int64, note_id int64) ([]Attachment, error)
+	AttachmentRole(user_id int64, attachment_id int64) (Role, error)
+	ReplaceAttachmentContent(user_id int64, attachment_id int64, sha256 string, size int64) (*Attachment, error)
+	BlobInUse(sha256 string) (bool, error)
+	AddOrphanedBlobs(keys []string) error
+	GetOrphanedBlobs(limit int) ([]string, error)
+	ForgetOrphanedBlob(sha256 string) error
+	SaveThumbnail(thumbnail *Thumbnail) error
+	GetThumbnail(user_id int64, attachment_id int64, size string) (*Thumbnail, error)
+}
+
+func (a *PostgresAttachmentsStore) CreateAttachment(user_id int64, attachment *Attachment) (*Attachment, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created, err := a.CreateAttachmentTx(tx, user_id, attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// CreateAttachmentTx records an attachment as part of a larger transaction.
+// The user must be able to edit the note, the attachment belongs to the
+// note's owner. An ID taken with ReserveAttachmentIDTx is kept, otherwise the
+// next one is assigned.
+func (a *PostgresAttachmentsStore) CreateAttachmentTx(tx *sql.Tx, user_id int64, attachment *Attachment) (*Attachment, error) {
+	query := `
+	INSERT INTO attachments (id, user_id, note_id, filename, content_type, size, sha256)
+	SELECT COALESCE(NULLIF($7::BIGINT, 0), nextval(pg_get_serial_sequence('attachments', 'id'))), n.user_id, n.id, $3, $4, $5, $6
+	FROM notes n
+	WHERE n.id = $2 AND folder_role($1, n.folder_id) >= 'editor'
+	RETURNING id, created_at;
+	`
+
+	created := *attachment
+	err := tx.QueryRow(
+		query,
+		user_id,
+		attachment.NoteID,
+		attachment.Filename,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.SHA256,
+		attachment.ID,
+	).Scan(&created.ID, &created.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// ReserveAttachmentIDTx takes an id for an attachment that is about to be
+// created, so a note can link to it before the note itself exists.
+func (a *PostgresAttachmentsStore) ReserveAttachmentIDTx(tx *sql.Tx) (int64, error) {
+	var id int64
+	err := tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('attachments', 'id'));`).Scan(&id)
+	return id, err
+}
+
+func (a *PostgresAttachmentsStore) GetAttachment(user_id int64, attachment_id int64) (*Attachment, error) {
+	query := `
+	SELECT a.id, a.note_id, a.filename, a.content_type, a.size, a.sha256, a.created_at
+	FROM attachments a
+	INNER JOIN notes n ON n.id = a.note_id
+	WHERE a.id = $2 AND folder_role($1, n.folder_id) IS NOT NULL;
+	`
+
+	var attachment Attachment
+	err := a.db.QueryRow(query, user_id, attachment_id).Scan(
+		&attachment.ID,
+		&attachment.NoteID,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.SHA256,
+		&attachment.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+func (a *PostgresAttachmentsStore) GetNoteAttachments(user_id int64, note_id int64) ([]Attachment, error) {
+	query := `
+	SELECT a.id, a.note_id, a.filename, a.content_type, a.size, a.sha256, a.created_at
+	FROM attachments a
+	INNER JOIN notes n ON n.id = a.note_id
+	WHERE a.note_id = $2 AND folder_role($1, n.folder_id) IS NOT NULL
+	ORDER BY a.id;
+	`
+
+	rows, err := a.db.Query(query, user_id, note_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+
+	for rows.Next() {
+		var attachment Attachment
+		err = rows.Scan(
+			&attachment.ID,
+			&attachment.NoteID,
+			&attachment.Filename,
+			&attachment.ContentType,
+			&attachment.Size,
+			&attachment.SHA256,
+			&attachment.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, nil
+}
+
+// AttachmentRole returns the user's role on the folder of the note an
+// attachment belongs to, RoleNone if there is no such attachment or the user
+// has no access to it.
+func (a *PostgresAttachmentsStore) AttachmentRole(user_id int64, attachment_id int64) (Role, error) {
+	query := `
+	SELECT folder_role($1, n.folder_id)
+	FROM attachments a
+	INNER JOIN notes n ON n.id = a.note_id
+	WHERE a.id = $2;
+	`
+
+	return scanRole(a.db.QueryRow(query, user_id, attachment_id))
+}
+
+// ReplaceAttachmentContent points an attachment at different content, its
+// thumbnails are kept since they are made from the same pixels.
+func (a *PostgresAttachmentsStore) ReplaceAttachmentContent(user_id int64, attachment_id int64, sha256 string, size int64) (*Attachment, error) {
+	query := `
+	UPDATE attachments a
+	SET sha256 = $3, size = $4
+	FROM notes n
+	WHERE n.id = a.note_id AND a.id = $2 AND folder_role($1, n.folder_id) >= 'editor'
+	RETURNING a.id, a.note_id, a.filename, a.content_type, a.size, a.sha256, a.created_at;
+	`
+
+	var attachment Attachment
+	err := a.db.QueryRow(query, user_id, attachment_id, sha256, size).Scan(
+		&attachment.ID,
+		&attachment.NoteID,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.SHA256,
+		&attachment.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// BlobInUse reports whether any attachment or thumbnail still refers to a
+// blob, blobs are shared between identical uploads.
+func (a *PostgresAttachmentsStore) BlobInUse(sha256 string) (bool, error) {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM attachments WHERE sha256 = $1)
+		OR EXISTS (SELECT 1 FROM attachment_thumbnails WHERE sha256 = $1);
+	`
+
+	var inUse bool
+	err := a.db.QueryRow(query, sha256).Scan(&inUse)
+	if err != nil {
+		return false, err
+	}
+
+	return inUse, nil
+}
+
+// AddOrphanedBlobs marks blobs that may no longer be referred to, for blobs
+// stored for rows that were never committed. Rows going away mark theirs by
+// trigger.
+func (a *PostgresAttachmentsStore) AddOrphanedBlobs(keys []string) error {
+	query := `
+	INSERT INTO orphaned_blobs (sha256)
+	SELECT unnest($1::TEXT[])
+	ON CONFLICT DO NOTHING;
+	`
+
+	_, err := a.db.Exec(query, keys)
+	return err
+}
+
+// GetOrphanedBlobs returns up to limit blobs marked as possibly no longer
+// referred to, oldest first.
+func (a *PostgresAttachmentsStore) GetOrphanedBlobs(limit int) ([]string, error) {
+	query := `
+	SELECT sha256
+	FROM orphaned_blobs
+	ORDER BY created_at, sha256
+	LIMIT $1;
+	`
+
+	rows, err := a.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// ForgetOrphanedBlob unmarks a blob once it was dealt with.
+func (a *PostgresAttachmentsStore) ForgetOrphanedBlob(sha256 string) error {
+	_, err := a.db.Exec(`DELETE FROM orphaned_blobs WHERE sha256 = $1;`, sha256)
+	return err
+}
+
+func (a *PostgresAttachmentsStore) SaveThumbnail(thumbnail *Thumbnail) error {
+	query := `
+	INSERT INTO attachment_thumbnails (attachment_id, size, content_type, width, height, byte_size, sha256)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (attachment_id, size) DO UPDATE
+	SET content_type = EXCLUDED.content_type,
+		width = EXCLUDED.width,
+		height = EXCLUDED.height,
+		byte_size = EXCLUDED.byte_size,
+		sha256 = EXCLUDED.sha256,
+		created_at = now();
+	`
+
+	_, err := a.db.Exec(
+		query,
+		thumbnail.AttachmentID,
+		thumbnail.Size,
+		thumbnail.ContentType,
+		thumbnail.Width,
+		thumbnail.Height,
+		thumbnail.ByteSize,
+		thumbnail.SHA256,
+	)
+	return err
+}
+
+func (a *PostgresAttachmentsStore) GetThumbnail(user_id int64, attachment_id int64, size string) (*Thumbnail, error) {
+	query := `
+	SELECT t.attachment_id, t.size, t.content_type, t.width, t.height, t.byte_size, t.sha256, t.created_at
+	FROM attachment_thumbnails t
+	INNER JOIN attachments a ON a.id = t.attachment_id
+	INNER JOIN notes n ON n.id = a.note_id
+	WHERE t.attachment_id = $2 AND t.size = $3 AND folder_role($1, n.folder_id) IS NOT NULL;
+	`
+
+	var thumbnail Thumbnail
+	err := a.db.QueryRow(query, user_id, attachment_id, size).Scan(
+		&thumbnail.AttachmentID,
+		&thumbnail.Size,
+		&thumbnail.ContentType,
+		&thumbnail.Width,
+		&thumbnail.Height,
+		&thumbnail.ByteSize,
+		&thumbnail.SHA256,
+		&thumbnail.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &thumbnail, nil
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Event is a change to a note or a folder, see migrations/00017_events.sql
+// for what each type means. FolderID is the folder that changed, or the one
+// the note is in. ParentID is the changed folder's parent and OldFolderID is
+// where a moved note or folder was before.
+type Event struct {
+	ID          int64     `json:"id"`
+	Type        string    `json:"type"`
+	WorkspaceID int64     `json:"workspace_id"`
+	NoteID      *int64    `json:"note_id,omitempty"`
+	FolderID    int64     `json:"folder_id"`
+	ParentID    *int64    `json:"parent_id,omitempty"`
+	OldFolderID *int64    `json:"old_folder_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// EventReset isn't logged, GET /events sends it to a client resuming from
+// an event that was pruned already. Its ID is where the stream goes on from.
+const EventReset = "reset"
+
+type PostgresEventsStore struct {
+	db *sql.DB
+}
+
+func NewPostgresEventsStore(db *sql.DB) *PostgresEventsStore {
+	return &PostgresEventsStore{db: db}
+}
+
+type EventsStore interface {
+	GetEvents(user_id int64, workspace_id int64, after_id int64, limit int) ([]Event, error)
+	GetLastEventID() (int64, error)
+	GetFirstEventID() (int64, error)
+	DeleteEventsBefore(before time.Time) (int64, error)
+}
+
+// publishEvents numbers the events committed since it last ran, see
+// migrations/00025_event_publishing.sql. Events only have an id, and can only
+// be read, once they are published.
+func (e *PostgresEventsStore) publishEvents() error {
+	_, err := e.db.Exec(`SELECT publish_events();`)
+	return err
+}
+
+// GetEvents returns up to limit events after after_id, oldest first, about
+// folders the user can see now in the workspace, or in all of them for 0. A
+// note or folder that was moved out of sight still shows up through the
+// folder it left.
+func (e *PostgresEventsStore) GetEvents(user_id int64, workspace_id int64, after_id int64, limit int) ([]Event, error) {
+	err := e.publishEvents()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	WITH visible AS (
+		SELECT folder_id FROM workspace_folders($1, $2)
+	)
+	SELECT id, type, workspace_id, note_id, folder_id, parent_id, old_folder_id, created_at
+	FROM events
+	WHERE id > $3
+		AND (
+			folder_id IN (SELECT folder_id FROM visible)
+			OR parent_id IN (SELECT folder_id FROM visible)
+			OR old_folder_id IN (SELECT folder_id FROM visible)
+		)
+	ORDER BY id
+	LIMIT $4;
+	`
+
+	rows, err := e.db.Query(query, user_id, workspace_id, after_id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+
+	for rows.Next() {
+		var event Event
+		err = rows.Scan(
+			&event.ID,
+			&event.Type,
+			&event.WorkspaceID,
+			&event.NoteID,
+			&event.FolderID,
+			&event.ParentID,
+			&event.OldFolderID,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetLastEventID returns the id of the newest event committed, 0 when none
+// ever was. Event ids follow each other without gaps in the order the events
+// were published, which is after they were committed, so nothing logged later
+// can have a lower id.
+func (e *PostgresEventsStore) GetLastEventID() (int64, error) {
+	err := e.publishEvents()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+	SELECT last_id
+	FROM event_seq;
+	`
+
+	var id int64
+	err = e.db.QueryRow(query).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetFirstEventID returns the id of the oldest event still in the log, or the
+// id the next one will get when the log is empty. Clients can only resume
+// from the event before it or later, older events were pruned.
+func (e *PostgresEventsStore) GetFirstEventID() (int64, error) {
+	query := `
+	SELECT COALESCE((SELECT MIN(id) FROM events), last_id + 1)
+	FROM event_seq;
+	`
+
+	var id int64
+	err := e.db.QueryRow(query).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// DeleteEventsBefore drops events older than before from the log and returns
+// how many went. Clients can't resume from before the oldest event left.
+// Events are published first and only published ones are dropped, so none
+// goes without the first id moving past it.
+func (e *PostgresEventsStore) DeleteEventsBefore(before time.Time) (int64, error) {
+	err := e.publishEvents()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+	DELETE FROM events
+	WHERE id IS NOT NULL AND created_at < $1;
+	`
+
+	result, err := e.db.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
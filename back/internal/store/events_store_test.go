@@ -0,0 +1,135 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvents(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	eventsStore := NewPostgresEventsStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Theo2", "example@gmail.com", "Password")
+
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	rootFolderId2 := CreateRootFolder(t, db, *folderStore, user2)
+
+	start, err := eventsStore.GetLastEventID()
+	assert.NoError(t, err)
+
+	folder := createSubFolder(t, db, *folderStore, user, rootFolderId, "Projects")
+	note, err := notesStore.CreateNote(user.ID, rootFolderId, "Plan", "content")
+	assert.NoError(t, err)
+	_, err = notesStore.UpdateNote(user.ID, note.ID, "more content")
+	assert.NoError(t, err)
+	_, err = notesStore.PatchNote(user.ID, note.ID, NoteUpdate{FolderID: &folder.ID})
+	assert.NoError(t, err)
+	_, err = folderStore.UpdateFolder(user.ID, folder.ID, rootFolderId, "Old projects")
+	assert.NoError(t, err)
+	_, err = notesStore.TrashNote(user.ID, note.ID)
+	assert.NoError(t, err)
+	err = notesStore.PurgeNote(user.ID, note.ID)
+	assert.NoError(t, err)
+	_, err = folderStore.DeleteFolder(user.ID, folder.ID)
+	assert.NoError(t, err)
+
+	t.Run("logs changes in order", func(t *testing.T) {
+		events, err := eventsStore.GetEvents(user.ID, 0, start, 100)
+		assert.NoError(t, err)
+
+		types := []string{}
+		for i, event := range events {
+			types = append(types, event.Type)
+			assert.Equal(t, start+int64(i)+1, event.ID, "ids have no gaps")
+		}
+		assert.Equal(t, []string{
+			"folder.created",
+			"note.created",
+			"note.updated",
+			"note.moved",
+			"folder.updated",
+			"note.deleted",
+			"folder.deleted",
+		}, types)
+
+		moved := events[3]
+		assert.Equal(t, note.ID, *moved.NoteID)
+		assert.Equal(t, folder.ID, moved.FolderID)
+		assert.Equal(t, rootFolderId, *moved.OldFolderID)
+
+		deleted := events[6]
+		assert.Nil(t, deleted.NoteID)
+		assert.Equal(t, folder.ID, deleted.FolderID)
+		assert.Equal(t, rootFolderId, *deleted.ParentID)
+	})
+
+	t.Run("resumes after an event", func(t *testing.T) {
+		events, err := eventsStore.GetEvents(user.ID, 0, start, 2)
+		assert.NoError(t, err)
+		assert.Len(t, events, 2)
+
+		rest, err := eventsStore.GetEvents(user.ID, 0, events[1].ID, 100)
+		assert.NoError(t, err)
+		assert.Len(t, rest, 5)
+	})
+
+	t.Run("only shows events the user can see", func(t *testing.T) {
+		events, err := eventsStore.GetEvents(user2.ID, 0, start, 100)
+		assert.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("numbers events in the order they were committed", func(t *testing.T) {
+		tx, err := db.Begin()
+		assert.NoError(t, err)
+		defer tx.Rollback()
+
+		ids, err := notesStore.ReserveNoteIDsTx(tx, 1)
+		assert.NoError(t, err)
+		slow, err := notesStore.CreateReservedNoteTx(tx, user.ID, ids[0], rootFolderId, "Slow", "")
+		assert.NoError(t, err)
+
+		// doesn't wait for the transaction above
+		_, err = notesStore.CreateNote(user2.ID, rootFolderId2, "Fast", "")
+		assert.NoError(t, err)
+
+		last, err := eventsStore.GetLastEventID()
+		assert.NoError(t, err)
+		assert.Equal(t, start+8, last)
+
+		assert.NoError(t, tx.Commit())
+
+		events, err := eventsStore.GetEvents(user.ID, 0, last, 100)
+		assert.NoError(t, err)
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, last+1, events[0].ID)
+			assert.Equal(t, slow.ID, *events[0].NoteID)
+		}
+	})
+
+	t.Run("prunes old events", func(t *testing.T) {
+		deleted, err := eventsStore.DeleteEventsBefore(time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Greater(t, deleted, int64(0))
+
+		events, err := eventsStore.GetEvents(user.ID, 0, 0, 100)
+		assert.NoError(t, err)
+		assert.Empty(t, events)
+
+		// ids aren't handed out again
+		last, err := eventsStore.GetLastEventID()
+		assert.NoError(t, err)
+		assert.Equal(t, start+9, last)
+
+		first, err := eventsStore.GetFirstEventID()
+		assert.NoError(t, err)
+		assert.Equal(t, last+1, first)
+	})
+}
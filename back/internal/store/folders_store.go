@@ -8,15 +8,19 @@ import (
 	"github.com/jackc/pgconn"
 )
 
-var ErrDuplicateFolder = errors.New("folder with this name already exists")
+var (
+	ErrDuplicateFolder = errors.New("folder with this name already exists")
+	ErrFolderCycle     = errors.New("a folder can't be moved into itself or one of its subfolders")
+)
 
 type Folder struct {
-	ID        int64     `json:"id"`
-	UserID    int64     `json:"user_id"`
-	ParentID  *int64    `json:"parent_id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	WorkspaceID int64     `json:"workspace_id"`
+	ParentID    *int64    `json:"parent_id"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 type PostgresFoldersStore struct {
@@ -29,23 +33,36 @@ func NewPostgresFoldersStore(db *sql.DB) *PostgresFoldersStore {
 
 type FoldersStore interface {
 	CreateFolder(user_id int64, parent_id int64, name string) (*Folder, error)
-	CreateFolderTx(tx *sql.Tx, user_id int64, parent_id *int64, name string) (int64, error)
+	CreateFolderTx(tx *sql.Tx, parent_id int64, name string) (int64, error)
 	GetRootFolder(user_id int64) (int64, error)
-	UserOwnsFolder(user_id int64, folder_id int64) (bool, error)
+	FolderRole(user_id int64, folder_id int64) (Role, error)
 	GetSubFolders(user_id int64, folder_id int64) ([]Folder, error)
+	GetFolder(user_id int64, folder_id int64) (*Folder, error)
+	GetFolderTree(user_id int64, folder_id int64) ([]Folder, error)
+	GetFolderPath(folder_id int64) ([]string, error)
+	IsDescendant(user_id int64, ancestor_id int64, folder_id int64) (bool, error)
+	UpdateFolder(user_id int64, folder_id int64, parent_id int64, name string) (*Folder, error)
+	DeleteFolder(user_id int64, folder_id int64) ([]int64, error)
+	PublishFolder(user_id int64, folder_id int64) (time.Time, error)
+	UnpublishFolder(user_id int64, folder_id int64) error
 }
 
+// CreateFolder adds a folder below parent_id, which the user must be able to
+// edit. The new folder belongs to the owner and workspace of its parent.
 func (f *PostgresFoldersStore) CreateFolder(user_id int64, parent_id int64, name string) (*Folder, error) {
 	query := `
-	INSERT INTO folders (user_id, parent_id, name)
-	VALUES ($1, $2, $3)
-	RETURNING id, user_id, parent_id, name, created_at, updated_at;
+	INSERT INTO folders (user_id, workspace_id, parent_id, name)
+	SELECT p.user_id, p.workspace_id, p.id, $3
+	FROM folders p
+	WHERE p.id = $2 AND folder_role($1, p.id) >= 'editor'
+	RETURNING id, user_id, workspace_id, parent_id, name, created_at, updated_at;
 	`
 
 	var folder Folder
 	err := f.db.QueryRow(query, user_id, parent_id, name).Scan(
 		&folder.ID,
 		&folder.UserID,
+		&folder.WorkspaceID,
 		&folder.ParentID,
 		&folder.Name,
 		&folder.CreatedAt,
@@ -63,15 +80,20 @@ func (f *PostgresFoldersStore) CreateFolder(user_id int64, parent_id int64, name
 	return &folder, nil
 }
 
-func (f *PostgresFoldersStore) CreateFolderTx(tx *sql.Tx, user_id int64, parent_id *int64, name string) (int64, error) {
+// CreateFolderTx creates a folder below parent_id as part of a larger
+// transaction, without checking access. Root folders are only made together
+// with their workspace.
+func (f *PostgresFoldersStore) CreateFolderTx(tx *sql.Tx, parent_id int64, name string) (int64, error) {
 	query := `
-	INSERT INTO folders (user_id, parent_id, name)
-	VALUES ($1, $2, $3)
+	INSERT INTO folders (user_id, workspace_id, parent_id, name)
+	SELECT user_id, workspace_id, id, $2
+	FROM folders
+	WHERE id = $1
 	RETURNING id;
 	`
 
 	var folder_id int64
-	err := tx.QueryRow(query, user_id, parent_id, name).Scan(&folder_id)
+	err := tx.QueryRow(query, parent_id, name).Scan(&folder_id)
 	if err != nil {
 		return 0, err
 	}
@@ -79,12 +101,14 @@ func (f *PostgresFoldersStore) CreateFolderTx(tx *sql.Tx, user_id int64, parent_
 	return folder_id, nil
 }
 
+// GetRootFolder returns the root folder of the user's personal workspace.
 func (f *PostgresFoldersStore) GetRootFolder(user_id int64) (int64, error) {
 	query := `
-	SELECT id 
-	FROM folders
-	WHERE user_id = $1
-		AND parent_id IS NULL;
+	SELECT f.id
+	FROM folders f
+	INNER JOIN workspaces w ON w.id = f.workspace_id
+	WHERE w.personal_user_id = $1
+		AND f.parent_id IS NULL;
 	`
 
 	var folder_id int64
@@ -96,33 +120,92 @@ func (f *PostgresFoldersStore) GetRootFolder(user_id int64) (int64, error) {
 	return folder_id, nil
 }
 
-func (f *PostgresFoldersStore) UserOwnsFolder(user_id int64, folder_id int64) (bool, error) {
+// FolderRole returns the user's role on a folder, RoleNone if the folder
+// doesn't exist or the user has no access to it.
+func (f *PostgresFoldersStore) FolderRole(user_id int64, folder_id int64) (Role, error) {
 	query := `
-	SELECT EXISTS (
-		SELECT 1 
-		FROM folders 
-		WHERE user_id = $1 AND id = $2
-	);
+	SELECT folder_role($1, $2);
 	`
 
-	var exists bool
-	err := f.db.QueryRow(query, user_id, folder_id).Scan(&exists)
+	return scanRole(f.db.QueryRow(query, user_id, folder_id))
+}
+
+func (f *PostgresFoldersStore) GetSubFolders(user_id int64, folder_id int64) ([]Folder, error) {
+	query := `
+	SELECT id, user_id, workspace_id, parent_id, name, created_at, updated_at
+	FROM folders
+	WHERE parent_id = $2 AND folder_role($1, $2) IS NOT NULL;
+	`
+
+	rows, err := f.db.Query(query, user_id, folder_id)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	defer rows.Close()
+
+	folders := []Folder{}
 
-	if exists == false {
-		return false, errors.New("folder doesn't exist or you don't have access to it")
+	for rows.Next() {
+		var folder Folder
+		err = rows.Scan(
+			&folder.ID,
+			&folder.UserID,
+			&folder.WorkspaceID,
+			&folder.ParentID,
+			&folder.Name,
+			&folder.CreatedAt,
+			&folder.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
 	}
 
-	return true, nil
+	return folders, nil
 }
 
-func (f *PostgresFoldersStore) GetSubFolders(user_id int64, folder_id int64) ([]Folder, error) {
+func (f *PostgresFoldersStore) GetFolder(user_id int64, folder_id int64) (*Folder, error) {
+	query := `
+	SELECT id, user_id, workspace_id, parent_id, name, created_at, updated_at
+	FROM folders
+	WHERE id = $2 AND folder_role($1, id) IS NOT NULL;
+	`
+
+	var folder Folder
+	err := f.db.QueryRow(query, user_id, folder_id).Scan(
+		&folder.ID,
+		&folder.UserID,
+		&folder.WorkspaceID,
+		&folder.ParentID,
+		&folder.Name,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+// GetFolderTree returns folder_id followed by every folder below it, parents
+// always before their children. Returns sql.ErrNoRows if the user has no
+// access to folder_id.
+func (f *PostgresFoldersStore) GetFolderTree(user_id int64, folder_id int64) ([]Folder, error) {
 	query := `
-	SELECT id, user_id, parent_id, name, created_at, updated_at
-	FROM folders 
-	WHERE user_id = $1 and parent_id = $2;
+	WITH RECURSIVE subtree AS (
+		SELECT id, user_id, workspace_id, parent_id, name, created_at, updated_at, 0 AS depth
+		FROM folders
+		WHERE id = $2 AND folder_role($1, id) IS NOT NULL
+		UNION ALL
+		SELECT f.id, f.user_id, f.workspace_id, f.parent_id, f.name, f.created_at, f.updated_at, s.depth + 1
+		FROM folders f
+		INNER JOIN subtree s ON f.parent_id = s.id
+	)
+	SELECT id, user_id, workspace_id, parent_id, name, created_at, updated_at
+	FROM subtree
+	ORDER BY depth, name, id;
 	`
 
 	rows, err := f.db.Query(query, user_id, folder_id)
@@ -138,6 +221,7 @@ func (f *PostgresFoldersStore) GetSubFolders(user_id int64, folder_id int64) ([]
 		err = rows.Scan(
 			&folder.ID,
 			&folder.UserID,
+			&folder.WorkspaceID,
 			&folder.ParentID,
 			&folder.Name,
 			&folder.CreatedAt,
@@ -149,5 +233,281 @@ func (f *PostgresFoldersStore) GetSubFolders(user_id int64, folder_id int64) ([]
 		folders = append(folders, folder)
 	}
 
+	if len(folders) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
 	return folders, nil
 }
+
+// GetFolderPath lists the folder names from below the root of the workspace
+// down to folder_id. It doesn't check access, the caller does.
+func (f *PostgresFoldersStore) GetFolderPath(folder_id int64) ([]string, error) {
+	query := `
+	WITH RECURSIVE ancestors AS (
+		SELECT id, parent_id, name, 0 AS depth
+		FROM folders
+		WHERE id = $1
+		UNION ALL
+		SELECT f.id, f.parent_id, f.name, a.depth + 1
+		FROM folders f
+		INNER JOIN ancestors a ON f.id = a.parent_id
+	)
+	SELECT name
+	FROM ancestors
+	WHERE parent_id IS NOT NULL
+	ORDER BY depth DESC;
+	`
+
+	rows, err := f.db.Query(query, folder_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// IsDescendant reports whether folder_id is ancestor_id itself or sits
+// anywhere in the subtree below it.
+func (f *PostgresFoldersStore) IsDescendant(user_id int64, ancestor_id int64, folder_id int64) (bool, error) {
+	return isDescendant(f.db, user_id, ancestor_id, folder_id)
+}
+
+type rowQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func isDescendant(q rowQueryer, user_id int64, ancestor_id int64, folder_id int64) (bool, error) {
+	query := `
+	WITH RECURSIVE subtree AS (
+		SELECT id
+		FROM folders
+		WHERE id = $2 AND folder_role($1, id) IS NOT NULL
+		UNION
+		SELECT f.id
+		FROM folders f
+		INNER JOIN subtree s ON f.parent_id = s.id
+	)
+	SELECT EXISTS (
+		SELECT 1
+		FROM subtree
+		WHERE id = $3
+	);
+	`
+
+	var exists bool
+	err := q.QueryRow(query, user_id, ancestor_id, folder_id).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// UpdateFolder renames a folder and moves it below parent_id. The user must
+// be able to edit both, and folders can't move between workspaces. Moving a
+// folder into itself or one of its subfolders returns ErrFolderCycle.
+func (f *PostgresFoldersStore) UpdateFolder(user_id int64, folder_id int64, parent_id int64, name string) (*Folder, error) {
+	tx, err := f.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Two moves, a into b and b into a, could each find no cycle before the
+	// other one is committed. Locking the workspace, which every change to
+	// its folders takes its change number from anyway, makes the second one
+	// look at the tree after the first.
+	_, err = tx.Exec(`
+	SELECT w.id
+	FROM workspaces w
+	INNER JOIN folders f ON f.workspace_id = w.id
+	WHERE f.id = $1
+	FOR UPDATE OF w;
+	`, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	cycle, err := isDescendant(tx, user_id, folder_id, parent_id)
+	if err != nil {
+		return nil, err
+	}
+	if cycle {
+		return nil, ErrFolderCycle
+	}
+
+	query := `
+	UPDATE folders
+	SET parent_id = $1, name = $2, updated_at = now()
+	WHERE id = $4 AND parent_id IS NOT NULL
+		AND folder_role($3, id) >= 'editor'
+		AND (parent_id = $1 OR (
+			folder_role($3, $1) >= 'editor'
+			AND workspace_id = (SELECT workspace_id FROM folders WHERE id = $1)
+		))
+	RETURNING id, user_id, workspace_id, parent_id, name, created_at, updated_at;
+	`
+
+	var folder Folder
+	err = tx.QueryRow(query, parent_id, name, user_id, folder_id).Scan(
+		&folder.ID,
+		&folder.UserID,
+		&folder.WorkspaceID,
+		&folder.ParentID,
+		&folder.Name,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return nil, ErrDuplicateFolder
+			}
+		}
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+// DeleteFolder removes the folder together with all of its subfolders and
+// notes, which go with it through the ON DELETE CASCADE foreign keys. Only
+// owners can delete a folder. Returns the deleted folders that were
+// published, their sites are left for the caller to remove.
+func (f *PostgresFoldersStore) DeleteFolder(user_id int64, folder_id int64) ([]int64, error) {
+	tx, err := f.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// published_folders rows go with the folders, so find them first
+	query := `
+	WITH RECURSIVE subtree AS (
+		SELECT id
+		FROM folders
+		WHERE id = $2 AND parent_id IS NOT NULL AND folder_role($1, id) = 'owner'
+		UNION ALL
+		SELECT f.id
+		FROM folders f
+		INNER JOIN subtree s ON f.parent_id = s.id
+	)
+	SELECT p.folder_id
+	FROM published_folders p
+	INNER JOIN subtree s ON s.id = p.folder_id
+	ORDER BY p.folder_id
+	FOR UPDATE OF p;
+	`
+
+	rows, err := tx.Query(query, user_id, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	published := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		published = append(published, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	DELETE FROM folders
+	WHERE id = $2 AND parent_id IS NOT NULL AND folder_role($1, id) = 'owner';
+	`
+
+	result, err := tx.Exec(query, user_id, folder_id)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return published, nil
+}
+
+// PublishFolder marks a folder the user owns as published, or refreshes the
+// time it was published at, returning that time.
+func (f *PostgresFoldersStore) PublishFolder(user_id int64, folder_id int64) (time.Time, error) {
+	query := `
+	INSERT INTO published_folders (folder_id, user_id)
+	SELECT id, user_id
+	FROM folders
+	WHERE id = $2 AND folder_role($1, id) = 'owner'
+	ON CONFLICT (folder_id) DO UPDATE SET published_at = now()
+	RETURNING published_at;
+	`
+
+	var publishedAt time.Time
+	err := f.db.QueryRow(query, user_id, folder_id).Scan(&publishedAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return publishedAt, nil
+}
+
+func (f *PostgresFoldersStore) UnpublishFolder(user_id int64, folder_id int64) error {
+	query := `
+	DELETE FROM published_folders
+	WHERE folder_id = $2 AND folder_role($1, folder_id) = 'owner';
+	`
+
+	result, err := f.db.Exec(query, user_id, folder_id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
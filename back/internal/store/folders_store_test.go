@@ -96,7 +96,7 @@ func TestGetRootFolder(t *testing.T) {
 	})
 }
 
-func TestUserOwnsFolder(t *testing.T) {
+func TestFolderRole(t *testing.T) {
 	db := SetupTestDB(t)
 	TruncateTables(t, db)
 	folderStore := NewPostgresFoldersStore(db)
@@ -107,16 +107,22 @@ func TestUserOwnsFolder(t *testing.T) {
 
 	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
 
-	t.Run("returns true when user owns folder", func(t *testing.T) {
-		owns, err := folderStore.UserOwnsFolder(user.ID, rootFolderId)
+	t.Run("owner of the folder", func(t *testing.T) {
+		role, err := folderStore.FolderRole(user.ID, rootFolderId)
 		assert.NoError(t, err)
-		assert.True(t, owns)
+		assert.Equal(t, RoleOwner, role)
 	})
 
-	t.Run("returns false when user doesn't own folder", func(t *testing.T) {
-		owns, err := folderStore.UserOwnsFolder(user2.ID, rootFolderId)
-		assert.Error(t, err)
-		assert.False(t, owns)
+	t.Run("no access to other users folders", func(t *testing.T) {
+		role, err := folderStore.FolderRole(user2.ID, rootFolderId)
+		assert.NoError(t, err)
+		assert.Equal(t, RoleNone, role)
+	})
+
+	t.Run("no access to missing folders", func(t *testing.T) {
+		role, err := folderStore.FolderRole(user.ID, rootFolderId+1000)
+		assert.NoError(t, err)
+		assert.Equal(t, RoleNone, role)
 	})
 }
 
@@ -159,3 +165,221 @@ func TestGetSubFolders(t *testing.T) {
 		assert.Equal(t, 0, len(folders))
 	})
 }
+
+func TestGetFolder(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Theo2", "example@gmail.com", "Password")
+
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	subFolder := createSubFolder(t, db, *folderStore, user, rootFolderId, "subfolder")
+
+	t.Run("returns folder for owner", func(t *testing.T) {
+		folder, err := folderStore.GetFolder(user.ID, subFolder.ID)
+		assert.NoError(t, err)
+		CompareFolders(t, subFolder, folder)
+	})
+
+	t.Run("fails for other user", func(t *testing.T) {
+		folder, err := folderStore.GetFolder(user2.ID, subFolder.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, folder)
+	})
+}
+
+func TestIsDescendant(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	parent := createSubFolder(t, db, *folderStore, user, rootFolderId, "parent")
+	child := createSubFolder(t, db, *folderStore, user, parent.ID, "child")
+	grandchild := createSubFolder(t, db, *folderStore, user, child.ID, "grandchild")
+	sibling := createSubFolder(t, db, *folderStore, user, rootFolderId, "sibling")
+
+	t.Run("folder is its own descendant", func(t *testing.T) {
+		is, err := folderStore.IsDescendant(user.ID, parent.ID, parent.ID)
+		assert.NoError(t, err)
+		assert.True(t, is)
+	})
+
+	t.Run("finds nested descendants", func(t *testing.T) {
+		is, err := folderStore.IsDescendant(user.ID, parent.ID, grandchild.ID)
+		assert.NoError(t, err)
+		assert.True(t, is)
+	})
+
+	t.Run("sibling is not a descendant", func(t *testing.T) {
+		is, err := folderStore.IsDescendant(user.ID, parent.ID, sibling.ID)
+		assert.NoError(t, err)
+		assert.False(t, is)
+	})
+
+	t.Run("ancestor is not a descendant", func(t *testing.T) {
+		is, err := folderStore.IsDescendant(user.ID, child.ID, parent.ID)
+		assert.NoError(t, err)
+		assert.False(t, is)
+	})
+}
+
+func TestGetFolderTree(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	parent := createSubFolder(t, db, *folderStore, user, rootFolderId, "parent")
+	child := createSubFolder(t, db, *folderStore, user, parent.ID, "child")
+	grandchild := createSubFolder(t, db, *folderStore, user, child.ID, "grandchild")
+	another := createSubFolder(t, db, *folderStore, user, parent.ID, "another")
+	createSubFolder(t, db, *folderStore, user, rootFolderId, "sibling")
+
+	t.Run("returns the subtree parents first", func(t *testing.T) {
+		folders, err := folderStore.GetFolderTree(user.ID, parent.ID)
+		assert.NoError(t, err)
+
+		ids := []int64{}
+		for _, folder := range folders {
+			ids = append(ids, folder.ID)
+		}
+		assert.Equal(t, []int64{parent.ID, another.ID, child.ID, grandchild.ID}, ids)
+	})
+
+	t.Run("other users folder", func(t *testing.T) {
+		_, err := folderStore.GetFolderTree(user2.ID, parent.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
+
+func TestUpdateFolder(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Theo2", "example@gmail.com", "Password")
+
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	folder := createSubFolder(t, db, *folderStore, user, rootFolderId, "folder")
+	other := createSubFolder(t, db, *folderStore, user, rootFolderId, "other")
+
+	t.Run("renames folder", func(t *testing.T) {
+		updated, err := folderStore.UpdateFolder(user.ID, folder.ID, rootFolderId, "renamed")
+		assert.NoError(t, err)
+		assert.Equal(t, "renamed", updated.Name)
+		assert.Equal(t, rootFolderId, *updated.ParentID)
+	})
+
+	t.Run("moves folder", func(t *testing.T) {
+		updated, err := folderStore.UpdateFolder(user.ID, folder.ID, other.ID, "renamed")
+		assert.NoError(t, err)
+		assert.Equal(t, other.ID, *updated.ParentID)
+	})
+
+	t.Run("fails to move a folder below itself", func(t *testing.T) {
+		updated, err := folderStore.UpdateFolder(user.ID, other.ID, folder.ID, "other")
+		assert.ErrorIs(t, err, ErrFolderCycle)
+		assert.Nil(t, updated)
+	})
+
+	t.Run("fails on sibling name clash", func(t *testing.T) {
+		updated, err := folderStore.UpdateFolder(user.ID, folder.ID, rootFolderId, "other")
+		assert.ErrorIs(t, err, ErrDuplicateFolder)
+		assert.Nil(t, updated)
+	})
+
+	t.Run("fails for other user", func(t *testing.T) {
+		updated, err := folderStore.UpdateFolder(user2.ID, folder.ID, rootFolderId, "hacked")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, updated)
+	})
+}
+
+func TestDeleteFolder(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Theo2", "example@gmail.com", "Password")
+
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	parent := createSubFolder(t, db, *folderStore, user, rootFolderId, "parent")
+	child := createSubFolder(t, db, *folderStore, user, parent.ID, "child")
+	note, err := notesStore.CreateNote(user.ID, child.ID, "title", "content")
+	assert.NoError(t, err)
+
+	t.Run("refuses to delete root folder", func(t *testing.T) {
+		_, err := folderStore.DeleteFolder(user.ID, rootFolderId)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("fails for other user", func(t *testing.T) {
+		_, err := folderStore.DeleteFolder(user2.ID, parent.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("deletes folder with subfolders and notes", func(t *testing.T) {
+		_, err := folderStore.DeleteFolder(user.ID, parent.ID)
+		assert.NoError(t, err)
+
+		_, err = folderStore.GetFolder(user.ID, child.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, err = notesStore.GetNote(user.ID, note.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
+
+func TestPublishFolder(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Theo2", "example@gmail.com", "Password")
+
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	folder := createSubFolder(t, db, *folderStore, user, rootFolderId, "site")
+
+	t.Run("publishes and republishes", func(t *testing.T) {
+		first, err := folderStore.PublishFolder(user.ID, folder.ID)
+		assert.NoError(t, err)
+
+		second, err := folderStore.PublishFolder(user.ID, folder.ID)
+		assert.NoError(t, err)
+		assert.False(t, second.Before(first))
+	})
+
+	t.Run("fails for other user", func(t *testing.T) {
+		_, err := folderStore.PublishFolder(user2.ID, folder.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		err = folderStore.UnpublishFolder(user2.ID, folder.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("unpublishes", func(t *testing.T) {
+		err := folderStore.UnpublishFolder(user.ID, folder.ID)
+		assert.NoError(t, err)
+
+		err = folderStore.UnpublishFolder(user.ID, folder.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"database/sql"
 	"fmt"
+	"markdown-notes/migrations"
 	"testing"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
@@ -15,7 +16,7 @@ func SetupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("opening test db: %v", err)
 	}
 
-	err = Migrate(db, "../../migrations/")
+	err = MigrateFS(db, migrations.FS, ".")
 	if err != nil {
 		t.Fatalf("migrating test db error: %v", err)
 	}
@@ -24,7 +25,7 @@ func SetupTestDB(t *testing.T) *sql.DB {
 }
 
 func TruncateTables(t *testing.T, db *sql.DB) {
-	tables := []string{"tokens", "notes", "folders", "users"} // order matters (FK constraints)
+	tables := []string{"events", "tombstones", "workspace_invitations", "tokens", "shares", "published_folders", "folder_members", "orphaned_blobs", "attachment_thumbnails", "attachments", "note_links", "note_tags", "note_revisions", "notes", "folders", "workspace_members", "workspaces", "users"} // order matters (FK constraints)
 	for _, table := range tables {
 		_, err := db.Exec(fmt.Sprintf("TRUNCATE TABLE %s CASCADE", table))
 		if err != nil {
@@ -47,12 +48,15 @@ func CompareFolders(t *testing.T, f1 *Folder, f2 *Folder) {
 	t.Helper()
 	assert.Equal(t, f1.ID, f2.ID)
 	assert.Equal(t, f1.UserID, f2.UserID)
+	assert.Equal(t, f1.WorkspaceID, f2.WorkspaceID)
 	assert.Equal(t, f1.ParentID, f2.ParentID)
 	assert.Equal(t, f1.Name, f2.Name)
 	assert.Equal(t, f1.CreatedAt, f2.CreatedAt)
 	assert.Equal(t, f1.UpdatedAt, f2.UpdatedAt)
 }
 
+// CreateRootFolder creates the user's personal workspace and returns its root
+// folder.
 func CreateRootFolder(t *testing.T, db *sql.DB, folderStore PostgresFoldersStore, user *User) int64 {
 	t.Helper()
 
@@ -61,9 +65,9 @@ func CreateRootFolder(t *testing.T, db *sql.DB, folderStore PostgresFoldersStore
 		t.Fatalf("failed to begin tx: %v", err)
 	}
 
-	rootFolderId, err := folderStore.CreateFolderTx(tx, user.ID, nil, "root")
+	workspace, err := NewPostgresWorkspacesStore(db).CreateWorkspaceTx(tx, user.ID, "Personal", true)
 	if err != nil {
-		t.Fatalf("failed to create root folder: %v", err)
+		t.Fatalf("failed to create personal workspace: %v", err)
 	}
 
 	err = tx.Commit()
@@ -71,7 +75,7 @@ func CreateRootFolder(t *testing.T, db *sql.DB, folderStore PostgresFoldersStore
 		t.Fatalf("failed to commit tx: %v", err)
 	}
 
-	return rootFolderId
+	return workspace.RootFolderID
 }
 
 func CreateTestUser(t *testing.T, db *sql.DB, userStore UserStore, username string, email string, password string) *User {
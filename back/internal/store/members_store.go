@@ -0,0 +1,258 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+var (
+	ErrForbidden       = errors.New("you don't have permission to do that")
+	ErrDuplicateMember = errors.New("user is already a member of this folder")
+)
+
+// Role is what a user may do in a folder and everything below it. Viewers
+// read, editors also change notes and folders, owners also delete folders and
+// decide who else has access. Workspace admins are owners and members are
+// editors of every folder in the workspace, other users get roles through
+// folder_members.
+type Role string
+
+const (
+	RoleNone   Role = ""
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleOwner  Role = "owner"
+)
+
+var roleRanks = map[Role]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Can reports whether r allows what required allows.
+func (r Role) Can(required Role) bool {
+	return r != RoleNone && roleRanks[r] >= roleRanks[required]
+}
+
+// Check turns a role into the error for an action needing required:
+// sql.ErrNoRows without any access, so nothing leaks about what exists, and
+// ErrForbidden when the role is too weak.
+func (r Role) Check(required Role) error {
+	switch {
+	case r == RoleNone:
+		return sql.ErrNoRows
+	case !r.Can(required):
+		return ErrForbidden
+	default:
+		return nil
+	}
+}
+
+// Member is a user given a role on a folder.
+type Member struct {
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharedFolder is a folder from a workspace the user doesn't belong to, or
+// is only a guest in, that they were made a member of.
+type SharedFolder struct {
+	Folder
+	Role  Role   `json:"role"`
+	Owner string `json:"owner"`
+}
+
+type PostgresMembersStore struct {
+	db *sql.DB
+}
+
+func NewPostgresMembersStore(db *sql.DB) *PostgresMembersStore {
+	return &PostgresMembersStore{db: db}
+}
+
+// MembersStore manages who has been given access to a folder. The caller
+// checks the acting user may manage the folder.
+type MembersStore interface {
+	GetMembers(folder_id int64) ([]Member, error)
+	AddMember(folder_id int64, user_id int64, role Role) (*Member, error)
+	UpdateMember(folder_id int64, user_id int64, role Role) (*Member, error)
+	DeleteMember(folder_id int64, user_id int64) error
+	GetSharedFolders(user_id int64) ([]SharedFolder, error)
+}
+
+func (m *PostgresMembersStore) GetMembers(folder_id int64) ([]Member, error) {
+	query := `
+	SELECT u.id, u.username, m.role, m.created_at
+	FROM folder_members m
+	INNER JOIN users u ON u.id = m.user_id
+	WHERE m.folder_id = $1
+	ORDER BY u.username;
+	`
+
+	rows, err := m.db.Query(query, folder_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []Member{}
+
+	for rows.Next() {
+		var member Member
+		err = rows.Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func (m *PostgresMembersStore) AddMember(folder_id int64, user_id int64, role Role) (*Member, error) {
+	query := `
+	WITH added AS (
+		INSERT INTO folder_members (folder_id, user_id, role)
+		VALUES ($1, $2, $3)
+		RETURNING user_id, role, created_at
+	)
+	SELECT a.user_id, u.username, a.role, a.created_at
+	FROM added a
+	INNER JOIN users u ON u.id = a.user_id;
+	`
+
+	var member Member
+	err := m.db.QueryRow(query, folder_id, user_id, role).Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return nil, ErrDuplicateMember
+			}
+		}
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+func (m *PostgresMembersStore) UpdateMember(folder_id int64, user_id int64, role Role) (*Member, error) {
+	query := `
+	WITH updated AS (
+		UPDATE folder_members
+		SET role = $3
+		WHERE folder_id = $1 AND user_id = $2
+		RETURNING user_id, role, created_at
+	)
+	SELECT p.user_id, u.username, p.role, p.created_at
+	FROM updated p
+	INNER JOIN users u ON u.id = p.user_id;
+	`
+
+	var member Member
+	err := m.db.QueryRow(query, folder_id, user_id, role).Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+func (m *PostgresMembersStore) DeleteMember(folder_id int64, user_id int64) error {
+	query := `
+	DELETE FROM folder_members
+	WHERE folder_id = $1 AND user_id = $2;
+	`
+
+	result, err := m.db.Exec(query, folder_id, user_id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetSharedFolders lists the folders the user was made a member of outside
+// the workspaces they are a member or admin of, with the role they have there
+// once inherited roles are taken into account.
+func (m *PostgresMembersStore) GetSharedFolders(user_id int64) ([]SharedFolder, error) {
+	query := `
+	SELECT f.id, f.user_id, f.workspace_id, f.parent_id, f.name, f.created_at, f.updated_at, folder_role($1, f.id), o.username
+	FROM folder_members m
+	INNER JOIN folders f ON f.id = m.folder_id
+	INNER JOIN users o ON o.id = f.user_id
+	WHERE m.user_id = $1 AND NOT EXISTS (
+		SELECT 1
+		FROM workspace_members wm
+		WHERE wm.workspace_id = f.workspace_id AND wm.user_id = $1 AND wm.role <> 'guest'
+	)
+	ORDER BY o.username, f.name, f.id;
+	`
+
+	rows, err := m.db.Query(query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []SharedFolder{}
+
+	for rows.Next() {
+		var folder SharedFolder
+		err = rows.Scan(
+			&folder.ID,
+			&folder.UserID,
+			&folder.WorkspaceID,
+			&folder.ParentID,
+			&folder.Name,
+			&folder.CreatedAt,
+			&folder.UpdatedAt,
+			&folder.Role,
+			&folder.Owner,
+		)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// scanRole reads a role that is NULL when the user has no access.
+func scanRole(row *sql.Row) (Role, error) {
+	var role sql.NullString
+	err := row.Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RoleNone, nil
+	}
+	if err != nil {
+		return RoleNone, err
+	}
+
+	return Role(role.String), nil
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleCheck(t *testing.T) {
+	assert.NoError(t, RoleOwner.Check(RoleEditor))
+	assert.NoError(t, RoleEditor.Check(RoleEditor))
+	assert.ErrorIs(t, RoleViewer.Check(RoleEditor), ErrForbidden)
+	assert.ErrorIs(t, RoleEditor.Check(RoleOwner), ErrForbidden)
+	assert.ErrorIs(t, RoleNone.Check(RoleViewer), sql.ErrNoRows)
+
+	assert.True(t, RoleViewer.Valid())
+	assert.False(t, RoleNone.Valid())
+	assert.False(t, Role("admin").Valid())
+}
+
+func TestMembers(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	membersStore := NewPostgresMembersStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	tagsStore := NewPostgresTagsStore(db)
+
+	owner := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	member := CreateTestUser(t, db, userStore, "Theo2", "example@gmail.com", "Password")
+
+	rootFolderId := CreateRootFolder(t, db, *folderStore, owner)
+	CreateRootFolder(t, db, *folderStore, member)
+	projects := createSubFolder(t, db, *folderStore, owner, rootFolderId, "Projects")
+	nested := createSubFolder(t, db, *folderStore, owner, projects.ID, "Alpha")
+
+	plan, err := notesStore.CreateNote(owner.ID, nested.ID, "Plan", "#work the plan")
+	assert.NoError(t, err)
+	secret, err := notesStore.CreateNote(owner.ID, rootFolderId, "Secret", "#work hidden")
+	assert.NoError(t, err)
+
+	t.Run("no access before being added", func(t *testing.T) {
+		_, err := notesStore.GetNote(member.ID, plan.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("viewers read the subtree", func(t *testing.T) {
+		added, err := membersStore.AddMember(projects.ID, member.ID, RoleViewer)
+		assert.NoError(t, err)
+		assert.Equal(t, "Theo2", added.Username)
+		assert.Equal(t, RoleViewer, added.Role)
+
+		_, err = membersStore.AddMember(projects.ID, member.ID, RoleEditor)
+		assert.ErrorIs(t, err, ErrDuplicateMember)
+
+		role, err := folderStore.FolderRole(member.ID, nested.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, RoleViewer, role)
+
+		role, err = folderStore.FolderRole(member.ID, rootFolderId)
+		assert.NoError(t, err)
+		assert.Equal(t, RoleNone, role)
+
+		role, err = notesStore.NoteRole(member.ID, plan.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, RoleViewer, role)
+
+		note, err := notesStore.GetNote(member.ID, plan.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Plan", note.Title)
+
+		_, err = notesStore.GetNote(member.ID, secret.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, err = notesStore.UpdateNote(member.ID, plan.ID, "changed")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		tags, err := tagsStore.GetTags(member.ID, 0, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []TagCount{{Tag: "work", Count: 1}}, tags)
+	})
+
+	t.Run("editors change notes in the owners tree", func(t *testing.T) {
+		updated, err := membersStore.UpdateMember(projects.ID, member.ID, RoleEditor)
+		assert.NoError(t, err)
+		assert.Equal(t, RoleEditor, updated.Role)
+
+		_, err = notesStore.UpdateNote(member.ID, plan.ID, "changed")
+		assert.NoError(t, err)
+
+		folder, err := folderStore.CreateFolder(member.ID, nested.ID, "Beta")
+		assert.NoError(t, err)
+		assert.Equal(t, owner.ID, folder.UserID)
+
+		_, err = folderStore.CreateFolder(member.ID, rootFolderId, "Nope")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, err = folderStore.DeleteFolder(member.ID, folder.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("lists members and shared folders", func(t *testing.T) {
+		members, err := membersStore.GetMembers(projects.ID)
+		assert.NoError(t, err)
+		assert.Len(t, members, 1)
+		assert.Equal(t, member.ID, members[0].UserID)
+
+		shared, err := membersStore.GetSharedFolders(member.ID)
+		assert.NoError(t, err)
+		assert.Len(t, shared, 1)
+		assert.Equal(t, projects.ID, shared[0].ID)
+		assert.Equal(t, RoleEditor, shared[0].Role)
+		assert.Equal(t, "Theo", shared[0].Owner)
+
+		shared, err = membersStore.GetSharedFolders(owner.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, shared)
+	})
+
+	t.Run("removing a member takes access away", func(t *testing.T) {
+		err := membersStore.DeleteMember(projects.ID, member.ID)
+		assert.NoError(t, err)
+
+		err = membersStore.DeleteMember(projects.ID, member.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, err = notesStore.GetNote(member.ID, plan.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	// Registered here rather than in the migrations package, which the store
+	// imports to migrate test databases: resolving links takes saveLinks.
+	goose.AddNamedMigrationContext("00024_backfill_note_links.go", upBackfillNoteLinks, downBackfillNoteLinks)
+}
+
+// upBackfillNoteLinks indexes the links of notes written before note_links
+// existed, the same way saving each note would. Notes are read in batches to
+// keep memory bounded on large databases.
+func upBackfillNoteLinks(ctx context.Context, tx *sql.Tx) error {
+	const batchSize = 500
+
+	var lastID int64
+	for {
+		rows, err := tx.QueryContext(ctx, `
+		SELECT id, folder_id, title, note
+		FROM notes
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2;
+		`, lastID, batchSize)
+		if err != nil {
+			return err
+		}
+
+		var batch []Note
+		for rows.Next() {
+			var note Note
+			err = rows.Scan(&note.ID, &note.FolderID, &note.Title, &note.Note)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, note)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range batch {
+			err = saveLinks(tx, &batch[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// downBackfillNoteLinks leaves the links in place, they are what saving each
+// note would have produced anyway.
+func downBackfillNoteLinks(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,699 @@
+package store
+
+import (
+	"database/sql"
+	"path"
+	"strconv"
+	"strings"
+
+	"markdown-notes/internal/markdown"
+)
+
+type LinkedNote struct {
+	ID       int64  `json:"id"`
+	FolderID int64  `json:"folder_id"`
+	Title    string `json:"title"`
+}
+
+// Outlink is a link written in a note, Note is nil while the link is dangling.
+type Outlink struct {
+	Kind   string      `json:"kind"`
+	Target string      `json:"target"`
+	Text   string      `json:"text"`
+	Note   *LinkedNote `json:"note"`
+}
+
+// Backlink is a note linking to another one, with the text of its link.
+type Backlink struct {
+	LinkedNote
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// GraphNode is a note in the link graph.
+type GraphNode struct {
+	ID         int64    `json:"id"`
+	Title      string   `json:"title"`
+	FolderID   int64    `json:"folder_id"`
+	FolderPath string   `json:"folder_path"`
+	Tags       []string `json:"tags"`
+}
+
+// GraphEdge is a resolved link between two notes in the link graph.
+type GraphEdge struct {
+	Source int64  `json:"source"`
+	Target int64  `json:"target"`
+	Kind   string `json:"kind"`
+}
+
+type PostgresNoteLinksStore struct {
+	db *sql.DB
+}
+
+func NewPostgresNoteLinksStore(db *sql.DB) *PostgresNoteLinksStore {
+	return &PostgresNoteLinksStore{db: db}
+}
+
+type NoteLinksStore interface {
+	GetOutlinks(user_id int64, note_id int64) ([]Outlink, error)
+	GetFoldersOutlinks(user_id int64, folder_ids []int64) (map[int64][]Outlink, error)
+	GetBacklinks(user_id int64, note_id int64) ([]Backlink, error)
+	GetGraph(user_id int64, folder_id int64) ([]GraphNode, []GraphEdge, error)
+}
+
+func (l *PostgresNoteLinksStore) GetOutlinks(user_id int64, note_id int64) ([]Outlink, error) {
+	query := `
+	SELECT l.kind, l.target, l.text, t.id, t.folder_id, t.title
+	FROM note_links l
+	INNER JOIN notes s ON s.id = l.source_note_id
+	LEFT JOIN notes t ON t.id = l.target_note_id AND t.deleted_at IS NULL
+	WHERE s.id = $2 AND s.deleted_at IS NULL AND folder_role($1, s.folder_id) IS NOT NULL
+	ORDER BY l.id;
+	`
+
+	rows, err := l.db.Query(query, user_id, note_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []Outlink{}
+
+	for rows.Next() {
+		var (
+			link     Outlink
+			id       sql.NullInt64
+			folderID sql.NullInt64
+			title    sql.NullString
+		)
+		err = rows.Scan(&link.Kind, &link.Target, &link.Text, &id, &folderID, &title)
+		if err != nil {
+			return nil, err
+		}
+
+		if id.Valid {
+			link.Note = &LinkedNote{ID: id.Int64, FolderID: folderID.Int64, Title: title.String}
+		}
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+func (l *PostgresNoteLinksStore) GetBacklinks(user_id int64, note_id int64) ([]Backlink, error) {
+	query := `
+	SELECT s.id, s.folder_id, s.title, l.kind, l.text
+	FROM note_links l
+	INNER JOIN notes s ON s.id = l.source_note_id
+	INNER JOIN notes t ON t.id = l.target_note_id
+	WHERE t.id = $2 AND folder_role($1, t.folder_id) IS NOT NULL
+		AND s.folder_id IN (SELECT folder_id FROM accessible_folders($1))
+		AND s.deleted_at IS NULL AND t.deleted_at IS NULL
+	ORDER BY s.title, l.id;
+	`
+
+	rows, err := l.db.Query(query, user_id, note_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []Backlink{}
+
+	for rows.Next() {
+		var link Backlink
+		err = rows.Scan(&link.ID, &link.FolderID, &link.Title, &link.Kind, &link.Text)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// GetGraph returns the notes in the subtree of folder_id, or of the root of
+// the user's personal workspace when folder_id is 0, with the links between
+// them. Returns sql.ErrNoRows if the user has no access to folder_id.
+func (l *PostgresNoteLinksStore) GetGraph(user_id int64, folder_id int64) ([]GraphNode, []GraphEdge, error) {
+	// the graph is drawn from the workspace the folder is in, which the user
+	// may only have been given a part of
+	query := `
+	SELECT f.id, f.workspace_id, folder_role($1, r.id) IS NOT NULL
+	FROM folders f
+	INNER JOIN folders r ON r.workspace_id = f.workspace_id AND r.parent_id IS NULL
+	INNER JOIN workspaces w ON w.id = f.workspace_id
+	WHERE folder_role($1, f.id) IS NOT NULL
+		AND (CASE WHEN $2 = 0 THEN f.id = r.id AND w.personal_user_id = $1 ELSE f.id = $2 END);
+	`
+
+	var (
+		workspace_id int64
+		seesRoot     bool
+	)
+	err := l.db.QueryRow(query, user_id, folder_id).Scan(&folder_id, &workspace_id, &seesRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tree, err := loadFolders(l.db, workspace_id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// paths start at the folder shared with the user when they can't see the
+	// whole workspace, the folders above it are none of their business
+	hidden := 0
+	if !seesRoot {
+		hidden = len(tree.folderPath(folder_id)) - 1
+	}
+
+	query = `
+	WITH RECURSIVE scope AS (
+		SELECT id
+		FROM folders
+		WHERE id = $1
+		UNION
+		SELECT f.id
+		FROM folders f
+		INNER JOIN scope s ON f.parent_id = s.id
+	)
+	SELECT n.id, n.title, n.folder_id, COALESCE(string_agg(nt.tag, ' ' ORDER BY nt.tag), '')
+	FROM notes n
+	LEFT JOIN note_tags nt ON nt.note_id = n.id
+	WHERE n.deleted_at IS NULL AND n.folder_id IN (SELECT id FROM scope)
+	GROUP BY n.id
+	ORDER BY n.id;
+	`
+
+	rows, err := l.db.Query(query, folder_id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	nodes := []GraphNode{}
+	inScope := map[int64]bool{}
+
+	for rows.Next() {
+		var (
+			node GraphNode
+			tags string
+		)
+		err = rows.Scan(&node.ID, &node.Title, &node.FolderID, &tags)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		node.FolderPath = "/" + strings.Join(tree.folderPath(node.FolderID)[hidden:], "/")
+		node.Tags = strings.Fields(tags)
+		nodes = append(nodes, node)
+		inScope[node.ID] = true
+	}
+
+	query = `
+	SELECT DISTINCT l.source_note_id, l.target_note_id, l.kind
+	FROM note_links l
+	INNER JOIN notes s ON s.id = l.source_note_id
+	INNER JOIN notes t ON t.id = l.target_note_id
+	INNER JOIN folders f ON f.id = s.folder_id
+	WHERE f.workspace_id = $1 AND s.deleted_at IS NULL AND t.deleted_at IS NULL
+	ORDER BY l.source_note_id, l.target_note_id;
+	`
+
+	edgeRows, err := l.db.Query(query, workspace_id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer edgeRows.Close()
+
+	edges := []GraphEdge{}
+
+	for edgeRows.Next() {
+		var edge GraphEdge
+		err = edgeRows.Scan(&edge.Source, &edge.Target, &edge.Kind)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if inScope[edge.Source] && inScope[edge.Target] {
+			edges = append(edges, edge)
+		}
+	}
+
+	return nodes, edges, nil
+}
+
+// GetFoldersOutlinks returns the outlinks of every note in the folders, by
+// note id. Notes without links are left out.
+func (l *PostgresNoteLinksStore) GetFoldersOutlinks(user_id int64, folder_ids []int64) (map[int64][]Outlink, error) {
+	query := `
+	SELECT l.source_note_id, l.kind, l.target, l.text, t.id, t.folder_id, t.title
+	FROM note_links l
+	INNER JOIN notes s ON s.id = l.source_note_id
+	LEFT JOIN notes t ON t.id = l.target_note_id AND t.deleted_at IS NULL
+	WHERE s.folder_id = ANY($2::BIGINT[]) AND s.deleted_at IS NULL
+		AND folder_role($1, s.folder_id) IS NOT NULL
+	ORDER BY l.source_note_id, l.id;
+	`
+
+	rows, err := l.db.Query(query, user_id, folder_ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := map[int64][]Outlink{}
+
+	for rows.Next() {
+		var (
+			note_id  int64
+			link     Outlink
+			id       sql.NullInt64
+			folderID sql.NullInt64
+			title    sql.NullString
+		)
+		err = rows.Scan(&note_id, &link.Kind, &link.Target, &link.Text, &id, &folderID, &title)
+		if err != nil {
+			return nil, err
+		}
+
+		if id.Valid {
+			link.Note = &LinkedNote{ID: id.Int64, FolderID: folderID.Int64, Title: title.String}
+		}
+		links[note_id] = append(links[note_id], link)
+	}
+
+	return links, rows.Err()
+}
+
+// saveLinks replaces the outgoing links of a note with the ones found in its
+// current content, resolving them against the notes in the same workspace, and
+// points dangling links elsewhere at this note if they now resolve to it.
+func saveLinks(tx *sql.Tx, note *Note) error {
+	query := `
+	DELETE FROM note_links
+	WHERE source_note_id = $1;
+	`
+
+	// links only resolve within the workspace the note is in
+	var workspace_id int64
+	err := tx.QueryRow(`SELECT workspace_id FROM folders WHERE id = $1;`, note.FolderID).Scan(&workspace_id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(query, note.ID)
+	if err != nil {
+		return err
+	}
+
+	err = resolveDanglingLinks(tx, workspace_id, note)
+	if err != nil {
+		return err
+	}
+
+	links := markdown.ExtractLinks(note.Note)
+	if len(links) == 0 {
+		return nil
+	}
+
+	var (
+		titles []string
+		ids    []int64
+	)
+	for _, link := range links {
+		if link.Kind == markdown.LinkKindID {
+			if id, err := strconv.ParseInt(link.Target, 10, 64); err == nil {
+				ids = append(ids, id)
+			}
+			continue
+		}
+		titles = append(titles, linkTitle(link.Target))
+	}
+
+	tree, err := loadLinkTree(tx, workspace_id, titles, ids, []int64{note.FolderID})
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO note_links (source_note_id, target_note_id, kind, target, text)
+	VALUES ($1, $2, $3, $4, $5);
+	`
+
+	for _, link := range links {
+		var target_note_id *int64
+		if id, ok := tree.resolve(link, note.FolderID); ok {
+			target_note_id = &id
+		}
+
+		_, err = tx.Exec(query, note.ID, target_note_id, link.Kind, link.Target, link.Text)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveDanglingLinks points the dangling links in the workspace that name
+// the note's title, whether on its own, after folders or as a markdown path,
+// or its id at the note when that is where they resolve to now.
+func resolveDanglingLinks(tx *sql.Tx, workspace_id int64, note *Note) error {
+	query := `
+	SELECT l.id, l.kind, l.target, s.folder_id
+	FROM note_links l
+	INNER JOIN notes s ON s.id = l.source_note_id
+	INNER JOIN folders f ON f.id = s.folder_id
+	WHERE f.workspace_id = $1 AND l.target_note_id IS NULL
+		AND (CASE WHEN l.kind = $4
+			THEN l.target = $3
+			ELSE lower(l.target) = lower($2) OR right(lower(l.target), char_length($2) + 1) = '/' || lower($2)
+		END);
+	`
+
+	rows, err := tx.Query(query, workspace_id, note.Title, strconv.FormatInt(note.ID, 10), markdown.LinkKindID)
+	if err != nil {
+		return err
+	}
+
+	type danglingLink struct {
+		id       int64
+		link     markdown.Link
+		folderID int64
+	}
+
+	var dangling []danglingLink
+	for rows.Next() {
+		var d danglingLink
+		err = rows.Scan(&d.id, &d.link.Kind, &d.link.Target, &d.folderID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		dangling = append(dangling, d)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(dangling) == 0 {
+		return nil
+	}
+
+	folderIDs := make([]int64, 0, len(dangling))
+	for _, d := range dangling {
+		folderIDs = append(folderIDs, d.folderID)
+	}
+
+	tree, err := loadLinkTree(tx, workspace_id, []string{note.Title}, []int64{note.ID}, folderIDs)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	UPDATE note_links
+	SET target_note_id = $2
+	WHERE id = $1;
+	`
+
+	for _, d := range dangling {
+		if id, ok := tree.resolve(d.link, d.folderID); !ok || id != note.ID {
+			continue
+		}
+
+		_, err = tx.Exec(query, d.id, note.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkTitle is the title a link target names, its last path segment.
+func linkTitle(target string) string {
+	return path.Base(strings.Trim(target, "/"))
+}
+
+type linkTreeFolder struct {
+	parentID *int64
+	name     string
+}
+
+type linkTreeNote struct {
+	id       int64
+	folderID int64
+	title    string
+}
+
+// linkTree is the part of a workspace's folders and notes needed to work out
+// which note a link points at.
+type linkTree struct {
+	folders map[int64]linkTreeFolder
+	notes   []linkTreeNote
+}
+
+// queryer is what loadLinkTree needs from either a *sql.DB or a *sql.Tx.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// loadFolders loads every folder of a workspace, without notes.
+func loadFolders(tx queryer, workspace_id int64) (*linkTree, error) {
+	tree := &linkTree{folders: map[int64]linkTreeFolder{}}
+
+	rows, err := tx.Query(`SELECT id, parent_id, name FROM folders WHERE workspace_id = $1;`, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id     int64
+			folder linkTreeFolder
+		)
+		if err = rows.Scan(&id, &folder.parentID, &folder.name); err != nil {
+			return nil, err
+		}
+		tree.folders[id] = folder
+	}
+
+	return tree, rows.Err()
+}
+
+// loadLinkTree loads the notes of a workspace with one of the titles or ids,
+// and the folders from them and from folder_ids up to the root. That is all
+// resolve needs for links naming those titles or ids from those folders: any
+// folder a link passes through on its way to one of the notes is above it.
+func loadLinkTree(tx queryer, workspace_id int64, titles []string, ids []int64, folder_ids []int64) (*linkTree, error) {
+	tree := &linkTree{folders: map[int64]linkTreeFolder{}}
+
+	lowered := make([]string, 0, len(titles))
+	for _, title := range titles {
+		lowered = append(lowered, strings.ToLower(title))
+	}
+
+	query := `
+	SELECT n.id, n.folder_id, n.title
+	FROM notes n
+	INNER JOIN folders f ON f.id = n.folder_id
+	WHERE f.workspace_id = $1 AND n.deleted_at IS NULL
+		AND (lower(n.title) = ANY($2::TEXT[]) OR n.id = ANY($3::BIGINT[]));
+	`
+
+	noteRows, err := tx.Query(query, workspace_id, lowered, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for noteRows.Next() {
+		var note linkTreeNote
+		if err = noteRows.Scan(&note.id, &note.folderID, &note.title); err != nil {
+			noteRows.Close()
+			return nil, err
+		}
+		tree.notes = append(tree.notes, note)
+		folder_ids = append(folder_ids, note.folderID)
+	}
+	noteRows.Close()
+	if err = noteRows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	WITH RECURSIVE chain AS (
+		SELECT id, parent_id, name
+		FROM folders
+		WHERE id = ANY($1::BIGINT[])
+		UNION
+		SELECT f.id, f.parent_id, f.name
+		FROM folders f
+		INNER JOIN chain c ON f.id = c.parent_id
+	)
+	SELECT id, parent_id, name FROM chain;
+	`
+
+	rows, err := tx.Query(query, folder_ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id     int64
+			folder linkTreeFolder
+		)
+		if err = rows.Scan(&id, &folder.parentID, &folder.name); err != nil {
+			return nil, err
+		}
+		tree.folders[id] = folder
+	}
+
+	return tree, rows.Err()
+}
+
+// folderPath lists the folder names from below the root down to folder_id.
+func (t *linkTree) folderPath(folder_id int64) []string {
+	var names []string
+
+	for {
+		folder, ok := t.folders[folder_id]
+		if !ok || folder.parentID == nil {
+			break
+		}
+		names = append([]string{folder.name}, names...)
+		folder_id = *folder.parentID
+	}
+
+	return names
+}
+
+func (t *linkTree) root(folder_id int64) int64 {
+	for {
+		folder, ok := t.folders[folder_id]
+		if !ok || folder.parentID == nil {
+			return folder_id
+		}
+		folder_id = *folder.parentID
+	}
+}
+
+func (t *linkTree) child(folder_id int64, name string) (int64, bool) {
+	for id, folder := range t.folders {
+		if folder.parentID != nil && *folder.parentID == folder_id && strings.EqualFold(folder.name, name) {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
+
+// resolve finds the note a link points at from a note in source_folder_id.
+//
+// Markdown links are paths, relative to the source folder unless they start
+// with a slash. Wiki links name a note by title, optionally prefixed with the
+// folders it sits in, and when several notes qualify the one next to the
+// source wins, then the one closest to the root. Links by id point at that
+// note as long as it is in the workspace.
+func (t *linkTree) resolve(link markdown.Link, source_folder_id int64) (int64, bool) {
+	if link.Kind == markdown.LinkKindID {
+		id, err := strconv.ParseInt(link.Target, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		for _, note := range t.notes {
+			if note.id == id {
+				return id, true
+			}
+		}
+
+		return 0, false
+	}
+
+	if link.Kind == markdown.LinkKindMarkdown {
+		folder_id := source_folder_id
+		target := link.Target
+		if strings.HasPrefix(target, "/") {
+			folder_id = t.root(source_folder_id)
+		}
+
+		// cleaning leaves .. only at the start, so the walk never goes down
+		// into a folder just to come back up, which may not be loaded
+		dir, title := path.Split(path.Clean(strings.Trim(target, "/")))
+		for _, segment := range strings.Split(dir, "/") {
+			switch segment {
+			case "", ".":
+			case "..":
+				if parent := t.folders[folder_id].parentID; parent != nil {
+					folder_id = *parent
+				}
+			default:
+				child, ok := t.child(folder_id, segment)
+				if !ok {
+					return 0, false
+				}
+				folder_id = child
+			}
+		}
+
+		for _, note := range t.notes {
+			if note.folderID == folder_id && strings.EqualFold(note.title, title) {
+				return note.id, true
+			}
+		}
+
+		return 0, false
+	}
+
+	segments := strings.Split(strings.Trim(link.Target, "/"), "/")
+	title := segments[len(segments)-1]
+	dirs := segments[:len(segments)-1]
+
+	var (
+		best     int64
+		bestRank int
+		found    bool
+	)
+	for _, note := range t.notes {
+		if !strings.EqualFold(note.title, title) {
+			continue
+		}
+
+		folders := t.folderPath(note.folderID)
+		if !hasFolderSuffix(folders, dirs) {
+			continue
+		}
+
+		rank := len(folders)
+		if note.folderID == source_folder_id {
+			rank = -1
+		}
+
+		if !found || rank < bestRank || rank == bestRank && note.id < best {
+			best, bestRank, found = note.id, rank, true
+		}
+	}
+
+	return best, found
+}
+
+func hasFolderSuffix(folders []string, suffix []string) bool {
+	if len(suffix) > len(folders) {
+		return false
+	}
+
+	offset := len(folders) - len(suffix)
+	for i, name := range suffix {
+		if !strings.EqualFold(folders[offset+i], name) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"markdown-notes/internal/markdown"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkTreeResolve(t *testing.T) {
+	root := int64(1)
+	projects := int64(2)
+	alpha := int64(3)
+	archive := int64(4)
+
+	tree := &linkTree{
+		folders: map[int64]linkTreeFolder{
+			root:     {parentID: nil, name: "root"},
+			projects: {parentID: &root, name: "projects"},
+			alpha:    {parentID: &projects, name: "alpha"},
+			archive:  {parentID: &root, name: "archive"},
+		},
+		notes: []linkTreeNote{
+			{id: 10, folderID: root, title: "Index"},
+			{id: 11, folderID: alpha, title: "Goals"},
+			{id: 12, folderID: archive, title: "Goals"},
+			{id: 13, folderID: projects, title: "Overview"},
+			{id: 14, folderID: alpha, title: "Index"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		link   markdown.Link
+		source int64
+		want   int64
+		found  bool
+	}{
+		{name: "wiki link by title", link: markdown.Link{Kind: markdown.LinkKindWiki, Target: "overview"}, source: root, want: 13, found: true},
+		{name: "wiki link prefers the source folder", link: markdown.Link{Kind: markdown.LinkKindWiki, Target: "Index"}, source: alpha, want: 14, found: true},
+		{name: "wiki link prefers notes closest to the root", link: markdown.Link{Kind: markdown.LinkKindWiki, Target: "Index"}, source: archive, want: 10, found: true},
+		{name: "wiki link with folder", link: markdown.Link{Kind: markdown.LinkKindWiki, Target: "archive/Goals"}, source: alpha, want: 12, found: true},
+		{name: "wiki link to unknown title", link: markdown.Link{Kind: markdown.LinkKindWiki, Target: "Missing"}, source: root, found: false},
+		{name: "relative markdown link", link: markdown.Link{Kind: markdown.LinkKindMarkdown, Target: "alpha/Goals"}, source: projects, want: 11, found: true},
+		{name: "markdown link up the tree", link: markdown.Link{Kind: markdown.LinkKindMarkdown, Target: "../../archive/Goals"}, source: alpha, want: 12, found: true},
+		{name: "absolute markdown link", link: markdown.Link{Kind: markdown.LinkKindMarkdown, Target: "/Index"}, source: alpha, want: 10, found: true},
+		{name: "markdown link to missing folder", link: markdown.Link{Kind: markdown.LinkKindMarkdown, Target: "nowhere/Goals"}, source: root, found: false},
+		{name: "link by id", link: markdown.Link{Kind: markdown.LinkKindID, Target: "12"}, source: root, want: 12, found: true},
+		{name: "link by unknown id", link: markdown.Link{Kind: markdown.LinkKindID, Target: "99"}, source: root, found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, found := tree.resolve(tt.link, tt.source)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.want, id)
+		})
+	}
+}
+
+func TestNoteLinks(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	linksStore := NewPostgresNoteLinksStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+
+	target, err := notesStore.CreateNote(user.ID, rootFolderId, "Target", "")
+	assert.NoError(t, err)
+	source, err := notesStore.CreateNote(user.ID, rootFolderId, "Source", "see [[Target|the target]] and [[Later]]")
+	assert.NoError(t, err)
+
+	t.Run("lists resolved and dangling outlinks", func(t *testing.T) {
+		links, err := linksStore.GetOutlinks(user.ID, source.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(links))
+		assert.Equal(t, target.ID, links[0].Note.ID)
+		assert.Equal(t, "the target", links[0].Text)
+		assert.Nil(t, links[1].Note)
+		assert.Equal(t, "Later", links[1].Target)
+	})
+
+	t.Run("lists the outlinks of every note in folders", func(t *testing.T) {
+		links, err := linksStore.GetFoldersOutlinks(user.ID, []int64{rootFolderId})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(links))
+		if assert.Equal(t, 2, len(links[source.ID])) {
+			assert.Equal(t, target.ID, links[source.ID][0].Note.ID)
+			assert.Nil(t, links[source.ID][1].Note)
+		}
+
+		links, err = linksStore.GetFoldersOutlinks(user2.ID, []int64{rootFolderId})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(links))
+	})
+
+	t.Run("lists backlinks", func(t *testing.T) {
+		links, err := linksStore.GetBacklinks(user.ID, target.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(links))
+		assert.Equal(t, source.ID, links[0].ID)
+	})
+
+	t.Run("dangling links resolve once the note exists", func(t *testing.T) {
+		later, err := notesStore.CreateNote(user.ID, rootFolderId, "Later", "")
+		assert.NoError(t, err)
+
+		links, err := linksStore.GetBacklinks(user.ID, later.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(links))
+		assert.Equal(t, source.ID, links[0].ID)
+	})
+
+	t.Run("dangling links with folders resolve once the note exists", func(t *testing.T) {
+		linking, err := notesStore.CreateNote(user.ID, rootFolderId, "Linking", "see [[plans/Deep|deep]] and [deep](plans/Deep.md)")
+		assert.NoError(t, err)
+
+		plans, err := folderStore.CreateFolder(user.ID, rootFolderId, "Plans")
+		assert.NoError(t, err)
+		deep, err := notesStore.CreateNote(user.ID, plans.ID, "Deep", "")
+		assert.NoError(t, err)
+
+		links, err := linksStore.GetBacklinks(user.ID, deep.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(links))
+		for _, link := range links {
+			assert.Equal(t, linking.ID, link.ID)
+		}
+	})
+
+	t.Run("links by id resolve, also to notes created after them", func(t *testing.T) {
+		tx, err := db.Begin()
+		assert.NoError(t, err)
+		defer tx.Rollback()
+
+		ids, err := notesStore.ReserveNoteIDsTx(tx, 2)
+		assert.NoError(t, err)
+
+		first, err := notesStore.CreateReservedNoteTx(tx, user.ID, ids[0], rootFolderId, "First", "[next]("+markdown.NoteURL(ids[1])+")")
+		assert.NoError(t, err)
+		assert.Equal(t, ids[0], first.ID)
+		_, err = notesStore.CreateReservedNoteTx(tx, user.ID, ids[1], rootFolderId, "Second", "[back]("+markdown.NoteURL(ids[0])+"#top)")
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		links, err := linksStore.GetOutlinks(user.ID, ids[0])
+		assert.NoError(t, err)
+		if assert.Equal(t, 1, len(links)) && assert.NotNil(t, links[0].Note) {
+			assert.Equal(t, ids[1], links[0].Note.ID)
+			assert.Equal(t, markdown.LinkKindID, links[0].Kind)
+		}
+
+		links, err = linksStore.GetOutlinks(user.ID, ids[1])
+		assert.NoError(t, err)
+		if assert.Equal(t, 1, len(links)) && assert.NotNil(t, links[0].Note) {
+			assert.Equal(t, ids[0], links[0].Note.ID)
+		}
+	})
+
+	t.Run("backfills the links of notes saved before they were indexed", func(t *testing.T) {
+		_, err := db.Exec(`DELETE FROM note_links;`)
+		assert.NoError(t, err)
+
+		tx, err := db.Begin()
+		assert.NoError(t, err)
+		err = upBackfillNoteLinks(context.Background(), tx)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+
+		links, err := linksStore.GetBacklinks(user.ID, target.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(links))
+		assert.Equal(t, source.ID, links[0].ID)
+	})
+
+	t.Run("trashed targets show up as dangling", func(t *testing.T) {
+		_, err := notesStore.TrashNote(user.ID, target.ID)
+		assert.NoError(t, err)
+
+		links, err := linksStore.GetOutlinks(user.ID, source.ID)
+		assert.NoError(t, err)
+		assert.Nil(t, links[0].Note)
+	})
+
+	t.Run("does not return other user's links", func(t *testing.T) {
+		links, err := linksStore.GetOutlinks(user2.ID, source.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(links))
+	})
+}
+
+func TestGetGraph(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	linksStore := NewPostgresNoteLinksStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	sub, err := folderStore.CreateFolder(user.ID, rootFolderId, "sub")
+	assert.NoError(t, err)
+
+	a, err := notesStore.CreateNote(user.ID, rootFolderId, "A", "#topic links to [[B]] and [[Missing]]")
+	assert.NoError(t, err)
+	b, err := notesStore.CreateNote(user.ID, sub.ID, "B", "back to [A](../A.md) and [[C]]")
+	assert.NoError(t, err)
+	c, err := notesStore.CreateNote(user.ID, sub.ID, "C", "")
+	assert.NoError(t, err)
+
+	t.Run("returns the whole graph", func(t *testing.T) {
+		nodes, edges, err := linksStore.GetGraph(user.ID, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(nodes))
+		assert.Equal(t, a.ID, nodes[0].ID)
+		assert.Equal(t, "/", nodes[0].FolderPath)
+		assert.Equal(t, []string{"topic"}, nodes[0].Tags)
+		assert.Equal(t, "/sub", nodes[1].FolderPath)
+		assert.Equal(t, []GraphEdge{
+			{Source: a.ID, Target: b.ID, Kind: "wiki"},
+			{Source: b.ID, Target: a.ID, Kind: "markdown"},
+			{Source: b.ID, Target: c.ID, Kind: "wiki"},
+		}, edges)
+	})
+
+	t.Run("scopes to a folder subtree", func(t *testing.T) {
+		nodes, edges, err := linksStore.GetGraph(user.ID, sub.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(nodes))
+		assert.Equal(t, []GraphEdge{{Source: b.ID, Target: c.ID, Kind: "wiki"}}, edges)
+	})
+
+	t.Run("leaves out trashed notes", func(t *testing.T) {
+		_, err := notesStore.TrashNote(user.ID, c.ID)
+		assert.NoError(t, err)
+
+		nodes, edges, err := linksStore.GetGraph(user.ID, sub.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(nodes))
+		assert.Empty(t, edges)
+	})
+
+	t.Run("other users folder", func(t *testing.T) {
+		_, _, err := linksStore.GetGraph(user2.ID, sub.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
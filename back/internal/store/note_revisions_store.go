@@ -0,0 +1,218 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+// DefaultRevisionWindow is how long after a revision is started that further
+// saves keep being folded into it rather than opening a new one.
+const DefaultRevisionWindow = 2 * time.Minute
+
+type NoteRevision struct {
+	ID        int64     `json:"id"`
+	NoteID    int64     `json:"note_id"`
+	Revision  int64     `json:"revision"`
+	Title     string    `json:"title"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PostgresNoteRevisionsStore struct {
+	db *sql.DB
+}
+
+func NewPostgresNoteRevisionsStore(db *sql.DB) *PostgresNoteRevisionsStore {
+	return &PostgresNoteRevisionsStore{db: db}
+}
+
+type NoteRevisionsStore interface {
+	GetRevisions(user_id int64, note_id int64) ([]NoteRevision, error)
+	GetRevision(user_id int64, note_id int64, revision int64) (*NoteRevision, error)
+	RestoreRevision(user_id int64, note_id int64, revision int64) (*Note, error)
+}
+
+// GetRevisions lists the history of a note, newest first. The note bodies are
+// left out, use GetRevision to fetch a single version in full. It fails with
+// sql.ErrNoRows when the note doesn't exist or the user has no access to it.
+func (r *PostgresNoteRevisionsStore) GetRevisions(user_id int64, note_id int64) ([]NoteRevision, error) {
+	query := `
+	SELECT 1
+	FROM notes
+	WHERE id = $2 AND deleted_at IS NULL AND folder_role($1, folder_id) IS NOT NULL;
+	`
+
+	var found int
+	err := r.db.QueryRow(query, user_id, note_id).Scan(&found)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT r.id, r.note_id, r.revision, r.title, r.created_at, r.updated_at
+	FROM note_revisions r
+	INNER JOIN notes n ON n.id = r.note_id
+	WHERE n.id = $2 AND n.deleted_at IS NULL AND folder_role($1, n.folder_id) IS NOT NULL
+	ORDER BY r.revision DESC;
+	`
+
+	rows, err := r.db.Query(query, user_id, note_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []NoteRevision{}
+
+	for rows.Next() {
+		var revision NoteRevision
+		err = rows.Scan(
+			&revision.ID,
+			&revision.NoteID,
+			&revision.Revision,
+			&revision.Title,
+			&revision.CreatedAt,
+			&revision.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+func (r *PostgresNoteRevisionsStore) GetRevision(user_id int64, note_id int64, revision int64) (*NoteRevision, error) {
+	query := `
+	SELECT r.id, r.note_id, r.revision, r.title, r.note, r.created_at, r.updated_at
+	FROM note_revisions r
+	INNER JOIN notes n ON n.id = r.note_id
+	WHERE n.id = $2 AND n.deleted_at IS NULL AND r.revision = $3
+		AND folder_role($1, n.folder_id) IS NOT NULL;
+	`
+
+	var dbRevision NoteRevision
+	err := r.db.QueryRow(query, user_id, note_id, revision).Scan(
+		&dbRevision.ID,
+		&dbRevision.NoteID,
+		&dbRevision.Revision,
+		&dbRevision.Title,
+		&dbRevision.Note,
+		&dbRevision.CreatedAt,
+		&dbRevision.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbRevision, nil
+}
+
+// RestoreRevision puts the title and body of an older revision back into the
+// note, failing with ErrDuplicateNote when another note in the folder took the
+// title since. The restore always opens a new revision instead of being folded
+// into the latest one, so whatever it replaced stays in the history.
+func (r *PostgresNoteRevisionsStore) RestoreRevision(user_id int64, note_id int64, revision int64) (*Note, error) {
+	query := `
+	UPDATE notes n
+	SET title = r.title, note = r.note, version = n.version + 1, updated_at = now()
+	FROM note_revisions r
+	WHERE r.note_id = n.id AND r.revision = $3
+		AND n.id = $2 AND n.deleted_at IS NULL AND folder_role($1, n.folder_id) >= 'editor'
+	RETURNING n.id, n.folder_id, n.title, n.note, n.version, n.created_at, n.updated_at;
+	`
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var dbNote Note
+	err = tx.QueryRow(query, user_id, note_id, revision).Scan(
+		&dbNote.ID,
+		&dbNote.FolderID,
+		&dbNote.Title,
+		&dbNote.Note,
+		&dbNote.Version,
+		&dbNote.CreatedAt,
+		&dbNote.UpdatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrDuplicateNote
+		}
+		return nil, err
+	}
+
+	err = afterSave(tx, &dbNote, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbNote, nil
+}
+
+// recordRevision stores the current state of a note in its history. Saves
+// landing within window of the latest revision being started overwrite it, so
+// autosaving while typing doesn't flood the history. It has to run in the same
+// transaction that updated the note, the row lock taken there keeps revision
+// numbers from racing.
+func recordRevision(tx *sql.Tx, note *Note, window time.Duration) error {
+	query := `
+	SELECT id, title, note, created_at > now() - make_interval(secs => $2)
+	FROM note_revisions
+	WHERE note_id = $1
+	ORDER BY revision DESC
+	LIMIT 1;
+	`
+
+	var (
+		latestID     int64
+		latestTitle  string
+		latestNote   string
+		withinWindow bool
+	)
+	err := tx.QueryRow(query, note.ID, window.Seconds()).Scan(&latestID, &latestTitle, &latestNote, &withinWindow)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if err == nil {
+		if latestTitle == note.Title && latestNote == note.Note {
+			return nil
+		}
+
+		if withinWindow {
+			query = `
+			UPDATE note_revisions
+			SET title = $1, note = $2, updated_at = now()
+			WHERE id = $3;
+			`
+
+			_, err = tx.Exec(query, note.Title, note.Note, latestID)
+			return err
+		}
+	}
+
+	query = `
+	INSERT INTO note_revisions (note_id, revision, title, note)
+	SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3
+	FROM note_revisions
+	WHERE note_id = $1;
+	`
+
+	_, err = tx.Exec(query, note.ID, note.Title, note.Note)
+	return err
+}
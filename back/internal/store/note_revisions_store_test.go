@@ -0,0 +1,152 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordRevisions(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	revisionsStore := NewPostgresNoteRevisionsStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+
+	t.Run("creating a note records the first revision", func(t *testing.T) {
+		note, err := notesStore.CreateNote(user.ID, rootFolderId, "first", "v1")
+		assert.NoError(t, err)
+
+		revisions, err := revisionsStore.GetRevisions(user.ID, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(revisions))
+		assert.Equal(t, int64(1), revisions[0].Revision)
+	})
+
+	t.Run("every save is a revision without a window", func(t *testing.T) {
+		notesStore.SetRevisionWindow(0)
+		note, err := notesStore.CreateNote(user.ID, rootFolderId, "second", "v1")
+		assert.NoError(t, err)
+		_, err = notesStore.UpdateNote(user.ID, note.ID, "v2")
+		assert.NoError(t, err)
+		_, err = notesStore.UpdateNote(user.ID, note.ID, "v3")
+		assert.NoError(t, err)
+
+		revisions, err := revisionsStore.GetRevisions(user.ID, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(revisions))
+		assert.Equal(t, int64(3), revisions[0].Revision)
+
+		revision, err := revisionsStore.GetRevision(user.ID, note.ID, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", revision.Note)
+	})
+
+	t.Run("saves within the window are coalesced", func(t *testing.T) {
+		notesStore.SetRevisionWindow(time.Hour)
+		note, err := notesStore.CreateNote(user.ID, rootFolderId, "third", "v1")
+		assert.NoError(t, err)
+		_, err = notesStore.UpdateNote(user.ID, note.ID, "v2")
+		assert.NoError(t, err)
+		_, err = notesStore.UpdateNote(user.ID, note.ID, "v3")
+		assert.NoError(t, err)
+
+		revisions, err := revisionsStore.GetRevisions(user.ID, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(revisions))
+
+		revision, err := revisionsStore.GetRevision(user.ID, note.ID, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "v3", revision.Note)
+	})
+
+	t.Run("unchanged saves don't add revisions", func(t *testing.T) {
+		notesStore.SetRevisionWindow(0)
+		note, err := notesStore.CreateNote(user.ID, rootFolderId, "fourth", "same")
+		assert.NoError(t, err)
+		_, err = notesStore.UpdateNote(user.ID, note.ID, "same")
+		assert.NoError(t, err)
+
+		revisions, err := revisionsStore.GetRevisions(user.ID, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(revisions))
+	})
+
+	t.Run("other users can't see the history", func(t *testing.T) {
+		note, err := notesStore.CreateNote(user.ID, rootFolderId, "private", "secret")
+		assert.NoError(t, err)
+
+		revisions, err := revisionsStore.GetRevisions(user2.ID, note.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, revisions)
+
+		revision, err := revisionsStore.GetRevision(user2.ID, note.ID, 1)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, revision)
+	})
+}
+
+func TestRestoreRevision(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	revisionsStore := NewPostgresNoteRevisionsStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+
+	notesStore.SetRevisionWindow(time.Hour)
+	note, err := notesStore.CreateNote(user.ID, rootFolderId, "title", "original")
+	assert.NoError(t, err)
+	notesStore.SetRevisionWindow(0)
+	_, err = notesStore.UpdateNote(user.ID, note.ID, "oops")
+	assert.NoError(t, err)
+	renamed := "renamed"
+	_, err = notesStore.PatchNote(user.ID, note.ID, NoteUpdate{Title: &renamed})
+	assert.NoError(t, err)
+
+	t.Run("restores old title and content as a new revision", func(t *testing.T) {
+		restored, err := revisionsStore.RestoreRevision(user.ID, note.ID, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "title", restored.Title)
+		assert.Equal(t, "original", restored.Note)
+
+		revisions, err := revisionsStore.GetRevisions(user.ID, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, len(revisions))
+
+		revision, err := revisionsStore.GetRevision(user.ID, note.ID, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, "renamed", revision.Title)
+		assert.Equal(t, "oops", revision.Note)
+	})
+
+	t.Run("fails when another note took the title", func(t *testing.T) {
+		_, err := notesStore.CreateNote(user.ID, rootFolderId, "renamed", "")
+		assert.NoError(t, err)
+		_, err = revisionsStore.RestoreRevision(user.ID, note.ID, 3)
+		assert.ErrorIs(t, err, ErrDuplicateNote)
+	})
+
+	t.Run("fails for non-existent revision", func(t *testing.T) {
+		restored, err := revisionsStore.RestoreRevision(user.ID, note.ID, 99)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, restored)
+	})
+
+	t.Run("fails for wrong user id", func(t *testing.T) {
+		restored, err := revisionsStore.RestoreRevision(user2.ID, note.ID, 1)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, restored)
+	})
+}
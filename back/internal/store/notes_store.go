@@ -3,50 +3,180 @@ package store
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/jackc/pgconn"
 )
 
-var ErrDuplicateNote = errors.New("note with this title already exists in this folder")
+var (
+	ErrDuplicateNote = errors.New("note with this title already exists in this folder")
+	ErrStaleNote     = errors.New("note has been changed since it was last read")
+)
 
 type Note struct {
-	ID        int64     `json:"id"`
-	FolderID  int64     `json:"folder_id"`
-	Title     string    `json:"title"`
-	Note      string    `json:"note"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int64      `json:"id"`
+	FolderID  int64      `json:"folder_id"`
+	Title     string     `json:"title"`
+	Note      string     `json:"note"`
+	Version   int64      `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// NoteUpdate holds the fields of a note that should change, nil fields are
+// left as they are. When IfVersion is set the update only goes through if the
+// note is still at that version.
+type NoteUpdate struct {
+	Title     *string
+	Note      *string
+	FolderID  *int64
+	IfVersion *int64
+}
+
+// SearchHit is a note matching a search, the title and snippet are HTML
+// escaped and have the matched words wrapped in <mark> tags.
+type SearchHit struct {
+	NoteID     int64     `json:"id"`
+	FolderID   int64     `json:"folder_id"`
+	FolderPath string    `json:"folder_path"`
+	Title      string    `json:"title"`
+	Snippet    string    `json:"snippet"`
+	Rank       float32   `json:"rank"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type PostgresNotesStore struct {
-	db *sql.DB
+	db             *sql.DB
+	revisionWindow time.Duration
 }
 
 func NewPostgresNotesStore(db *sql.DB) *PostgresNotesStore {
-	return &PostgresNotesStore{db: db}
+	return &PostgresNotesStore{db: db, revisionWindow: DefaultRevisionWindow}
+}
+
+// SetRevisionWindow changes how long consecutive saves keep being folded into
+// the same revision, zero records every save as its own revision.
+func (n *PostgresNotesStore) SetRevisionWindow(window time.Duration) {
+	n.revisionWindow = window
 }
 
 type NotesStore interface {
 	CreateNote(user_id int64, folder_id int64, title string, note string) (*Note, error)
+	CreateNoteTx(tx *sql.Tx, user_id int64, folder_id int64, title string, note string) (*Note, error)
+	ReserveNoteIDsTx(tx *sql.Tx, count int) ([]int64, error)
+	CreateReservedNoteTx(tx *sql.Tx, user_id int64, note_id int64, folder_id int64, title string, note string) (*Note, error)
 	GetNotesInFolder(user_id int64, folder_id int64) ([]Note, error)
 	GetNote(user_id int64, note_id int64) (*Note, error)
+	NoteRole(user_id int64, note_id int64) (Role, error)
 	UpdateNote(user_id int64, note_id int64, note string) (*Note, error)
+	UpdateNoteTx(tx *sql.Tx, user_id int64, note_id int64, note string) (*Note, error)
+	PatchNote(user_id int64, note_id int64, update NoteUpdate) (*Note, error)
+	TrashNote(user_id int64, note_id int64) (*Note, error)
+	TrashNoteIfVersion(user_id int64, note_id int64, version int64) (*Note, error)
+	GetTrashedNotes(user_id int64, workspace_id int64) ([]Note, error)
+	RestoreNote(user_id int64, note_id int64) (*Note, error)
+	PurgeNote(user_id int64, note_id int64) error
+	EmptyTrash(user_id int64, workspace_id int64) (int64, error)
+	SearchNotes(user_id int64, workspace_id int64, query string, limit int, cursor int) ([]SearchHit, int, error)
+}
+
+// afterSave keeps everything derived from a note's content in step with it:
+// its revision history, tags and links. It runs inside the transaction that
+// wrote the note.
+func afterSave(tx *sql.Tx, note *Note, revisionWindow time.Duration) error {
+	err := recordRevision(tx, note, revisionWindow)
+	if err != nil {
+		return err
+	}
+
+	err = saveTags(tx, note)
+	if err != nil {
+		return err
+	}
+
+	return saveLinks(tx, note)
 }
 
 func (n *PostgresNotesStore) CreateNote(user_id int64, folder_id int64, title string, note string) (*Note, error) {
+	tx, err := n.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	dbNote, err := n.CreateNoteTx(tx, user_id, folder_id, title, note)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return dbNote, nil
+}
+
+// CreateNoteTx creates a note as part of a larger transaction. The user must
+// be able to edit the folder, the note belongs to the owner of its tree.
+func (n *PostgresNotesStore) CreateNoteTx(tx *sql.Tx, user_id int64, folder_id int64, title string, note string) (*Note, error) {
+	return n.createNoteTx(tx, user_id, 0, folder_id, title, note)
+}
+
+// ReserveNoteIDsTx takes ids for notes that are about to be created with
+// CreateReservedNoteTx, so notes created together can link to each other by
+// id from the start.
+func (n *PostgresNotesStore) ReserveNoteIDsTx(tx *sql.Tx, count int) ([]int64, error) {
 	query := `
-	INSERT INTO notes (user_id, folder_id, title, note)
-	VALUES ($1, $2, $3, $4)
-	RETURNING id, folder_id, title, note, created_at, updated_at;
+	SELECT nextval(pg_get_serial_sequence('notes', 'id'))
+	FROM generate_series(1, $1);
+	`
+
+	rows, err := tx.Query(query, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0, count)
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// CreateReservedNoteTx is CreateNoteTx for a note with an id taken by
+// ReserveNoteIDsTx.
+func (n *PostgresNotesStore) CreateReservedNoteTx(tx *sql.Tx, user_id int64, note_id int64, folder_id int64, title string, note string) (*Note, error) {
+	return n.createNoteTx(tx, user_id, note_id, folder_id, title, note)
+}
+
+// createNoteTx creates a note with note_id, or the next id for 0.
+func (n *PostgresNotesStore) createNoteTx(tx *sql.Tx, user_id int64, note_id int64, folder_id int64, title string, note string) (*Note, error) {
+	query := `
+	INSERT INTO notes (id, user_id, folder_id, title, note)
+	SELECT COALESCE(NULLIF($5::BIGINT, 0), nextval(pg_get_serial_sequence('notes', 'id'))), f.user_id, f.id, $3, $4
+	FROM folders f
+	WHERE f.id = $2 AND folder_role($1, f.id) >= 'editor'
+	RETURNING id, folder_id, title, note, version, created_at, updated_at;
 	`
 
 	var dbNote Note
-	err := n.db.QueryRow(query, user_id, folder_id, title, note).Scan(
+	err := tx.QueryRow(query, user_id, folder_id, title, note, note_id).Scan(
 		&dbNote.ID,
 		&dbNote.FolderID,
 		&dbNote.Title,
 		&dbNote.Note,
+		&dbNote.Version,
 		&dbNote.CreatedAt,
 		&dbNote.UpdatedAt,
 	)
@@ -60,14 +190,19 @@ func (n *PostgresNotesStore) CreateNote(user_id int64, folder_id int64, title st
 		return nil, err
 	}
 
+	err = afterSave(tx, &dbNote, n.revisionWindow)
+	if err != nil {
+		return nil, err
+	}
+
 	return &dbNote, nil
 }
 
 func (n *PostgresNotesStore) GetNotesInFolder(user_id int64, folder_id int64) ([]Note, error) {
 	query := `
-	SELECT id, folder_id, title, note, created_at, updated_at
+	SELECT id, folder_id, title, note, version, created_at, updated_at
 	FROM notes
-	WHERE folder_id = $1 AND user_id = $2
+	WHERE folder_id = $1 AND deleted_at IS NULL AND folder_role($2, $1) IS NOT NULL
 	ORDER BY updated_at;
 	`
 
@@ -86,6 +221,7 @@ func (n *PostgresNotesStore) GetNotesInFolder(user_id int64, folder_id int64) ([
 			&note.FolderID,
 			&note.Title,
 			&note.Note,
+			&note.Version,
 			&note.CreatedAt,
 			&note.UpdatedAt,
 		)
@@ -98,11 +234,23 @@ func (n *PostgresNotesStore) GetNotesInFolder(user_id int64, folder_id int64) ([
 	return notes, nil
 }
 
+// NoteRole returns the user's role on the folder a note is in, RoleNone if
+// the note doesn't exist, is in the trash or the user has no access to it.
+func (n *PostgresNotesStore) NoteRole(user_id int64, note_id int64) (Role, error) {
+	query := `
+	SELECT folder_role($1, folder_id)
+	FROM notes
+	WHERE id = $2 AND deleted_at IS NULL;
+	`
+
+	return scanRole(n.db.QueryRow(query, user_id, note_id))
+}
+
 func (n *PostgresNotesStore) GetNote(user_id int64, note_id int64) (*Note, error) {
 	query := `
-	SELECT id, folder_id, title, note, created_at, updated_at 
-	FROM notes 
-	WHERE user_id = $1 AND id = $2;
+	SELECT id, folder_id, title, note, version, created_at, updated_at
+	FROM notes
+	WHERE id = $2 AND deleted_at IS NULL AND folder_role($1, folder_id) IS NOT NULL;
 	`
 
 	var dbNote Note
@@ -111,6 +259,7 @@ func (n *PostgresNotesStore) GetNote(user_id int64, note_id int64) (*Note, error
 		&dbNote.FolderID,
 		&dbNote.Title,
 		&dbNote.Note,
+		&dbNote.Version,
 		&dbNote.CreatedAt,
 		&dbNote.UpdatedAt,
 	)
@@ -122,26 +271,429 @@ func (n *PostgresNotesStore) GetNote(user_id int64, note_id int64) (*Note, error
 }
 
 func (n *PostgresNotesStore) UpdateNote(user_id int64, note_id int64, note string) (*Note, error) {
+	tx, err := n.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	dbNote, err := n.UpdateNoteTx(tx, user_id, note_id, note)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return dbNote, nil
+}
+
+// UpdateNoteTx replaces a note's content as part of a larger transaction.
+func (n *PostgresNotesStore) UpdateNoteTx(tx *sql.Tx, user_id int64, note_id int64, note string) (*Note, error) {
+	query := `
+	UPDATE notes
+	SET note = $1, version = version + 1, updated_at = now()
+	WHERE id = $3 AND deleted_at IS NULL AND folder_role($2, folder_id) >= 'editor'
+	RETURNING id, folder_id, title, note, version, created_at, updated_at;
+	`
+
+	var dbNote Note
+	err := tx.QueryRow(query, note, user_id, note_id).Scan(
+		&dbNote.ID,
+		&dbNote.FolderID,
+		&dbNote.Title,
+		&dbNote.Note,
+		&dbNote.Version,
+		&dbNote.CreatedAt,
+		&dbNote.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = afterSave(tx, &dbNote, n.revisionWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbNote, nil
+}
+
+func (n *PostgresNotesStore) PatchNote(user_id int64, note_id int64, update NoteUpdate) (*Note, error) {
+	query := `
+	UPDATE notes
+	SET title = COALESCE($1, title),
+			note = COALESCE($2, note),
+			folder_id = COALESCE($3, folder_id),
+			version = version + 1,
+			updated_at = now()
+	WHERE id = $5 AND deleted_at IS NULL AND folder_role($4, folder_id) >= 'editor'
+		AND ($6::BIGINT IS NULL OR version = $6)
+		AND ($3::BIGINT IS NULL OR $3 = folder_id OR (
+			folder_role($4, $3) >= 'editor'
+			AND (SELECT workspace_id FROM folders WHERE id = $3) = (SELECT workspace_id FROM folders WHERE id = notes.folder_id)
+		))
+	RETURNING id, folder_id, title, note, version, created_at, updated_at;
+	`
+
+	tx, err := n.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var dbNote Note
+	err = tx.QueryRow(query, update.Title, update.Note, update.FolderID, user_id, note_id, update.IfVersion).Scan(
+		&dbNote.ID,
+		&dbNote.FolderID,
+		&dbNote.Title,
+		&dbNote.Note,
+		&dbNote.Version,
+		&dbNote.CreatedAt,
+		&dbNote.UpdatedAt,
+	)
+	if err == sql.ErrNoRows && update.IfVersion != nil {
+		// tell a missing note apart from one that moved on to a newer version
+		_, getErr := n.GetNote(user_id, note_id)
+		if getErr == nil {
+			return nil, ErrStaleNote
+		}
+		return nil, err
+	}
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return nil, ErrDuplicateNote
+			}
+		}
+		return nil, err
+	}
+
+	err = afterSave(tx, &dbNote, n.revisionWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbNote, nil
+}
+
+func (n *PostgresNotesStore) TrashNote(user_id int64, note_id int64) (*Note, error) {
+	return n.trashNote(user_id, note_id, nil)
+}
+
+// TrashNoteIfVersion trashes the note only while it is at version, returning
+// ErrStaleNote when it moved on to a newer one.
+func (n *PostgresNotesStore) TrashNoteIfVersion(user_id int64, note_id int64, version int64) (*Note, error) {
+	return n.trashNote(user_id, note_id, &version)
+}
+
+func (n *PostgresNotesStore) trashNote(user_id int64, note_id int64, if_version *int64) (*Note, error) {
 	query := `
 	UPDATE notes
-	SET note = $1, updated_at = now()
-	WHERE user_id = $2 AND id = $3
-	RETURNING id, folder_id, title, note, created_at, updated_at;
+	SET deleted_at = now()
+	WHERE id = $2 AND deleted_at IS NULL AND folder_role($1, folder_id) >= 'editor'
+		AND ($3::BIGINT IS NULL OR version = $3)
+	RETURNING id, folder_id, title, note, version, created_at, updated_at, deleted_at;
 	`
 
 	var dbNote Note
-	err := n.db.QueryRow(query, note, user_id, note_id).Scan(
+	err := n.db.QueryRow(query, user_id, note_id, if_version).Scan(
 		&dbNote.ID,
 		&dbNote.FolderID,
 		&dbNote.Title,
 		&dbNote.Note,
+		&dbNote.Version,
 		&dbNote.CreatedAt,
 		&dbNote.UpdatedAt,
+		&dbNote.DeletedAt,
 	)
+	if err == sql.ErrNoRows && if_version != nil {
+		// tell a missing note apart from one that moved on to a newer version
+		_, getErr := n.GetNote(user_id, note_id)
+		if getErr == nil {
+			return nil, ErrStaleNote
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbNote, nil
+}
 
+// GetTrashedNotes lists the trashed notes the user could restore, from the
+// folders they can edit in the workspace or in every workspace when
+// workspace_id is 0.
+func (n *PostgresNotesStore) GetTrashedNotes(user_id int64, workspace_id int64) ([]Note, error) {
+	query := `
+	SELECT id, folder_id, title, note, version, created_at, updated_at, deleted_at
+	FROM notes
+	WHERE deleted_at IS NOT NULL
+		AND folder_id IN (SELECT folder_id FROM workspace_folders($1, $2) WHERE role >= 'editor')
+	ORDER BY deleted_at DESC;
+	`
+
+	rows, err := n.db.Query(query, user_id, workspace_id)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	notes := []Note{}
+
+	for rows.Next() {
+		var note Note
+		err = rows.Scan(
+			&note.ID,
+			&note.FolderID,
+			&note.Title,
+			&note.Note,
+			&note.Version,
+			&note.CreatedAt,
+			&note.UpdatedAt,
+			&note.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+
+	return notes, nil
+}
+
+func (n *PostgresNotesStore) RestoreNote(user_id int64, note_id int64) (*Note, error) {
+	query := `
+	UPDATE notes
+	SET deleted_at = NULL
+	WHERE id = $2 AND deleted_at IS NOT NULL AND folder_role($1, folder_id) >= 'editor'
+	RETURNING id, folder_id, title, note, version, created_at, updated_at;
+	`
+
+	var dbNote Note
+	err := n.db.QueryRow(query, user_id, note_id).Scan(
+		&dbNote.ID,
+		&dbNote.FolderID,
+		&dbNote.Title,
+		&dbNote.Note,
+		&dbNote.Version,
+		&dbNote.CreatedAt,
+		&dbNote.UpdatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if pgErr.Code == "23505" {
+				return nil, ErrDuplicateNote
+			}
+		}
+		return nil, err
+	}
 
 	return &dbNote, nil
 }
+
+// PurgeNote deletes a trashed note for good, which only owners can do.
+func (n *PostgresNotesStore) PurgeNote(user_id int64, note_id int64) error {
+	query := `
+	DELETE FROM notes
+	WHERE id = $2 AND deleted_at IS NOT NULL AND folder_role($1, folder_id) = 'owner';
+	`
+
+	result, err := n.db.Exec(query, user_id, note_id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// EmptyTrash purges the trashed notes in every folder the user owns in the
+// workspace, or in every workspace when workspace_id is 0.
+func (n *PostgresNotesStore) EmptyTrash(user_id int64, workspace_id int64) (int64, error) {
+	query := `
+	DELETE FROM notes
+	WHERE deleted_at IS NOT NULL
+		AND folder_id IN (SELECT folder_id FROM workspace_folders($1, $2) WHERE role = 'owner');
+	`
+
+	result, err := n.db.Exec(query, user_id, workspace_id)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// SearchNotes runs a web search style query (quoted phrases, -negation, OR and
+// word* prefixes) over the notes the user has access to in the workspace, or
+// in every workspace when workspace_id is 0, best matches first.
+// The cursor is the number of hits already seen, the returned cursor is 0 once
+// there is nothing left to fetch. Folder paths of notes in shared folders
+// start at the highest folder the user can see.
+func (n *PostgresNotesStore) SearchNotes(user_id int64, workspace_id int64, query string, limit int, cursor int) ([]SearchHit, int, error) {
+	sqlQuery := `
+	WITH RECURSIVE access AS (
+		SELECT folder_id
+		FROM workspace_folders($1, $5)
+	), hits AS (
+		SELECT n.id, n.folder_id, n.updated_at, ts_rank_cd(n.search, q.query) AS rank, q.query,
+			-- escaped before highlighting, so only the <mark> tags are markup
+			replace(replace(replace(n.title, '&', '&amp;'), '<', '&lt;'), '>', '&gt;') AS title,
+			replace(replace(replace(n.note, '&', '&amp;'), '<', '&lt;'), '>', '&gt;') AS note
+		FROM notes n, to_tsquery('english', $2) AS q(query)
+		WHERE n.folder_id IN (SELECT folder_id FROM access) AND n.deleted_at IS NULL AND n.search @@ q.query
+		ORDER BY rank DESC, n.id DESC
+		LIMIT $3 OFFSET $4
+	), paths AS (
+		SELECT h.id AS note_id, h.folder_id, ''::TEXT AS path
+		FROM hits h
+		UNION ALL
+		SELECT p.note_id, f.parent_id, '/' || f.name || p.path
+		FROM paths p
+		INNER JOIN folders f ON f.id = p.folder_id
+		WHERE f.parent_id IS NOT NULL AND f.id IN (SELECT folder_id FROM access)
+	)
+	SELECT h.id, h.folder_id, COALESCE(NULLIF(p.path, ''), '/'),
+		ts_headline('english', h.title, h.query, 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'),
+		ts_headline('english', h.note, h.query, 'MaxFragments=2, MaxWords=30, MinWords=10, StartSel=<mark>, StopSel=</mark>'),
+		h.rank, h.updated_at
+	FROM hits h
+	LEFT JOIN (
+		SELECT DISTINCT ON (note_id) note_id, path
+		FROM paths
+		ORDER BY note_id, length(path) DESC
+	) p ON p.note_id = h.id
+	ORDER BY h.rank DESC, h.id DESC;
+	`
+
+	// fetch one extra hit to find out whether there is another page
+	rows, err := n.db.Query(sqlQuery, user_id, searchQuery(query), limit+1, cursor, workspace_id)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+
+	for rows.Next() {
+		var hit SearchHit
+		err = rows.Scan(
+			&hit.NoteID,
+			&hit.FolderID,
+			&hit.FolderPath,
+			&hit.Title,
+			&hit.Snippet,
+			&hit.Rank,
+			&hit.UpdatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		hits = append(hits, hit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if len(hits) > limit {
+		return hits[:limit], cursor + limit, nil
+	}
+
+	return hits, 0, nil
+}
+
+// searchQuery turns a web search style query into a to_tsquery expression,
+// since websearch_to_tsquery has no prefix syntax of its own. Terms are ANDed
+// unless "or" stands between them, "-" negates a term, quoted text is matched
+// as a phrase and a trailing * matches prefixes. Every term is quoted, so
+// nothing typed is read as tsquery syntax, and to_tsquery normalizes the words
+// the way websearch_to_tsquery would.
+func searchQuery(query string) string {
+	var (
+		expr      strings.Builder
+		pendingOr bool
+	)
+
+	add := func(term string, negated bool, prefix bool) {
+		hasWord := strings.ContainsFunc(term, func(r rune) bool {
+			return unicode.IsLetter(r) || unicode.IsDigit(r)
+		})
+		if !hasWord {
+			return
+		}
+
+		if expr.Len() > 0 {
+			if pendingOr {
+				expr.WriteString(" | ")
+			} else {
+				expr.WriteString(" & ")
+			}
+		}
+		pendingOr = false
+
+		if negated {
+			expr.WriteString("!")
+		}
+		expr.WriteString("'" + strings.NewReplacer(`\`, `\\`, "'", "''").Replace(term) + "'")
+		if prefix {
+			expr.WriteString(":*")
+		}
+	}
+
+	rest := query
+	for {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			break
+		}
+
+		negated := strings.HasPrefix(rest, "-")
+		if negated {
+			rest = rest[1:]
+		}
+
+		if strings.HasPrefix(rest, `"`) {
+			var phrase string
+			phrase, rest, _ = strings.Cut(rest[1:], `"`)
+			add(phrase, negated, false)
+			continue
+		}
+
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end == -1 {
+			end = len(rest)
+		}
+		word := rest[:end]
+		rest = rest[end:]
+
+		if !negated && strings.EqualFold(word, "or") {
+			pendingOr = expr.Len() > 0
+			continue
+		}
+
+		term := strings.TrimRight(word, "*")
+		add(term, negated, term != word)
+	}
+
+	return expr.String()
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"database/sql"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -160,3 +161,385 @@ func TestUpdateNote(t *testing.T) {
 		assert.Nil(t, updatedNote)
 	})
 }
+
+func TestTrashNote(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+
+	note, err := notesStore.CreateNote(user.ID, rootFolderId, "title", "content")
+	assert.NoError(t, err)
+
+	t.Run("fails for wrong user id", func(t *testing.T) {
+		trashedNote, err := notesStore.TrashNote(user2.ID, note.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, trashedNote)
+	})
+
+	t.Run("refuses to trash a note that moved on from the version", func(t *testing.T) {
+		trashedNote, err := notesStore.TrashNoteIfVersion(user.ID, note.ID, note.Version+1)
+		assert.ErrorIs(t, err, ErrStaleNote)
+		assert.Nil(t, trashedNote)
+	})
+
+	t.Run("moves note to trash", func(t *testing.T) {
+		trashedNote, err := notesStore.TrashNote(user.ID, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, note.ID, trashedNote.ID)
+		assert.NotNil(t, trashedNote.DeletedAt)
+	})
+
+	t.Run("trashed note is hidden from folder and get", func(t *testing.T) {
+		notes, err := notesStore.GetNotesInFolder(user.ID, rootFolderId)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(notes))
+
+		dbNote, err := notesStore.GetNote(user.ID, note.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, dbNote)
+	})
+
+	t.Run("trashed note cannot be updated", func(t *testing.T) {
+		updatedNote, err := notesStore.UpdateNote(user.ID, note.ID, "new content")
+		assert.Error(t, err)
+		assert.Nil(t, updatedNote)
+	})
+
+	t.Run("trashed note is listed in trash", func(t *testing.T) {
+		notes, err := notesStore.GetTrashedNotes(user.ID, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(notes))
+		assert.Equal(t, note.ID, notes[0].ID)
+
+		otherNotes, err := notesStore.GetTrashedNotes(user2.ID, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(otherNotes))
+	})
+
+	t.Run("title can be reused after trashing", func(t *testing.T) {
+		newNote, err := notesStore.CreateNote(user.ID, rootFolderId, "title", "content")
+		assert.NoError(t, err)
+		assert.NotNil(t, newNote)
+	})
+}
+
+func TestRestoreNote(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+
+	note, err := notesStore.CreateNote(user.ID, rootFolderId, "title", "content")
+	assert.NoError(t, err)
+
+	t.Run("fails for note that isn't trashed", func(t *testing.T) {
+		restoredNote, err := notesStore.RestoreNote(user.ID, note.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, restoredNote)
+	})
+
+	_, err = notesStore.TrashNote(user.ID, note.ID)
+	assert.NoError(t, err)
+
+	t.Run("fails for wrong user id", func(t *testing.T) {
+		restoredNote, err := notesStore.RestoreNote(user2.ID, note.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, restoredNote)
+	})
+
+	t.Run("restores trashed note", func(t *testing.T) {
+		restoredNote, err := notesStore.RestoreNote(user.ID, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, note.ID, restoredNote.ID)
+		assert.Nil(t, restoredNote.DeletedAt)
+
+		dbNote, err := notesStore.GetNote(user.ID, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, note.ID, dbNote.ID)
+	})
+
+	t.Run("fails when a live note has taken the title", func(t *testing.T) {
+		_, err := notesStore.TrashNote(user.ID, note.ID)
+		assert.NoError(t, err)
+		_, err = notesStore.CreateNote(user.ID, rootFolderId, "title", "replacement")
+		assert.NoError(t, err)
+
+		restoredNote, err := notesStore.RestoreNote(user.ID, note.ID)
+		assert.ErrorIs(t, err, ErrDuplicateNote)
+		assert.Nil(t, restoredNote)
+	})
+}
+
+func TestPurgeNote(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+
+	note, err := notesStore.CreateNote(user.ID, rootFolderId, "title", "content")
+	assert.NoError(t, err)
+
+	t.Run("refuses to purge a note that isn't trashed", func(t *testing.T) {
+		err := notesStore.PurgeNote(user.ID, note.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	_, err = notesStore.TrashNote(user.ID, note.ID)
+	assert.NoError(t, err)
+
+	t.Run("fails for wrong user id", func(t *testing.T) {
+		err := notesStore.PurgeNote(user2.ID, note.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("purges trashed note", func(t *testing.T) {
+		err := notesStore.PurgeNote(user.ID, note.ID)
+		assert.NoError(t, err)
+
+		notes, err := notesStore.GetTrashedNotes(user.ID, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(notes))
+	})
+
+	t.Run("empties trash", func(t *testing.T) {
+		for _, title := range []string{"a", "b"} {
+			n, err := notesStore.CreateNote(user.ID, rootFolderId, title, "content")
+			assert.NoError(t, err)
+			_, err = notesStore.TrashNote(user.ID, n.ID)
+			assert.NoError(t, err)
+		}
+
+		purged, err := notesStore.EmptyTrash(user.ID, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), purged)
+	})
+}
+
+func TestPatchNote(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	subFolder, err := folderStore.CreateFolder(user.ID, rootFolderId, "subfolder")
+	assert.NoError(t, err)
+
+	note, err := notesStore.CreateNote(user.ID, rootFolderId, "title", "content")
+	assert.NoError(t, err)
+	_, err = notesStore.CreateNote(user.ID, rootFolderId, "taken", "content")
+	assert.NoError(t, err)
+
+	t.Run("renames note and keeps content", func(t *testing.T) {
+		title := "renamed"
+		updatedNote, err := notesStore.PatchNote(user.ID, note.ID, NoteUpdate{Title: &title})
+		assert.NoError(t, err)
+		assert.Equal(t, "renamed", updatedNote.Title)
+		assert.Equal(t, "content", updatedNote.Note)
+		assert.Equal(t, rootFolderId, updatedNote.FolderID)
+	})
+
+	t.Run("moves note to another folder", func(t *testing.T) {
+		updatedNote, err := notesStore.PatchNote(user.ID, note.ID, NoteUpdate{FolderID: &subFolder.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, subFolder.ID, updatedNote.FolderID)
+		assert.Equal(t, "renamed", updatedNote.Title)
+	})
+
+	t.Run("fails when title is taken in destination folder", func(t *testing.T) {
+		title := "taken"
+		updatedNote, err := notesStore.PatchNote(user.ID, note.ID, NoteUpdate{Title: &title, FolderID: &rootFolderId})
+		assert.ErrorIs(t, err, ErrDuplicateNote)
+		assert.Nil(t, updatedNote)
+	})
+
+	t.Run("fails for wrong user id", func(t *testing.T) {
+		content := "hacked"
+		updatedNote, err := notesStore.PatchNote(user2.ID, note.ID, NoteUpdate{Note: &content})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, updatedNote)
+	})
+}
+
+func TestPatchNoteIfVersion(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+
+	note, err := notesStore.CreateNote(user.ID, rootFolderId, "title", "content")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), note.Version)
+
+	t.Run("saves when version matches", func(t *testing.T) {
+		content := "first tab"
+		updatedNote, err := notesStore.PatchNote(user.ID, note.ID, NoteUpdate{Note: &content, IfVersion: &note.Version})
+		assert.NoError(t, err)
+		assert.Equal(t, "first tab", updatedNote.Note)
+		assert.Equal(t, int64(2), updatedNote.Version)
+	})
+
+	t.Run("refuses stale version", func(t *testing.T) {
+		content := "second tab"
+		updatedNote, err := notesStore.PatchNote(user.ID, note.ID, NoteUpdate{Note: &content, IfVersion: &note.Version})
+		assert.ErrorIs(t, err, ErrStaleNote)
+		assert.Nil(t, updatedNote)
+
+		dbNote, err := notesStore.GetNote(user.ID, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "first tab", dbNote.Note)
+	})
+
+	t.Run("reports missing note rather than stale", func(t *testing.T) {
+		content := "content"
+		updatedNote, err := notesStore.PatchNote(user.ID, 9999, NoteUpdate{Note: &content, IfVersion: &note.Version})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Nil(t, updatedNote)
+	})
+
+	t.Run("plain updates bump the version", func(t *testing.T) {
+		updatedNote, err := notesStore.UpdateNote(user.ID, note.ID, "server side")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), updatedNote.Version)
+	})
+}
+
+func TestSearchNotes(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	projects, err := folderStore.CreateFolder(user.ID, rootFolderId, "projects")
+	assert.NoError(t, err)
+	alpha, err := folderStore.CreateFolder(user.ID, projects.ID, "alpha")
+	assert.NoError(t, err)
+
+	inTitle, err := notesStore.CreateNote(user.ID, alpha.ID, "Kubernetes upgrade", "steps for the cluster")
+	assert.NoError(t, err)
+	inBody, err := notesStore.CreateNote(user.ID, rootFolderId, "Meeting", "we talked about the kubernetes migration plan")
+	assert.NoError(t, err)
+	trashed, err := notesStore.CreateNote(user.ID, rootFolderId, "Old", "kubernetes notes from last year")
+	assert.NoError(t, err)
+	_, err = notesStore.TrashNote(user.ID, trashed.ID)
+	assert.NoError(t, err)
+
+	t.Run("ranks title matches above body matches", func(t *testing.T) {
+		hits, next, err := notesStore.SearchNotes(user.ID, 0, "kubernetes", 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, next)
+		assert.Equal(t, 2, len(hits))
+		assert.Equal(t, inTitle.ID, hits[0].NoteID)
+		assert.Equal(t, inBody.ID, hits[1].NoteID)
+		assert.Contains(t, hits[0].Title, "<mark>Kubernetes</mark>")
+		assert.Contains(t, hits[1].Snippet, "<mark>kubernetes</mark>")
+	})
+
+	t.Run("includes the folder path of each hit", func(t *testing.T) {
+		hits, _, err := notesStore.SearchNotes(user.ID, 0, "kubernetes", 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "/projects/alpha", hits[0].FolderPath)
+		assert.Equal(t, "/", hits[1].FolderPath)
+	})
+
+	t.Run("supports phrases, negation and prefixes", func(t *testing.T) {
+		hits, _, err := notesStore.SearchNotes(user.ID, 0, `"migration plan"`, 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(hits))
+		assert.Equal(t, inBody.ID, hits[0].NoteID)
+
+		hits, _, err = notesStore.SearchNotes(user.ID, 0, "kubernetes -meeting", 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(hits))
+		assert.Equal(t, inTitle.ID, hits[0].NoteID)
+
+		hits, _, err = notesStore.SearchNotes(user.ID, 0, "kuber*", 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(hits))
+
+		hits, _, err = notesStore.SearchNotes(user.ID, 0, "nothing OR clust*", 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(hits))
+		assert.Equal(t, inTitle.ID, hits[0].NoteID)
+	})
+
+	t.Run("escapes the text around the highlights", func(t *testing.T) {
+		_, err := notesStore.CreateNote(user.ID, rootFolderId, "<b>Escaped</b>", "a <img src=x onerror=alert(1)> escaped & done")
+		assert.NoError(t, err)
+
+		hits, _, err := notesStore.SearchNotes(user.ID, 0, "escaped", 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(hits))
+		assert.Equal(t, "&lt;b&gt;<mark>Escaped</mark>&lt;/b&gt;", hits[0].Title)
+		assert.NotContains(t, hits[0].Snippet, "<img")
+		assert.Contains(t, hits[0].Snippet, "<mark>escaped</mark> &amp; done")
+	})
+
+	t.Run("pages with the cursor", func(t *testing.T) {
+		hits, next, err := notesStore.SearchNotes(user.ID, 0, "kubernetes", 1, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(hits))
+		assert.Equal(t, 1, next)
+
+		hits, next, err = notesStore.SearchNotes(user.ID, 0, "kubernetes", 1, next)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(hits))
+		assert.Equal(t, inBody.ID, hits[0].NoteID)
+		assert.Equal(t, 0, next)
+	})
+
+	t.Run("does not return other user's notes", func(t *testing.T) {
+		hits, _, err := notesStore.SearchNotes(user2.ID, 0, "kubernetes", 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(hits))
+	})
+}
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "plain words", want: "'plain' & 'words'"},
+		{query: "kube* cluster", want: "'kube':* & 'cluster'"},
+		{query: "cluster -draft*", want: "'cluster' & !'draft':*"},
+		{query: `"exact phrase*" other*`, want: "'exact phrase*' & 'other':*"},
+		{query: "foo OR bar*", want: "'foo' | 'bar':*"},
+		{query: `-"old plan" or new`, want: "!'old plan' | 'new'"},
+		{query: "or *** ok or", want: "'ok'"},
+		{query: `it's a & (b|c)`, want: "'it''s' & 'a' & '(b|c)'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.want, searchQuery(tt.query))
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// Share is a read-only link to a note or a folder subtree for people without
+// an account. Exactly one of NoteID and FolderID is set. Token is only known
+// when the share is created, afterwards just its hash is kept.
+type Share struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"-"`
+	NoteID       *int64     `json:"note_id"`
+	FolderID     *int64     `json:"folder_id"`
+	Name         string     `json:"name"`
+	Token        string     `json:"token,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	HasPassword  bool       `json:"has_password"`
+	PasswordHash password   `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	hash []byte
+}
+
+// AccessKey proves a visitor entered the share's password. It is derived from
+// the share's token and password hashes, so it can't be worked out from the
+// link alone and stops working once the share is revoked.
+func (s *Share) AccessKey() string {
+	sum := sha256.Sum256(append(append([]byte{}, s.hash...), s.PasswordHash.hash...))
+	return hex.EncodeToString(sum[:])
+}
+
+type PostgresSharesStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSharesStore(db *sql.DB) *PostgresSharesStore {
+	return &PostgresSharesStore{db: db}
+}
+
+type SharesStore interface {
+	CreateShare(share *Share, hash []byte) (*Share, error)
+	GetUserShares(user_id int64) ([]Share, error)
+	DeleteShare(user_id int64, share_id int64) error
+	GetShareByToken(tokenPlainText string) (*Share, error)
+}
+
+// CreateShare saves a share under the hash of its token. The caller checks
+// the user owns what is being shared.
+func (s *PostgresSharesStore) CreateShare(share *Share, hash []byte) (*Share, error) {
+	query := `
+	INSERT INTO shares (user_id, note_id, folder_id, hash, expires_at, password_hash)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at;
+	`
+
+	err := s.db.QueryRow(query, share.UserID, share.NoteID, share.FolderID, hash, share.ExpiresAt, share.PasswordHash.hash).Scan(&share.ID, &share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	share.hash = hash
+	share.HasPassword = share.PasswordHash.hash != nil
+	return share, nil
+}
+
+// GetUserShares returns the user's shares, expired ones included, newest
+// first.
+func (s *PostgresSharesStore) GetUserShares(user_id int64) ([]Share, error) {
+	query := `
+	SELECT s.id, s.user_id, s.note_id, s.folder_id, COALESCE(n.title, f.name, ''), s.expires_at, s.password_hash IS NOT NULL, s.created_at
+	FROM shares s
+	LEFT JOIN notes n ON n.id = s.note_id
+	LEFT JOIN folders f ON f.id = s.folder_id
+	WHERE s.user_id = $1
+	ORDER BY s.created_at DESC, s.id DESC;
+	`
+
+	rows, err := s.db.Query(query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []Share{}
+
+	for rows.Next() {
+		var share Share
+		err = rows.Scan(
+			&share.ID,
+			&share.UserID,
+			&share.NoteID,
+			&share.FolderID,
+			&share.Name,
+			&share.ExpiresAt,
+			&share.HasPassword,
+			&share.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+func (s *PostgresSharesStore) DeleteShare(user_id int64, share_id int64) error {
+	query := `
+	DELETE FROM shares
+	WHERE user_id = $1 AND id = $2;
+	`
+
+	result, err := s.db.Exec(query, user_id, share_id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetShareByToken looks a share up by the token in its link. Expired shares
+// and shares of trashed notes return sql.ErrNoRows.
+func (s *PostgresSharesStore) GetShareByToken(tokenPlainText string) (*Share, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	query := `
+	SELECT s.id, s.user_id, s.note_id, s.folder_id, COALESCE(n.title, f.name, ''), s.expires_at, s.password_hash, s.created_at
+	FROM shares s
+	LEFT JOIN notes n ON n.id = s.note_id
+	LEFT JOIN folders f ON f.id = s.folder_id
+	WHERE s.hash = $1
+		AND (s.expires_at IS NULL OR s.expires_at > $2)
+		AND (s.note_id IS NULL OR n.deleted_at IS NULL);
+	`
+
+	share := &Share{}
+	err := s.db.QueryRow(query, tokenHash[:], time.Now()).Scan(
+		&share.ID,
+		&share.UserID,
+		&share.NoteID,
+		&share.FolderID,
+		&share.Name,
+		&share.ExpiresAt,
+		&share.PasswordHash.hash,
+		&share.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	share.hash = tokenHash[:]
+	share.HasPassword = share.PasswordHash.hash != nil
+	return share, nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"database/sql"
+	"markdown-notes/internal/tokens"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShares(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	sharesStore := NewPostgresSharesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Theo2", "example@gmail.com", "Password")
+
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	folder := createSubFolder(t, db, *folderStore, user, rootFolderId, "shared")
+	note, err := notesStore.CreateNote(user.ID, rootFolderId, "Plan", "content")
+	assert.NoError(t, err)
+
+	noteToken, err := tokens.GenerateToken(user.ID, 0, tokens.ScopeShare)
+	assert.NoError(t, err)
+	noteShare := &Share{UserID: user.ID, NoteID: &note.ID}
+	noteShare.PasswordHash.Set("secret")
+	_, err = sharesStore.CreateShare(noteShare, noteToken.Hash)
+	assert.NoError(t, err)
+
+	folderToken, err := tokens.GenerateToken(user.ID, time.Hour, tokens.ScopeShare)
+	assert.NoError(t, err)
+	folderShare, err := sharesStore.CreateShare(&Share{UserID: user.ID, FolderID: &folder.ID, ExpiresAt: &folderToken.Expiry}, folderToken.Hash)
+	assert.NoError(t, err)
+
+	expiredToken, err := tokens.GenerateToken(user.ID, -time.Second, tokens.ScopeShare)
+	assert.NoError(t, err)
+	_, err = sharesStore.CreateShare(&Share{UserID: user.ID, FolderID: &folder.ID, ExpiresAt: &expiredToken.Expiry}, expiredToken.Hash)
+	assert.NoError(t, err)
+
+	t.Run("looks shares up by token", func(t *testing.T) {
+		share, err := sharesStore.GetShareByToken(noteToken.Plaintext)
+		assert.NoError(t, err)
+		assert.Equal(t, noteShare.ID, share.ID)
+		assert.Equal(t, "Plan", share.Name)
+		assert.True(t, share.HasPassword)
+		assert.Equal(t, noteShare.AccessKey(), share.AccessKey())
+
+		matches, err := share.PasswordHash.Matches("secret")
+		assert.NoError(t, err)
+		assert.True(t, matches)
+
+		share, err = sharesStore.GetShareByToken(folderToken.Plaintext)
+		assert.NoError(t, err)
+		assert.Equal(t, folder.ID, *share.FolderID)
+		assert.Nil(t, share.NoteID)
+		assert.False(t, share.HasPassword)
+		assert.NotEqual(t, noteShare.AccessKey(), share.AccessKey())
+	})
+
+	t.Run("expired and unknown tokens", func(t *testing.T) {
+		_, err := sharesStore.GetShareByToken(expiredToken.Plaintext)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, err = sharesStore.GetShareByToken("nope")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("lists the users shares", func(t *testing.T) {
+		shares, err := sharesStore.GetUserShares(user.ID)
+		assert.NoError(t, err)
+		assert.Len(t, shares, 3)
+
+		shares, err = sharesStore.GetUserShares(user2.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, shares)
+	})
+
+	t.Run("trashed notes aren't shared", func(t *testing.T) {
+		_, err := notesStore.TrashNote(user.ID, note.ID)
+		assert.NoError(t, err)
+
+		_, err = sharesStore.GetShareByToken(noteToken.Plaintext)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("deletes shares", func(t *testing.T) {
+		err := sharesStore.DeleteShare(user2.ID, folderShare.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		err = sharesStore.DeleteShare(user.ID, folderShare.ID)
+		assert.NoError(t, err)
+
+		_, err = sharesStore.GetShareByToken(folderToken.Plaintext)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+}
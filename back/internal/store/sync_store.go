@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SyncFolder and SyncNote are a folder and a note as of the change with
+// number ChangeSeq, their latest.
+type SyncFolder struct {
+	Folder
+	ChangeSeq int64 `json:"change_seq"`
+}
+
+type SyncNote struct {
+	Note
+	ChangeSeq int64 `json:"change_seq"`
+}
+
+// Tombstone is a note or a folder that was deleted for good, Type says
+// which. Trashed notes aren't deleted yet, they come as notes with DeletedAt
+// set.
+type Tombstone struct {
+	Type      string    `json:"type"`
+	ID        int64     `json:"id"`
+	FolderID  int64     `json:"folder_id"`
+	ChangeSeq int64     `json:"change_seq"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// SyncChanges are the changes in a workspace after a change number. Seq is
+// the number to ask for changes after next time, More says whether there
+// were more changes than fit.
+type SyncChanges struct {
+	Seq        int64        `json:"seq"`
+	More       bool         `json:"more"`
+	Folders    []SyncFolder `json:"folders"`
+	Notes      []SyncNote   `json:"notes"`
+	Tombstones []Tombstone  `json:"tombstones"`
+}
+
+type PostgresSyncStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSyncStore(db *sql.DB) *PostgresSyncStore {
+	return &PostgresSyncStore{db: db}
+}
+
+type SyncStore interface {
+	GetChanges(user_id int64, workspace_id int64, since int64, limit int) (*SyncChanges, error)
+	FolderChangedSince(user_id int64, folder_id int64, since int64) (bool, error)
+}
+
+// GetChanges returns up to limit changes after since to the notes and
+// folders of the workspace the user can see, oldest first and each note or
+// folder only as it is now. When everything fit, Seq is the workspace's
+// latest change number, so changes the user can't see aren't looked at
+// again.
+func (s *PostgresSyncStore) GetChanges(user_id int64, workspace_id int64, since int64, limit int) (*SyncChanges, error) {
+	query := `
+	WITH visible AS (
+		SELECT folder_id FROM workspace_folders($1, $2)
+	)
+	SELECT kind, id, user_id, folder_id, name, note, version, change_seq, created_at, updated_at, deleted_at
+	FROM (
+		SELECT 'folder' AS kind, f.id, f.user_id, f.parent_id AS folder_id, f.name, '' AS note, 0::BIGINT AS version,
+			f.change_seq, f.created_at, f.updated_at, NULL::TIMESTAMPTZ AS deleted_at
+		FROM folders f
+		WHERE f.change_seq > $3 AND f.id IN (SELECT folder_id FROM visible)
+		UNION ALL
+		SELECT 'note', n.id, n.user_id, n.folder_id, n.title, n.note, n.version,
+			n.change_seq, n.created_at, n.updated_at, n.deleted_at
+		FROM notes n
+		WHERE n.change_seq > $3 AND n.folder_id IN (SELECT folder_id FROM visible)
+		UNION ALL
+		SELECT 'tombstone', t.id, 0, t.folder_id, t.type, '', 0,
+			t.change_seq, t.deleted_at, t.deleted_at, t.deleted_at
+		FROM tombstones t
+		WHERE t.workspace_id = $2 AND t.change_seq > $3 AND t.folder_id IN (SELECT folder_id FROM visible)
+	) changes
+	ORDER BY change_seq
+	LIMIT $4;
+	`
+
+	// the changes and the latest change number have to be from the same
+	// snapshot
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query, user_id, workspace_id, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := &SyncChanges{
+		Seq:        since,
+		Folders:    []SyncFolder{},
+		Notes:      []SyncNote{},
+		Tombstones: []Tombstone{},
+	}
+
+	n := 0
+	for rows.Next() {
+		n++
+		if n > limit {
+			changes.More = true
+			break
+		}
+
+		var (
+			kind, name, note     string
+			id, userID, version  int64
+			folderID             *int64
+			changeSeq            int64
+			createdAt, updatedAt time.Time
+			deletedAt            *time.Time
+		)
+		err = rows.Scan(&kind, &id, &userID, &folderID, &name, &note, &version, &changeSeq, &createdAt, &updatedAt, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes.Seq = changeSeq
+
+		switch kind {
+		case "folder":
+			changes.Folders = append(changes.Folders, SyncFolder{
+				Folder: Folder{
+					ID:          id,
+					UserID:      userID,
+					WorkspaceID: workspace_id,
+					ParentID:    folderID,
+					Name:        name,
+					CreatedAt:   createdAt,
+					UpdatedAt:   updatedAt,
+				},
+				ChangeSeq: changeSeq,
+			})
+		case "note":
+			changes.Notes = append(changes.Notes, SyncNote{
+				Note: Note{
+					ID:        id,
+					FolderID:  *folderID,
+					Title:     name,
+					Note:      note,
+					Version:   version,
+					CreatedAt: createdAt,
+					UpdatedAt: updatedAt,
+					DeletedAt: deletedAt,
+				},
+				ChangeSeq: changeSeq,
+			})
+		default:
+			changes.Tombstones = append(changes.Tombstones, Tombstone{
+				Type:      name,
+				ID:        id,
+				FolderID:  *folderID,
+				ChangeSeq: changeSeq,
+				DeletedAt: *deletedAt,
+			})
+		}
+	}
+	rows.Close()
+
+	if !changes.More {
+		query = `
+		SELECT change_seq
+		FROM workspaces
+		WHERE id = $1;
+		`
+
+		err = tx.QueryRow(query, workspace_id).Scan(&changes.Seq)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// FolderChangedSince reports whether the folder, or anything in it, changed
+// after the change number since. The user needs access to the folder.
+func (s *PostgresSyncStore) FolderChangedSince(user_id int64, folder_id int64, since int64) (bool, error) {
+	query := `
+	WITH RECURSIVE tree AS (
+		SELECT id, change_seq
+		FROM folders
+		WHERE id = $2 AND folder_role($1, id) IS NOT NULL
+		UNION ALL
+		SELECT f.id, f.change_seq
+		FROM folders f
+		INNER JOIN tree t ON f.parent_id = t.id
+	)
+	SELECT
+		(SELECT COUNT(*) FROM tree) > 0,
+		EXISTS (SELECT 1 FROM tree WHERE change_seq > $3)
+		OR EXISTS (SELECT 1 FROM notes WHERE folder_id IN (SELECT id FROM tree) AND change_seq > $3)
+		OR EXISTS (SELECT 1 FROM tombstones WHERE folder_id IN (SELECT id FROM tree) AND change_seq > $3);
+	`
+
+	var found, changed bool
+	err := s.db.QueryRow(query, user_id, folder_id, since).Scan(&found, &changed)
+	if err != nil {
+		return false, err
+	}
+
+	if !found {
+		return false, sql.ErrNoRows
+	}
+
+	return changed, nil
+}
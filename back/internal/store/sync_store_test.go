@@ -0,0 +1,130 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncChanges(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	syncStore := NewPostgresSyncStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	workspacesStore := NewPostgresWorkspacesStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Theo2", "example@gmail.com", "Password")
+
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+	CreateRootFolder(t, db, *folderStore, user2)
+	workspace, err := workspacesStore.GetPersonalWorkspace(user.ID)
+	assert.NoError(t, err)
+
+	initial, err := syncStore.GetChanges(user.ID, workspace.ID, 0, 100)
+	assert.NoError(t, err)
+	assert.Len(t, initial.Folders, 1)
+	assert.Empty(t, initial.Notes)
+	assert.False(t, initial.More)
+
+	folder := createSubFolder(t, db, *folderStore, user, rootFolderId, "Projects")
+	note, err := notesStore.CreateNote(user.ID, folder.ID, "Plan", "content")
+	assert.NoError(t, err)
+	note2, err := notesStore.CreateNote(user.ID, rootFolderId, "Todo", "content")
+	assert.NoError(t, err)
+	_, err = notesStore.UpdateNote(user.ID, note.ID, "more content")
+	assert.NoError(t, err)
+	_, err = notesStore.TrashNote(user.ID, note2.ID)
+	assert.NoError(t, err)
+	err = notesStore.PurgeNote(user.ID, note2.ID)
+	assert.NoError(t, err)
+
+	t.Run("returns what changed since, as it is now", func(t *testing.T) {
+		changes, err := syncStore.GetChanges(user.ID, workspace.ID, initial.Seq, 100)
+		assert.NoError(t, err)
+		assert.False(t, changes.More)
+
+		assert.Len(t, changes.Folders, 1)
+		assert.Equal(t, folder.ID, changes.Folders[0].ID)
+
+		assert.Len(t, changes.Notes, 1)
+		assert.Equal(t, "more content", changes.Notes[0].Note.Note)
+		assert.Equal(t, int64(2), changes.Notes[0].Version)
+
+		assert.Equal(t, []Tombstone{{
+			Type:      "note",
+			ID:        note2.ID,
+			FolderID:  rootFolderId,
+			ChangeSeq: changes.Seq,
+			DeletedAt: changes.Tombstones[0].DeletedAt,
+		}}, changes.Tombstones)
+
+		again, err := syncStore.GetChanges(user.ID, workspace.ID, changes.Seq, 100)
+		assert.NoError(t, err)
+		assert.Empty(t, again.Folders)
+		assert.Empty(t, again.Notes)
+		assert.Empty(t, again.Tombstones)
+		assert.Equal(t, changes.Seq, again.Seq)
+	})
+
+	t.Run("pages through changes", func(t *testing.T) {
+		first, err := syncStore.GetChanges(user.ID, workspace.ID, initial.Seq, 1)
+		assert.NoError(t, err)
+		assert.True(t, first.More)
+		assert.Len(t, first.Folders, 1)
+
+		rest, err := syncStore.GetChanges(user.ID, workspace.ID, first.Seq, 100)
+		assert.NoError(t, err)
+		assert.False(t, rest.More)
+		assert.Len(t, rest.Notes, 1)
+		assert.Len(t, rest.Tombstones, 1)
+	})
+
+	t.Run("only returns what the user can see", func(t *testing.T) {
+		changes, err := syncStore.GetChanges(user2.ID, workspace.ID, 0, 100)
+		assert.NoError(t, err)
+		assert.Empty(t, changes.Folders)
+		assert.Empty(t, changes.Notes)
+		assert.Empty(t, changes.Tombstones)
+	})
+
+	t.Run("tells whether a folder changed", func(t *testing.T) {
+		changed, err := syncStore.FolderChangedSince(user.ID, folder.ID, initial.Seq)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+
+		latest, err := syncStore.GetChanges(user.ID, workspace.ID, 0, 100)
+		assert.NoError(t, err)
+		changed, err = syncStore.FolderChangedSince(user.ID, folder.ID, latest.Seq)
+		assert.NoError(t, err)
+		assert.False(t, changed)
+
+		_, err = syncStore.FolderChangedSince(user2.ID, folder.ID, 0)
+		assert.Error(t, err)
+	})
+
+	t.Run("moved folders bring along what is in them", func(t *testing.T) {
+		archive := createSubFolder(t, db, *folderStore, user, rootFolderId, "Archive")
+		old := createSubFolder(t, db, *folderStore, user, archive.ID, "Old")
+		archived, err := notesStore.CreateNote(user.ID, old.ID, "Archived", "content")
+		assert.NoError(t, err)
+
+		latest, err := syncStore.GetChanges(user.ID, workspace.ID, 0, 100)
+		assert.NoError(t, err)
+
+		_, err = folderStore.UpdateFolder(user.ID, archive.ID, folder.ID, "Archive")
+		assert.NoError(t, err)
+
+		changes, err := syncStore.GetChanges(user.ID, workspace.ID, latest.Seq, 100)
+		assert.NoError(t, err)
+		if assert.Len(t, changes.Folders, 2) {
+			assert.Equal(t, archive.ID, changes.Folders[0].ID)
+			assert.Equal(t, old.ID, changes.Folders[1].ID)
+		}
+		if assert.Len(t, changes.Notes, 1) {
+			assert.Equal(t, archived.ID, changes.Notes[0].ID)
+		}
+	})
+}
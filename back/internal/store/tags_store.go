@@ -0,0 +1,200 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+
+	"markdown-notes/internal/markdown"
+)
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+type PostgresTagsStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTagsStore(db *sql.DB) *PostgresTagsStore {
+	return &PostgresTagsStore{db: db}
+}
+
+type TagsStore interface {
+	GetTags(user_id int64, workspace_id int64, prefix string) ([]TagCount, error)
+	GetNotesWithTag(user_id int64, workspace_id int64, tag string) ([]Note, error)
+	GetNoteTags(user_id int64, note_id int64) ([]string, error)
+	GetFoldersNoteTags(user_id int64, folder_ids []int64) (map[int64][]string, error)
+}
+
+// likePrefix escapes a tag for use as the start of a LIKE pattern.
+func likePrefix(tag string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(tag) + "/%"
+}
+
+// GetTags counts how many of the notes the user has access to in the
+// workspace, or in any workspace when workspace_id is 0, carry each tag. A
+// prefix limits the result to that tag and the tags nested below it.
+func (t *PostgresTagsStore) GetTags(user_id int64, workspace_id int64, prefix string) ([]TagCount, error) {
+	query := `
+	SELECT nt.tag, COUNT(*)
+	FROM note_tags nt
+	INNER JOIN notes n ON n.id = nt.note_id
+	WHERE n.folder_id IN (SELECT folder_id FROM workspace_folders($1, $4)) AND n.deleted_at IS NULL
+		AND ($2 = '' OR nt.tag = $2 OR nt.tag LIKE $3)
+	GROUP BY nt.tag
+	ORDER BY nt.tag;
+	`
+
+	rows, err := t.db.Query(query, user_id, prefix, likePrefix(prefix), workspace_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+
+	for rows.Next() {
+		var tag TagCount
+		err = rows.Scan(&tag.Tag, &tag.Count)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// GetNotesWithTag returns the notes tagged with tag or with any tag nested
+// below it, so "project" also finds notes tagged "project/alpha". A
+// workspace_id of 0 looks in every workspace.
+func (t *PostgresTagsStore) GetNotesWithTag(user_id int64, workspace_id int64, tag string) ([]Note, error) {
+	query := `
+	SELECT n.id, n.folder_id, n.title, n.note, n.version, n.created_at, n.updated_at
+	FROM notes n
+	WHERE n.folder_id IN (SELECT folder_id FROM workspace_folders($1, $4)) AND n.deleted_at IS NULL
+		AND EXISTS (
+			SELECT 1
+			FROM note_tags nt
+			WHERE nt.note_id = n.id AND (nt.tag = $2 OR nt.tag LIKE $3)
+		)
+	ORDER BY n.updated_at DESC;
+	`
+
+	rows, err := t.db.Query(query, user_id, tag, likePrefix(tag), workspace_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []Note{}
+
+	for rows.Next() {
+		var note Note
+		err = rows.Scan(
+			&note.ID,
+			&note.FolderID,
+			&note.Title,
+			&note.Note,
+			&note.Version,
+			&note.CreatedAt,
+			&note.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+
+	return notes, nil
+}
+
+func (t *PostgresTagsStore) GetNoteTags(user_id int64, note_id int64) ([]string, error) {
+	query := `
+	SELECT nt.tag
+	FROM note_tags nt
+	INNER JOIN notes n ON n.id = nt.note_id
+	WHERE n.id = $2 AND folder_role($1, n.folder_id) IS NOT NULL
+	ORDER BY nt.tag;
+	`
+
+	rows, err := t.db.Query(query, user_id, note_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+
+	for rows.Next() {
+		var tag string
+		err = rows.Scan(&tag)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// GetFoldersNoteTags returns the tags of every note in the folders, by note
+// id. Notes without tags are left out.
+func (t *PostgresTagsStore) GetFoldersNoteTags(user_id int64, folder_ids []int64) (map[int64][]string, error) {
+	query := `
+	SELECT nt.note_id, nt.tag
+	FROM note_tags nt
+	INNER JOIN notes n ON n.id = nt.note_id
+	WHERE n.folder_id = ANY($2::BIGINT[]) AND n.deleted_at IS NULL
+		AND folder_role($1, n.folder_id) IS NOT NULL
+	ORDER BY nt.note_id, nt.tag;
+	`
+
+	rows, err := t.db.Query(query, user_id, folder_ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := map[int64][]string{}
+
+	for rows.Next() {
+		var note_id int64
+		var tag string
+		err = rows.Scan(&note_id, &tag)
+		if err != nil {
+			return nil, err
+		}
+		tags[note_id] = append(tags[note_id], tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// saveTags replaces the stored tags of a note with the ones found in its
+// current content, inside the transaction that saved the note.
+func saveTags(tx *sql.Tx, note *Note) error {
+	query := `
+	DELETE FROM note_tags
+	WHERE note_id = $1;
+	`
+
+	_, err := tx.Exec(query, note.ID)
+	if err != nil {
+		return err
+	}
+
+	tags := markdown.ExtractTags(note.Note)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	query = `
+	INSERT INTO note_tags (note_id, tag)
+	SELECT $1, unnest($2::TEXT[]);
+	`
+
+	_, err = tx.Exec(query, note.ID, tags)
+	return err
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTags(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	tagsStore := NewPostgresTagsStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	user2 := CreateTestUser(t, db, userStore, "Other", "other@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+
+	one, err := notesStore.CreateNote(user.ID, rootFolderId, "one", "#work #project/alpha")
+	assert.NoError(t, err)
+	two, err := notesStore.CreateNote(user.ID, rootFolderId, "two", "---\ntags: [work]\n---\n#project/beta")
+	assert.NoError(t, err)
+
+	t.Run("counts tags across notes", func(t *testing.T) {
+		tags, err := tagsStore.GetTags(user.ID, 0, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []TagCount{
+			{Tag: "project/alpha", Count: 1},
+			{Tag: "project/beta", Count: 1},
+			{Tag: "work", Count: 2},
+		}, tags)
+	})
+
+	t.Run("filters by prefix", func(t *testing.T) {
+		tags, err := tagsStore.GetTags(user.ID, 0, "project")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(tags))
+	})
+
+	t.Run("does not return other user's tags", func(t *testing.T) {
+		tags, err := tagsStore.GetTags(user2.ID, 0, "")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(tags))
+	})
+
+	t.Run("returns the tags of the notes in folders", func(t *testing.T) {
+		tags, err := tagsStore.GetFoldersNoteTags(user.ID, []int64{rootFolderId})
+		assert.NoError(t, err)
+		assert.Equal(t, map[int64][]string{
+			one.ID: {"project/alpha", "work"},
+			two.ID: {"project/beta", "work"},
+		}, tags)
+
+		tags, err = tagsStore.GetFoldersNoteTags(user2.ID, []int64{rootFolderId})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(tags))
+	})
+}
+
+func TestGetNotesWithTag(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	tagsStore := NewPostgresTagsStore(db)
+
+	user := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	rootFolderId := CreateRootFolder(t, db, *folderStore, user)
+
+	alpha, err := notesStore.CreateNote(user.ID, rootFolderId, "alpha", "#project/alpha")
+	assert.NoError(t, err)
+	projects, err := notesStore.CreateNote(user.ID, rootFolderId, "projects", "#project")
+	assert.NoError(t, err)
+	_, err = notesStore.CreateNote(user.ID, rootFolderId, "lookalike", "#projects")
+	assert.NoError(t, err)
+
+	t.Run("matches nested tags by prefix", func(t *testing.T) {
+		notes, err := tagsStore.GetNotesWithTag(user.ID, 0, "project")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(notes))
+	})
+
+	t.Run("matches exact nested tag", func(t *testing.T) {
+		notes, err := tagsStore.GetNotesWithTag(user.ID, 0, "project/alpha")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(notes))
+		assert.Equal(t, alpha.ID, notes[0].ID)
+	})
+
+	t.Run("tags follow note updates", func(t *testing.T) {
+		_, err := notesStore.UpdateNote(user.ID, projects.ID, "no more tags")
+		assert.NoError(t, err)
+
+		tags, err := tagsStore.GetNoteTags(user.ID, projects.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(tags))
+
+		notes, err := tagsStore.GetNotesWithTag(user.ID, 0, "project")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(notes))
+	})
+
+	t.Run("trashed notes are hidden", func(t *testing.T) {
+		_, err := notesStore.TrashNote(user.ID, alpha.ID)
+		assert.NoError(t, err)
+
+		notes, err := tagsStore.GetNotesWithTag(user.ID, 0, "project")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(notes))
+	})
+}
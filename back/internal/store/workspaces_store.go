@@ -0,0 +1,432 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"markdown-notes/internal/tokens"
+)
+
+var ErrLastAdmin = errors.New("a workspace needs at least one admin")
+
+// WorkspaceRole is what a user may do in a workspace. Admins own every folder
+// in it and manage who belongs to it, members can edit every folder, guests
+// only see the folders they were given a role on through folder_members.
+type WorkspaceRole string
+
+const (
+	WorkspaceRoleGuest  WorkspaceRole = "guest"
+	WorkspaceRoleMember WorkspaceRole = "member"
+	WorkspaceRoleAdmin  WorkspaceRole = "admin"
+)
+
+func (r WorkspaceRole) Valid() bool {
+	return r == WorkspaceRoleGuest || r == WorkspaceRoleMember || r == WorkspaceRoleAdmin
+}
+
+// Workspace is a folder tree shared by its members. Every user has a
+// personal one, made when they register, that nobody else can join.
+type Workspace struct {
+	ID           int64         `json:"id"`
+	Name         string        `json:"name"`
+	Personal     bool          `json:"personal"`
+	Role         WorkspaceRole `json:"role"`
+	RootFolderID int64         `json:"root_folder_id"`
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+// WorkspaceMember is a user belonging to a workspace.
+type WorkspaceMember struct {
+	UserID    int64         `json:"user_id"`
+	Username  string        `json:"username"`
+	Role      WorkspaceRole `json:"role"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+type PostgresWorkspacesStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWorkspacesStore(db *sql.DB) *PostgresWorkspacesStore {
+	return &PostgresWorkspacesStore{db: db}
+}
+
+// WorkspacesStore manages workspaces and who belongs to them. Apart from
+// GetWorkspace, the caller checks the acting user may manage the workspace.
+type WorkspacesStore interface {
+	CreateWorkspace(user_id int64, name string) (*Workspace, error)
+	CreateWorkspaceTx(tx *sql.Tx, user_id int64, name string, personal bool) (*Workspace, error)
+	GetUserWorkspaces(user_id int64) ([]Workspace, error)
+	GetWorkspace(user_id int64, workspace_id int64) (*Workspace, error)
+	GetPersonalWorkspace(user_id int64) (*Workspace, error)
+	GetWorkspaceMembers(workspace_id int64) ([]WorkspaceMember, error)
+	UpdateWorkspaceMember(workspace_id int64, user_id int64, role WorkspaceRole) (*WorkspaceMember, error)
+	DeleteWorkspaceMember(workspace_id int64, user_id int64) error
+	CreateInvitation(workspace_id int64, role WorkspaceRole, token *tokens.Token) error
+	AcceptInvitation(user_id int64, tokenPlainText string) (*Workspace, error)
+}
+
+func (w *PostgresWorkspacesStore) CreateWorkspace(user_id int64, name string) (*Workspace, error) {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	workspace, err := w.CreateWorkspaceTx(tx, user_id, name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+// CreateWorkspaceTx creates a workspace with its root folder as part of a
+// larger transaction, making user_id its admin.
+func (w *PostgresWorkspacesStore) CreateWorkspaceTx(tx *sql.Tx, user_id int64, name string, personal bool) (*Workspace, error) {
+	var personal_user_id *int64
+	if personal {
+		personal_user_id = &user_id
+	}
+
+	workspace := &Workspace{Name: name, Personal: personal, Role: WorkspaceRoleAdmin}
+
+	query := `
+	INSERT INTO workspaces (name, personal_user_id)
+	VALUES ($1, $2)
+	RETURNING id, created_at;
+	`
+
+	err := tx.QueryRow(query, name, personal_user_id).Scan(&workspace.ID, &workspace.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	INSERT INTO workspace_members (workspace_id, user_id, role)
+	VALUES ($1, $2, $3);
+	`
+
+	_, err = tx.Exec(query, workspace.ID, user_id, WorkspaceRoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	INSERT INTO folders (user_id, workspace_id, parent_id, name)
+	VALUES ($1, $2, NULL, 'root')
+	RETURNING id;
+	`
+
+	err = tx.QueryRow(query, user_id, workspace.ID).Scan(&workspace.RootFolderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+// GetUserWorkspaces lists the workspaces the user belongs to, their personal
+// one first.
+func (w *PostgresWorkspacesStore) GetUserWorkspaces(user_id int64) ([]Workspace, error) {
+	query := `
+	SELECT ws.id, ws.name, ws.personal_user_id IS NOT NULL, m.role, f.id, ws.created_at
+	FROM workspaces ws
+	INNER JOIN workspace_members m ON m.workspace_id = ws.id
+	INNER JOIN folders f ON f.workspace_id = ws.id AND f.parent_id IS NULL
+	WHERE m.user_id = $1
+	ORDER BY ws.personal_user_id IS NULL, ws.name, ws.id;
+	`
+
+	rows, err := w.db.Query(query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []Workspace{}
+
+	for rows.Next() {
+		var workspace Workspace
+		err = rows.Scan(
+			&workspace.ID,
+			&workspace.Name,
+			&workspace.Personal,
+			&workspace.Role,
+			&workspace.RootFolderID,
+			&workspace.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+// GetWorkspace returns a workspace with the user's role in it, or
+// sql.ErrNoRows if the user doesn't belong to it.
+func (w *PostgresWorkspacesStore) GetWorkspace(user_id int64, workspace_id int64) (*Workspace, error) {
+	query := `
+	SELECT ws.id, ws.name, ws.personal_user_id IS NOT NULL, m.role, f.id, ws.created_at
+	FROM workspaces ws
+	INNER JOIN workspace_members m ON m.workspace_id = ws.id
+	INNER JOIN folders f ON f.workspace_id = ws.id AND f.parent_id IS NULL
+	WHERE m.user_id = $1 AND ws.id = $2;
+	`
+
+	return scanWorkspace(w.db.QueryRow(query, user_id, workspace_id))
+}
+
+func (w *PostgresWorkspacesStore) GetPersonalWorkspace(user_id int64) (*Workspace, error) {
+	query := `
+	SELECT ws.id, ws.name, ws.personal_user_id IS NOT NULL, m.role, f.id, ws.created_at
+	FROM workspaces ws
+	INNER JOIN workspace_members m ON m.workspace_id = ws.id
+	INNER JOIN folders f ON f.workspace_id = ws.id AND f.parent_id IS NULL
+	WHERE m.user_id = $1 AND ws.personal_user_id = $1;
+	`
+
+	return scanWorkspace(w.db.QueryRow(query, user_id))
+}
+
+func scanWorkspace(row *sql.Row) (*Workspace, error) {
+	var workspace Workspace
+	err := row.Scan(
+		&workspace.ID,
+		&workspace.Name,
+		&workspace.Personal,
+		&workspace.Role,
+		&workspace.RootFolderID,
+		&workspace.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+func (w *PostgresWorkspacesStore) GetWorkspaceMembers(workspace_id int64) ([]WorkspaceMember, error) {
+	query := `
+	SELECT u.id, u.username, m.role, m.created_at
+	FROM workspace_members m
+	INNER JOIN users u ON u.id = m.user_id
+	WHERE m.workspace_id = $1
+	ORDER BY u.username;
+	`
+
+	rows, err := w.db.Query(query, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []WorkspaceMember{}
+
+	for rows.Next() {
+		var member WorkspaceMember
+		err = rows.Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// UpdateWorkspaceMember changes a member's role, returning ErrLastAdmin
+// rather than leave the workspace without an admin.
+func (w *PostgresWorkspacesStore) UpdateWorkspaceMember(workspace_id int64, user_id int64, role WorkspaceRole) (*WorkspaceMember, error) {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	WITH updated AS (
+		UPDATE workspace_members
+		SET role = $3
+		WHERE workspace_id = $1 AND user_id = $2
+		RETURNING user_id, role, created_at
+	)
+	SELECT p.user_id, u.username, p.role, p.created_at
+	FROM updated p
+	INNER JOIN users u ON u.id = p.user_id;
+	`
+
+	var member WorkspaceMember
+	err = tx.QueryRow(query, workspace_id, user_id, role).Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkAdminLeft(tx, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// DeleteWorkspaceMember removes a user from a workspace, returning
+// ErrLastAdmin rather than leave the workspace without an admin.
+func (w *PostgresWorkspacesStore) DeleteWorkspaceMember(workspace_id int64, user_id int64) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	DELETE FROM workspace_members
+	WHERE workspace_id = $1 AND user_id = $2;
+	`
+
+	result, err := tx.Exec(query, workspace_id, user_id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = checkAdminLeft(tx, workspace_id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func checkAdminLeft(tx *sql.Tx, workspace_id int64) error {
+	query := `
+	SELECT EXISTS (
+		SELECT 1
+		FROM workspace_members
+		WHERE workspace_id = $1 AND role = 'admin'
+	);
+	`
+
+	var exists bool
+	err := tx.QueryRow(query, workspace_id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrLastAdmin
+	}
+
+	return nil
+}
+
+// CreateInvitation saves an invitation token, whoever accepts it joins the
+// workspace with role.
+func (w *PostgresWorkspacesStore) CreateInvitation(workspace_id int64, role WorkspaceRole, token *tokens.Token) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO tokens (hash, user_id, expiry, scope)
+	VALUES ($1, $2, $3, $4);
+	`
+
+	_, err = tx.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO workspace_invitations (hash, workspace_id, role)
+	VALUES ($1, $2, $3);
+	`
+
+	_, err = tx.Exec(query, token.Hash, workspace_id, role)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AcceptInvitation adds the user to the workspace an invitation is for and
+// uses the invitation up. Users who already belong to the workspace keep the
+// stronger of their role and the invited one. Unknown and expired tokens
+// return sql.ErrNoRows.
+func (w *PostgresWorkspacesStore) AcceptInvitation(user_id int64, tokenPlainText string) (*Workspace, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	DELETE FROM tokens t
+	USING workspace_invitations i
+	WHERE t.hash = $1 AND i.hash = t.hash AND t.scope = $2 AND t.expiry > $3
+	RETURNING i.workspace_id, i.role;
+	`
+
+	var (
+		workspace_id int64
+		role         WorkspaceRole
+	)
+	err = tx.QueryRow(query, tokenHash[:], tokens.ScopeInvitation, time.Now()).Scan(&workspace_id, &role)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	INSERT INTO workspace_members (workspace_id, user_id, role)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (workspace_id, user_id) DO UPDATE
+	SET role = GREATEST(workspace_members.role, EXCLUDED.role);
+	`
+
+	_, err = tx.Exec(query, workspace_id, user_id, role)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return w.GetWorkspace(user_id, workspace_id)
+}
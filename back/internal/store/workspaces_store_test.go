@@ -0,0 +1,139 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"markdown-notes/internal/tokens"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkspaces(t *testing.T) {
+	db := SetupTestDB(t)
+	TruncateTables(t, db)
+	workspacesStore := NewPostgresWorkspacesStore(db)
+	folderStore := NewPostgresFoldersStore(db)
+	userStore := NewPostgresUserStore(db)
+	notesStore := NewPostgresNotesStore(db)
+	tagsStore := NewPostgresTagsStore(db)
+
+	admin := CreateTestUser(t, db, userStore, "Theo", "drumandbassbob@gmail.com", "Password")
+	member := CreateTestUser(t, db, userStore, "Theo2", "example@gmail.com", "Password")
+	guest := CreateTestUser(t, db, userStore, "Theo3", "guest@gmail.com", "Password")
+
+	personalRoot := CreateRootFolder(t, db, *folderStore, admin)
+	CreateRootFolder(t, db, *folderStore, member)
+	CreateRootFolder(t, db, *folderStore, guest)
+
+	team, err := workspacesStore.CreateWorkspace(admin.ID, "Team")
+	assert.NoError(t, err)
+	assert.Equal(t, WorkspaceRoleAdmin, team.Role)
+	assert.False(t, team.Personal)
+
+	docs := createSubFolder(t, db, *folderStore, admin, team.RootFolderID, "Docs")
+	assert.Equal(t, team.ID, docs.WorkspaceID)
+	guide, err := notesStore.CreateNote(admin.ID, docs.ID, "Guide", "#team read me")
+	assert.NoError(t, err)
+	_, err = notesStore.CreateNote(admin.ID, personalRoot, "Diary", "#private read me")
+	assert.NoError(t, err)
+
+	invite := func(role WorkspaceRole) *tokens.Token {
+		token, err := tokens.GenerateToken(admin.ID, time.Hour, tokens.ScopeInvitation)
+		assert.NoError(t, err)
+		assert.NoError(t, workspacesStore.CreateInvitation(team.ID, role, token))
+		return token
+	}
+
+	t.Run("lists the user's workspaces, personal first", func(t *testing.T) {
+		workspaces, err := workspacesStore.GetUserWorkspaces(admin.ID)
+		assert.NoError(t, err)
+		assert.Len(t, workspaces, 2)
+		assert.True(t, workspaces[0].Personal)
+		assert.Equal(t, personalRoot, workspaces[0].RootFolderID)
+		assert.Equal(t, "Team", workspaces[1].Name)
+
+		_, err = workspacesStore.GetWorkspace(member.ID, team.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("invitations are used up when accepted", func(t *testing.T) {
+		token := invite(WorkspaceRoleMember)
+
+		workspace, err := workspacesStore.AcceptInvitation(member.ID, token.Plaintext)
+		assert.NoError(t, err)
+		assert.Equal(t, team.ID, workspace.ID)
+		assert.Equal(t, WorkspaceRoleMember, workspace.Role)
+
+		_, err = workspacesStore.AcceptInvitation(guest.ID, token.Plaintext)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		_, err = workspacesStore.AcceptInvitation(guest.ID, invite(WorkspaceRoleGuest).Plaintext)
+		assert.NoError(t, err)
+	})
+
+	t.Run("workspace roles become folder roles", func(t *testing.T) {
+		role, err := folderStore.FolderRole(admin.ID, docs.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, RoleOwner, role)
+
+		role, err = folderStore.FolderRole(member.ID, docs.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, RoleEditor, role)
+
+		role, err = folderStore.FolderRole(guest.ID, docs.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, RoleNone, role)
+
+		_, err = notesStore.UpdateNote(member.ID, guide.ID, "#team changed")
+		assert.NoError(t, err)
+	})
+
+	t.Run("listings can be narrowed to a workspace", func(t *testing.T) {
+		tags, err := tagsStore.GetTags(admin.ID, team.ID, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []TagCount{{Tag: "team", Count: 1}}, tags)
+
+		tags, err = tagsStore.GetTags(admin.ID, 0, "")
+		assert.NoError(t, err)
+		assert.Len(t, tags, 2)
+
+		hits, _, err := notesStore.SearchNotes(admin.ID, team.ID, "read", 10, 0)
+		assert.NoError(t, err)
+		assert.Len(t, hits, 1)
+		assert.Equal(t, "/Docs", hits[0].FolderPath)
+	})
+
+	t.Run("notes can't move between workspaces", func(t *testing.T) {
+		_, err := notesStore.PatchNote(admin.ID, guide.ID, NoteUpdate{FolderID: &personalRoot})
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		path, err := folderStore.GetFolderPath(docs.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Docs"}, path)
+	})
+
+	t.Run("a workspace keeps at least one admin", func(t *testing.T) {
+		_, err := workspacesStore.UpdateWorkspaceMember(team.ID, admin.ID, WorkspaceRoleMember)
+		assert.ErrorIs(t, err, ErrLastAdmin)
+
+		err = workspacesStore.DeleteWorkspaceMember(team.ID, admin.ID)
+		assert.ErrorIs(t, err, ErrLastAdmin)
+
+		updated, err := workspacesStore.UpdateWorkspaceMember(team.ID, member.ID, WorkspaceRoleAdmin)
+		assert.NoError(t, err)
+		assert.Equal(t, WorkspaceRoleAdmin, updated.Role)
+
+		err = workspacesStore.DeleteWorkspaceMember(team.ID, admin.ID)
+		assert.NoError(t, err)
+
+		members, err := workspacesStore.GetWorkspaceMembers(team.ID)
+		assert.NoError(t, err)
+		assert.Len(t, members, 2)
+
+		role, err := folderStore.FolderRole(admin.ID, docs.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, RoleNone, role)
+	})
+}
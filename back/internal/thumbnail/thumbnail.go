@@ -0,0 +1,159 @@
+// Package thumbnail produces scaled down copies of PNG, JPEG and GIF images.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"markdown-notes/internal/exif"
+
+	"golang.org/x/image/draw"
+)
+
+var ErrUnsupported = errors.New("thumbnails are only available for png, jpeg and gif images")
+
+// Sizes maps each thumbnail size to the longest side it is scaled to fit.
+var Sizes = map[string]int{
+	"small":  256,
+	"medium": 1024,
+}
+
+// maxPixels guards against decompression bombs, images larger than this are
+// not decoded.
+const maxPixels = 50_000_000
+
+// Supported reports whether thumbnails can be made for a content type.
+func Supported(content_type string) bool {
+	switch content_type {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	default:
+		return false
+	}
+}
+
+// Thumbnail is an encoded thumbnail image.
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Generate scales an image to fit within maxSide pixels on its longest side,
+// turning it upright according to its EXIF orientation. Images are never
+// scaled up. JPEGs stay JPEGs, everything else becomes a PNG. Re-encoding
+// leaves all metadata behind.
+func Generate(data []byte, maxSide int) (*Thumbnail, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, errors.New("image is too large to make a thumbnail of")
+	}
+
+	var src image.Image
+	switch format {
+	case "jpeg":
+		src, err = jpeg.Decode(bytes.NewReader(data))
+	case "png":
+		src, err = png.Decode(bytes.NewReader(data))
+	case "gif":
+		src, err = gif.Decode(bytes.NewReader(data))
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	orientation := 1
+	if format == "jpeg" || format == "png" {
+		orientation = exif.Orientation(data)
+	}
+
+	bounds := src.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy(), maxSide)
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), src, bounds, draw.Src, nil)
+
+	dst := orient(scaled, orientation)
+
+	var buf bytes.Buffer
+	contentType := "image/png"
+	if format == "jpeg" {
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Thumbnail{
+		Data:        buf.Bytes(),
+		ContentType: contentType,
+		Width:       dst.Bounds().Dx(),
+		Height:      dst.Bounds().Dy(),
+	}, nil
+}
+
+// fit scales width and height down to fit within maxSide, keeping the
+// aspect ratio.
+func fit(width int, height int, maxSide int) (int, int) {
+	if width <= maxSide && height <= maxSide {
+		return width, height
+	}
+
+	if width >= height {
+		return maxSide, max(1, height*maxSide/width)
+	}
+
+	return max(1, width*maxSide/height), maxSide
+}
+
+// orient applies an EXIF orientation so the image displays upright.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	// orientations 5 to 8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+		}
+	}
+
+	return dst
+}
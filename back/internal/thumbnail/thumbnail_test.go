@@ -0,0 +1,104 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encode(t *testing.T, format string, width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	// mark the top left corner so orientation can be checked
+	img.SetRGBA(0, 0, color.RGBA{255, 0, 0, 255})
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	assert.NoError(t, err)
+
+	return buf.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("scales down to fit", func(t *testing.T) {
+		thumb, err := Generate(encode(t, "png", 2000, 1000), Sizes["small"])
+		assert.NoError(t, err)
+		assert.Equal(t, "image/png", thumb.ContentType)
+		assert.Equal(t, 256, thumb.Width)
+		assert.Equal(t, 128, thumb.Height)
+
+		img, err := png.Decode(bytes.NewReader(thumb.Data))
+		assert.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 256, 128), img.Bounds())
+	})
+
+	t.Run("keeps jpegs as jpeg", func(t *testing.T) {
+		thumb, err := Generate(encode(t, "jpeg", 500, 1500), Sizes["medium"])
+		assert.NoError(t, err)
+		assert.Equal(t, "image/jpeg", thumb.ContentType)
+		assert.Equal(t, 341, thumb.Width)
+		assert.Equal(t, 1024, thumb.Height)
+	})
+
+	t.Run("turns gifs into png and never scales up", func(t *testing.T) {
+		thumb, err := Generate(encode(t, "gif", 100, 50), Sizes["small"])
+		assert.NoError(t, err)
+		assert.Equal(t, "image/png", thumb.ContentType)
+		assert.Equal(t, 100, thumb.Width)
+		assert.Equal(t, 50, thumb.Height)
+	})
+
+	t.Run("rejects other content", func(t *testing.T) {
+		_, err := Generate([]byte("not an image"), Sizes["small"])
+		assert.ErrorIs(t, err, ErrUnsupported)
+	})
+}
+
+func TestOrient(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.SetRGBA(0, 0, color.RGBA{255, 0, 0, 255})
+	red := color.RGBA{255, 0, 0, 255}
+
+	// where the top left pixel ends up for each orientation
+	corners := map[int]image.Point{
+		1: {0, 0},
+		2: {2, 0},
+		3: {2, 1},
+		4: {0, 1},
+		5: {0, 0},
+		6: {1, 0},
+		7: {1, 2},
+		8: {0, 2},
+	}
+
+	for orientation, corner := range corners {
+		dst := orient(src, orientation)
+		if orientation >= 5 {
+			assert.Equal(t, image.Rect(0, 0, 2, 3), dst.Bounds(), "orientation %d", orientation)
+		} else {
+			assert.Equal(t, image.Rect(0, 0, 3, 2), dst.Bounds(), "orientation %d", orientation)
+		}
+		assert.Equal(t, red, dst.RGBAAt(corner.X, corner.Y), "orientation %d", orientation)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	assert.True(t, Supported("image/png"))
+	assert.True(t, Supported("image/jpeg"))
+	assert.True(t, Supported("image/gif"))
+	assert.False(t, Supported("image/webp"))
+	assert.False(t, Supported("text/plain; charset=utf-8"))
+}
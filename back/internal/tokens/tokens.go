@@ -8,7 +8,9 @@ import (
 )
 
 const (
-	ScopeAuth = "authentication"
+	ScopeAuth       = "authentication"
+	ScopeShare      = "share"
+	ScopeInvitation = "invitation"
 )
 
 type Token struct {
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE notes
+  ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- trashed notes shouldn't block creating a new note with the same title
+ALTER TABLE notes
+  DROP CONSTRAINT notes_unique_title_per_folder;
+
+CREATE UNIQUE INDEX notes_unique_title_per_folder
+  ON notes(user_id, title, folder_id)
+  WHERE deleted_at IS NULL;
+
+CREATE INDEX idx_notes_user_deleted ON notes(user_id, deleted_at)
+  WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_notes_user_deleted;
+DROP INDEX notes_unique_title_per_folder;
+
+DELETE FROM notes WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE notes
+  ADD CONSTRAINT notes_unique_title_per_folder UNIQUE (user_id, title, folder_id);
+
+ALTER TABLE notes
+  DROP COLUMN deleted_at;
+-- +goose StatementEnd
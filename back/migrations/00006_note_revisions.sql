@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS note_revisions (
+  id BIGSERIAL PRIMARY KEY,
+  note_id BIGINT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+  revision BIGINT NOT NULL,
+  title VARCHAR(255) NOT NULL,
+  note TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (note_id, revision)
+);
+
+-- existing notes start their history from what they hold right now
+INSERT INTO note_revisions (note_id, revision, title, note, created_at, updated_at)
+SELECT id, 1, title, note, updated_at, updated_at
+FROM notes;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE note_revisions;
+-- +goose StatementEnd
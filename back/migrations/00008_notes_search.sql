@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE notes
+  ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(note, '')), 'B')
+  ) STORED;
+
+CREATE INDEX idx_notes_search ON notes USING GIN (search);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_notes_search;
+
+ALTER TABLE notes
+  DROP COLUMN search;
+-- +goose StatementEnd
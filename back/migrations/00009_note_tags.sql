@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS note_tags (
+  note_id BIGINT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+  tag VARCHAR(100) NOT NULL,
+  PRIMARY KEY (note_id, tag)
+);
+
+CREATE INDEX idx_note_tags_tag ON note_tags(tag text_pattern_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE note_tags;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS note_links (
+  id BIGSERIAL PRIMARY KEY,
+  source_note_id BIGINT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+  target_note_id BIGINT REFERENCES notes(id) ON DELETE SET NULL,
+  kind VARCHAR(16) NOT NULL,
+  target TEXT NOT NULL,
+  text TEXT NOT NULL
+);
+
+CREATE INDEX idx_note_links_source ON note_links(source_note_id);
+CREATE INDEX idx_note_links_target ON note_links(target_note_id);
+CREATE INDEX idx_note_links_dangling ON note_links(lower(target))
+  WHERE target_note_id IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE note_links;
+-- +goose StatementEnd
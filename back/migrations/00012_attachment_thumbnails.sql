@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS attachment_thumbnails (
+  attachment_id BIGINT NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+  size VARCHAR(16) NOT NULL,
+  content_type VARCHAR(255) NOT NULL,
+  width INT NOT NULL,
+  height INT NOT NULL,
+  byte_size BIGINT NOT NULL,
+  sha256 CHAR(64) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (attachment_id, size)
+);
+
+CREATE INDEX idx_attachment_thumbnails_sha256 ON attachment_thumbnails(sha256);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE attachment_thumbnails;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS shares (
+  id BIGSERIAL PRIMARY KEY,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  note_id BIGINT REFERENCES notes(id) ON DELETE CASCADE,
+  folder_id BIGINT REFERENCES folders(id) ON DELETE CASCADE,
+  hash BYTEA NOT NULL UNIQUE,
+  expires_at TIMESTAMP(0) WITH TIME ZONE,
+  password_hash BYTEA,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK ((note_id IS NULL) <> (folder_id IS NULL))
+);
+
+CREATE INDEX idx_shares_user ON shares(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE shares;
+-- +goose StatementEnd
@@ -0,0 +1,73 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Roles are declared weakest first so they compare and MAX() by strength.
+CREATE TYPE member_role AS ENUM ('viewer', 'editor', 'owner');
+
+CREATE TABLE IF NOT EXISTS folder_members (
+  folder_id BIGINT NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role member_role NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (folder_id, user_id)
+);
+
+CREATE INDEX idx_folder_members_user ON folder_members(user_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- folder_role is the role a user has on a folder: owner of the whole tree it
+-- is in, otherwise the strongest role granted on it or any folder above it.
+-- NULL means no access.
+CREATE FUNCTION folder_role(p_user_id BIGINT, p_folder_id BIGINT)
+RETURNS member_role AS $$
+  WITH RECURSIVE ancestors AS (
+    SELECT id, parent_id, user_id
+    FROM folders
+    WHERE id = p_folder_id
+    UNION ALL
+    SELECT f.id, f.parent_id, f.user_id
+    FROM folders f
+    INNER JOIN ancestors a ON f.id = a.parent_id
+  )
+  SELECT CASE
+    WHEN bool_or(a.user_id = p_user_id) THEN 'owner'::member_role
+    ELSE MAX(m.role)
+  END
+  FROM ancestors a
+  LEFT JOIN folder_members m ON m.folder_id = a.id AND m.user_id = p_user_id;
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- accessible_folders lists every folder a user can see with their role on
+-- it, for queries that span all of them.
+CREATE FUNCTION accessible_folders(p_user_id BIGINT)
+RETURNS TABLE (folder_id BIGINT, role member_role) AS $$
+  WITH RECURSIVE granted AS (
+    SELECT m.folder_id, m.role
+    FROM folder_members m
+    WHERE m.user_id = p_user_id
+    UNION ALL
+    SELECT f.id, g.role
+    FROM folders f
+    INNER JOIN granted g ON f.parent_id = g.folder_id
+  )
+  SELECT id, 'owner'::member_role
+  FROM folders
+  WHERE user_id = p_user_id
+  UNION ALL
+  SELECT g.folder_id, MAX(g.role)
+  FROM granted g
+  INNER JOIN folders f ON f.id = g.folder_id
+  WHERE f.user_id <> p_user_id
+  GROUP BY g.folder_id;
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION accessible_folders(BIGINT);
+DROP FUNCTION folder_role(BIGINT, BIGINT);
+DROP TABLE folder_members;
+DROP TYPE member_role;
+-- +goose StatementEnd
@@ -0,0 +1,185 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Roles are declared weakest first so they compare by strength.
+CREATE TYPE workspace_role AS ENUM ('guest', 'member', 'admin');
+
+CREATE TABLE IF NOT EXISTS workspaces (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  -- set for the workspace every user gets when they register
+  personal_user_id BIGINT UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+  workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role workspace_role NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX idx_workspace_members_user ON workspace_members(user_id);
+
+-- An invitation is a token of the invitation scope, what it invites to is
+-- kept here and goes away with the token.
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+  hash BYTEA PRIMARY KEY REFERENCES tokens(hash) ON DELETE CASCADE,
+  workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  role workspace_role NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE folders
+  ADD COLUMN workspace_id BIGINT REFERENCES workspaces(id) ON DELETE CASCADE;
+
+-- every tree so far is someone's personal one
+INSERT INTO workspaces (name, personal_user_id)
+SELECT 'Personal', id
+FROM users;
+
+INSERT INTO workspace_members (workspace_id, user_id, role)
+SELECT id, personal_user_id, 'admin'
+FROM workspaces;
+
+UPDATE folders f
+SET workspace_id = w.id
+FROM workspaces w
+WHERE w.personal_user_id = f.user_id;
+
+ALTER TABLE folders
+  ALTER COLUMN workspace_id SET NOT NULL;
+
+CREATE INDEX idx_folders_workspace ON folders(workspace_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- Workspace admins own every folder in the workspace and members can edit
+-- them all. Guests, like users from outside the workspace, only get what
+-- folder_members grants them.
+CREATE OR REPLACE FUNCTION folder_role(p_user_id BIGINT, p_folder_id BIGINT)
+RETURNS member_role AS $$
+  WITH RECURSIVE ancestors AS (
+    SELECT id, parent_id
+    FROM folders
+    WHERE id = p_folder_id
+    UNION ALL
+    SELECT f.id, f.parent_id
+    FROM folders f
+    INNER JOIN ancestors a ON f.id = a.parent_id
+  )
+  SELECT GREATEST(
+    (
+      SELECT CASE wm.role
+        WHEN 'admin' THEN 'owner'::member_role
+        WHEN 'member' THEN 'editor'::member_role
+      END
+      FROM folders f
+      INNER JOIN workspace_members wm ON wm.workspace_id = f.workspace_id
+      WHERE f.id = p_folder_id AND wm.user_id = p_user_id
+    ),
+    (
+      SELECT MAX(m.role)
+      FROM ancestors a
+      INNER JOIN folder_members m ON m.folder_id = a.id
+      WHERE m.user_id = p_user_id
+    )
+  );
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION accessible_folders(p_user_id BIGINT)
+RETURNS TABLE (folder_id BIGINT, role member_role) AS $$
+  WITH RECURSIVE granted AS (
+    SELECT m.folder_id, m.role
+    FROM folder_members m
+    WHERE m.user_id = p_user_id
+    UNION ALL
+    SELECT f.id, g.role
+    FROM folders f
+    INNER JOIN granted g ON f.parent_id = g.folder_id
+  ), roles AS (
+    SELECT f.id AS folder_id,
+      CASE wm.role WHEN 'admin' THEN 'owner'::member_role ELSE 'editor'::member_role END AS role
+    FROM folders f
+    INNER JOIN workspace_members wm ON wm.workspace_id = f.workspace_id
+    WHERE wm.user_id = p_user_id AND wm.role <> 'guest'
+    UNION ALL
+    SELECT g.folder_id, g.role
+    FROM granted g
+  )
+  SELECT r.folder_id, MAX(r.role)
+  FROM roles r
+  GROUP BY r.folder_id;
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- accessible_folders narrowed down to one workspace, or all of them across
+-- every workspace when p_workspace_id is 0.
+CREATE OR REPLACE FUNCTION workspace_folders(p_user_id BIGINT, p_workspace_id BIGINT)
+RETURNS TABLE (folder_id BIGINT, role member_role) AS $$
+  SELECT a.folder_id, a.role
+  FROM accessible_folders(p_user_id) a
+  INNER JOIN folders f ON f.id = a.folder_id
+  WHERE p_workspace_id = 0 OR f.workspace_id = p_workspace_id;
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION workspace_folders(BIGINT, BIGINT);
+
+CREATE OR REPLACE FUNCTION accessible_folders(p_user_id BIGINT)
+RETURNS TABLE (folder_id BIGINT, role member_role) AS $$
+  WITH RECURSIVE granted AS (
+    SELECT m.folder_id, m.role
+    FROM folder_members m
+    WHERE m.user_id = p_user_id
+    UNION ALL
+    SELECT f.id, g.role
+    FROM folders f
+    INNER JOIN granted g ON f.parent_id = g.folder_id
+  )
+  SELECT id, 'owner'::member_role
+  FROM folders
+  WHERE user_id = p_user_id
+  UNION ALL
+  SELECT g.folder_id, MAX(g.role)
+  FROM granted g
+  INNER JOIN folders f ON f.id = g.folder_id
+  WHERE f.user_id <> p_user_id
+  GROUP BY g.folder_id;
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION folder_role(p_user_id BIGINT, p_folder_id BIGINT)
+RETURNS member_role AS $$
+  WITH RECURSIVE ancestors AS (
+    SELECT id, parent_id, user_id
+    FROM folders
+    WHERE id = p_folder_id
+    UNION ALL
+    SELECT f.id, f.parent_id, f.user_id
+    FROM folders f
+    INNER JOIN ancestors a ON f.id = a.parent_id
+  )
+  SELECT CASE
+    WHEN bool_or(a.user_id = p_user_id) THEN 'owner'::member_role
+    ELSE MAX(m.role)
+  END
+  FROM ancestors a
+  LEFT JOIN folder_members m ON m.folder_id = a.id AND m.user_id = p_user_id;
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX idx_folders_workspace;
+ALTER TABLE folders DROP COLUMN workspace_id;
+DROP TABLE workspace_invitations;
+DROP TABLE workspace_members;
+DROP TABLE workspaces;
+DROP TYPE workspace_role;
+-- +goose StatementEnd
@@ -0,0 +1,113 @@
+-- +goose Up
+-- +goose StatementBegin
+-- events is the log of changes to notes and folders that GET /events streams
+-- and resumes from. Rows are written by the triggers below, so every change
+-- gets logged however it was made, and outlive the notes and folders they are
+-- about.
+CREATE TABLE IF NOT EXISTS events (
+  id BIGSERIAL PRIMARY KEY,
+  type TEXT NOT NULL,
+  workspace_id BIGINT NOT NULL,
+  note_id BIGINT,
+  folder_id BIGINT NOT NULL,
+  parent_id BIGINT,
+  old_folder_id BIGINT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_events_created ON events(created_at);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- log_event adds an event and wakes the listeners of its workspace. NOTIFY
+-- is only delivered on commit and folds identical payloads of a transaction
+-- into one, so a big import wakes them once.
+CREATE FUNCTION log_event(
+  p_type TEXT,
+  p_workspace_id BIGINT,
+  p_note_id BIGINT,
+  p_folder_id BIGINT,
+  p_parent_id BIGINT,
+  p_old_folder_id BIGINT
+) RETURNS VOID AS $$
+BEGIN
+  INSERT INTO events (type, workspace_id, note_id, folder_id, parent_id, old_folder_id)
+  VALUES (p_type, p_workspace_id, p_note_id, p_folder_id, p_parent_id, p_old_folder_id);
+
+  PERFORM pg_notify('events', p_workspace_id::TEXT);
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- Trashing a note counts as deleting it and restoring it as creating it
+-- again. Notes and folders deleted along with the folder they were in are
+-- left out, the event for that folder covers them.
+CREATE FUNCTION log_note_event() RETURNS TRIGGER AS $$
+DECLARE
+  v_workspace_id BIGINT;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    SELECT workspace_id INTO v_workspace_id FROM folders WHERE id = OLD.folder_id;
+    IF v_workspace_id IS NOT NULL AND OLD.deleted_at IS NULL THEN
+      PERFORM log_event('note.deleted', v_workspace_id, OLD.id, OLD.folder_id, NULL, NULL);
+    END IF;
+    RETURN NULL;
+  END IF;
+
+  SELECT workspace_id INTO v_workspace_id FROM folders WHERE id = NEW.folder_id;
+
+  IF TG_OP = 'INSERT' THEN
+    PERFORM log_event('note.created', v_workspace_id, NEW.id, NEW.folder_id, NULL, NULL);
+  ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+    PERFORM log_event('note.deleted', v_workspace_id, NEW.id, NEW.folder_id, NULL, NULL);
+  ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+    PERFORM log_event('note.created', v_workspace_id, NEW.id, NEW.folder_id, NULL, NULL);
+  ELSIF OLD.folder_id <> NEW.folder_id THEN
+    PERFORM log_event('note.moved', v_workspace_id, NEW.id, NEW.folder_id, NULL, OLD.folder_id);
+  ELSIF OLD.title <> NEW.title OR OLD.note <> NEW.note THEN
+    PERFORM log_event('note.updated', v_workspace_id, NEW.id, NEW.folder_id, NULL, NULL);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION log_folder_event() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    IF OLD.parent_id IS NULL OR EXISTS (SELECT 1 FROM folders WHERE id = OLD.parent_id) THEN
+      PERFORM log_event('folder.deleted', OLD.workspace_id, NULL, OLD.id, OLD.parent_id, NULL);
+    END IF;
+  ELSIF TG_OP = 'INSERT' THEN
+    PERFORM log_event('folder.created', NEW.workspace_id, NULL, NEW.id, NEW.parent_id, NULL);
+  ELSIF OLD.parent_id IS DISTINCT FROM NEW.parent_id THEN
+    PERFORM log_event('folder.moved', NEW.workspace_id, NULL, NEW.id, NEW.parent_id, OLD.parent_id);
+  ELSIF OLD.name <> NEW.name THEN
+    PERFORM log_event('folder.updated', NEW.workspace_id, NULL, NEW.id, NEW.parent_id, NULL);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER notes_events
+  AFTER INSERT OR UPDATE OR DELETE ON notes
+  FOR EACH ROW EXECUTE FUNCTION log_note_event();
+
+CREATE TRIGGER folders_events
+  AFTER INSERT OR UPDATE OR DELETE ON folders
+  FOR EACH ROW EXECUTE FUNCTION log_folder_event();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER folders_events ON folders;
+DROP TRIGGER notes_events ON notes;
+DROP FUNCTION log_folder_event();
+DROP FUNCTION log_note_event();
+DROP FUNCTION log_event(TEXT, BIGINT, BIGINT, BIGINT, BIGINT, BIGINT);
+DROP TABLE events;
+-- +goose StatementEnd
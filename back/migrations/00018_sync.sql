@@ -0,0 +1,136 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every change to a note or a folder takes the next number of its
+-- workspace's change_seq, which is what GET /sync pages through. Taking it
+-- locks the workspace row until the change commits, so changes commit in the
+-- order of their numbers and a client that synced up to some number can't
+-- miss a change committed later with a smaller one.
+--
+-- The numbers are per workspace rather than per user: a note in a shared
+-- workspace is one change for all of its members, which a per-user sequence
+-- would have to number once for each of them. Clients sync one workspace at
+-- a time, the personal one by default, so from their side it works the same.
+ALTER TABLE workspaces
+  ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE folders
+  ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE notes
+  ADD COLUMN change_seq BIGINT NOT NULL DEFAULT 0;
+
+UPDATE workspaces SET change_seq = 1;
+UPDATE folders SET change_seq = 1;
+UPDATE notes SET change_seq = 1;
+
+CREATE INDEX idx_folders_workspace_change ON folders(workspace_id, change_seq);
+CREATE INDEX idx_notes_change ON notes(change_seq);
+
+-- tombstones are the notes and folders deleted for good, kept for clients
+-- to sync the deletion. folder_id is the folder they were in.
+CREATE TABLE IF NOT EXISTS tombstones (
+  type TEXT NOT NULL,
+  id BIGINT NOT NULL,
+  workspace_id BIGINT NOT NULL,
+  folder_id BIGINT NOT NULL,
+  change_seq BIGINT NOT NULL,
+  deleted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (type, id)
+);
+
+CREATE INDEX idx_tombstones_workspace_change ON tombstones(workspace_id, change_seq);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION next_change_seq(p_workspace_id BIGINT)
+RETURNS BIGINT AS $$
+  UPDATE workspaces
+  SET change_seq = change_seq + 1
+  WHERE id = p_workspace_id
+  RETURNING change_seq;
+$$ LANGUAGE SQL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION bump_note_change_seq() RETURNS TRIGGER AS $$
+BEGIN
+  NEW.change_seq := next_change_seq((SELECT workspace_id FROM folders WHERE id = NEW.folder_id));
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION bump_folder_change_seq() RETURNS TRIGGER AS $$
+BEGIN
+  NEW.change_seq := next_change_seq(NEW.workspace_id);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- Like the events, notes and folders deleted along with the folder they were
+-- in get no tombstone of their own.
+CREATE FUNCTION add_note_tombstone() RETURNS TRIGGER AS $$
+DECLARE
+  v_workspace_id BIGINT;
+BEGIN
+  SELECT workspace_id INTO v_workspace_id FROM folders WHERE id = OLD.folder_id;
+  IF v_workspace_id IS NOT NULL THEN
+    INSERT INTO tombstones (type, id, workspace_id, folder_id, change_seq)
+    VALUES ('note', OLD.id, v_workspace_id, OLD.folder_id, next_change_seq(v_workspace_id));
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION add_folder_tombstone() RETURNS TRIGGER AS $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM folders WHERE id = OLD.parent_id) THEN
+    INSERT INTO tombstones (type, id, workspace_id, folder_id, change_seq)
+    VALUES ('folder', OLD.id, OLD.workspace_id, OLD.parent_id, next_change_seq(OLD.workspace_id));
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER notes_change_seq
+  BEFORE INSERT OR UPDATE ON notes
+  FOR EACH ROW EXECUTE FUNCTION bump_note_change_seq();
+
+CREATE TRIGGER folders_change_seq
+  BEFORE INSERT OR UPDATE ON folders
+  FOR EACH ROW EXECUTE FUNCTION bump_folder_change_seq();
+
+CREATE TRIGGER notes_tombstones
+  AFTER DELETE ON notes
+  FOR EACH ROW EXECUTE FUNCTION add_note_tombstone();
+
+CREATE TRIGGER folders_tombstones
+  AFTER DELETE ON folders
+  FOR EACH ROW EXECUTE FUNCTION add_folder_tombstone();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER folders_tombstones ON folders;
+DROP TRIGGER notes_tombstones ON notes;
+DROP TRIGGER folders_change_seq ON folders;
+DROP TRIGGER notes_change_seq ON notes;
+DROP FUNCTION add_folder_tombstone();
+DROP FUNCTION add_note_tombstone();
+DROP FUNCTION bump_folder_change_seq();
+DROP FUNCTION bump_note_change_seq();
+DROP FUNCTION next_change_seq(BIGINT);
+DROP TABLE tombstones;
+DROP INDEX idx_notes_change;
+DROP INDEX idx_folders_workspace_change;
+ALTER TABLE notes DROP COLUMN change_seq;
+ALTER TABLE folders DROP COLUMN change_seq;
+ALTER TABLE workspaces DROP COLUMN change_seq;
+-- +goose StatementEnd
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"markdown-notes/internal/markdown"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upBackfillNoteTags, downBackfillNoteTags)
+}
+
+// upBackfillNoteTags indexes the tags of notes written before note_tags
+// existed. Tags are parsed the same way saving a note does, which SQL can't
+// do, so this one is a Go migration. Notes are read in batches to keep memory
+// bounded on large databases.
+func upBackfillNoteTags(ctx context.Context, tx *sql.Tx) error {
+	const batchSize = 500
+
+	type note struct {
+		id   int64
+		note string
+	}
+
+	var lastID int64
+	for {
+		rows, err := tx.QueryContext(ctx, `
+		SELECT id, note
+		FROM notes
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2;
+		`, lastID, batchSize)
+		if err != nil {
+			return err
+		}
+
+		var batch []note
+		for rows.Next() {
+			var n note
+			err = rows.Scan(&n.id, &n.note)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, n)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, n := range batch {
+			tags := markdown.ExtractTags(n.note)
+			if len(tags) == 0 {
+				continue
+			}
+
+			_, err = tx.ExecContext(ctx, `
+			INSERT INTO note_tags (note_id, tag)
+			SELECT $1, unnest($2::TEXT[])
+			ON CONFLICT DO NOTHING;
+			`, n.id, tags)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].id
+	}
+}
+
+// downBackfillNoteTags leaves the tags in place, they are what saving each
+// note would have produced anyway.
+func downBackfillNoteTags(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
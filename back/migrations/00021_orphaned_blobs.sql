@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+-- orphaned_blobs holds the blobs an attachment or thumbnail stopped
+-- referring to, however the row went away, including along with a purged
+-- note or a deleted folder. They are deleted from the blob store once nothing
+-- else refers to them, see service.BlobCollector.
+CREATE TABLE IF NOT EXISTS orphaned_blobs (
+  sha256 CHAR(64) PRIMARY KEY,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION record_orphaned_blob() RETURNS TRIGGER AS $$
+BEGIN
+  INSERT INTO orphaned_blobs (sha256) VALUES (OLD.sha256)
+  ON CONFLICT DO NOTHING;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER attachments_deleted_blob
+AFTER DELETE ON attachments
+FOR EACH ROW EXECUTE FUNCTION record_orphaned_blob();
+
+CREATE TRIGGER attachments_replaced_blob
+AFTER UPDATE OF sha256 ON attachments
+FOR EACH ROW WHEN (OLD.sha256 <> NEW.sha256) EXECUTE FUNCTION record_orphaned_blob();
+
+CREATE TRIGGER attachment_thumbnails_deleted_blob
+AFTER DELETE ON attachment_thumbnails
+FOR EACH ROW EXECUTE FUNCTION record_orphaned_blob();
+
+CREATE TRIGGER attachment_thumbnails_replaced_blob
+AFTER UPDATE OF sha256 ON attachment_thumbnails
+FOR EACH ROW WHEN (OLD.sha256 <> NEW.sha256) EXECUTE FUNCTION record_orphaned_blob();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER attachment_thumbnails_replaced_blob ON attachment_thumbnails;
+DROP TRIGGER attachment_thumbnails_deleted_blob ON attachment_thumbnails;
+DROP TRIGGER attachments_replaced_blob ON attachments;
+DROP TRIGGER attachments_deleted_blob ON attachments;
+DROP FUNCTION record_orphaned_blob();
+DROP TABLE orphaned_blobs;
+-- +goose StatementEnd
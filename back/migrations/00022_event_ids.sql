@@ -0,0 +1,68 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Events used to take their ids from a sequence, which hands them out when
+-- the row is inserted rather than when its transaction commits. An event that
+-- committed after one with a higher id was then never streamed, as clients
+-- had already moved past it. Ids now come from a counter that stays locked
+-- until the transaction logging the event commits, so they become visible in
+-- order and without gaps.
+CREATE TABLE IF NOT EXISTS event_seq (
+  id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+  last_id BIGINT NOT NULL
+);
+
+INSERT INTO event_seq (last_id)
+SELECT COALESCE(MAX(id), 0) FROM events;
+
+ALTER TABLE events ALTER COLUMN id DROP DEFAULT;
+DROP SEQUENCE events_id_seq;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION log_event(
+  p_type TEXT,
+  p_workspace_id BIGINT,
+  p_note_id BIGINT,
+  p_folder_id BIGINT,
+  p_parent_id BIGINT,
+  p_old_folder_id BIGINT
+) RETURNS VOID AS $$
+DECLARE
+  v_id BIGINT;
+BEGIN
+  UPDATE event_seq
+  SET last_id = last_id + 1
+  RETURNING last_id INTO v_id;
+
+  INSERT INTO events (id, type, workspace_id, note_id, folder_id, parent_id, old_folder_id)
+  VALUES (v_id, p_type, p_workspace_id, p_note_id, p_folder_id, p_parent_id, p_old_folder_id);
+
+  PERFORM pg_notify('events', p_workspace_id::TEXT);
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION log_event(
+  p_type TEXT,
+  p_workspace_id BIGINT,
+  p_note_id BIGINT,
+  p_folder_id BIGINT,
+  p_parent_id BIGINT,
+  p_old_folder_id BIGINT
+) RETURNS VOID AS $$
+BEGIN
+  INSERT INTO events (type, workspace_id, note_id, folder_id, parent_id, old_folder_id)
+  VALUES (p_type, p_workspace_id, p_note_id, p_folder_id, p_parent_id, p_old_folder_id);
+
+  PERFORM pg_notify('events', p_workspace_id::TEXT);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE SEQUENCE events_id_seq OWNED BY events.id;
+SELECT setval('events_id_seq', GREATEST(last_id, 1), last_id > 0) FROM event_seq;
+ALTER TABLE events ALTER COLUMN id SET DEFAULT nextval('events_id_seq');
+
+DROP TABLE event_seq;
+-- +goose StatementEnd
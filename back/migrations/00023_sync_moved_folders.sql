@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A folder moved into a client's view brought along notes and folders the
+-- client never synced, but only the folder itself got a new change number.
+-- Moving a folder now gives everything below it one too, so GET /sync hands
+-- the contents out right after the folder.
+CREATE FUNCTION bump_moved_folder_contents() RETURNS TRIGGER AS $$
+DECLARE
+  v_folder_ids BIGINT[];
+BEGIN
+  WITH RECURSIVE subtree AS (
+    SELECT id
+    FROM folders
+    WHERE parent_id = NEW.id
+    UNION ALL
+    SELECT f.id
+    FROM folders f
+    INNER JOIN subtree s ON f.parent_id = s.id
+  )
+  SELECT array_agg(id) INTO v_folder_ids FROM subtree;
+
+  -- the change_seq triggers replace the numbers set here with new ones
+  UPDATE folders SET change_seq = 0 WHERE id = ANY(v_folder_ids);
+  UPDATE notes SET change_seq = 0 WHERE folder_id = NEW.id OR folder_id = ANY(v_folder_ids);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER folders_moved_change_seq
+  AFTER UPDATE OF parent_id ON folders
+  FOR EACH ROW
+  WHEN (OLD.parent_id IS DISTINCT FROM NEW.parent_id)
+  EXECUTE FUNCTION bump_moved_folder_contents();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER folders_moved_change_seq ON folders;
+DROP FUNCTION bump_moved_folder_contents();
+-- +goose StatementEnd
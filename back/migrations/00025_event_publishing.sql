@@ -0,0 +1,96 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Taking event ids from event_seq in the transaction logging the event kept
+-- the counter locked until that transaction committed, so every write in
+-- every workspace waited for the slowest one. Events are now logged without
+-- an id and numbered by publish_events once they are committed. Only
+-- publish_events locks the counter, and only while it numbers what was
+-- committed since it last ran, so ids still follow each other in the order
+-- events became visible and readers never skip one.
+ALTER TABLE events DROP CONSTRAINT events_pkey;
+ALTER TABLE events ALTER COLUMN id DROP NOT NULL;
+ALTER TABLE events ADD COLUMN log_id BIGSERIAL PRIMARY KEY;
+
+CREATE UNIQUE INDEX idx_events_id ON events(id);
+CREATE INDEX idx_events_unpublished ON events(log_id) WHERE id IS NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION log_event(
+  p_type TEXT,
+  p_workspace_id BIGINT,
+  p_note_id BIGINT,
+  p_folder_id BIGINT,
+  p_parent_id BIGINT,
+  p_old_folder_id BIGINT
+) RETURNS VOID AS $$
+BEGIN
+  INSERT INTO events (type, workspace_id, note_id, folder_id, parent_id, old_folder_id)
+  VALUES (p_type, p_workspace_id, p_note_id, p_folder_id, p_parent_id, p_old_folder_id);
+
+  PERFORM pg_notify('events', p_workspace_id::TEXT);
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- publish_events numbers the committed events that have no id yet, in the
+-- order they were logged. Runs wait for each other on the counter, and each
+-- statement after the lock sees what the run before it committed.
+CREATE FUNCTION publish_events() RETURNS VOID AS $$
+DECLARE
+  v_last_id BIGINT;
+  v_count BIGINT;
+BEGIN
+  SELECT last_id INTO v_last_id FROM event_seq FOR UPDATE;
+
+  UPDATE events e
+  SET id = v_last_id + p.n
+  FROM (
+    SELECT log_id, row_number() OVER (ORDER BY log_id) AS n
+    FROM events
+    WHERE id IS NULL
+  ) p
+  WHERE e.log_id = p.log_id;
+  GET DIAGNOSTICS v_count = ROW_COUNT;
+
+  IF v_count > 0 THEN
+    UPDATE event_seq SET last_id = last_id + v_count;
+  END IF;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT publish_events();
+DROP FUNCTION publish_events();
+
+CREATE OR REPLACE FUNCTION log_event(
+  p_type TEXT,
+  p_workspace_id BIGINT,
+  p_note_id BIGINT,
+  p_folder_id BIGINT,
+  p_parent_id BIGINT,
+  p_old_folder_id BIGINT
+) RETURNS VOID AS $$
+DECLARE
+  v_id BIGINT;
+BEGIN
+  UPDATE event_seq
+  SET last_id = last_id + 1
+  RETURNING last_id INTO v_id;
+
+  INSERT INTO events (id, type, workspace_id, note_id, folder_id, parent_id, old_folder_id)
+  VALUES (v_id, p_type, p_workspace_id, p_note_id, p_folder_id, p_parent_id, p_old_folder_id);
+
+  PERFORM pg_notify('events', p_workspace_id::TEXT);
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX idx_events_unpublished;
+DROP INDEX idx_events_id;
+ALTER TABLE events DROP COLUMN log_id;
+ALTER TABLE events ALTER COLUMN id SET NOT NULL;
+ALTER TABLE events ADD PRIMARY KEY (id);
+-- +goose StatementEnd
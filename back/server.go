@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"markdown-notes/internal/app"
-	"markdown-notes/internal/middleware"
-	"markdown-notes/internal/utils"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -16,32 +21,30 @@ func main() {
 	}
 	defer app.DB.Close()
 
-	e.GET("/health", app.HealthCheck)
-	e.POST("/user/register", app.UserHandler.HandleRegisterUser)
-	e.POST("/tokens/auth", app.TokenHandler.HandleCreateToken)
+	app.RegisterRoutes(e)
+	// event streams only end when the client goes away, so they are closed
+	// as soon as shutting down starts rather than waited for
+	e.Server.RegisterOnShutdown(app.EventsHandler.Close)
 
-	r := e.Group("")
-	r.Use(app.UserMiddleware.AuthMiddleware)
-
-	restricted(r, app)
-
-	e.Logger.Fatal(e.Start(":8080"))
-}
-
-func restricted(g *echo.Group, app *app.App) {
-	g.GET("/me", func(c echo.Context) error {
-		u, ok := middleware.CurrentUser(c)
-		if !ok {
-			return echo.NewHTTPError(401, "not authenticated")
+	go func() {
+		err := e.Start(":8080")
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
 		}
-		return c.JSON(200, utils.Envelope{"username": u.Username})
-	})
-	g.GET("/notes/:note_id", app.NotesHandler.HandleGetNote)
-	g.GET("/folders", app.FolderHandler.GetRootFolderContent)
-	g.GET("/folders/:folder_id", app.FolderHandler.GetFolderContent)
+	}()
 
-	g.POST("/notes/new", app.NotesHandler.HandleCreateNote)
-	g.POST("/folders/new", app.FolderHandler.HandleCreateFolder)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	// finish the requests in flight before stopping the background work
+	// they may have queued
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = e.Shutdown(shutdownCtx)
+	if err != nil {
+		e.Logger.Error(err)
+	}
 
-	g.PATCH("/notes/:note_id/save", app.NotesHandler.HandlePatchNote)
+	app.Close()
 }
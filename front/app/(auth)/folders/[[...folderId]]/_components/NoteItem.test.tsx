@@ -8,6 +8,7 @@ const mockNote: Note = {
   folder_id: 0,
   title: 'title',
   note: 'title',
+  version: 1,
   created_at: '2026-01-25 12:59:45.059176+00',
   updated_at: '2026-01-25 12:59:45.059176+00'
 }
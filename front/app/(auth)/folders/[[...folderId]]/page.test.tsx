@@ -17,6 +17,7 @@ const rootFolderContentMock: FolderContent = {
       "folder_id": 1,
       "title": "test",
       "note": "hello world!",
+      "version": 1,
       "created_at": "2026-01-25T19:00:35.0896+04:00",
       "updated_at": "2026-01-25T19:00:35.0896+04:00"
     }
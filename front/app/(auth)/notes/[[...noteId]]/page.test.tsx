@@ -15,6 +15,7 @@ const noteMock: Note = {
   "folder_id": 1,
   "title": "Test Note",
   "note": "hello world!",
+  "version": 1,
   "created_at": "2026-01-25T19:00:35.0896+04:00",
   "updated_at": "2026-01-25T19:00:35.0896+04:00"
 };
@@ -129,6 +130,7 @@ describe("/notes page", () => {
     nock("http://localhost").get("/api/notes/1").reply(200, noteMock);
     nock("http://localhost")
       .patch("/api/notes/1/save", { note: "hello world! updated" })
+      .matchHeader("If-Match", '"1"')
       .reply(200, { ...noteMock, note: "hello world! updated" });
 
     render(
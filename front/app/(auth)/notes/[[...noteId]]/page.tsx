@@ -36,7 +36,11 @@ export default function NoteEditor() {
 
   const { mutate: saveNote, isPending: isSaving } = useMutation({
     mutationFn: (content: string) =>
-      clientFetch.patch(`/api/notes/${noteId}/save`, { note: content }),
+      clientFetch.patch(
+        `/api/notes/${noteId}/save`,
+        { note: content },
+        { headers: { "If-Match": `"${note?.version}"` } }
+      ),
     onError: (e) => {
       const errorMessage = parseErrorMessage(e);
       toast.error("Error saving note", {
@@ -3,6 +3,7 @@ export type Note = {
   folder_id: number;
   title: string;
   note: string;
+  version: number;
   created_at: string;
   updated_at: string;
 };